@@ -2,6 +2,7 @@ package main
 
 import (
 	"Elastos.ELA/common"
+	"Elastos.ELA/common/config"
 	"Elastos.ELA/common/serialization"
 	"Elastos.ELA/core/store/ChainStore"
 	"Elastos.ELA/core/store/LevelDBStore"
@@ -15,7 +16,7 @@ func main() {
 	wantHeight, _ := strconv.Atoi(os.Args[1])
 	wantheightInt32 := uint32(wantHeight)
 
-	st, err := LevelDBStore.NewLevelDBStore("Chain")
+	st, err := LevelDBStore.NewLevelDBStore(config.DataPath("Chain"))
 	if err != nil {
 		fmt.Println("connect leveldb failed!")
 		fmt.Println(err)
@@ -1,7 +1,6 @@
 package account
 
 import (
-	"Elastos.ELA/crypto"
 	"fmt"
 	"os"
 	"path"
@@ -20,6 +19,6 @@ func TestClient(t *testing.T) {
 	for i := 0; i < 10000; i++ {
 		p := path.Join(dir, fmt.Sprintf("wallet%d.txt", i))
 		fmt.Println("client path", p)
-		CreateClient(p, []byte(DefaultPin))
+		Create(p, []byte("passwd"))
 	}
 }
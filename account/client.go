@@ -52,6 +52,10 @@ type Client interface {
 
 	GetCoins() map[*transaction.UTXOTxInput]*Coin
 	DeleteCoinsData(programHash Uint168) error
+	GetRedeemScript(programHash Uint168) []byte
+
+	GetHistory(offset, limit uint32) ([]TxRecord, uint32)
+	SetTransactionLabel(txid string, label string) error
 }
 
 type ClientImpl struct {
@@ -66,10 +70,20 @@ type ClientImpl struct {
 	contracts   map[Uint168]*ct.Contract
 	coins       map[*transaction.UTXOTxInput]*Coin
 
-	watchOnly     []Uint168
+	watchOnly     map[Uint168]*WatchOnlyAddress
 	currentHeight int32
+	// hash of the block at currentHeight, zero when it is not known
+	blockHash Uint256
+	// changes of the recent blocks, oldest first
+	undo []*BlockUndo
+
+	// external chain of a hd wallet, nil for a wallet of random keys
+	hdChain   *crypto.ExtendedKey
+	hdData    HDData
+	lookahead map[Uint168]uint32
 
 	FileStore
+	history   *HistoryStore
 	isRunning bool
 }
 
@@ -104,6 +118,18 @@ func Open(path string, passwordKey []byte) (*ClientImpl, error) {
 	if err := client.LoadCoins(); err != nil {
 		return nil, errors.New("Load coins failure")
 	}
+	if err := client.LoadUndo(); err != nil {
+		return nil, errors.New("Load undo data failure")
+	}
+	if err := client.LoadWatchOnly(); err != nil {
+		return nil, errors.New("Load watch-only addresses failure")
+	}
+	if err := client.LoadHD(); err != nil {
+		return nil, errors.New("Load hd keys failure")
+	}
+	if err := client.history.load(); err != nil {
+		return nil, errors.New("Load history failure")
+	}
 
 	return client, nil
 }
@@ -136,30 +162,96 @@ func Recover(path string, password []byte, privateKeyHex string) (*ClientImpl, e
 func (client *ClientImpl) ProcessBlocks() {
 	time.Sleep(time.Second)
 	for client.isRunning {
-		for true {
-			blockHeight := ledger.DefaultLedger.GetLocalBlockChainHeight()
-			if client.currentHeight >= int32(blockHeight) {
-				break
-			}
-			block, err := ledger.DefaultLedger.GetBlockWithHeight(uint32(client.currentHeight) + 1)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "fatal error: syncing failed, block missing, height %d\n", client.currentHeight)
-				break
-			}
-			client.ProcessOneBlock(block)
+		for client.syncBlock() {
 		}
 		time.Sleep(1 * time.Second)
 	}
 }
 
+// syncBlock moves the wallet one block towards the chain tip. When the block
+// processed last is no longer in the chain it is rolled back first. It
+// returns false when the wallet is synced or syncing failed.
+func (client *ClientImpl) syncBlock() bool {
+	client.mu.Lock()
+	height, lastHash := client.currentHeight, client.blockHash
+	client.mu.Unlock()
+
+	blockHeight := int32(ledger.DefaultLedger.GetLocalBlockChainHeight())
+	if height >= 0 && lastHash != (Uint256{}) {
+		hash, err := ledger.DefaultLedger.Store.GetBlockHash(uint32(height))
+		if height > blockHeight || err != nil || hash != lastHash {
+			if err := client.rollbackBlock(); err != nil {
+				fmt.Fprintf(os.Stderr, "rolling back wallet error: %v\n", err)
+				return false
+			}
+			return true
+		}
+	}
+	if height >= blockHeight {
+		return false
+	}
+	block, err := ledger.DefaultLedger.GetBlockWithHeight(uint32(height) + 1)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal error: syncing failed, block missing, height %d\n", height)
+		return false
+	}
+	client.ProcessOneBlock(block)
+	return true
+}
+
 func (client *ClientImpl) ProcessOneBlock(block *ledger.Block) {
 	client.mu.Lock()
 	defer client.mu.Unlock()
+	// the block may have been rolled back since it was read
+	hash, err := ledger.DefaultLedger.Store.GetBlockHash(block.Blockdata.Height)
+	if err != nil || hash != block.Hash() {
+		return
+	}
+	// the block must follow the one processed last, the next sync rolls the
+	// wallet back otherwise
+	if int32(block.Blockdata.Height) != client.currentHeight+1 {
+		return
+	}
+	if client.blockHash != (Uint256{}) && block.Blockdata.PrevBlockHash != client.blockHash {
+		return
+	}
+
+	client.applyBlock(block)
+}
+
+// applyBlock adds the coins and history of the block to the wallet and keeps
+// what it changed for a rollback, the caller holds the lock.
+func (client *ClientImpl) applyBlock(block *ledger.Block) {
+	// addresses of a hd wallet the block pays to
+	if client.hdChain != nil {
+		for _, tx := range block.Transactions {
+			for _, output := range tx.Outputs {
+				client.discoverHDAddress(output.ProgramHash)
+			}
+		}
+	}
+
+	// history, worked out before the coins change
+	var records []TxRecord
+	for _, tx := range block.Transactions {
+		records = append(records, client.txRecords(tx, block.Blockdata)...)
+	}
+	if len(records) > 0 {
+		if err := client.history.AddRecords(records); err != nil {
+			fmt.Fprintf(os.Stderr, "saving history error: %v\n", err)
+		}
+	}
+
+	undo := &BlockUndo{
+		Hash:     block.Hash(),
+		PrevHash: block.Blockdata.PrevBlockHash,
+		Height:   block.Blockdata.Height,
+	}
 	var needUpdate bool
 	// received coins
 	for _, tx := range block.Transactions {
 		for index, output := range tx.Outputs {
-			if contract, ok := client.contracts[output.ProgramHash]; ok {
+			if client.isWalletAddress(output.ProgramHash) {
 				input := &transaction.UTXOTxInput{ReferTxID: tx.Hash(), ReferTxOutputIndex: uint16(index)}
 				if _, ok := client.coins[input]; !ok {
 					// If it's not Coinbase transaction, the new created utxos could be spent in next block height.
@@ -168,16 +260,8 @@ func (client *ClientImpl) ProcessOneBlock(block *ledger.Block) {
 					if tx.IsCoinBaseTx() {
 						h = block.Blockdata.Height + config.Parameters.ChainParam.SpendCoinbaseSpan
 					}
-					var newCoin Coin
-					switch {
-					case contract.IsStandard():
-						newCoin = Coin{Output: output, AddressType: SingleSign, Height: h}
-					case contract.IsMultiSigContract():
-						newCoin = Coin{Output: output, AddressType: MultiSign, Height: h}
-					case contract.GetType() == ct.CustomContract:
-						newCoin = Coin{Output: output, AddressType: Script, Height: h}
-					}
-					client.coins[input] = &newCoin
+					client.coins[input] = client.walletCoin(output, h)
+					undo.created = append(undo.created, input)
 					needUpdate = true
 				}
 			}
@@ -187,27 +271,170 @@ func (client *ClientImpl) ProcessOneBlock(block *ledger.Block) {
 	// spent coins
 	for _, tx := range block.Transactions {
 		for _, input := range tx.UTXOInputs {
-			for k := range client.coins {
+			for k, coin := range client.coins {
 				if k.ReferTxOutputIndex == input.ReferTxOutputIndex && k.ReferTxID == input.ReferTxID {
 					delete(client.coins, k)
+					undo.spent = append(undo.spent, spentCoin{input: k, coin: coin})
 					needUpdate = true
 				}
 			}
 		}
 	}
 
-	// update wallet store
-	if needUpdate {
-		if err := client.SaveCoins(); err != nil {
-			fmt.Fprintf(os.Stderr, "saving coins error: %v\n", err)
-		}
+	client.undo = append(client.undo, undo)
+	if len(client.undo) > MaxUndoBlocks {
+		client.undo = client.undo[len(client.undo)-MaxUndoBlocks:]
 	}
 
-	// update height
+	// update height and wallet store
 	client.currentHeight++
-	bytesBuffer := bytes.NewBuffer([]byte{})
-	binary.Write(bytesBuffer, binary.LittleEndian, &client.currentHeight)
-	client.SaveStoredData("Height", bytesBuffer.Bytes())
+	client.blockHash = undo.Hash
+	client.saveSyncState(needUpdate)
+}
+
+// rollbackBlock undoes the block processed last, the wallet is rebuilt when
+// the block is not in the undo data.
+func (client *ClientImpl) rollbackBlock() error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if n := len(client.undo); n > 0 && client.undo[n-1].Hash == client.blockHash {
+		client.undoBlock()
+		return nil
+	}
+
+	log.Warnf("Wallet block %d is too old to roll back, rebuilding wallet", client.currentHeight)
+	return client.rebuildLocked()
+}
+
+// undoBlock removes the block processed last from the wallet, the caller
+// holds the lock and checked it is the last one in the undo data.
+func (client *ClientImpl) undoBlock() {
+	undo := client.undo[len(client.undo)-1]
+	client.undo = client.undo[:len(client.undo)-1]
+
+	// spent coins come back first, a coin created and spent in the block is
+	// then removed with the created ones
+	for _, s := range undo.spent {
+		client.coins[s.input] = s.coin
+	}
+	for _, input := range undo.created {
+		for k := range client.coins {
+			if k.ReferTxOutputIndex == input.ReferTxOutputIndex && k.ReferTxID == input.ReferTxID {
+				delete(client.coins, k)
+			}
+		}
+	}
+	if err := client.history.RemoveRecords(undo.Height); err != nil {
+		fmt.Fprintf(os.Stderr, "saving history error: %v\n", err)
+	}
+
+	client.currentHeight--
+	client.blockHash = undo.PrevHash
+	client.saveSyncState(true)
+}
+
+// saveSyncState saves the coins when they changed, the undo data,
+// currentHeight and blockHash in one write, the caller holds the lock.
+func (client *ClientImpl) saveSyncState(coinsChanged bool) {
+	var coins map[*transaction.UTXOTxInput]*Coin
+	if coinsChanged {
+		coins = client.coins
+	}
+	if err := client.SaveSyncData(coins, client.undo, client.currentHeight, client.blockHash); err != nil {
+		fmt.Fprintf(os.Stderr, "saving wallet error: %v\n", err)
+	}
+}
+
+// txRecords works out the effect of the transaction on the wallet for each
+// asset it moves, the caller holds the lock.
+func (client *ClientImpl) txRecords(tx *transaction.Transaction, block *ledger.Blockdata) []TxRecord {
+	type flow struct {
+		in, out           Fixed64
+		totalIn, totalOut Fixed64
+	}
+	var assets []Uint256
+	flows := make(map[Uint256]*flow)
+	flowOf := func(assetID Uint256) *flow {
+		f, ok := flows[assetID]
+		if !ok {
+			f = new(flow)
+			flows[assetID] = f
+			assets = append(assets, assetID)
+		}
+		return f
+	}
+
+	for _, output := range tx.Outputs {
+		f := flowOf(output.AssetID)
+		f.totalOut += output.Value
+		if client.isWalletAddress(output.ProgramHash) {
+			f.out += output.Value
+		}
+	}
+	reference, err := tx.GetReference()
+	feeKnown := err == nil
+	if err != nil {
+		// the wallet coins are enough to tell what the wallet spent
+		reference = make(map[*transaction.UTXOTxInput]*transaction.TxOutput)
+		for _, input := range tx.UTXOInputs {
+			for k, coin := range client.coins {
+				if k.ReferTxOutputIndex == input.ReferTxOutputIndex && k.ReferTxID == input.ReferTxID {
+					reference[input] = coin.Output
+				}
+			}
+		}
+	}
+	for _, output := range reference {
+		f := flowOf(output.AssetID)
+		f.totalIn += output.Value
+		if client.isWalletAddress(output.ProgramHash) {
+			f.in += output.Value
+		}
+	}
+
+	txid := tx.Hash()
+	var records []TxRecord
+	for _, assetID := range assets {
+		f := flows[assetID]
+		if f.in == 0 && f.out == 0 {
+			continue
+		}
+		record := TxRecord{
+			TxID:      BytesToHexString(txid.ToArrayReverse()),
+			AssetID:   BytesToHexString(assetID.ToArrayReverse()),
+			Height:    block.Height,
+			Timestamp: block.Timestamp,
+		}
+		if f.in == 0 {
+			record.Direction = TxReceived
+			record.Amount = f.out
+		} else {
+			if feeKnown {
+				record.Fee = f.totalIn - f.totalOut
+			}
+			if external := f.totalOut - f.out; external > 0 {
+				record.Direction = TxSent
+				record.Amount = external
+			} else {
+				record.Direction = TxSelf
+			}
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func newCoin(contract *ct.Contract, output *transaction.TxOutput, height uint32) *Coin {
+	var coin Coin
+	switch {
+	case contract.IsStandard():
+		coin = Coin{Output: output, AddressType: SingleSign, Height: height}
+	case contract.IsMultiSigContract():
+		coin = Coin{Output: output, AddressType: MultiSign, Height: height}
+	case contract.GetType() == ct.CustomContract:
+		coin = Coin{Output: output, AddressType: Script, Height: height}
+	}
+	return &coin
 }
 
 func (client *ClientImpl) ProcessSignals() {
@@ -243,8 +470,10 @@ func NewClient(path string, password []byte, create bool) *ClientImpl {
 		accounts:      map[Uint168]*Account{},
 		contracts:     map[Uint168]*ct.Contract{},
 		coins:         map[*transaction.UTXOTxInput]*Coin{},
+		watchOnly:     map[Uint168]*WatchOnlyAddress{},
 		currentHeight: -1,
 		FileStore:     FileStore{path: path},
+		history:       NewHistoryStore(path + HistoryFileSuffix),
 		isRunning:     true,
 	}
 
@@ -255,7 +484,6 @@ func NewClient(path string, password []byte, create bool) *ClientImpl {
 		//create new client
 		client.iv = make([]byte, 16)
 		client.masterKey = make([]byte, 32)
-		client.watchOnly = []Uint168{}
 
 		//generate random number for iv/masterkey
 		r := rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -268,6 +496,7 @@ func NewClient(path string, password []byte, create bool) *ClientImpl {
 
 		//new client store (build DB)
 		client.BuildDatabase(path)
+		os.Remove(path + HistoryFileSuffix)
 
 		if err := client.SaveStoredData("Version", []byte(WalletStoreVersion)); err != nil {
 			log.Error(err)
@@ -297,12 +526,16 @@ func NewClient(path string, password []byte, create bool) *ClientImpl {
 		// if has local blockchain database, then update wallet block height. Otherwise, wallet block height is 0 by default
 		if ledger.DefaultLedger != nil && ledger.DefaultLedger.Blockchain != nil {
 			client.currentHeight = int32(ledger.DefaultLedger.GetLocalBlockChainHeight())
+			client.blockHash, _ = ledger.DefaultLedger.Store.GetBlockHash(uint32(client.currentHeight))
 		}
 		bytesBuffer := bytes.NewBuffer([]byte{})
 		binary.Write(bytesBuffer, binary.LittleEndian, &client.currentHeight)
 		if err := client.SaveStoredData("Height", bytesBuffer.Bytes()); err != nil {
 			return nil
 		}
+		if err := client.SaveStoredData("BlockHash", client.blockHash.ToArray()); err != nil {
+			return nil
+		}
 
 	} else {
 		if ok := client.verifyPasswordKey(passwordKey); !ok {
@@ -332,6 +565,10 @@ func NewClient(path string, password []byte, create bool) *ClientImpl {
 		var height int32
 		binary.Read(bytesBuffer, binary.LittleEndian, &height)
 		client.currentHeight = height
+		// wallets saved before the block hash was kept have none
+		if tmp, err := client.LoadStoredData("BlockHash"); err == nil && len(tmp) > 0 {
+			client.blockHash, _ = Uint256ParseFromBytes(tmp)
+		}
 	}
 	ClearBytes(passwordKey, len(passwordKey))
 
@@ -512,8 +749,14 @@ func (cl *ClientImpl) DecryptPrivateKey(prikey []byte) ([]byte, error) {
 	return dec, nil
 }
 
-// CreateAccount create a new Account then save it
+// CreateAccount create a new Account then save it, the account of a hd
+// wallet is the next one of its key tree
 func (cl *ClientImpl) CreateAccount() (*Account, error) {
+	if cl.hdChain != nil {
+		cl.mu.Lock()
+		defer cl.mu.Unlock()
+		return cl.createHDAccount()
+	}
 	account, err := NewAccount()
 	if err != nil {
 		return nil, err
@@ -550,6 +793,11 @@ func (cl *ClientImpl) SaveAccount(ac *Account) error {
 	cl.mu.Lock()
 	defer cl.mu.Unlock()
 
+	return cl.saveAccount(ac)
+}
+
+// saveAccount is SaveAccount with the lock held
+func (cl *ClientImpl) saveAccount(ac *Account) error {
 	// save Account to memory
 	programHash := ac.ProgramHash
 	cl.accounts[programHash] = ac
@@ -712,6 +960,11 @@ func (cl *ClientImpl) SaveContract(ct *contract.Contract) error {
 	cl.mu.Lock()
 	defer cl.mu.Unlock()
 
+	return cl.saveContract(ct)
+}
+
+// saveContract is SaveContract with the lock held
+func (cl *ClientImpl) saveContract(ct *contract.Contract) error {
 	// save contract to memory
 	cl.contracts[ct.ProgramHash] = ct
 
@@ -766,6 +1019,16 @@ func (client *ClientImpl) LoadCoins() error {
 
 	return nil
 }
+func (client *ClientImpl) LoadUndo() error {
+	undo, err := client.LoadUndoData()
+	if err != nil {
+		return err
+	}
+	client.undo = undo
+
+	return nil
+}
+
 func (client *ClientImpl) SaveCoins() error {
 	if err := client.SaveCoinsData(client.coins); err != nil {
 		return err
@@ -810,6 +1073,19 @@ func (client *ClientImpl) GetCoins() map[*transaction.UTXOTxInput]*Coin {
 	return client.coins
 }
 
+// GetHistory returns the wallet transaction records newest first, see
+// HistoryStore.GetRecords.
+func (client *ClientImpl) GetHistory(offset, limit uint32) ([]TxRecord, uint32) {
+	return client.history.GetRecords(offset, limit)
+}
+
+func (client *ClientImpl) SetTransactionLabel(txid string, label string) error {
+	if b, err := HexStringToBytes(txid); err != nil || len(b) != UINT256SIZE {
+		return errors.New("invalid transaction id")
+	}
+	return client.history.SetLabel(txid, label)
+}
+
 func (client *ClientImpl) GetAccounts() []*Account {
 	client.mu.Lock()
 	defer client.mu.Unlock()
@@ -821,18 +1097,27 @@ func (client *ClientImpl) GetAccounts() []*Account {
 	return accounts
 }
 
+// Rebuild resets the wallet so the next sync rescans the chain from the
+// genesis block.
 func (client *ClientImpl) Rebuild() error {
-	// reset wallet block height
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.rebuildLocked()
+}
+
+// rebuildLocked resets the wallet, the caller holds the lock.
+func (client *ClientImpl) rebuildLocked() error {
+	// reset wallet block height and coins
 	client.currentHeight = -1
-	var height int32 = -1
-	bytesBuffer := bytes.NewBuffer([]byte{})
-	binary.Write(bytesBuffer, binary.LittleEndian, &height)
-	if err := client.SaveStoredData("Height", bytesBuffer.Bytes()); err != nil {
+	client.blockHash = Uint256{}
+	client.undo = nil
+	client.coins = make(map[*transaction.UTXOTxInput]*Coin)
+	if err := client.SaveSyncData(client.coins, nil, client.currentHeight, client.blockHash); err != nil {
 		return err
 	}
 
-	// reset coins
-	if err := client.DeleteCoins(); err != nil {
+	// reset history, the labels are kept
+	if err := client.history.reset(); err != nil {
 		return err
 	}
 
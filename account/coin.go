@@ -13,6 +13,7 @@ const (
 	SingleSign AddressType = 0
 	MultiSign  AddressType = 1
 	Script     AddressType = 2
+	WatchOnly  AddressType = 3
 )
 
 type Coin struct {
@@ -31,7 +32,9 @@ func (coin *Coin) Serialize(w io.Writer, version string) error {
 
 func (coin *Coin) Deserialize(r io.Reader, version string) error {
 	coin.Output = new(transaction.TxOutput)
-	coin.Output.Deserialize(r)
+	if err := coin.Output.Deserialize(r); err != nil {
+		return err
+	}
 	addrType, err := serialization.ReadUint8(r)
 	if err != nil {
 		return err
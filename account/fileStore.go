@@ -25,6 +25,7 @@ type WalletData struct {
 	IV           string
 	MasterKey    string
 	Height       int32
+	BlockHash    string // hash of the block processed last
 	Version      string
 }
 
@@ -40,6 +41,20 @@ type ContractData struct {
 	RawData     string
 }
 
+type WatchOnlyData struct {
+	Address      string
+	ProgramHash  string
+	RedeemScript string
+}
+
+// HDData is the key tree of a hd wallet. The seed is encrypted with the
+// master key, it is empty in a wallet created from an extended public key.
+type HDData struct {
+	SeedEncrypted     string
+	ExtendedPublicKey string
+	NextIndex         uint32
+}
+
 type FileStore struct {
 	// this lock could be hold by readDB, writeDB and interrupt signals.
 	sync.Mutex
@@ -51,11 +66,16 @@ type FileStore struct {
 
 type CoinData string
 
+type UndoData string
+
 type FileData struct {
 	WalletData
-	Account  []AccountData
-	Contract []ContractData
-	Coins    CoinData
+	Account   []AccountData
+	Contract  []ContractData
+	Coins     CoinData
+	Undo      UndoData
+	HD        HDData
+	WatchOnly []WatchOnlyData
 }
 
 // Caller holds the lock and reads bytes from DB, then close the DB and release the lock
@@ -255,7 +275,7 @@ func (cs *FileStore) LoadContractData() ([]ContractData, error) {
 	return cs.data.Contract, nil
 }
 
-func (cs *FileStore) SaveCoinsData(coins map[*transaction.UTXOTxInput]*Coin) error {
+func (cs *FileStore) SaveWatchOnlyData(programHash Uint168, redeemScript []byte) error {
 	JSONData, err := cs.readDB()
 	if err != nil {
 		return errors.New("error: reading db")
@@ -263,18 +283,40 @@ func (cs *FileStore) SaveCoinsData(coins map[*transaction.UTXOTxInput]*Coin) err
 	if err := json.Unmarshal(JSONData, &cs.data); err != nil {
 		return errors.New("error: unmarshal db")
 	}
+	addr, err := programHash.ToAddress()
+	if err != nil {
+		return errors.New("invalid address")
+	}
+	w := WatchOnlyData{
+		Address:      addr,
+		ProgramHash:  BytesToHexString(programHash.ToArray()),
+		RedeemScript: BytesToHexString(redeemScript),
+	}
+	cs.data.WatchOnly = append(cs.data.WatchOnly, w)
 
-	length := uint32(len(coins))
-	if length == 0 {
-		cs.data.Coins = ""
-	} else {
-		w := new(bytes.Buffer)
-		serialization.WriteUint32(w, uint32(len(coins)))
-		for k, v := range coins {
-			k.Serialize(w)
-			v.Serialize(w, cs.data.Version)
+	JSONBlob, err := json.Marshal(cs.data)
+	if err != nil {
+		return errors.New("error: marshal db")
+	}
+	cs.writeDB(JSONBlob)
+
+	return nil
+}
+
+func (cs *FileStore) DeleteWatchOnlyData(programHash string) error {
+	JSONData, err := cs.readDB()
+	if err != nil {
+		return errors.New("error: reading db")
+	}
+	if err := json.Unmarshal(JSONData, &cs.data); err != nil {
+		return errors.New("error: unmarshal db")
+	}
+
+	for i, v := range cs.data.WatchOnly {
+		if programHash == v.ProgramHash {
+			cs.data.WatchOnly = append(cs.data.WatchOnly[:i], cs.data.WatchOnly[i+1:]...)
+			break
 		}
-		cs.data.Coins = CoinData(BytesToHexString(w.Bytes()))
 	}
 
 	JSONBlob, err := json.Marshal(cs.data)
@@ -286,6 +328,38 @@ func (cs *FileStore) SaveCoinsData(coins map[*transaction.UTXOTxInput]*Coin) err
 	return nil
 }
 
+func (cs *FileStore) LoadWatchOnlyData() ([]WatchOnlyData, error) {
+	JSONData, err := cs.readDB()
+	if err != nil {
+		return nil, errors.New("error: reading db")
+	}
+	if err := json.Unmarshal(JSONData, &cs.data); err != nil {
+		return nil, errors.New("error: unmarshal db")
+	}
+
+	return cs.data.WatchOnly, nil
+}
+
+func (cs *FileStore) SaveCoinsData(coins map[*transaction.UTXOTxInput]*Coin) error {
+	JSONData, err := cs.readDB()
+	if err != nil {
+		return errors.New("error: reading db")
+	}
+	if err := json.Unmarshal(JSONData, &cs.data); err != nil {
+		return errors.New("error: unmarshal db")
+	}
+
+	cs.data.Coins = encodeCoins(coins, cs.data.Version)
+
+	JSONBlob, err := json.Marshal(cs.data)
+	if err != nil {
+		return errors.New("error: marshal db")
+	}
+	cs.writeDB(JSONBlob)
+
+	return nil
+}
+
 func (cs *FileStore) DeleteCoinsData(programHash Uint168) error {
 	JSONData, err := cs.readDB()
 	if err != nil {
@@ -322,6 +396,19 @@ func (cs *FileStore) DeleteCoinsData(programHash Uint168) error {
 	return nil
 }
 
+func encodeCoins(coins map[*transaction.UTXOTxInput]*Coin, version string) CoinData {
+	if len(coins) == 0 {
+		return ""
+	}
+	w := new(bytes.Buffer)
+	serialization.WriteUint32(w, uint32(len(coins)))
+	for k, v := range coins {
+		k.Serialize(w)
+		v.Serialize(w, version)
+	}
+	return CoinData(BytesToHexString(w.Bytes()))
+}
+
 func (cs *FileStore) LoadCoinsData() (map[*transaction.UTXOTxInput]*Coin, error) {
 	JSONData, err := cs.readDB()
 	if err != nil {
@@ -349,6 +436,103 @@ func (cs *FileStore) LoadCoinsData() (map[*transaction.UTXOTxInput]*Coin, error)
 	return coins, nil
 }
 
+// SaveSyncData saves the state of the wallet after a block was processed or
+// rolled back in one write: the coins, the changes of the recent blocks
+// oldest first, the height and the hash of the block processed last. The
+// coins saved already are kept when coins is nil.
+func (cs *FileStore) SaveSyncData(coins map[*transaction.UTXOTxInput]*Coin, undo []*BlockUndo,
+	height int32, blockHash Uint256) error {
+	JSONData, err := cs.readDB()
+	if err != nil {
+		return errors.New("error: reading db")
+	}
+	if err := json.Unmarshal(JSONData, &cs.data); err != nil {
+		return errors.New("error: unmarshal db")
+	}
+
+	if coins != nil {
+		cs.data.Coins = encodeCoins(coins, cs.data.Version)
+	}
+	cs.data.Undo = ""
+	if len(undo) > 0 {
+		w := new(bytes.Buffer)
+		serialization.WriteUint32(w, uint32(len(undo)))
+		for _, u := range undo {
+			if err := u.Serialize(w, cs.data.Version); err != nil {
+				return err
+			}
+		}
+		cs.data.Undo = UndoData(BytesToHexString(w.Bytes()))
+	}
+	cs.data.Height = height
+	cs.data.BlockHash = ""
+	if blockHash != (Uint256{}) {
+		cs.data.BlockHash = BytesToHexString(blockHash.ToArray())
+	}
+
+	JSONBlob, err := json.Marshal(cs.data)
+	if err != nil {
+		return errors.New("error: marshal db")
+	}
+	cs.writeDB(JSONBlob)
+
+	return nil
+}
+
+func (cs *FileStore) LoadUndoData() ([]*BlockUndo, error) {
+	JSONData, err := cs.readDB()
+	if err != nil {
+		return nil, errors.New("error: reading db")
+	}
+	if err := json.Unmarshal(JSONData, &cs.data); err != nil {
+		return nil, errors.New("error: unmarshal db")
+	}
+	var undo []*BlockUndo
+	rawUndo, _ := HexStringToBytes(string(cs.data.Undo))
+	r := bytes.NewReader(rawUndo)
+	num, _ := serialization.ReadUint32(r)
+	for i := 0; i < int(num); i++ {
+		u := new(BlockUndo)
+		if err := u.Deserialize(r, cs.data.Version); err != nil {
+			return nil, err
+		}
+		undo = append(undo, u)
+	}
+
+	return undo, nil
+}
+
+func (cs *FileStore) SaveHDData(hd HDData) error {
+	JSONData, err := cs.readDB()
+	if err != nil {
+		return errors.New("error: reading db")
+	}
+	if err := json.Unmarshal(JSONData, &cs.data); err != nil {
+		return errors.New("error: unmarshal db")
+	}
+
+	cs.data.HD = hd
+
+	JSONBlob, err := json.Marshal(cs.data)
+	if err != nil {
+		return errors.New("error: marshal db")
+	}
+	cs.writeDB(JSONBlob)
+
+	return nil
+}
+
+func (cs *FileStore) LoadHDData() (HDData, error) {
+	JSONData, err := cs.readDB()
+	if err != nil {
+		return HDData{}, errors.New("error: reading db")
+	}
+	if err := json.Unmarshal(JSONData, &cs.data); err != nil {
+		return HDData{}, errors.New("error: unmarshal db")
+	}
+	return cs.data.HD, nil
+}
+
 func (cs *FileStore) SaveStoredData(name string, value []byte) error {
 	JSONData, err := cs.readDB()
 	if err != nil {
@@ -373,7 +557,8 @@ func (cs *FileStore) SaveStoredData(name string, value []byte) error {
 		bytesBuffer := bytes.NewBuffer(value)
 		binary.Read(bytesBuffer, binary.LittleEndian, &height)
 		cs.data.Height = height
-
+	case "BlockHash":
+		cs.data.BlockHash = hexValue
 	}
 	JSONBlob, err := json.Marshal(cs.data)
 	if err != nil {
@@ -405,6 +590,8 @@ func (cs *FileStore) LoadStoredData(name string) ([]byte, error) {
 		bytesBuffer := bytes.NewBuffer([]byte{})
 		binary.Write(bytesBuffer, binary.LittleEndian, cs.data.Height)
 		return bytesBuffer.Bytes(), nil
+	case "BlockHash":
+		return HexStringToBytes(cs.data.BlockHash)
 	}
 
 	return nil, errors.New("Can't find the key: " + name)
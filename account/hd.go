@@ -0,0 +1,272 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	. "Elastos.ELA/common"
+	ct "Elastos.ELA/core/contract"
+	"Elastos.ELA/crypto"
+)
+
+const (
+	// the keys of a hd wallet are at m/44'/2305'/0'/0/index
+	HDPurpose  = 44
+	HDCoinType = 2305
+
+	// DefaultGapLimit is the number of unused addresses after the last used
+	// one that are watched for payments.
+	DefaultGapLimit = 20
+
+	MnemonicBits = 128
+)
+
+// CreateHD creates a wallet with the key tree of the mnemonic sentence, the
+// main account is the first address of the tree.
+func CreateHD(path string, password []byte, mnemonic, passphrase string) (*ClientImpl, error) {
+	seed, err := crypto.MnemonicToSeed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	client := NewClient(path, password, true)
+	if client == nil {
+		return nil, errors.New("client nil")
+	}
+	if err := client.initHD(seed, ""); err != nil {
+		return nil, err
+	}
+	account, err := client.CreateAccount()
+	if err != nil {
+		return nil, err
+	}
+	if err := client.CreateContract(account); err != nil {
+		return nil, err
+	}
+	client.mainAccount = account.ProgramHash
+
+	return client, nil
+}
+
+// RecoverHD restores a wallet from its mnemonic sentence, the addresses in
+// use are found again when the wallet rescans the chain.
+func RecoverHD(path string, password []byte, mnemonic, passphrase string) (*ClientImpl, error) {
+	client, err := CreateHD(path, password, mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Rebuild(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// RecoverWatchOnlyHD creates a wallet of the addresses of an extended public
+// key exported by a hd wallet, it can see the coins but not spend them.
+func RecoverWatchOnlyHD(path string, password []byte, xpub string) (*ClientImpl, error) {
+	client := NewClient(path, password, true)
+	if client == nil {
+		return nil, errors.New("client nil")
+	}
+	if err := client.initHD(nil, xpub); err != nil {
+		return nil, err
+	}
+	client.mu.Lock()
+	err := client.useHDAddress(client.hdData.NextIndex)
+	client.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Rebuild(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// hdChainKey returns the external chain key of the tree and the extended
+// public key of its account.
+func hdChainKey(seed []byte, xpub string) (*crypto.ExtendedKey, string, error) {
+	var accountKey *crypto.ExtendedKey
+	if seed != nil {
+		master, err := crypto.NewMasterKey(seed)
+		if err != nil {
+			return nil, "", err
+		}
+		accountKey, err = master.Derive(crypto.HardenedKeyStart+HDPurpose,
+			crypto.HardenedKeyStart+HDCoinType, crypto.HardenedKeyStart)
+		if err != nil {
+			return nil, "", err
+		}
+	} else {
+		var err error
+		accountKey, err = crypto.ParseExtendedKey(xpub)
+		if err != nil {
+			return nil, "", err
+		}
+		if accountKey.IsPrivate() {
+			return nil, "", errors.New("not an extended public key")
+		}
+	}
+	chain, err := accountKey.Child(0)
+	if err != nil {
+		return nil, "", err
+	}
+	return chain, accountKey.Neuter().String(), nil
+}
+
+func (client *ClientImpl) initHD(seed []byte, xpub string) error {
+	chain, xpub, err := hdChainKey(seed, xpub)
+	if err != nil {
+		return err
+	}
+	if seed != nil {
+		encryptedSeed, err := crypto.AesEncrypt(seed, client.masterKey, client.iv)
+		if err != nil {
+			return err
+		}
+		client.hdData.SeedEncrypted = BytesToHexString(encryptedSeed)
+	}
+	client.hdData.ExtendedPublicKey = xpub
+	client.hdChain = chain
+	if err := client.SaveHDData(client.hdData); err != nil {
+		return err
+	}
+	return client.fillLookahead()
+}
+
+// LoadHD loads the key tree of a hd wallet, nothing is done for a wallet of
+// random keys.
+func (client *ClientImpl) LoadHD() error {
+	hd, err := client.LoadHDData()
+	if err != nil {
+		return err
+	}
+	if hd.ExtendedPublicKey == "" {
+		return nil
+	}
+	var seed []byte
+	if hd.SeedEncrypted != "" {
+		encryptedSeed, err := HexStringToBytes(hd.SeedEncrypted)
+		if err != nil {
+			return err
+		}
+		if seed, err = crypto.AesDecrypt(encryptedSeed, client.masterKey, client.iv); err != nil {
+			return err
+		}
+	}
+	chain, _, err := hdChainKey(seed, hd.ExtendedPublicKey)
+	if err != nil {
+		return err
+	}
+	client.hdData = hd
+	client.hdChain = chain
+	return client.fillLookahead()
+}
+
+// GetExtendedPublicKey returns the extended public key of the account of a
+// hd wallet, a watch-only wallet can be created from it.
+func (client *ClientImpl) GetExtendedPublicKey() string {
+	return client.hdData.ExtendedPublicKey
+}
+
+// fillLookahead derives the program hashes of the DefaultGapLimit addresses
+// after the last one in use.
+func (client *ClientImpl) fillLookahead() error {
+	lookahead := make(map[Uint168]uint32, DefaultGapLimit)
+	for i := client.hdData.NextIndex; i < client.hdData.NextIndex+DefaultGapLimit; i++ {
+		_, contract, err := client.deriveHD(i)
+		if err != nil {
+			return err
+		}
+		lookahead[contract.ProgramHash] = i
+	}
+	client.lookahead = lookahead
+	return nil
+}
+
+// deriveHD returns the account and the contract of the index of the chain,
+// the account is nil in a watch-only wallet.
+func (client *ClientImpl) deriveHD(index uint32) (*Account, *ct.Contract, error) {
+	key, err := client.hdChain.Child(index)
+	if err != nil {
+		return nil, nil, err
+	}
+	if key.IsPrivate() {
+		privateKey, _ := key.PrivateKey()
+		account, err := NewAccountWithPrivatekey(privateKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		contract, err := ct.CreateSignatureContract(account.PubKey())
+		if err != nil {
+			return nil, nil, err
+		}
+		return account, contract, nil
+	}
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	contract, err := ct.CreateSignatureContract(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, contract, nil
+}
+
+// createHDAccount derives the account of the next index of the chain, the
+// caller holds the lock.
+func (client *ClientImpl) createHDAccount() (*Account, error) {
+	if !client.hdChain.IsPrivate() {
+		return nil, errors.New("watch-only wallet has no private keys")
+	}
+	account, _, err := client.deriveHD(client.hdData.NextIndex)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.saveAccount(account); err != nil {
+		return nil, err
+	}
+	client.hdData.NextIndex++
+	if err := client.SaveHDData(client.hdData); err != nil {
+		return nil, err
+	}
+	return account, client.fillLookahead()
+}
+
+// useHDAddress adds the addresses of the chain up to the index to the
+// wallet, the caller holds the lock.
+func (client *ClientImpl) useHDAddress(index uint32) error {
+	for i := client.hdData.NextIndex; i <= index; i++ {
+		account, contract, err := client.deriveHD(i)
+		if err != nil {
+			return err
+		}
+		if account != nil {
+			if err := client.saveAccount(account); err != nil {
+				return err
+			}
+		}
+		if err := client.saveContract(contract); err != nil {
+			return err
+		}
+	}
+	client.hdData.NextIndex = index + 1
+	if err := client.SaveHDData(client.hdData); err != nil {
+		return err
+	}
+	return client.fillLookahead()
+}
+
+// discoverHDAddress adds the address of the lookahead window a transaction
+// pays to, together with the ones before it, so a recovered wallet finds its
+// addresses again as it rescans. The caller holds the lock.
+func (client *ClientImpl) discoverHDAddress(programHash Uint168) {
+	index, ok := client.lookahead[programHash]
+	if !ok {
+		return
+	}
+	if err := client.useHDAddress(index); err != nil {
+		fmt.Fprintf(os.Stderr, "hd address discovery error: %v\n", err)
+	}
+}
@@ -0,0 +1,153 @@
+package account
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	. "Elastos.ELA/common"
+)
+
+const (
+	HistoryFileSuffix = ".history"
+
+	TxReceived = "received"
+	TxSent     = "sent"
+	TxSelf     = "self"
+)
+
+// TxRecord is the effect of one transaction on the wallet for a single
+// asset. Amount is the value that entered (received) or left (sent) the
+// wallet program hashes, it is 0 when the wallet only paid itself. Fee is
+// set when the wallet spent inputs of the transaction.
+type TxRecord struct {
+	TxID      string
+	AssetID   string
+	Direction string
+	Amount    Fixed64
+	Fee       Fixed64
+	Height    uint32
+	Timestamp uint32
+	Label     string `json:",omitempty"`
+}
+
+type HistoryData struct {
+	Records []TxRecord
+	// labels are kept apart from the records so they survive rollbacks
+	// and wallet rebuilds
+	Labels map[string]string
+}
+
+// HistoryStore keeps the transaction history of a wallet in a file next to
+// the wallet file. The records are in block order.
+type HistoryStore struct {
+	sync.Mutex
+
+	data HistoryData
+	path string
+}
+
+func NewHistoryStore(path string) *HistoryStore {
+	hs := &HistoryStore{path: path}
+	hs.data.Labels = make(map[string]string)
+	return hs
+}
+
+func (hs *HistoryStore) load() error {
+	hs.Lock()
+	defer hs.Unlock()
+
+	data, err := ioutil.ReadFile(hs.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.New("error: reading history")
+	}
+	if err := json.Unmarshal(data, &hs.data); err != nil {
+		return errors.New("error: unmarshal history")
+	}
+	if hs.data.Labels == nil {
+		hs.data.Labels = make(map[string]string)
+	}
+	return nil
+}
+
+// Caller holds the lock
+func (hs *HistoryStore) save() error {
+	data, err := json.Marshal(hs.data)
+	if err != nil {
+		return errors.New("error: marshal history")
+	}
+	return ioutil.WriteFile(hs.path, data, 0666)
+}
+
+func (hs *HistoryStore) AddRecords(records []TxRecord) error {
+	hs.Lock()
+	defer hs.Unlock()
+
+	for _, r := range records {
+		r.Label = ""
+		hs.data.Records = append(hs.data.Records, r)
+	}
+	return hs.save()
+}
+
+// RemoveRecords drops the records of the blocks from the height on.
+func (hs *HistoryStore) RemoveRecords(height uint32) error {
+	hs.Lock()
+	defer hs.Unlock()
+
+	i := len(hs.data.Records)
+	for i > 0 && hs.data.Records[i-1].Height >= height {
+		i--
+	}
+	if i == len(hs.data.Records) {
+		return nil
+	}
+	hs.data.Records = hs.data.Records[:i]
+	return hs.save()
+}
+
+func (hs *HistoryStore) SetLabel(txid string, label string) error {
+	hs.Lock()
+	defer hs.Unlock()
+
+	if label == "" {
+		delete(hs.data.Labels, txid)
+	} else {
+		hs.data.Labels[txid] = label
+	}
+	return hs.save()
+}
+
+// GetRecords returns the records newest first, skipping the first offset
+// entries and returning at most limit of them (0 means no limit). The total
+// number of records is also returned.
+func (hs *HistoryStore) GetRecords(offset, limit uint32) ([]TxRecord, uint32) {
+	hs.Lock()
+	defer hs.Unlock()
+
+	total := uint32(len(hs.data.Records))
+	records := make([]TxRecord, 0)
+	for i := int(total) - 1 - int(offset); i >= 0; i-- {
+		if limit > 0 && uint32(len(records)) >= limit {
+			break
+		}
+		r := hs.data.Records[i]
+		r.Label = hs.data.Labels[r.TxID]
+		records = append(records, r)
+	}
+	return records, total
+}
+
+// reset removes all the records, the labels are kept.
+func (hs *HistoryStore) reset() error {
+	hs.Lock()
+	defer hs.Unlock()
+
+	hs.data.Records = nil
+	return hs.save()
+}
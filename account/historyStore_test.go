@@ -0,0 +1,111 @@
+package account
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestHistoryStore(t *testing.T) (*HistoryStore, func()) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHistoryStore(filepath.Join(dir, "wallet.dat"+HistoryFileSuffix)), func() { os.RemoveAll(dir) }
+}
+
+func TestHistoryStoreRecords(t *testing.T) {
+	hs, cleanup := newTestHistoryStore(t)
+	defer cleanup()
+
+	hs.AddRecords([]TxRecord{
+		{TxID: "a", Direction: TxReceived, Amount: 10, Height: 1},
+		{TxID: "b", Direction: TxSent, Amount: 4, Fee: 1, Height: 2},
+	})
+	hs.AddRecords([]TxRecord{{TxID: "c", Direction: TxSelf, Height: 3, Label: "ignored"}})
+
+	records, total := hs.GetRecords(0, 0)
+	if total != 3 || len(records) != 3 {
+		t.Fatalf("%d of %d records, want 3 of 3", len(records), total)
+	}
+	if records[0].TxID != "c" || records[2].TxID != "a" {
+		t.Fatalf("records are not newest first: %v", records)
+	}
+	if records[0].Label != "" {
+		t.Fatal("label of an added record is kept")
+	}
+	records, total = hs.GetRecords(1, 1)
+	if total != 3 || len(records) != 1 || records[0].TxID != "b" {
+		t.Fatalf("offset 1 limit 1 returns %v of %d, want b of 3", records, total)
+	}
+	if records, _ = hs.GetRecords(5, 0); len(records) != 0 {
+		t.Fatalf("offset past the end returns %v", records)
+	}
+
+	// the records are saved
+	loaded := NewHistoryStore(hs.path)
+	if err := loaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, total := loaded.GetRecords(0, 0); total != 3 {
+		t.Fatalf("%d records loaded, want 3", total)
+	}
+}
+
+func TestHistoryStoreRemoveRecords(t *testing.T) {
+	hs, cleanup := newTestHistoryStore(t)
+	defer cleanup()
+
+	hs.AddRecords([]TxRecord{
+		{TxID: "a", Height: 1},
+		{TxID: "b", Height: 2},
+		{TxID: "c", Height: 2},
+		{TxID: "d", Height: 3},
+	})
+	if err := hs.RemoveRecords(2); err != nil {
+		t.Fatal(err)
+	}
+	records, total := hs.GetRecords(0, 0)
+	if total != 1 || records[0].TxID != "a" {
+		t.Fatalf("records %v left, want a", records)
+	}
+	if err := hs.RemoveRecords(5); err != nil {
+		t.Fatal(err)
+	}
+	if _, total := hs.GetRecords(0, 0); total != 1 {
+		t.Fatal("removing the records above the history removed some")
+	}
+}
+
+func TestHistoryStoreLabels(t *testing.T) {
+	hs, cleanup := newTestHistoryStore(t)
+	defer cleanup()
+
+	hs.AddRecords([]TxRecord{{TxID: "a", Height: 1}, {TxID: "b", Height: 2}})
+	hs.SetLabel("b", "rent")
+	hs.SetLabel("a", "salary")
+	hs.SetLabel("a", "")
+
+	// labels survive rollbacks and rebuilds
+	hs.RemoveRecords(2)
+	if err := hs.reset(); err != nil {
+		t.Fatal(err)
+	}
+	if _, total := hs.GetRecords(0, 0); total != 0 {
+		t.Fatal("reset kept the records")
+	}
+	hs.AddRecords([]TxRecord{{TxID: "a", Height: 1}, {TxID: "b", Height: 2}})
+
+	loaded := NewHistoryStore(hs.path)
+	if err := loaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	records, _ := loaded.GetRecords(0, 0)
+	if records[0].Label != "rent" {
+		t.Fatalf("label of b is %q, want rent", records[0].Label)
+	}
+	if records[1].Label != "" {
+		t.Fatalf("removed label of a is %q", records[1].Label)
+	}
+}
@@ -0,0 +1,93 @@
+package account
+
+import (
+	"io"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/serialization"
+	"Elastos.ELA/core/transaction"
+)
+
+// MaxUndoBlocks is the number of processed blocks the wallet can roll back
+// on its own, a deeper reorganization rebuilds the wallet.
+const MaxUndoBlocks = 100
+
+// spentCoin is a coin of the wallet spent by a block.
+type spentCoin struct {
+	input *transaction.UTXOTxInput
+	coin  *Coin
+}
+
+// BlockUndo is what a processed block changed in the wallet. The block is
+// no longer in the chain store when it is rolled back, so the wallet keeps
+// the coins it created and spent itself.
+type BlockUndo struct {
+	Hash     Uint256
+	PrevHash Uint256
+	Height   uint32
+	created  []*transaction.UTXOTxInput
+	spent    []spentCoin
+}
+
+func (u *BlockUndo) Serialize(w io.Writer, version string) error {
+	if _, err := u.Hash.Serialize(w); err != nil {
+		return err
+	}
+	if _, err := u.PrevHash.Serialize(w); err != nil {
+		return err
+	}
+	serialization.WriteUint32(w, u.Height)
+	serialization.WriteUint32(w, uint32(len(u.created)))
+	for _, input := range u.created {
+		input.Serialize(w)
+	}
+	serialization.WriteUint32(w, uint32(len(u.spent)))
+	for _, s := range u.spent {
+		s.input.Serialize(w)
+		if err := s.coin.Serialize(w, version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *BlockUndo) Deserialize(r io.Reader, version string) error {
+	if err := u.Hash.Deserialize(r); err != nil {
+		return err
+	}
+	if err := u.PrevHash.Deserialize(r); err != nil {
+		return err
+	}
+	var err error
+	if u.Height, err = serialization.ReadUint32(r); err != nil {
+		return err
+	}
+	count, err := serialization.ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	u.created = nil
+	for i := uint32(0); i < count; i++ {
+		input := new(transaction.UTXOTxInput)
+		if err := input.Deserialize(r); err != nil {
+			return err
+		}
+		u.created = append(u.created, input)
+	}
+	if count, err = serialization.ReadUint32(r); err != nil {
+		return err
+	}
+	u.spent = nil
+	for i := uint32(0); i < count; i++ {
+		input := new(transaction.UTXOTxInput)
+		if err := input.Deserialize(r); err != nil {
+			return err
+		}
+		coin := new(Coin)
+		if err := coin.Deserialize(r, version); err != nil {
+			return err
+		}
+		u.spent = append(u.spent, spentCoin{input: input, coin: coin})
+	}
+	return nil
+}
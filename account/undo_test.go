@@ -0,0 +1,209 @@
+package account
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/core/ledger"
+	"Elastos.ELA/core/transaction"
+	"Elastos.ELA/core/transaction/payload"
+)
+
+// testTxStore holds the transfers of the test blocks so the wallet can look
+// up the outputs they spend.
+type testTxStore map[Uint256]*transaction.Transaction
+
+func (s testTxStore) GetTransaction(hash Uint256) (*transaction.Transaction, uint32, error) {
+	if txn, ok := s[hash]; ok {
+		return txn, 0, nil
+	}
+	return nil, 0, errors.New("transaction not found")
+}
+func (s testTxStore) GetHeight() uint32 { return 0 }
+
+var testTxns = make(testTxStore)
+
+func newTestClient(t *testing.T) (*ClientImpl, func()) {
+	log.Init()
+	transaction.TxStore = testTxns
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Create(filepath.Join(dir, WalletFileName), []byte("passwd"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return client, func() {
+		client.isRunning = false
+		os.RemoveAll(dir)
+	}
+}
+
+func newTestBlock(height uint32, prev Uint256, txns ...*transaction.Transaction) *ledger.Block {
+	return &ledger.Block{
+		Blockdata:    &ledger.Blockdata{Height: height, PrevBlockHash: prev, Timestamp: 1514000000 + height},
+		Transactions: txns,
+	}
+}
+
+func newTestTransfer(inputs []*transaction.UTXOTxInput, outputs ...*transaction.TxOutput) *transaction.Transaction {
+	txn, _ := transaction.NewTransferAssetTransaction(inputs, outputs)
+	testTxns[txn.Hash()] = txn
+	return txn
+}
+
+// walletCoins returns the value of the wallet coins by outpoint.
+func walletCoins(client *ClientImpl) map[transaction.UTXOTxInput]Fixed64 {
+	coins := make(map[transaction.UTXOTxInput]Fixed64)
+	for input, coin := range client.coins {
+		coins[*input] = coin.Output.Value
+	}
+	return coins
+}
+
+func sameCoins(a, b map[transaction.UTXOTxInput]Fixed64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+func TestUndoBlock(t *testing.T) {
+	client, cleanup := newTestClient(t)
+	defer cleanup()
+	wallet := client.mainAccount
+	other := Uint168{1}
+
+	coinbase, _ := transaction.NewCoinBaseTransaction(&payload.CoinBase{}, 0)
+	coinbase.Outputs = []*transaction.TxOutput{{Value: 100, ProgramHash: wallet}}
+	received := newTestTransfer([]*transaction.UTXOTxInput{{ReferTxID: Uint256{9}}},
+		&transaction.TxOutput{Value: 50, ProgramHash: wallet})
+	b0 := newTestBlock(0, Uint256{}, coinbase, received)
+
+	// b1 spends a coin of b0 and a coin it creates itself
+	sent := newTestTransfer([]*transaction.UTXOTxInput{{ReferTxID: received.Hash()}},
+		&transaction.TxOutput{Value: 20, ProgramHash: other},
+		&transaction.TxOutput{Value: 30, ProgramHash: wallet})
+	paid := newTestTransfer([]*transaction.UTXOTxInput{{ReferTxID: Uint256{8}}},
+		&transaction.TxOutput{Value: 5, ProgramHash: wallet})
+	spentAgain := newTestTransfer([]*transaction.UTXOTxInput{{ReferTxID: paid.Hash()}},
+		&transaction.TxOutput{Value: 5, ProgramHash: other})
+	b1 := newTestBlock(1, b0.Hash(), sent, paid, spentAgain)
+
+	client.mu.Lock()
+	client.applyBlock(b0)
+	afterB0 := walletCoins(client)
+	client.applyBlock(b1)
+	client.mu.Unlock()
+
+	if len(afterB0) != 2 {
+		t.Fatalf("%d coins after b0, want 2", len(afterB0))
+	}
+	want := map[transaction.UTXOTxInput]Fixed64{
+		{ReferTxID: coinbase.Hash()}:                    100,
+		{ReferTxID: sent.Hash(), ReferTxOutputIndex: 1}: 30,
+	}
+	if coins := walletCoins(client); !sameCoins(coins, want) {
+		t.Fatalf("coins after b1 are %v, want %v", coins, want)
+	}
+	if client.currentHeight != 1 || client.blockHash != b1.Hash() {
+		t.Fatalf("wallet is at %d %x, want b1", client.currentHeight, client.blockHash)
+	}
+	if _, total := client.GetHistory(0, 0); total != 5 {
+		t.Fatalf("%d history records, want 5", total)
+	}
+
+	// the undo data survives a restart
+	opened, err := Open(client.path, []byte("passwd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { opened.isRunning = false }()
+	if len(opened.undo) != 2 || opened.blockHash != b1.Hash() || opened.currentHeight != 1 {
+		t.Fatalf("opened wallet has %d undo blocks at %d %x", len(opened.undo), opened.currentHeight, opened.blockHash)
+	}
+
+	if err := opened.rollbackBlock(); err != nil {
+		t.Fatal(err)
+	}
+	if coins := walletCoins(opened); !sameCoins(coins, afterB0) {
+		t.Fatalf("coins after rolling back b1 are %v, want %v", coins, afterB0)
+	}
+	if opened.currentHeight != 0 || opened.blockHash != b0.Hash() {
+		t.Fatalf("wallet is at %d %x, want b0", opened.currentHeight, opened.blockHash)
+	}
+	records, total := opened.GetHistory(0, 0)
+	if total != 2 {
+		t.Fatalf("%d history records, want the 2 of b0", total)
+	}
+	for _, r := range records {
+		if r.Height != 0 {
+			t.Fatalf("record of height %d is kept", r.Height)
+		}
+	}
+
+	// a replacement of b1 applies on top of b0
+	b1b := newTestBlock(1, b0.Hash(), newTestTransfer([]*transaction.UTXOTxInput{{ReferTxID: Uint256{7}}},
+		&transaction.TxOutput{Value: 1, ProgramHash: wallet}))
+	opened.mu.Lock()
+	opened.applyBlock(b1b)
+	opened.mu.Unlock()
+	if len(walletCoins(opened)) != 3 || opened.blockHash != b1b.Hash() {
+		t.Fatal("replacement block is not applied")
+	}
+}
+
+func TestRollbackRebuild(t *testing.T) {
+	client, cleanup := newTestClient(t)
+	defer cleanup()
+
+	coinbase, _ := transaction.NewCoinBaseTransaction(&payload.CoinBase{}, 0)
+	coinbase.Outputs = []*transaction.TxOutput{{Value: 100, ProgramHash: client.mainAccount}}
+	prev := Uint256{}
+	client.mu.Lock()
+	for h := uint32(0); h < MaxUndoBlocks+2; h++ {
+		var txns []*transaction.Transaction
+		if h == 0 {
+			txns = append(txns, coinbase)
+		}
+		b := newTestBlock(h, prev, txns...)
+		client.applyBlock(b)
+		prev = b.Hash()
+	}
+	client.mu.Unlock()
+	if len(client.undo) != MaxUndoBlocks {
+		t.Fatalf("%d undo blocks kept, want %d", len(client.undo), MaxUndoBlocks)
+	}
+
+	for i := 0; i < MaxUndoBlocks; i++ {
+		if err := client.rollbackBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if client.currentHeight != 1 || len(client.coins) != 1 {
+		t.Fatalf("wallet is at %d with %d coins, want 1 with 1", client.currentHeight, len(client.coins))
+	}
+
+	// the block is too old to roll back
+	if err := client.rollbackBlock(); err != nil {
+		t.Fatal(err)
+	}
+	if client.currentHeight != -1 || client.blockHash != (Uint256{}) || len(client.coins) != 0 {
+		t.Fatal("wallet is not rebuilt")
+	}
+	if _, total := client.GetHistory(0, 0); total != 0 {
+		t.Fatal("history is kept by the rebuild")
+	}
+}
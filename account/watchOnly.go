@@ -0,0 +1,172 @@
+package account
+
+import (
+	"errors"
+
+	. "Elastos.ELA/common"
+	ct "Elastos.ELA/core/contract"
+	"Elastos.ELA/core/transaction"
+	"Elastos.ELA/crypto"
+)
+
+// WatchOnlyAddress is an address the wallet follows without holding its
+// keys. The redeem script is known when a public key or a script was
+// imported, the transactions spending its coins can then be signed offline.
+type WatchOnlyAddress struct {
+	ProgramHash  Uint168
+	RedeemScript []byte
+}
+
+func NewWatchOnlyAddress(address string) (*WatchOnlyAddress, error) {
+	programHash, err := ToScriptHash(address)
+	if err != nil {
+		return nil, errors.New("invalid address")
+	}
+	return &WatchOnlyAddress{ProgramHash: programHash}, nil
+}
+
+func NewWatchOnlyPublicKey(pubKey *crypto.PubKey) (*WatchOnlyAddress, error) {
+	script, err := ct.CreateSignatureRedeemScript(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewWatchOnlyScript(script)
+}
+
+// NewWatchOnlyScript returns the address of a redeem script, a standard
+// single sign, a multisig or a custom script.
+func NewWatchOnlyScript(script []byte) (*WatchOnlyAddress, error) {
+	var signType int
+	switch (&ct.Contract{Code: script}).GetType() {
+	case ct.SignatureContract:
+		signType = 1
+	case ct.MultiSigContract:
+		signType = 2
+	default:
+		signType = 3
+	}
+	programHash, err := ToCodeHash(script, signType)
+	if err != nil {
+		return nil, err
+	}
+	return &WatchOnlyAddress{ProgramHash: programHash, RedeemScript: script}, nil
+}
+
+// ImportWatchOnly saves the addresses and rebuilds the wallet once so the
+// coins they had already are found. Nothing is imported when one of them is
+// in the wallet already.
+func (client *ClientImpl) ImportWatchOnly(addresses ...*WatchOnlyAddress) error {
+	client.mu.Lock()
+	imported := make(map[Uint168]bool)
+	for _, w := range addresses {
+		if _, ok := client.contracts[w.ProgramHash]; ok {
+			client.mu.Unlock()
+			return errors.New("address is in the wallet already")
+		}
+		if _, ok := client.watchOnly[w.ProgramHash]; ok || imported[w.ProgramHash] {
+			client.mu.Unlock()
+			return errors.New("address is watched already")
+		}
+		imported[w.ProgramHash] = true
+	}
+	for _, w := range addresses {
+		client.watchOnly[w.ProgramHash] = w
+		if err := client.SaveWatchOnlyData(w.ProgramHash, w.RedeemScript); err != nil {
+			client.mu.Unlock()
+			return err
+		}
+	}
+	client.mu.Unlock()
+
+	if len(addresses) == 0 {
+		return nil
+	}
+	return client.Rebuild()
+}
+
+func (client *ClientImpl) DeleteWatchOnly(programHash Uint168) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	delete(client.watchOnly, programHash)
+	for input, coin := range client.coins {
+		if coin.AddressType == WatchOnly && coin.Output.ProgramHash == programHash {
+			delete(client.coins, input)
+		}
+	}
+	if err := client.SaveCoins(); err != nil {
+		return err
+	}
+	return client.DeleteWatchOnlyData(BytesToHexString(programHash.ToArray()))
+}
+
+// LoadWatchOnly loads the watch-only addresses from db to memory
+func (client *ClientImpl) LoadWatchOnly() error {
+	watchOnly := map[Uint168]*WatchOnlyAddress{}
+
+	data, err := client.LoadWatchOnlyData()
+	if err != nil {
+		return err
+	}
+	for _, w := range data {
+		rawHash, _ := HexStringToBytes(w.ProgramHash)
+		programHash, err := Uint168ParseFromBytes(rawHash)
+		if err != nil {
+			return err
+		}
+		script, _ := HexStringToBytes(w.RedeemScript)
+		watchOnly[programHash] = &WatchOnlyAddress{ProgramHash: programHash, RedeemScript: script}
+	}
+
+	client.watchOnly = watchOnly
+	return nil
+}
+
+// GetWatchOnly returns the watch-only addresses of the wallet
+func (client *ClientImpl) GetWatchOnly() []*WatchOnlyAddress {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	watchOnly := []*WatchOnlyAddress{}
+	for _, w := range client.watchOnly {
+		watchOnly = append(watchOnly, w)
+	}
+	return watchOnly
+}
+
+// GetRedeemScript returns the redeem script of a contract or a watch-only
+// address of the wallet, nil when it is unknown.
+func (client *ClientImpl) GetRedeemScript(programHash Uint168) []byte {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if contract, ok := client.contracts[programHash]; ok {
+		return contract.Code
+	}
+	if w, ok := client.watchOnly[programHash]; ok && len(w.RedeemScript) > 0 {
+		return w.RedeemScript
+	}
+	return nil
+}
+
+// walletCoin returns the coin of the output when it pays to the wallet, nil
+// otherwise. The caller holds the lock.
+func (client *ClientImpl) walletCoin(output *transaction.TxOutput, height uint32) *Coin {
+	if contract, ok := client.contracts[output.ProgramHash]; ok {
+		return newCoin(contract, output, height)
+	}
+	if _, ok := client.watchOnly[output.ProgramHash]; ok {
+		return &Coin{Output: output, AddressType: WatchOnly, Height: height}
+	}
+	return nil
+}
+
+// isWalletAddress tells if the program hash is one of the wallet, watch-only
+// included. The caller holds the lock.
+func (client *ClientImpl) isWalletAddress(programHash Uint168) bool {
+	if _, ok := client.contracts[programHash]; ok {
+		return true
+	}
+	_, ok := client.watchOnly[programHash]
+	return ok
+}
@@ -0,0 +1,88 @@
+package account
+
+import (
+	"testing"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/core/transaction"
+)
+
+func TestImportWatchOnly(t *testing.T) {
+	client, cleanup := newTestClient(t)
+	defer cleanup()
+
+	watched := Uint168{0x12, 1}
+	address, _ := watched.ToAddress()
+	first, err := NewWatchOnlyAddress(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewWatchOnlyScript([]byte{0x51})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pay := newTestTransfer([]*transaction.UTXOTxInput{{ReferTxID: Uint256{6}}},
+		&transaction.TxOutput{Value: 7, ProgramHash: watched},
+		&transaction.TxOutput{Value: 3, ProgramHash: client.mainAccount})
+	b0 := newTestBlock(0, Uint256{}, pay)
+	client.mu.Lock()
+	client.applyBlock(b0)
+	client.mu.Unlock()
+	if len(client.coins) != 1 {
+		t.Fatalf("%d coins before the import, want 1", len(client.coins))
+	}
+
+	if err := client.ImportWatchOnly(first, second); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.GetWatchOnly()) != 2 {
+		t.Fatalf("%d watch-only addresses, want 2", len(client.GetWatchOnly()))
+	}
+	if client.currentHeight != -1 || len(client.coins) != 0 {
+		t.Fatal("wallet is not rebuilt by the import")
+	}
+
+	// nothing is imported when an address is known already
+	third, _ := NewWatchOnlyScript([]byte{0x52})
+	if err := client.ImportWatchOnly(third, first); err == nil {
+		t.Fatal("watched address is imported again")
+	}
+	if err := client.ImportWatchOnly(third, third); err == nil {
+		t.Fatal("address is imported twice in a batch")
+	}
+	main, _ := client.mainAccount.ToAddress()
+	own, _ := NewWatchOnlyAddress(main)
+	if err := client.ImportWatchOnly(own); err == nil {
+		t.Fatal("wallet address is imported as watch-only")
+	}
+	if len(client.GetWatchOnly()) != 2 {
+		t.Fatal("a rejected batch is imported in part")
+	}
+
+	// the rescan finds the coin of the watched address
+	client.mu.Lock()
+	client.applyBlock(b0)
+	client.mu.Unlock()
+	var watchOnly, singleSign int
+	for _, coin := range client.GetCoins() {
+		switch {
+		case coin.AddressType == WatchOnly && coin.Output.ProgramHash == watched:
+			watchOnly++
+		case coin.AddressType == SingleSign:
+			singleSign++
+		}
+	}
+	if watchOnly != 1 || singleSign != 1 {
+		t.Fatalf("%d watch-only and %d single sign coins, want 1 and 1", watchOnly, singleSign)
+	}
+
+	opened, err := Open(client.path, []byte("passwd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { opened.isRunning = false }()
+	if len(opened.GetWatchOnly()) != 2 || opened.GetRedeemScript(second.ProgramHash) == nil {
+		t.Fatal("watch-only addresses are not saved")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"strconv"
 
@@ -14,7 +15,17 @@ import (
 )
 
 func Address() string {
-	return "http://localhost" + ":" + strconv.Itoa(config.Parameters.HttpJsonPort)
+	rpcConfig := config.Parameters.RpcConfiguration
+	scheme, host := "http", "localhost"
+	if rpcConfig.EnableTLS {
+		scheme = "https"
+	}
+	if bind := rpcConfig.BindAddress; bind != "" {
+		if ip := net.ParseIP(bind); ip == nil || !ip.IsUnspecified() {
+			host = bind
+		}
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(config.Parameters.HttpJsonPort))
 }
 
 func PrintError(c *cli.Context, err error, cmd string) {
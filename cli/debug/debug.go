@@ -17,7 +17,11 @@ func debugAction(c *cli.Context) (err error) {
 	}
 	level := c.Int("level")
 	if level != -1 {
-		resp, err := httpjsonrpc.Call(Address(), "setdebuginfo", 0, []interface{}{level})
+		params := []interface{}{level}
+		if module := c.String("module"); module != "" {
+			params = append(params, module)
+		}
+		resp, err := httpjsonrpc.Call(Address(), "setdebuginfo", 0, params)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			return err
@@ -38,6 +42,10 @@ func NewCommand() *cli.Command {
 				Usage: "log level 0-6",
 				Value: -1,
 			},
+			cli.StringFlag{
+				Name:  "module, m",
+				Usage: "set the level of one module only: main, ledger, store, net, pow or rpc",
+			},
 		},
 		Action: debugAction,
 		OnUsageError: func(c *cli.Context, err error, isSubcommand bool) error {
@@ -0,0 +1,293 @@
+package offline
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"Elastos.ELA/account"
+	. "Elastos.ELA/cli/common"
+	. "Elastos.ELA/common"
+	"Elastos.ELA/core/transaction"
+	"Elastos.ELA/net/httpjsonrpc"
+
+	"github.com/urfave/cli"
+)
+
+// readPartialTransaction reads the partial transaction in hex from --data or
+// from the file of --file.
+func readPartialTransaction(c *cli.Context) (*transaction.PartialTransaction, error) {
+	data := c.String("data")
+	if file := c.String("file"); file != "" {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		data = string(content)
+	}
+	if data == "" {
+		return nil, errors.New("partial transaction is required with [--data] or [--file]")
+	}
+	raw, err := HexStringToBytes(strings.TrimSpace(data))
+	if err != nil {
+		return nil, errors.New("invalid partial transaction format")
+	}
+	ptx := new(transaction.PartialTransaction)
+	if err := ptx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("invalid partial transaction, %v", err)
+	}
+	return ptx, nil
+}
+
+// writeOutput prints the data in hex, or writes it to the file of --output.
+func writeOutput(c *cli.Context, data []byte) error {
+	if output := c.String("output"); output != "" {
+		return ioutil.WriteFile(output, []byte(BytesToHexString(data)), 0644)
+	}
+	fmt.Println(BytesToHexString(data))
+	return nil
+}
+
+func createTransaction(c *cli.Context) error {
+	asset := c.String("asset")
+	from := c.String("from")
+	to := c.String("to")
+	value := c.String("value")
+	fee := c.String("fee")
+	msg := ""
+	switch {
+	case asset == "":
+		msg = "asset id is required with [--asset]"
+	case from == "":
+		msg = "watch-only sender address is required with [--from]"
+	case to == "":
+		msg = "receiver address is required with [--to]"
+	case value == "":
+		msg = "asset amount is required with [--value]"
+	case fee == "":
+		msg = "tranfer fee is required with [--fee]"
+	}
+	if msg != "" {
+		fmt.Fprintln(os.Stderr, msg)
+		os.Exit(1)
+	}
+	outputs := []interface{}{map[string]interface{}{"Address": to, "Value": value}}
+	resp, err := httpjsonrpc.Call(Address(), "createunsignedtransaction", 0, []interface{}{asset, from, outputs, fee})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	FormatOutput(resp)
+
+	return nil
+}
+
+// checkTransaction shows what the transaction spends and pays, so the signer
+// knows what it signs.
+func checkTransaction(c *cli.Context) error {
+	ptx, err := readPartialTransaction(c)
+	if err != nil {
+		return err
+	}
+	txn := ptx.Transaction
+	hash := txn.Hash()
+	fmt.Printf("Transaction: %s\n", BytesToHexString(hash.ToArrayReverse()))
+
+	balance := make(map[Uint256]Fixed64)
+	fmt.Println("Inputs:")
+	for _, output := range ptx.References {
+		address, _ := output.ProgramHash.ToAddress()
+		fmt.Printf("  %s  %s  %v\n", address, BytesToHexString(output.AssetID.ToArrayReverse()), output.Value)
+		balance[output.AssetID] += output.Value
+	}
+	fmt.Println("Outputs:")
+	for _, output := range txn.Outputs {
+		address, _ := output.ProgramHash.ToAddress()
+		fmt.Printf("  %s  %s  %v\n", address, BytesToHexString(output.AssetID.ToArrayReverse()), output.Value)
+		balance[output.AssetID] -= output.Value
+	}
+	fmt.Println("Fee:")
+	for assetID, value := range balance {
+		fmt.Printf("  %s  %v\n", BytesToHexString(assetID.ToArrayReverse()), value)
+	}
+	fmt.Println("Signatures:")
+	for i, programHash := range ptx.Context.ProgramHashes {
+		address, _ := programHash.ToAddress()
+		have, need := ptx.SignatureCount(i)
+		if need == 0 {
+			fmt.Printf("  %s  [ %v/? ] redeem script unknown\n", address, have)
+			continue
+		}
+		fmt.Printf("  %s  [ %v/%v ]\n", address, have, need)
+	}
+
+	return nil
+}
+
+// signTransaction signs with the keys of a local wallet, no node is needed.
+func signTransaction(c *cli.Context) error {
+	ptx, err := readPartialTransaction(c)
+	if err != nil {
+		return err
+	}
+	wallet, err := account.Open(c.String("wallet"), WalletPassword(c.String("password")))
+	if err != nil {
+		return err
+	}
+	signed := 0
+	for _, acct := range wallet.GetAccounts() {
+		count, err := ptx.Sign(acct)
+		if err != nil {
+			return err
+		}
+		signed += count
+	}
+	if signed == 0 {
+		return errors.New("no available account detected")
+	}
+	fmt.Fprintf(os.Stderr, "%v signature(s) added\n", signed)
+
+	var buffer bytes.Buffer
+	if err := ptx.Serialize(&buffer); err != nil {
+		return err
+	}
+	return writeOutput(c, buffer.Bytes())
+}
+
+func finalizeTransaction(c *cli.Context) ([]byte, error) {
+	ptx, err := readPartialTransaction(c)
+	if err != nil {
+		return nil, err
+	}
+	txn, err := ptx.Finalize()
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	if err := txn.Serialize(&buffer); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func offlineAction(c *cli.Context) error {
+	if c.NumFlags() == 0 {
+		cli.ShowSubcommandHelp(c)
+		return nil
+	}
+
+	var err error
+	switch {
+	case c.Bool("create"):
+		err = createTransaction(c)
+	case c.Bool("check"):
+		err = checkTransaction(c)
+	case c.Bool("sign"):
+		err = signTransaction(c)
+	case c.Bool("finalize"):
+		var raw []byte
+		if raw, err = finalizeTransaction(c); err == nil {
+			err = writeOutput(c, raw)
+		}
+	case c.Bool("send"):
+		var raw []byte
+		if raw, err = finalizeTransaction(c); err == nil {
+			var resp []byte
+			resp, err = httpjsonrpc.Call(Address(), "sendrawtransaction", 0, []interface{}{BytesToHexString(raw)})
+			if err == nil {
+				FormatOutput(resp)
+			}
+		}
+	default:
+		cli.ShowSubcommandHelp(c)
+		return nil
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+func NewCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "offline",
+		Usage: "offline transaction creation, checking, sign and broadcast",
+		Description: "With nodectl offline, you create a transaction of a watch-only address on an online node,\n" +
+			"   sign it with a wallet on a machine without the chain, and send it from any node.",
+		ArgsUsage: "[args]",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "create, c",
+				Usage: "create a partial transaction spending a watch-only address",
+			},
+			cli.BoolFlag{
+				Name:  "check",
+				Usage: "show the inputs, outputs, fee and signatures of a partial transaction",
+			},
+			cli.BoolFlag{
+				Name:  "sign, s",
+				Usage: "sign a partial transaction with the wallet",
+			},
+			cli.BoolFlag{
+				Name:  "finalize",
+				Usage: "make the raw transaction of a fully signed partial transaction",
+			},
+			cli.BoolFlag{
+				Name:  "send",
+				Usage: "finalize a partial transaction and send it to the node",
+			},
+			cli.StringFlag{
+				Name:  "data, d",
+				Usage: "partial transaction in hex",
+			},
+			cli.StringFlag{
+				Name:  "file",
+				Usage: "file of the partial transaction in hex",
+			},
+			cli.StringFlag{
+				Name:  "output, o",
+				Usage: "file to write the result to",
+			},
+			cli.StringFlag{
+				Name:  "wallet, w",
+				Usage: "wallet name",
+				Value: account.WalletFileName,
+			},
+			cli.StringFlag{
+				Name:  "password, p",
+				Usage: "wallet password",
+			},
+			cli.StringFlag{
+				Name:  "asset, a",
+				Usage: "uniq id for asset",
+			},
+			cli.StringFlag{
+				Name:  "from, f",
+				Usage: "watch-only address to spend from",
+			},
+			cli.StringFlag{
+				Name:  "to, t",
+				Usage: "asset to which address",
+			},
+			cli.StringFlag{
+				Name:  "value, v",
+				Usage: "asset amount",
+			},
+			cli.StringFlag{
+				Name:  "fee",
+				Usage: "transfer fee",
+			},
+		},
+		Action: offlineAction,
+		OnUsageError: func(c *cli.Context, err error, isSubcommand bool) error {
+			PrintError(c, err, "offline")
+			return cli.NewExitError("", 1)
+		},
+	}
+}
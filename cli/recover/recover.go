@@ -18,19 +18,40 @@ func recoverAction(c *cli.Context) error {
 	}
 
 	privateKey := c.String("key")
-	if privateKey == "" {
-		fmt.Println("missing -k,--key option")
+	xpub := c.String("xpub")
+	if privateKey == "" && !c.Bool("mnemonic") && xpub == "" {
+		fmt.Println("missing -k,--key, -m,--mnemonic or --xpub option")
 		os.Exit(1)
 	}
+	var mnemonic string
+	if c.Bool("mnemonic") {
+		var err error
+		mnemonic, err = password.GetMnemonic()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if mnemonic == "" {
+			fmt.Println("missing mnemonic words")
+			os.Exit(1)
+		}
+	}
 	newPassword, err := password.GetConfirmedPassword()
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 	newWalletName := fmt.Sprintf("wallet-%s-recovered.dat", time.Now().Format("2006-01-02-15-04-05"))
-	_, err = account.Recover(newWalletName, []byte(newPassword), privateKey)
+	switch {
+	case mnemonic != "":
+		_, err = account.RecoverHD(newWalletName, []byte(newPassword), mnemonic, c.String("passphrase"))
+	case xpub != "":
+		_, err = account.RecoverWatchOnlyHD(newWalletName, []byte(newPassword), xpub)
+	default:
+		_, err = account.Recover(newWalletName, []byte(newPassword), privateKey)
+	}
 	if err != nil {
-		fmt.Println("failed to recover wallet from private key")
+		fmt.Println("failed to recover wallet:", err)
 		os.Exit(1)
 	}
 	fmt.Println("wallet is recovered successfully")
@@ -40,7 +61,7 @@ func recoverAction(c *cli.Context) error {
 func NewCommand() *cli.Command {
 	return &cli.Command{
 		Name:        "recover",
-		Usage:       "recover wallet from private key",
+		Usage:       "recover wallet from private key, mnemonic or extended public key",
 		Description: "With nodectl recover, you could recover your asset.",
 		ArgsUsage:   "[args]",
 		Flags: []cli.Flag{
@@ -48,6 +69,18 @@ func NewCommand() *cli.Command {
 				Name:  "key, k",
 				Usage: "private key",
 			},
+			cli.BoolFlag{
+				Name:  "mnemonic, m",
+				Usage: "recover a hd wallet, the mnemonic words are read from the terminal",
+			},
+			cli.StringFlag{
+				Name:  "passphrase",
+				Usage: "optional passphrase of the mnemonic",
+			},
+			cli.StringFlag{
+				Name:  "xpub",
+				Usage: "extended public key of a hd wallet, the recovered wallet is watch-only",
+			},
 		},
 		Action: recoverAction,
 		OnUsageError: func(c *cli.Context, err error, isSubcommand bool) error {
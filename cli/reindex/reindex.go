@@ -0,0 +1,62 @@
+package reindex
+
+import (
+	"fmt"
+	"os"
+
+	. "Elastos.ELA/cli/common"
+	"Elastos.ELA/core/store/ChainStore"
+	"github.com/urfave/cli"
+)
+
+func reindexAction(c *cli.Context) error {
+	check := c.Bool("check")
+
+	store, err := ChainStore.NewLedgerStore()
+	if err != nil {
+		fmt.Println("failed to open the chain database, make sure the node is stopped:", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	report, err := store.(*ChainStore.ChainStore).CheckIntegrity(!check)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	for _, problem := range report.Problems {
+		fmt.Println(problem)
+	}
+	fmt.Printf("stored height: %d, verified height: %d, problems: %d\n",
+		report.StoredHeight, report.VerifiedHeight, len(report.Problems))
+	if report.Repaired {
+		fmt.Println("chain database is rebuilt")
+	} else if len(report.Problems) > 0 {
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+func NewCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "reindex",
+		Usage: "verify the chain database and rebuild its indexes",
+		Description: "With nodectl reindex, you could verify every stored block against its header chain\n" +
+			"and rebuild the unspent, address history and asset indexes in place.\n" +
+			"The node must be stopped while it runs.",
+		ArgsUsage: "[args]",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "check, c",
+				Usage: "only report the mismatches, do not rebuild",
+			},
+		},
+		Action: reindexAction,
+		OnUsageError: func(c *cli.Context, err error, isSubcommand bool) error {
+			PrintError(c, err, "reindex")
+			return cli.NewExitError("", 1)
+		},
+	}
+}
@@ -0,0 +1,111 @@
+package snapshot
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	. "Elastos.ELA/cli/common"
+	. "Elastos.ELA/common"
+	"Elastos.ELA/core/store/ChainStore"
+	"github.com/urfave/cli"
+)
+
+func snapshotAction(c *cli.Context) error {
+	if c.NumFlags() == 0 {
+		cli.ShowSubcommandHelp(c)
+		return nil
+	}
+	exportFile := c.String("export")
+	importFile := c.String("import")
+	if exportFile == "" && importFile == "" {
+		fmt.Println("missing --export or --import option")
+		os.Exit(1)
+	}
+
+	store, err := ChainStore.NewLedgerStore()
+	if err != nil {
+		fmt.Println("failed to open the chain database, make sure the node is stopped:", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+	chain := store.(*ChainStore.ChainStore)
+
+	if exportFile != "" {
+		_, height, err := chain.CurrentBlock()
+		if err != nil {
+			fmt.Println("no chain in the database:", err)
+			os.Exit(1)
+		}
+		if c.IsSet("height") {
+			height = uint32(c.Uint("height"))
+		}
+		file, err := os.Create(exportFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		w := bufio.NewWriter(file)
+		commitment, err := chain.ExportSnapshot(height, w)
+		if err == nil {
+			err = w.Flush()
+		}
+		file.Close()
+		if err != nil {
+			fmt.Println("failed to export snapshot:", err)
+			os.Remove(exportFile)
+			os.Exit(1)
+		}
+		hash, _ := chain.GetBlockHash(height)
+		fmt.Printf("snapshot of height %d is written to %s\n", height, exportFile)
+		fmt.Println("add this checkpoint to AddCheckpoints to import it:")
+		fmt.Printf("%d:%s:%s\n", height, BytesToHexString(hash.ToArrayReverse()), BytesToHexString(commitment.ToArrayReverse()))
+		return nil
+	}
+
+	file, err := os.Open(importFile)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer file.Close()
+	height, err := chain.ImportSnapshot(bufio.NewReader(file))
+	if err != nil {
+		fmt.Println("failed to import snapshot:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("snapshot is imported, the node will sync from height %d\n", height)
+
+	return nil
+}
+
+func NewCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "snapshot",
+		Usage: "export or import a snapshot of the unspent set",
+		Description: "With nodectl snapshot, you could export the unspent set, asset registry and header chain\n" +
+			"at a height, or bootstrap an empty node from such a snapshot.\n" +
+			"An imported node has no address history below the snapshot height.\n" +
+			"The node must be stopped while it runs.",
+		ArgsUsage: "[args]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "export, e",
+				Usage: "write a snapshot to the file",
+			},
+			cli.UintFlag{
+				Name:  "height",
+				Usage: "height of the exported snapshot, the current height by default",
+			},
+			cli.StringFlag{
+				Name:  "import, i",
+				Usage: "load a snapshot from the file, it must match a checkpoint in AddCheckpoints",
+			},
+		},
+		Action: snapshotAction,
+		OnUsageError: func(c *cli.Context, err error, isSubcommand bool) error {
+			PrintError(c, err, "snapshot")
+			return cli.NewExitError("", 1)
+		},
+	}
+}
@@ -0,0 +1,90 @@
+package wallet
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"Elastos.ELA/account"
+	. "Elastos.ELA/cli/common"
+
+	"github.com/urfave/cli"
+)
+
+func showHistory(wallet account.Client, offset, limit uint32) {
+	records, total := wallet.GetHistory(offset, limit)
+	if total == 0 {
+		fmt.Println("no transactions")
+		return
+	}
+	fmt.Println("Height   Time\t\t\tDirection  Amount\t\tFee\t\tTransaction ID\t\t\t\t\t\t\t\t  Label")
+	fmt.Println("------   ----\t\t\t---------  ------\t\t---\t\t--------------\t\t\t\t\t\t\t\t  -----")
+	for _, r := range records {
+		t := time.Unix(int64(r.Timestamp), 0).Format("2006-01-02 15:04:05")
+		fmt.Printf("%-8d %s\t%-9s  %-14v\t%-10v\t%s  %s\n", r.Height, t, r.Direction, r.Amount, r.Fee, r.TxID, r.Label)
+	}
+	fmt.Printf("%d of %d transactions\n", len(records), total)
+}
+
+func historyAction(c *cli.Context) error {
+	wallet, err := account.Open(c.String("name"), getPassword(c.String("password")))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// label a transaction
+	if label := c.String("label"); label != "" {
+		s := strings.SplitN(label, ":", 2)
+		if len(s) != 2 {
+			fmt.Fprintln(os.Stderr, "--label txid:text")
+			os.Exit(1)
+		}
+		if err := wallet.SetTransactionLabel(s[0], s[1]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return nil
+	}
+
+	showHistory(wallet, uint32(c.Uint("offset")), uint32(c.Uint("limit")))
+	return nil
+}
+
+func newHistoryCommand() cli.Command {
+	return cli.Command{
+		Name:      "history",
+		Usage:     "list the wallet transactions, newest first",
+		ArgsUsage: "[args]",
+		Flags: []cli.Flag{
+			cli.UintFlag{
+				Name:  "offset",
+				Usage: "skip the newest transactions",
+			},
+			cli.UintFlag{
+				Name:  "limit",
+				Usage: "number of transactions to list, 0 for all",
+				Value: 20,
+			},
+			cli.StringFlag{
+				Name:  "label",
+				Usage: "label a transaction, txid:text, an empty text removes the label",
+			},
+			cli.StringFlag{
+				Name:  "name, n",
+				Usage: "wallet name",
+				Value: account.WalletFileName,
+			},
+			cli.StringFlag{
+				Name:  "password, p",
+				Usage: "wallet password",
+			},
+		},
+		Action: historyAction,
+		OnUsageError: func(c *cli.Context, err error, isSubcommand bool) error {
+			PrintError(c, err, "history")
+			return cli.NewExitError("", 1)
+		},
+	}
+}
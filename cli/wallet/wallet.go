@@ -7,6 +7,7 @@ import (
 	"Elastos.ELA/common/password"
 	ct "Elastos.ELA/core/contract"
 	"Elastos.ELA/crypto"
+	"errors"
 	"fmt"
 	"github.com/urfave/cli"
 	"os"
@@ -125,6 +126,51 @@ func showMultisigInfo(wallet account.Client) {
 	}
 }
 
+func showWatchOnlyInfo(wallet *account.ClientImpl) {
+	coins := wallet.GetCoins()
+	for _, w := range wallet.GetWatchOnly() {
+		assets := make(map[Uint256]Fixed64)
+		for _, out := range coins {
+			if out.AddressType == account.WatchOnly && out.Output.ProgramHash == w.ProgramHash {
+				assets[out.Output.AssetID] += out.Output.Value
+			}
+		}
+		address, _ := w.ProgramHash.ToAddress()
+		fmt.Println("-----------------------------------------------------------------------------------")
+		fmt.Printf("Address: %s\n", address)
+		if len(w.RedeemScript) > 0 {
+			fmt.Printf("Redeem script: %s\n", BytesToHexString(w.RedeemScript))
+		}
+		if len(assets) != 0 {
+			fmt.Println(" ID   Asset ID\t\t\t\t\t\t\t\tAmount")
+			fmt.Println("----  --------\t\t\t\t\t\t\t\t------")
+			i := 0
+			for id, value := range assets {
+				fmt.Printf("%4s  %s  %v\n", strconv.Itoa(i), BytesToHexString(id.ToArrayReverse()), value)
+				i++
+			}
+		}
+		fmt.Println("-----------------------------------------------------------------------------------")
+	}
+}
+
+// parseWatchOnly parses an address, a public key or a redeem script in hex
+func parseWatchOnly(item string) (*account.WatchOnlyAddress, error) {
+	if _, err := ToScriptHash(item); err == nil {
+		return account.NewWatchOnlyAddress(item)
+	}
+	data, err := HexStringToBytes(item)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("not an address, a public key or a redeem script: " + item)
+	}
+	if len(data) == crypto.COMPRESSEDLEN || len(data) == crypto.NOCOMPRESSEDLEN {
+		if pubKey, err := crypto.DecodePoint(data); err == nil {
+			return account.NewWatchOnlyPublicKey(pubKey)
+		}
+	}
+	return account.NewWatchOnlyScript(data)
+}
+
 func showBalancesInfo(wallet account.Client) {
 	coins := wallet.GetCoins()
 	assets := make(map[Uint256]Fixed64)
@@ -230,20 +276,27 @@ func walletAction(c *cli.Context) error {
 			fmt.Printf("CAUTION: '%s' already exists!\n", name)
 			os.Exit(1)
 		} else {
-			wallet, err := account.Create(name, getConfirmedPassword(passwd))
+			mnemonic, err := crypto.NewMnemonic(account.MnemonicBits)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			wallet, err := account.CreateHD(name, getConfirmedPassword(passwd), mnemonic, c.String("passphrase"))
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
 				os.Exit(1)
 			}
 			showAccountsInfo(wallet)
+			fmt.Println("\nWrite down the mnemonic words, the wallet can be recovered with them:")
+			fmt.Println(mnemonic)
 		}
 		return nil
 	}
 
 	// list wallet info
 	if item := c.String("list"); item != "" {
-		if item != "account" && item != "balance" && item != "verbose" && item != "multisig" && item != "script" {
-			fmt.Fprintln(os.Stderr, "--list [account | balance | verbose | multisig | script]")
+		if item != "account" && item != "balance" && item != "verbose" && item != "multisig" && item != "script" && item != "watchonly" && item != "xpub" {
+			fmt.Fprintln(os.Stderr, "--list [account | balance | verbose | multisig | script | watchonly | xpub]")
 			os.Exit(1)
 		} else {
 			wallet, err := account.Open(name, getPassword(passwd))
@@ -262,6 +315,14 @@ func walletAction(c *cli.Context) error {
 				showMultisigInfo(wallet)
 			case "script":
 				showScriptInfo(wallet)
+			case "watchonly":
+				showWatchOnlyInfo(wallet)
+			case "xpub":
+				if xpub := wallet.GetExtendedPublicKey(); xpub != "" {
+					fmt.Println(xpub)
+				} else {
+					fmt.Println("not a hd wallet")
+				}
 			}
 		}
 		return nil
@@ -390,6 +451,48 @@ func walletAction(c *cli.Context) error {
 		return nil
 	}
 
+	// watch-only addresses
+	if items := c.String("importwatchonly"); items != "" {
+		// the wallet is rescanned once for all the items
+		var addresses []*account.WatchOnlyAddress
+		for _, item := range strings.Split(items, ":") {
+			w, err := parseWatchOnly(item)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			addresses = append(addresses, w)
+		}
+		wallet, err := account.Open(name, getPassword(passwd))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := wallet.ImportWatchOnly(addresses...); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%d watch-only addresses imported, the wallet will rescan the chain\n", len(addresses))
+		return nil
+	}
+	if address := c.String("removewatchonly"); address != "" {
+		programHash, err := ToScriptHash(address)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "invalid address")
+			os.Exit(1)
+		}
+		wallet, err := account.Open(name, getPassword(passwd))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := wallet.DeleteWatchOnly(programHash); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return nil
+	}
+
 	// change password
 	if c.Bool("changepassword") {
 		fmt.Printf("Wallet File: '%s'\n", name)
@@ -465,7 +568,11 @@ func NewCommand() *cli.Command {
 			},
 			cli.StringFlag{
 				Name:  "list, l",
-				Usage: "list wallet information [account, balance, verbose, multisig, script]",
+				Usage: "list wallet information [account, balance, verbose, multisig, script, watchonly, xpub]",
+			},
+			cli.StringFlag{
+				Name:  "passphrase",
+				Usage: "optional passphrase of the mnemonic of a new wallet",
 			},
 			cli.IntFlag{
 				Name:  "addaccount",
@@ -487,6 +594,14 @@ func NewCommand() *cli.Command {
 				Name:  "hash",
 				Usage: "customize secret hash",
 			},
+			cli.StringFlag{
+				Name:  "importwatchonly",
+				Usage: "import addresses, public keys or redeem scripts as watch-only, separated by ':'",
+			},
+			cli.StringFlag{
+				Name:  "removewatchonly",
+				Usage: "remove a watch-only address",
+			},
 			cli.BoolFlag{
 				Name:  "changepassword",
 				Usage: "change wallet password",
@@ -505,6 +620,9 @@ func NewCommand() *cli.Command {
 				Usage: "wallet password",
 			},
 		},
+		Subcommands: []cli.Command{
+			newHistoryCommand(),
+		},
 		Action: walletAction,
 		OnUsageError: func(c *cli.Context, err error, isSubcommand bool) error {
 			PrintError(c, err, "wallet")
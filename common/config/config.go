@@ -7,6 +7,7 @@ import (
 	"log"
 	"math/big"
 	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -14,6 +15,7 @@ const (
 	DefaultConfigFilename = "./config.json"
 	MINGENBLOCKTIME       = 2
 	DEFAULTGENBLOCKTIME   = 6
+	MINPRUNEDEPTH         = 288
 )
 
 var (
@@ -64,6 +66,35 @@ type PowConfiguration struct {
 	MinerInfo        string `json:"MinerInfo"`
 	MinTxFee         int    `json:"MinTxFee"`
 	ActiveNet        string `json:"ActiveNet"`
+
+	StratumStart      bool          `json:"StratumStart"`
+	StratumAddress    string        `json:"StratumAddress"`
+	StratumPort       int           `json:"StratumPort"`
+	StratumDifficulty float64       `json:"StratumDifficulty"`
+	StratumUsers      []StratumUser `json:"StratumUsers"`
+}
+
+// StratumUser is an account of the stratum server, its workers authorize as
+// "<user>" or "<user>.<worker>" with the password.
+type StratumUser struct {
+	User     string `json:"User"`
+	Password string `json:"Password"`
+}
+
+// RpcUser is an account of the JSON-RPC server. Methods lists the methods
+// and method groups ("@read", "@send", "@mining", "@wallet", "@admin") the
+// user may call, an empty list allows all methods.
+type RpcUser struct {
+	User     string   `json:"User"`
+	Password string   `json:"Password"`
+	Methods  []string `json:"Methods"`
+}
+
+type RpcConfiguration struct {
+	BindAddress string    `json:"BindAddress"`
+	EnableTLS   bool      `json:"EnableTLS"`
+	CookieFile  string    `json:"CookieFile"`
+	Users       []RpcUser `json:"Users"`
 }
 
 type Configuration struct {
@@ -75,6 +106,9 @@ type Configuration struct {
 	RestKeyPath         string           `json:"RestKeyPath"`
 	HttpInfoPort        uint16           `json:"HttpInfoPort"`
 	HttpInfoStart       bool             `json:"HttpInfoStart"`
+	HttpMetricsPort     uint16           `json:"HttpMetricsPort"`
+	HttpMetricsAddress  string           `json:"HttpMetricsAddress"`
+	HttpMetricsStart    bool             `json:"HttpMetricsStart"`
 	HttpWsPort          int              `json:"HttpWsPort"`
 	WsHeartbeatInterval time.Duration    `json:"WsHeartbeatInterval"`
 	HttpJsonPort        int              `json:"HttpJsonPort"`
@@ -90,14 +124,25 @@ type Configuration struct {
 	GenBlockTime        uint             `json:"GenBlockTime"`
 	MultiCoreNum        uint             `json:"MultiCoreNum"`
 	MaxLogSize          int64            `json:"MaxLogSize"`
+	MaxLogFiles         int              `json:"MaxLogFiles"`
+	LogRotateHours      int              `json:"LogRotateHours"`
+	LogFormat           string           `json:"LogFormat"`
+	LogLevels           map[string]int   `json:"LogLevels"`
 	MaxTxInBlock        int              `json:"MaxTransactionInBlock"`
 	MaxBlockSize        int              `json:"MaxBlockSize"`
+	MaxTxPoolSize       int              `json:"MaxTxPoolSize"`
+	MaxTxPoolCount      int              `json:"MaxTxPoolCount"`
+	TxPoolExpiry        uint             `json:"TxPoolExpiry"`
+	DataDir             string           `json:"DataDir"`
+	StoreBackend        string           `json:"StoreBackend"`
+	PruneDepth          uint32           `json:"PruneDepth"`
 	PowConfiguration    PowConfiguration `json:"PowConfiguration"`
+	RpcConfiguration    RpcConfiguration `json:"RpcConfiguration"`
 	MaxHdrSyncReqs      int              `json:"MaxConcurrentSyncHeaderReqs"`
 	DefaultMaxPeers     uint             `json:"DefaultMaxPeers"`
 	GetAddrMax          uint             `json:"GetAddrMax"`
 	MaxOutboundCnt      uint             `json:"MaxOutboundCnt"`
-	//AddCheckpoints format: "<height>:<hash>"
+	//AddCheckpoints format: "<height>:<hash>[:<snapshot hash>]"
 	AddCheckpoints []string `json:"AddCheckpoints"`
 }
 
@@ -146,5 +191,14 @@ func init() {
 	} else if Parameters.PowConfiguration.ActiveNet == "RegNet" {
 		Parameters.ChainParam = regNet
 	}
+	if Parameters.PruneDepth > 0 && Parameters.PruneDepth < MINPRUNEDEPTH {
+		Parameters.PruneDepth = MINPRUNEDEPTH
+	}
+
+}
 
+// DataPath returns the path of the file name in DataDir, the working
+// directory is used when DataDir is not set.
+func DataPath(name string) string {
+	return filepath.Join(Parameters.DataDir, name)
 }
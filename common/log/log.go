@@ -3,6 +3,7 @@ package log
 import (
 	"Elastos.ELA/common/config"
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -11,8 +12,11 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -48,9 +52,85 @@ var (
 		fatalLog: Color(Red, "[FATAL]"),
 		traceLog: Color(Pink, "[TRACE]"),
 	}
+	levelNames = map[int]string{
+		debugLog: "debug",
+		infoLog:  "info",
+		warnLog:  "warn",
+		errorLog: "error",
+		fatalLog: "fatal",
+		traceLog: "trace",
+	}
 	Stdout = os.Stdout
 )
 
+// The modules a log line can belong to, the level of each can be set on its
+// own with LogLevels in the configuration or SetModuleLevel.
+const (
+	MainModule   = "main"
+	LedgerModule = "ledger"
+	StoreModule  = "store"
+	NetModule    = "net"
+	PowModule    = "pow"
+	RpcModule    = "rpc"
+)
+
+var Modules = []string{MainModule, LedgerModule, StoreModule, NetModule, PowModule, RpcModule}
+
+// modulePackages maps package paths to modules, the first matching prefix
+// is used and packages matching none belong to MainModule.
+var modulePackages = []struct {
+	prefix string
+	module string
+}{
+	{"Elastos.ELA/core/store", StoreModule},
+	{"Elastos.ELA/core", LedgerModule},
+	{"Elastos.ELA/net/httpjsonrpc", RpcModule},
+	{"Elastos.ELA/net/httprestful", RpcModule},
+	{"Elastos.ELA/net/httpwebsocket", RpcModule},
+	{"Elastos.ELA/net/httpmetrics", RpcModule},
+	{"Elastos.ELA/net", NetModule},
+	{"Elastos.ELA/consensus", PowModule},
+}
+
+// moduleCache keeps the module of each calling pc.
+var moduleCache sync.Map
+
+func moduleOfPC(pc uintptr) string {
+	if m, ok := moduleCache.Load(pc); ok {
+		return m.(string)
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	module := moduleOfFunc(frame.Function)
+	moduleCache.Store(pc, module)
+	return module
+}
+
+// moduleOfFunc returns the module of the package of a fully qualified
+// function name.
+func moduleOfFunc(name string) string {
+	// the package path ends at the first dot after the last slash
+	pkg := name
+	if i := strings.IndexByte(name[strings.LastIndexByte(name, '/')+1:], '.'); i >= 0 {
+		pkg = name[:strings.LastIndexByte(name, '/')+1+i]
+	}
+	for _, mp := range modulePackages {
+		if pkg == mp.prefix || strings.HasPrefix(pkg, mp.prefix+"/") {
+			return mp.module
+		}
+	}
+	return MainModule
+}
+
+// callerModule returns the module of the function calling the log function
+// that calls it.
+func callerModule() string {
+	pc := make([]uintptr, 1)
+	if runtime.Callers(3, pc) == 0 {
+		return MainModule
+	}
+	return moduleOfPC(pc[0])
+}
+
 const (
 	namePrefix        = "LEVEL"
 	callDepth         = 2
@@ -58,6 +138,8 @@ const (
 	byteToMb          = 1024 * 1024
 	byteToKb          = 1024
 	Path              = "./Log/"
+	logFileSuffix     = "_LOG.log"
+	JSONFormat        = "json"
 )
 
 func GetGID() uint64 {
@@ -92,50 +174,136 @@ func NameLevel(name string) int {
 }
 
 type Logger struct {
+	sync.RWMutex
 	level   int
-	logger  *log.Logger
-	logFile *os.File
+	modules map[string]int // levels of the modules that do not use level
+	// minLevel is the lowest level any module logs at, the package level
+	// functions check it before looking up the module of the caller
+	minLevel int32
+	json     bool
+	out      io.Writer
+	logger   *log.Logger
+	logFile  *rotatingFile
 }
 
-func New(out io.Writer, prefix string, flag, level int, file *os.File) *Logger {
+func New(out io.Writer, prefix string, flag, level int) *Logger {
 	return &Logger{
-		level:   level,
-		logger:  log.New(out, prefix, flag),
-		logFile: file,
+		level:    level,
+		modules:  make(map[string]int),
+		minLevel: int32(level),
+		out:      out,
+		logger:   log.New(out, prefix, flag),
 	}
 }
 
+func validLevel(level int) bool {
+	return level >= 0 && level <= maxLevelLog
+}
+
+// SetDebugLevel sets the level of the modules that have no level of their
+// own.
 func (l *Logger) SetDebugLevel(level int) error {
-	if level > maxLevelLog || level < 0 {
+	if !validLevel(level) {
 		return errors.New("Invalid Debug Level")
 	}
 
+	l.Lock()
 	l.level = level
+	l.updateMinLevel()
+	l.Unlock()
 	return nil
 }
 
-func (l *Logger) Output(level int, a ...interface{}) error {
-	if level >= l.level {
-		gid := GetGID()
-		gidStr := strconv.FormatUint(gid, 10)
+// SetModuleLevel sets the level of a single module.
+func (l *Logger) SetModuleLevel(module string, level int) error {
+	if !validLevel(level) {
+		return errors.New("Invalid Debug Level")
+	}
+	for _, m := range Modules {
+		if m == module {
+			l.Lock()
+			l.modules[module] = level
+			l.updateMinLevel()
+			l.Unlock()
+			return nil
+		}
+	}
+	return errors.New("Unknown log module " + module)
+}
+
+// updateMinLevel recomputes minLevel, the caller must hold the lock.
+func (l *Logger) updateMinLevel() {
+	min := l.level
+	for _, level := range l.modules {
+		if level < min {
+			min = level
+		}
+	}
+	atomic.StoreInt32(&l.minLevel, int32(min))
+}
 
-		a = append([]interface{}{LevelName(level), "GID",
-			gidStr + ","}, a...)
+// disabled reports whether no module logs at level.
+func (l *Logger) disabled(level int) bool {
+	return level < int(atomic.LoadInt32(&l.minLevel))
+}
 
-		return l.logger.Output(callDepth, fmt.Sprintln(a...))
+// GetModuleLevel returns the level in effect for module.
+func (l *Logger) GetModuleLevel(module string) int {
+	l.RLock()
+	defer l.RUnlock()
+	if level, ok := l.modules[module]; ok {
+		return level
 	}
-	return nil
+	return l.level
 }
 
-func (l *Logger) Outputf(level int, format string, v ...interface{}) error {
-	if level >= l.level {
-		gid := GetGID()
-		v = append([]interface{}{LevelName(level), "GID",
-			gid}, v...)
+func (l *Logger) enabled(module string, level int) bool {
+	return level >= l.GetModuleLevel(module)
+}
 
-		return l.logger.Output(callDepth, fmt.Sprintf("%s %s %d, "+format+"\n", v...))
+func (l *Logger) write(module string, level int, msg string) error {
+	gid := GetGID()
+	if !l.json {
+		return l.logger.Output(callDepth+1, fmt.Sprintf("%s [%s] GID %d, %s", LevelName(level), module, gid, msg))
 	}
-	return nil
+	name, ok := levelNames[level]
+	if !ok {
+		name = strings.ToLower(namePrefix) + strconv.Itoa(level)
+	}
+	line, err := json.Marshal(struct {
+		Time   string `json:"time"`
+		Level  string `json:"level"`
+		Module string `json:"module"`
+		GID    uint64 `json:"gid"`
+		Msg    string `json:"msg"`
+	}{time.Now().Format(time.RFC3339Nano), name, module, gid, strings.TrimSuffix(msg, "\n")})
+	if err != nil {
+		return err
+	}
+	_, err = l.out.Write(append(line, '\n'))
+	return err
+}
+
+func (l *Logger) output(module string, level int, a ...interface{}) error {
+	if !l.enabled(module, level) {
+		return nil
+	}
+	return l.write(module, level, fmt.Sprintln(a...))
+}
+
+func (l *Logger) outputf(module string, level int, format string, v ...interface{}) error {
+	if !l.enabled(module, level) {
+		return nil
+	}
+	return l.write(module, level, fmt.Sprintf(format+"\n", v...))
+}
+
+func (l *Logger) Output(level int, a ...interface{}) error {
+	return l.output(MainModule, level, a...)
+}
+
+func (l *Logger) Outputf(level int, format string, v ...interface{}) error {
+	return l.outputf(MainModule, level, format, v...)
 }
 
 func (l *Logger) Trace(a ...interface{}) {
@@ -186,135 +354,310 @@ func (l *Logger) Fatalf(format string, a ...interface{}) {
 	l.Outputf(fatalLog, format, a...)
 }
 
+// caller returns the function name, file and line of the caller of the log
+// function calling it.
+func caller() (string, string, int) {
+	pc := make([]uintptr, 1)
+	runtime.Callers(3, pc)
+	frame, _ := runtime.CallersFrames(pc).Next()
+	return frame.Function, filepath.Base(frame.File), frame.Line
+}
+
 func Trace(a ...interface{}) {
-	if traceLog < Log.level {
+	if Log.disabled(traceLog) {
+		return
+	}
+	module := callerModule()
+	if !Log.enabled(module, traceLog) {
 		return
 	}
 
-	pc := make([]uintptr, 10)
-	runtime.Callers(2, pc)
-	f := runtime.FuncForPC(pc[0])
-	file, line := f.FileLine(pc[0])
-	fileName := filepath.Base(file)
-
-	nameFull := f.Name()
+	nameFull, fileName, line := caller()
 	nameEnd := filepath.Ext(nameFull)
 	funcName := strings.TrimPrefix(nameEnd, ".")
 
 	a = append([]interface{}{funcName + "()", fileName + ":" + strconv.Itoa(line)}, a...)
 
-	Log.Trace(a...)
+	Log.output(module, traceLog, a...)
 }
 
 func Tracef(format string, a ...interface{}) {
-	if traceLog < Log.level {
+	if Log.disabled(traceLog) {
+		return
+	}
+	module := callerModule()
+	if !Log.enabled(module, traceLog) {
 		return
 	}
 
-	pc := make([]uintptr, 10)
-	runtime.Callers(2, pc)
-	f := runtime.FuncForPC(pc[0])
-	file, line := f.FileLine(pc[0])
-	fileName := filepath.Base(file)
-
-	nameFull := f.Name()
+	nameFull, fileName, line := caller()
 	nameEnd := filepath.Ext(nameFull)
 	funcName := strings.TrimPrefix(nameEnd, ".")
 
 	a = append([]interface{}{funcName, fileName, line}, a...)
 
-	Log.Tracef("%s() %s:%d "+format, a...)
+	Log.outputf(module, traceLog, "%s() %s:%d "+format, a...)
 }
 
 func Debug(a ...interface{}) {
-	if debugLog < Log.level {
+	if Log.disabled(debugLog) {
+		return
+	}
+	module := callerModule()
+	if !Log.enabled(module, debugLog) {
 		return
 	}
 
-	pc := make([]uintptr, 10)
-	runtime.Callers(2, pc)
-	f := runtime.FuncForPC(pc[0])
-	file, line := f.FileLine(pc[0])
-	fileName := filepath.Base(file)
-
-	a = append([]interface{}{f.Name(), fileName + ":" + strconv.Itoa(line)}, a...)
+	funcName, fileName, line := caller()
+	a = append([]interface{}{funcName, fileName + ":" + strconv.Itoa(line)}, a...)
 
-	Log.Debug(a...)
+	Log.output(module, debugLog, a...)
 }
 
 func Debugf(format string, a ...interface{}) {
-	if debugLog < Log.level {
+	if Log.disabled(debugLog) {
+		return
+	}
+	module := callerModule()
+	if !Log.enabled(module, debugLog) {
 		return
 	}
 
-	pc := make([]uintptr, 10)
-	runtime.Callers(2, pc)
-	f := runtime.FuncForPC(pc[0])
-	file, line := f.FileLine(pc[0])
-	fileName := filepath.Base(file)
-
-	a = append([]interface{}{f.Name(), fileName, line}, a...)
+	funcName, fileName, line := caller()
+	a = append([]interface{}{funcName, fileName, line}, a...)
 
-	Log.Debugf("%s %s:%d "+format, a...)
+	Log.outputf(module, debugLog, "%s %s:%d "+format, a...)
 }
 
 func Info(a ...interface{}) {
-	Log.Info(a...)
+	if Log.disabled(infoLog) {
+		return
+	}
+	Log.output(callerModule(), infoLog, a...)
 }
 
 func Warn(a ...interface{}) {
-	Log.Warn(a...)
+	if Log.disabled(warnLog) {
+		return
+	}
+	Log.output(callerModule(), warnLog, a...)
 }
 
 func Error(a ...interface{}) {
-	Log.Error(a...)
+	if Log.disabled(errorLog) {
+		return
+	}
+	Log.output(callerModule(), errorLog, a...)
 }
 
 func Fatal(a ...interface{}) {
-	Log.Fatal(a...)
+	if Log.disabled(fatalLog) {
+		return
+	}
+	Log.output(callerModule(), fatalLog, a...)
 }
 
 func Infof(format string, a ...interface{}) {
-	Log.Infof(format, a...)
+	if Log.disabled(infoLog) {
+		return
+	}
+	Log.outputf(callerModule(), infoLog, format, a...)
 }
 
 func Warnf(format string, a ...interface{}) {
-	Log.Warnf(format, a...)
+	if Log.disabled(warnLog) {
+		return
+	}
+	Log.outputf(callerModule(), warnLog, format, a...)
 }
 
 func Errorf(format string, a ...interface{}) {
-	Log.Errorf(format, a...)
+	if Log.disabled(errorLog) {
+		return
+	}
+	Log.outputf(callerModule(), errorLog, format, a...)
 }
 
 func Fatalf(format string, a ...interface{}) {
-	Log.Fatalf(format, a...)
+	if Log.disabled(fatalLog) {
+		return
+	}
+	Log.outputf(callerModule(), fatalLog, format, a...)
 }
 
 func FileOpen(path string) (*os.File, error) {
+	if err := makeLogDir(path); err != nil {
+		return nil, err
+	}
+
+	var currenttime string = time.Now().Format("2006-01-02_15.04.05")
+
+	logfile, _, err := createLogFile(path, currenttime, 0)
+	return logfile, err
+}
+
+func makeLogDir(path string) error {
 	if fi, err := os.Stat(path); err == nil {
 		if !fi.IsDir() {
-			return nil, fmt.Errorf("open %s: not a directory", path)
+			return fmt.Errorf("open %s: not a directory", path)
 		}
 	} else if os.IsNotExist(err) {
 		if err := os.MkdirAll(path, 0766); err != nil {
-			return nil, err
+			return err
 		}
 	} else {
+		return err
+	}
+	return nil
+}
+
+// createLogFile creates the log file of the time with the lowest free
+// counter from n on and returns the counter, the first file of a time has
+// none. A file rotated within the same second gets a counter, reopening the
+// full file would never rotate it.
+func createLogFile(path, currenttime string, n int) (*os.File, int, error) {
+	for ; ; n++ {
+		name := path + currenttime + logFileSuffix
+		if n > 0 {
+			name = path + currenttime + "_" + strconv.Itoa(n) + logFileSuffix
+		}
+		logfile, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			return logfile, n, nil
+		}
+		if !os.IsExist(err) {
+			return nil, 0, err
+		}
+	}
+}
+
+// logFileOrder returns the creation time and the counter in the name of a
+// log file.
+func logFileOrder(name string) (string, int) {
+	base := strings.TrimSuffix(name, logFileSuffix)
+	// the time has one underscore, a counter adds a second one
+	if parts := strings.Split(base, "_"); len(parts) == 3 {
+		n, _ := strconv.Atoi(parts[2])
+		return parts[0] + "_" + parts[1], n
+	}
+	return base, 0
+}
+
+// rotatingFile is a log file that is replaced by a new one once it is
+// larger than MaxLogSize or older than LogRotateHours, only the newest
+// MaxLogFiles files are kept.
+type rotatingFile struct {
+	sync.Mutex
+	path     string
+	file     *os.File
+	size     int64
+	opened   time.Time
+	stamp    string // the time in the name of file
+	seq      int    // the counter in the name of file
+	maxSize  int64
+	interval time.Duration
+	keep     int
+}
+
+func newRotatingFile(path string) (*rotatingFile, error) {
+	f := &rotatingFile{
+		path:     path,
+		maxSize:  GetMaxLogChangeInterval(),
+		interval: time.Duration(config.Parameters.LogRotateHours) * time.Hour,
+		keep:     config.Parameters.MaxLogFiles,
+	}
+	if err := f.open(); err != nil {
 		return nil, err
 	}
+	return f, nil
+}
 
-	var currenttime string = time.Now().Format("2006-01-02_15.04.05")
+func (f *rotatingFile) open() error {
+	if err := makeLogDir(f.path); err != nil {
+		return err
+	}
+	// the counter goes on from the previous file of the same second, the
+	// lower ones may have been removed already
+	currenttime := time.Now().Format("2006-01-02_15.04.05")
+	seq := 0
+	if f.file != nil && currenttime == f.stamp {
+		seq = f.seq + 1
+	}
+	file, seq, err := createLogFile(f.path, currenttime, seq)
+	if err != nil {
+		return err
+	}
+	f.stamp, f.seq = currenttime, seq
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	f.removeOldFiles()
+	return nil
+}
 
-	logfile, err := os.OpenFile(path+currenttime+"_LOG.log", os.O_RDWR|os.O_CREATE, 0666)
+func (f *rotatingFile) removeOldFiles() {
+	if f.keep <= 0 {
+		return
+	}
+	entries, err := ioutil.ReadDir(f.path)
 	if err != nil {
-		return nil, err
+		return
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), logFileSuffix) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ti, ni := logFileOrder(names[i])
+		tj, nj := logFileOrder(names[j])
+		return ti < tj || ti == tj && ni < nj
+	})
+	current := filepath.Base(f.file.Name())
+	for i := 0; i < len(names)-f.keep; i++ {
+		if names[i] != current {
+			os.Remove(filepath.Join(f.path, names[i]))
+		}
 	}
-	return logfile, nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.size+int64(len(p)) > f.maxSize || (f.interval > 0 && time.Since(f.opened) > f.interval) {
+		old := f.file
+		if err := f.open(); err == nil {
+			old.Close()
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) Close() error {
+	f.Lock()
+	defer f.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
 }
 
 func Init(a ...interface{}) {
 	writers := []io.Writer{}
-	var logFile *os.File
+	var logFile *rotatingFile
 	var err error
 	if len(a) == 0 {
 		writers = append(writers, ioutil.Discard)
@@ -322,7 +665,7 @@ func Init(a ...interface{}) {
 		for _, o := range a {
 			switch o.(type) {
 			case string:
-				logFile, err = FileOpen(o.(string))
+				logFile, err = newRotatingFile(o.(string))
 				if err != nil {
 					fmt.Println("error: open log file failed")
 					os.Exit(1)
@@ -338,15 +681,14 @@ func Init(a ...interface{}) {
 	}
 	fileAndStdoutWrite := io.MultiWriter(writers...)
 	var printlevel = config.Parameters.PrintLevel
-	Log = New(fileAndStdoutWrite, "", log.Ldate|log.Lmicroseconds, printlevel, logFile)
-}
-
-func GetLogFileSize() (int64, error) {
-	f, e := Log.logFile.Stat()
-	if e != nil {
-		return 0, e
+	Log = New(fileAndStdoutWrite, "", log.Ldate|log.Lmicroseconds, printlevel)
+	Log.logFile = logFile
+	Log.json = config.Parameters.LogFormat == JSONFormat
+	for module, level := range config.Parameters.LogLevels {
+		if err := Log.SetModuleLevel(module, level); err != nil {
+			fmt.Println("error: LogLevels:", err)
+		}
 	}
-	return f.Size(), nil
 }
 
 func GetMaxLogChangeInterval() int64 {
@@ -357,19 +699,6 @@ func GetMaxLogChangeInterval() int64 {
 	}
 }
 
-func CheckIfNeedNewFile() bool {
-	logFileSize, err := GetLogFileSize()
-	maxLogFileSize := GetMaxLogChangeInterval()
-	if err != nil {
-		return false
-	}
-	if logFileSize > maxLogFileSize {
-		return true
-	} else {
-		return false
-	}
-}
-
 func ClosePrintLog() error {
 	var err error
 	if Log.logFile != nil {
@@ -1,30 +1,198 @@
 package log
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDebugPrint(t *testing.T) {
-	CreatePrintLog("./")
+	Init(Stdout)
 	Debug("debug testing")
 }
 
 func TestInfoPrint(t *testing.T) {
-	CreatePrintLog("./")
+	Init(Stdout)
 	Info("Info testing")
 }
 
 func TestWarningPrint(t *testing.T) {
-	CreatePrintLog("./")
+	Init(Stdout)
 	Warn("Warning testing")
 }
 
 func TestErrorPrint(t *testing.T) {
-	CreatePrintLog("./")
+	Init(Stdout)
 	Error("Error testing")
 }
 
 func TestFatalPrint(t *testing.T) {
-	CreatePrintLog("./")
+	Init(Stdout)
 	Fatal("Fatal testing")
 }
+
+func TestModuleOfFunc(t *testing.T) {
+	for name, want := range map[string]string{
+		"main.main": MainModule,
+		"Elastos.ELA/core/ledger.(*Blockchain).AddBlock":            LedgerModule,
+		"Elastos.ELA/core/store/ChainStore.(*ChainStore).persist":   StoreModule,
+		"Elastos.ELA/net/node.(*node).Tx":                           NetModule,
+		"Elastos.ELA/net/httpjsonrpc.StartRPCServer":                RpcModule,
+		"Elastos.ELA/net/httprestful/restful.(*restServer).Start":   RpcModule,
+		"Elastos.ELA/net/httpwebsocket/websocket.(*WsServer).Start": RpcModule,
+		"Elastos.ELA/net/httpmetrics.StartServer":                   RpcModule,
+		"Elastos.ELA/net/httpnodeinfo.StartServer":                  NetModule,
+		"Elastos.ELA/consensus/pow.(*PowService).GenerateBlock":     PowModule,
+		"Elastos.ELA/consensusx.Start":                              MainModule,
+		"Elastos.ELA/common/log.TestModuleOfFunc.func1":             MainModule,
+	} {
+		if module := moduleOfFunc(name); module != want {
+			t.Errorf("module of %s is %s, want %s", name, module, want)
+		}
+	}
+}
+
+func TestModuleLevels(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "", 0, infoLog)
+	if err := l.SetModuleLevel(NetModule, debugLog); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetModuleLevel("wallet", debugLog); err == nil {
+		t.Fatal("level of an unknown module is set")
+	}
+	if l.disabled(debugLog) {
+		t.Fatal("debug lines are disabled while a module logs them")
+	}
+
+	l.output(LedgerModule, debugLog, "ledger debug")
+	l.output(NetModule, debugLog, "net debug")
+	l.output(LedgerModule, infoLog, "ledger info")
+	out := buf.String()
+	if strings.Contains(out, "ledger debug") {
+		t.Fatal("module without a level of its own logs below the default level")
+	}
+	if !strings.Contains(out, "[net] GID") || !strings.Contains(out, "net debug") || !strings.Contains(out, "ledger info") {
+		t.Fatalf("unexpected output %q", out)
+	}
+
+	l.SetDebugLevel(errorLog)
+	if l.GetModuleLevel(LedgerModule) != errorLog || l.GetModuleLevel(NetModule) != debugLog {
+		t.Fatal("default level overrides the level of a module")
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "", 0, infoLog)
+	l.json = true
+	l.outputf(PowModule, warnLog, "block %d", 7)
+
+	var line struct {
+		Time   string
+		Level  string
+		Module string
+		Msg    string
+	}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line.Level != "warn" || line.Module != PowModule || line.Msg != "block 7" {
+		t.Fatalf("unexpected line %+v", line)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, line.Time); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testLogFiles(t *testing.T, path string) []string {
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestCreateLogFile(t *testing.T) {
+	path := t.TempDir() + "/"
+	stamp := "2018-01-02_15.04.05"
+	for want := 0; want < 3; want++ {
+		file, n, err := createLogFile(path, stamp, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+		if n != want {
+			t.Fatalf("file %d of the same time has counter %d", want, n)
+		}
+	}
+	names := testLogFiles(t, path)
+	want := []string{stamp + "_1" + logFileSuffix, stamp + "_2" + logFileSuffix, stamp + logFileSuffix}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Fatalf("log files %v, want %v", names, want)
+	}
+}
+
+func TestRemoveOldFiles(t *testing.T) {
+	path := t.TempDir() + "/"
+	// ordered by time and then counter, not by name
+	for _, name := range []string{
+		"2018-01-01_10.00.00" + logFileSuffix,
+		"2018-01-01_10.00.00_2" + logFileSuffix,
+		"2018-01-01_10.00.00_10" + logFileSuffix,
+		"2018-01-02_09.00.00" + logFileSuffix,
+		"notes.txt",
+	} {
+		if err := ioutil.WriteFile(path+name, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	current, err := os.Open(path + "2018-01-01_10.00.00_10" + logFileSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer current.Close()
+
+	f := &rotatingFile{path: path, file: current, keep: 1}
+	f.removeOldFiles()
+	names := testLogFiles(t, path)
+	want := []string{"2018-01-01_10.00.00_10" + logFileSuffix, "2018-01-02_09.00.00" + logFileSuffix, "notes.txt"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Fatalf("log files %v, want %v", names, want)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := t.TempDir() + "/"
+	f := &rotatingFile{path: path, maxSize: 10, keep: 2}
+	if err := f.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// every line but the first fills the file up and rotates it
+	for i := 0; i < 4; i++ {
+		if _, err := f.Write([]byte("12345678")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := testLogFiles(t, path)
+	if len(names) != 2 {
+		t.Fatalf("log files %v, want the newest two", names)
+	}
+	if current := filepath.Base(f.file.Name()); names[0] != current && names[1] != current {
+		t.Fatalf("current file %s is removed", current)
+	}
+	if f.size != 8 {
+		t.Fatalf("current file has %d bytes, want 8", f.size)
+	}
+}
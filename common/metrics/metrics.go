@@ -0,0 +1,224 @@
+// Package metrics keeps the runtime counters of the node and writes them in
+// the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds in seconds of the latency histograms.
+var DefaultBuckets = []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+var registry = struct {
+	sync.Mutex
+	metrics map[string]metric
+}{metrics: make(map[string]metric)}
+
+func register(name string, m metric) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.metrics[name]; ok {
+		panic("metrics: duplicate metric " + name)
+	}
+	registry.metrics[name] = m
+}
+
+// WriteAll writes every registered metric to w, sorted by name.
+func WriteAll(w io.Writer) {
+	registry.Lock()
+	names := make([]string, 0, len(registry.metrics))
+	for name := range registry.metrics {
+		names = append(names, name)
+	}
+	metrics := make([]metric, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		metrics = append(metrics, registry.metrics[name])
+	}
+	registry.Unlock()
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	name, help string
+	value      uint64
+}
+
+func NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	register(name, c)
+	return c
+}
+
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.value, n)
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	fmt.Fprintf(w, "%s %d\n", c.name, atomic.LoadUint64(&c.value))
+}
+
+// CounterVec is a set of counters told apart by the value of one label.
+type CounterVec struct {
+	sync.RWMutex
+	name, help, label string
+	values            map[string]*uint64
+}
+
+func NewCounterVec(name, help, label string) *CounterVec {
+	c := &CounterVec{name: name, help: help, label: label, values: make(map[string]*uint64)}
+	register(name, c)
+	return c
+}
+
+func (c *CounterVec) Add(labelValue string, n uint64) {
+	c.RLock()
+	v, ok := c.values[labelValue]
+	c.RUnlock()
+	if !ok {
+		c.Lock()
+		if v, ok = c.values[labelValue]; !ok {
+			v = new(uint64)
+			c.values[labelValue] = v
+		}
+		c.Unlock()
+	}
+	atomic.AddUint64(v, n)
+}
+
+func (c *CounterVec) Inc(labelValue string) {
+	c.Add(labelValue, 1)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	c.RLock()
+	defer c.RUnlock()
+	labels := make([]string, 0, len(c.values))
+	for l := range c.values {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	for _, l := range labels {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", c.name, c.label, escapeLabel(l), atomic.LoadUint64(c.values[l]))
+	}
+}
+
+// gaugeFunc reads its values when the metrics are written, so the state
+// kept elsewhere does not need to be mirrored.
+type gaugeFunc struct {
+	name, help, label string
+	f                 func() map[string]float64
+}
+
+// NewGaugeFunc registers a gauge whose value is read from f.
+func NewGaugeFunc(name, help string, f func() float64) {
+	register(name, &gaugeFunc{name: name, help: help, f: func() map[string]float64 {
+		return map[string]float64{"": f()}
+	}})
+}
+
+// NewGaugeVecFunc registers a gauge with one label, f returns the value of
+// each label value.
+func NewGaugeVecFunc(name, help, label string, f func() map[string]float64) {
+	register(name, &gaugeFunc{name: name, help: help, label: label, f: f})
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	values := g.f()
+	if g.label == "" {
+		fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(values[""]))
+		return
+	}
+	labels := make([]string, 0, len(values))
+	for l := range values {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	for _, l := range labels {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %s\n", g.name, g.label, escapeLabel(l), formatFloat(values[l]))
+	}
+}
+
+// Histogram counts observations in buckets, it is used for latencies in
+// seconds.
+type Histogram struct {
+	sync.Mutex
+	name, help string
+	bounds     []float64
+	counts     []uint64
+	sum        float64
+	count      uint64
+}
+
+func NewHistogram(name, help string, bounds []float64) *Histogram {
+	h := &Histogram{name: name, help: help, bounds: bounds, counts: make([]uint64, len(bounds))}
+	register(name, h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.Lock()
+	defer h.Unlock()
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// ObserveSince observes the seconds elapsed since start.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (h *Histogram) write(w io.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+	h.Lock()
+	defer h.Unlock()
+	for i, bound := range h.bounds {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatFloat(bound), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func writeMetric(m metric) string {
+	var buf bytes.Buffer
+	m.write(&buf)
+	return buf.String()
+}
+
+func TestCounter(t *testing.T) {
+	c := NewCounter("test_counter_total", "A test counter.")
+	c.Inc()
+	c.Add(41)
+	want := "# HELP test_counter_total A test counter.\n" +
+		"# TYPE test_counter_total counter\n" +
+		"test_counter_total 42\n"
+	if got := writeMetric(c); got != want {
+		t.Fatalf("counter is written as\n%s\nwant\n%s", got, want)
+	}
+
+	v := NewCounterVec("test_messages_total", "Test messages.", "command")
+	v.Inc("ping")
+	v.Add("block", 3)
+	v.Inc(`a"b\c`)
+	want = "# HELP test_messages_total Test messages.\n" +
+		"# TYPE test_messages_total counter\n" +
+		"test_messages_total{command=\"a\\\"b\\\\c\"} 1\n" +
+		"test_messages_total{command=\"block\"} 3\n" +
+		"test_messages_total{command=\"ping\"} 1\n"
+	if got := writeMetric(v); got != want {
+		t.Fatalf("counter vec is written as\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGauge(t *testing.T) {
+	value := 1.5
+	NewGaugeFunc("test_gauge", "A test gauge.", func() float64 { return value })
+	NewGaugeVecFunc("test_gauge_vec", "A test gauge vec.", "state", func() map[string]float64 {
+		return map[string]float64{"up": 2, "down": 0, "inf": math.Inf(1)}
+	})
+	value = 7
+
+	registry.Lock()
+	gauge, vec := registry.metrics["test_gauge"], registry.metrics["test_gauge_vec"]
+	registry.Unlock()
+	want := "# HELP test_gauge A test gauge.\n" +
+		"# TYPE test_gauge gauge\n" +
+		"test_gauge 7\n"
+	if got := writeMetric(gauge); got != want {
+		t.Fatalf("gauge is written as\n%s\nwant\n%s", got, want)
+	}
+	want = "# HELP test_gauge_vec A test gauge vec.\n" +
+		"# TYPE test_gauge_vec gauge\n" +
+		"test_gauge_vec{state=\"down\"} 0\n" +
+		"test_gauge_vec{state=\"inf\"} +Inf\n" +
+		"test_gauge_vec{state=\"up\"} 2\n"
+	if got := writeMetric(vec); got != want {
+		t.Fatalf("gauge vec is written as\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("test_latency_seconds", "A test histogram.", []float64{.1, 1})
+	h.Observe(.05)
+	h.Observe(.5)
+	h.Observe(.5)
+	h.Observe(3)
+	want := "# HELP test_latency_seconds A test histogram.\n" +
+		"# TYPE test_latency_seconds histogram\n" +
+		"test_latency_seconds_bucket{le=\"0.1\"} 1\n" +
+		"test_latency_seconds_bucket{le=\"1\"} 3\n" +
+		"test_latency_seconds_bucket{le=\"+Inf\"} 4\n" +
+		"test_latency_seconds_sum 4.05\n" +
+		"test_latency_seconds_count 4\n"
+	if got := writeMetric(h); got != want {
+		t.Fatalf("histogram is written as\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteAll(t *testing.T) {
+	NewCounter("test_b_total", "B.")
+	NewCounter("test_a_total", "A.")
+	var buf bytes.Buffer
+	WriteAll(&buf)
+	out := buf.String()
+	a, b := strings.Index(out, "# HELP test_a_total"), strings.Index(out, "# HELP test_b_total")
+	if a < 0 || b < 0 || a > b {
+		t.Fatal("metrics are not written sorted by name")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("duplicate metric registered")
+		}
+	}()
+	NewCounter("test_a_total", "A again.")
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/dnaproject/gopass"
 )
@@ -18,6 +19,17 @@ func GetPassword() ([]byte, error) {
 	return passwd, nil
 }
 
+// GetMnemonic gets the mnemonic words of a hd wallet from user input, they
+// are not echoed so they stay out of the terminal and the shell history
+func GetMnemonic() (string, error) {
+	fmt.Printf("Mnemonic:")
+	words, err := gopass.GetPasswd()
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(string(words)), " "), nil
+}
+
 // GetConfirmedPassword gets double confirmed password from user input
 func GetConfirmedPassword() ([]byte, error) {
 	fmt.Printf("Password:")
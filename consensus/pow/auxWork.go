@@ -0,0 +1,243 @@
+package pow
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/config"
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/core/auxpow"
+	"Elastos.ELA/core/ledger"
+	"Elastos.ELA/events"
+)
+
+const (
+	// the chain id of the aux blocks in the coinbase of the parents
+	AuxChainID = 1
+
+	// templates kept for each payout address and parent chain, the oldest
+	// is dropped for a new one
+	maxAuxWorksPerKey = 8
+	// payout addresses and parent chains mined for at the same time
+	maxAuxWorkKeys = 64
+	// a template is reused while the pool is unchanged, or for this long
+	auxWorkRefreshSecs = 60
+)
+
+var (
+	// the work was for a block which is no longer on the tip, the parent
+	// should get a new one
+	ErrAuxWorkStale = errors.New("stale aux block")
+	// the work was never given out, or so long ago it is forgotten
+	ErrAuxWorkUnknown = errors.New("unknown aux block")
+)
+
+// AuxWorkRejected is the error of a submission whose auxpow or block is
+// invalid, unlike a stale one it is the fault of the miner.
+type AuxWorkRejected struct {
+	Reason string
+}
+
+func (e *AuxWorkRejected) Error() string {
+	return "aux block rejected: " + e.Reason
+}
+
+type auxWorkKey struct {
+	payToAddr   string
+	parentChain string
+}
+
+type auxWork struct {
+	key     auxWorkKey
+	block   *ledger.Block
+	created time.Time
+	txCount int
+}
+
+// AuxWorkManager keeps the blocks given out to merged mining parents, so
+// several parents mining for several addresses can submit concurrently.
+// The works of a tip expire when the tip changes.
+type AuxWorkManager struct {
+	sync.Mutex
+	pow   *PowService
+	works map[Uint256]*auxWork
+	// the hashes of the works of each key, the oldest first
+	keys     map[auxWorkKey][]Uint256
+	keyOrder []auxWorkKey
+	// the works of the previous tip and the submitted ones, to tell a
+	// stale submission from an unknown one, and those of the tip before
+	expired     map[Uint256]struct{}
+	prevExpired map[Uint256]struct{}
+
+	// a block is added to the chain by one submission at a time
+	submitMutex sync.Mutex
+}
+
+func NewAuxWorkManager(pow *PowService) *AuxWorkManager {
+	m := &AuxWorkManager{
+		pow:         pow,
+		works:       make(map[Uint256]*auxWork),
+		keys:        make(map[auxWorkKey][]Uint256),
+		expired:     make(map[Uint256]struct{}),
+		prevExpired: make(map[Uint256]struct{}),
+	}
+	ledger.DefaultLedger.Blockchain.BCEvents.Subscribe(events.EventBlockPersistCompleted, m.blockPersistCompleted)
+	return m
+}
+
+// blockPersistCompleted expires the works which do not build on the new tip.
+// The hashes expired before are kept for one more tip, so a submission racing
+// with the tip change is still told it is stale.
+func (m *AuxWorkManager) blockPersistCompleted(v interface{}) {
+	m.expire(ledger.DefaultLedger.Blockchain.CurrentBlockHash())
+}
+
+func (m *AuxWorkManager) expire(tip Uint256) {
+	m.Lock()
+	defer m.Unlock()
+	m.prevExpired = m.expired
+	m.expired = make(map[Uint256]struct{})
+	for hash, work := range m.works {
+		if work.block.Blockdata.PrevBlockHash != tip {
+			m.expired[hash] = struct{}{}
+			m.remove(hash)
+		}
+	}
+}
+
+// remove drops the work of the hash, the caller holds the lock.
+func (m *AuxWorkManager) remove(hash Uint256) {
+	work, ok := m.works[hash]
+	if !ok {
+		return
+	}
+	delete(m.works, hash)
+	hashes := m.keys[work.key]
+	for i, h := range hashes {
+		if h == hash {
+			hashes = append(hashes[:i:i], hashes[i+1:]...)
+			break
+		}
+	}
+	if len(hashes) > 0 {
+		m.keys[work.key] = hashes
+		return
+	}
+	delete(m.keys, work.key)
+	for i, key := range m.keyOrder {
+		if key == work.key {
+			m.keyOrder = append(m.keyOrder[:i:i], m.keyOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+// GetWork returns a block for the parent chain to mine paying to the
+// address, the latest one of the pair while it is still fresh.
+func (m *AuxWorkManager) GetWork(payToAddr string, parentChain string) (*ledger.Block, error) {
+	key := auxWorkKey{payToAddr, parentChain}
+	tip := ledger.DefaultLedger.Blockchain.CurrentBlockHash()
+	txCount := m.pow.GetTransactionCount()
+
+	m.Lock()
+	if hashes := m.keys[key]; len(hashes) > 0 {
+		work := m.works[hashes[len(hashes)-1]]
+		if work.block.Blockdata.PrevBlockHash == tip && (work.txCount == txCount ||
+			time.Since(work.created) < auxWorkRefreshSecs*time.Second) {
+			m.Unlock()
+			return work.block, nil
+		}
+	}
+	m.Unlock()
+
+	block, err := m.pow.GenerateBlock(payToAddr)
+	if err != nil {
+		return nil, err
+	}
+	hash := block.Hash()
+
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.keys[key]; !ok {
+		if len(m.keyOrder) >= maxAuxWorkKeys {
+			oldest := m.keyOrder[0]
+			for _, h := range m.keys[oldest] {
+				m.remove(h)
+			}
+		}
+		m.keyOrder = append(m.keyOrder, key)
+	}
+	if hashes := m.keys[key]; len(hashes) >= maxAuxWorksPerKey {
+		m.remove(hashes[0])
+	}
+	m.works[hash] = &auxWork{key: key, block: block, created: time.Now(), txCount: txCount}
+	m.keys[key] = append(m.keys[key], hash)
+	return block, nil
+}
+
+func (m *AuxWorkManager) getWork(hash Uint256) (*auxWork, error) {
+	m.Lock()
+	defer m.Unlock()
+	work, ok := m.works[hash]
+	if ok {
+		return work, nil
+	}
+	if _, ok := m.expired[hash]; ok {
+		return nil, ErrAuxWorkStale
+	}
+	if _, ok := m.prevExpired[hash]; ok {
+		return nil, ErrAuxWorkStale
+	}
+	return nil, ErrAuxWorkUnknown
+}
+
+// SubmitWork adds the block of the hash with the auxpow of a parent to the
+// chain. A stale work returns ErrAuxWorkStale, an invalid one an
+// AuxWorkRejected, the chain is not touched for either.
+func (m *AuxWorkManager) SubmitWork(hash Uint256, auxPowData []byte) (*ledger.Block, error) {
+	work, err := m.getWork(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	var auxPow auxpow.AuxPow
+	if err := auxPow.Deserialize(bytes.NewReader(auxPowData)); err != nil {
+		return nil, &AuxWorkRejected{"invalid auxpow format"}
+	}
+	if !auxPow.Check(hash, AuxChainID) {
+		return nil, &AuxWorkRejected{"auxpow does not commit to the block"}
+	}
+	// the block itself is shared by the parents, the auxpow goes to a copy
+	blockData := *work.block.Blockdata
+	blockData.AuxPow = auxPow
+	if err := ledger.CheckProofOfWork(&blockData, config.Parameters.ChainParam.PowLimit); err != nil {
+		return nil, &AuxWorkRejected{"high hash"}
+	}
+	block := &ledger.Block{
+		Blockdata:    &blockData,
+		Transactions: work.block.Transactions,
+	}
+
+	m.submitMutex.Lock()
+	defer m.submitMutex.Unlock()
+	if blockData.PrevBlockHash != ledger.DefaultLedger.Blockchain.CurrentBlockHash() {
+		return nil, ErrAuxWorkStale
+	}
+	inMainChain, isOrphan, err := ledger.DefaultLedger.Blockchain.AddBlock(block)
+	if err != nil {
+		return nil, &AuxWorkRejected{err.Error()}
+	}
+	if isOrphan || !inMainChain {
+		return nil, ErrAuxWorkStale
+	}
+
+	m.Lock()
+	m.remove(hash)
+	m.expired[hash] = struct{}{}
+	m.Unlock()
+	log.Infof("Aux block %d submitted", blockData.Height)
+	return block, nil
+}
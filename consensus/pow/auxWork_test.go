@@ -0,0 +1,148 @@
+package pow
+
+import (
+	"bytes"
+	"testing"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/config"
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/core/ledger"
+)
+
+// testBits is the easiest target below the proof of work limit, about
+// every second parent header meets it.
+const testBits = 0x207fffff
+
+// testTipStore only knows the hash of the best block.
+type testTipStore struct {
+	ledger.ILedgerStore
+	tip Uint256
+}
+
+func (s *testTipStore) GetCurrentBlockHash() Uint256 { return s.tip }
+
+func newTestAuxWorkManager() *AuxWorkManager {
+	log.Init()
+	return &AuxWorkManager{
+		works:       make(map[Uint256]*auxWork),
+		keys:        make(map[auxWorkKey][]Uint256),
+		expired:     make(map[Uint256]struct{}),
+		prevExpired: make(map[Uint256]struct{}),
+	}
+}
+
+// addTestWork gives out a block on the previous one as GetWork does.
+func addTestWork(m *AuxWorkManager, key auxWorkKey, prev Uint256, bits uint32) *ledger.Block {
+	block := &ledger.Block{Blockdata: &ledger.Blockdata{PrevBlockHash: prev, Bits: bits, Height: 1,
+		Timestamp: 1514000000 + uint32(len(m.works))}}
+	hash := block.Hash()
+	m.Lock()
+	m.works[hash] = &auxWork{key: key, block: block}
+	if _, ok := m.keys[key]; !ok {
+		m.keyOrder = append(m.keyOrder, key)
+	}
+	m.keys[key] = append(m.keys[key], hash)
+	m.Unlock()
+	return block
+}
+
+func TestAuxWorkExpire(t *testing.T) {
+	m := newTestAuxWorkManager()
+	key := auxWorkKey{"addr", "btc"}
+	old := addTestWork(m, key, Uint256{1}, testBits)
+	current := addTestWork(m, key, Uint256{2}, testBits)
+	submitted := Uint256{3}
+	m.expired[submitted] = struct{}{}
+
+	m.expire(Uint256{2})
+	if _, err := m.getWork(old.Hash()); err != ErrAuxWorkStale {
+		t.Fatalf("work of the old tip returns %v, want stale", err)
+	}
+	if work, err := m.getWork(current.Hash()); err != nil || work.block != current {
+		t.Fatalf("work of the tip returns %v", err)
+	}
+	if hashes := m.keys[key]; len(hashes) != 1 || hashes[0] != current.Hash() {
+		t.Fatalf("key keeps %d works, want the one of the tip", len(hashes))
+	}
+	// a block submitted before the tip changed is still stale after it
+	if _, err := m.getWork(submitted); err != ErrAuxWorkStale {
+		t.Fatalf("submitted work returns %v after a tip change, want stale", err)
+	}
+
+	m.expire(Uint256{4})
+	for _, hash := range []Uint256{old.Hash(), current.Hash()} {
+		if _, err := m.getWork(hash); err != ErrAuxWorkStale {
+			t.Fatalf("expired work returns %v, want stale", err)
+		}
+	}
+	if len(m.keys) != 0 || len(m.keyOrder) != 0 {
+		t.Fatal("key without works is kept")
+	}
+
+	// one previous generation is kept only
+	m.expire(Uint256{5})
+	if _, err := m.getWork(old.Hash()); err != ErrAuxWorkUnknown {
+		t.Fatalf("work expired two tips ago returns %v, want unknown", err)
+	}
+	if _, err := m.getWork(current.Hash()); err != ErrAuxWorkStale {
+		t.Fatalf("work expired by the previous tip returns %v, want stale", err)
+	}
+	if _, err := m.getWork(submitted); err != ErrAuxWorkUnknown {
+		t.Fatalf("submitted work returns %v two tips later, want unknown", err)
+	}
+}
+
+func TestSubmitAuxWorkRejected(t *testing.T) {
+	saved := ledger.DefaultLedger
+	defer func() { ledger.DefaultLedger = saved }()
+	ledger.DefaultLedger = &ledger.Ledger{Store: &testTipStore{tip: Uint256{9}}}
+	ledger.DefaultLedger.Blockchain = ledger.NewBlockchain(0, ledger.DefaultLedger)
+
+	m := newTestAuxWorkManager()
+	key := auxWorkKey{"addr", ""}
+	hard := addTestWork(m, key, Uint256{9}, 0x1d00ffff)
+	easy := addTestWork(m, key, Uint256{1}, testBits)
+
+	serialize := func(hash Uint256, solve bool) []byte {
+		auxPow := generateAuxPow(hash)
+		if solve {
+			header := *easy.Blockdata
+			header.AuxPow = *auxPow
+			for ledger.CheckProofOfWork(&header, config.Parameters.ChainParam.PowLimit) != nil {
+				header.AuxPow.ParBlockHeader.Nonce++
+			}
+			auxPow = &header.AuxPow
+		}
+		var buf bytes.Buffer
+		auxPow.Serialize(&buf)
+		return buf.Bytes()
+	}
+
+	if _, err := m.SubmitWork(Uint256{7}, serialize(Uint256{7}, false)); err != ErrAuxWorkUnknown {
+		t.Fatalf("unknown work returns %v", err)
+	}
+	for _, c := range []struct {
+		name   string
+		hash   Uint256
+		auxPow []byte
+	}{
+		{"truncated auxpow", hard.Hash(), serialize(hard.Hash(), false)[:10]},
+		{"auxpow of another block", hard.Hash(), serialize(easy.Hash(), false)},
+		{"high hash", hard.Hash(), serialize(hard.Hash(), false)},
+	} {
+		if _, err := m.SubmitWork(c.hash, c.auxPow); err == nil {
+			t.Errorf("%s is accepted", c.name)
+		} else if _, ok := err.(*AuxWorkRejected); !ok {
+			t.Errorf("%s returns %v, want a rejection", c.name, err)
+		}
+	}
+
+	// a valid block which is not on the tip
+	if _, err := m.SubmitWork(easy.Hash(), serialize(easy.Hash(), true)); err != ErrAuxWorkStale {
+		t.Fatalf("block of an old tip returns %v, want stale", err)
+	}
+	if len(ledger.DefaultLedger.Blockchain.Orphans) != 0 {
+		t.Fatal("stale block is added to the chain")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"Elastos.ELA/common/log"
 	"Elastos.ELA/core/ledger"
 	"fmt"
+	"strconv"
 	"time"
 
 	zmq "github.com/pebbe/zmq4"
@@ -51,7 +52,7 @@ func (pow *PowService) ZMQServer() {
 	for {
 		select {
 		case <-pow.ZMQPublish:
-			publisher.Send(MSGHASKTX+"==Coming from elacoin node, glad to see you, Timestamp:"+string(time.Now().Unix()), zmq.SNDMORE)
+			publisher.Send(MSGHASKTX+"==Coming from elacoin node, glad to see you, Timestamp:"+strconv.FormatInt(time.Now().Unix(), 10), zmq.SNDMORE)
 		}
 	}
 }
@@ -6,7 +6,6 @@ import (
 	"errors"
 	"math"
 	"math/rand"
-	"sort"
 	"sync"
 	"time"
 
@@ -14,6 +13,7 @@ import (
 	. "Elastos.ELA/common"
 	"Elastos.ELA/common/config"
 	"Elastos.ELA/common/log"
+	"Elastos.ELA/common/metrics"
 	"Elastos.ELA/core/auxpow"
 	"Elastos.ELA/core/ledger"
 	tx "Elastos.ELA/core/transaction"
@@ -25,6 +25,9 @@ import (
 
 var TaskCh chan bool
 
+var hashAttempts = metrics.NewCounter("ela_mining_hash_attempts_total",
+	"Nonces tried by the CPU miner.")
+
 const (
 	maxNonce       = ^uint32(0) // 2^32 - 1
 	maxExtraNonce  = ^uint64(0) // 2^64 - 1
@@ -40,14 +43,9 @@ var (
 	RetargetPersent  = 25
 )
 
-type msgBlock struct {
-	BlockData map[string]*ledger.Block
-	Mutex     sync.Mutex
-}
-
 type PowService struct {
 	PayToAddr     string
-	MsgBlock      msgBlock
+	AuxWorks      *AuxWorkManager
 	ZMQPublish    chan bool
 	Mutex         sync.Mutex
 	Client        cl.Client
@@ -55,6 +53,7 @@ type PowService struct {
 	started       bool
 	manualMining  bool
 	localNet      protocol.Noder
+	templates     *templateNotifier
 
 	blockPersistCompletedSubscriber events.Subscriber
 	RollbackTransactionSubscriber   events.Subscriber
@@ -68,13 +67,37 @@ func (pow *PowService) GetTransactionCount() int {
 	return len(transactionsPool)
 }
 
+// CollectTransactions appends the pool transactions with the highest fee
+// rate to the block, within the block size and transaction count limits.
 func (pow *PowService) CollectTransactions(MsgBlock *ledger.Block) int {
 	txs := 0
-	transactionsPool := pow.localNet.GetTxnPool(true)
+	nextBlockHeight := ledger.DefaultLedger.Blockchain.GetBestHeight() + 1
+	calcTxsSize := 0
+	calcTxsAmount := len(MsgBlock.Transactions)
+	for _, tx := range MsgBlock.Transactions {
+		calcTxsSize += tx.GetSize()
+	}
+
+	for _, tx := range pow.localNet.GetTxnPoolByFeeRate() {
+		if calcTxsAmount >= config.Parameters.MaxTxInBlock {
+			break
+		}
+		// a smaller transaction with a lower fee rate may still fit
+		if (tx.GetSize() + calcTxsSize) > ledger.MaxBlockSize {
+			continue
+		}
 
-	for _, tx := range transactionsPool {
+		if !ledger.IsFinalizedTransaction(tx, nextBlockHeight) {
+			continue
+		}
+		fee := tx.GetFee(ledger.DefaultLedger.Blockchain.AssetID)
+		if fee != int64(tx.Fee) {
+			continue
+		}
 		log.Trace(tx)
 		MsgBlock.Transactions = append(MsgBlock.Transactions, tx)
+		calcTxsSize = calcTxsSize + tx.GetSize()
+		calcTxsAmount++
 		txs++
 	}
 	return txs
@@ -141,20 +164,6 @@ func calcBlockSubsidy(currentHeight uint32) int64 {
 	return subsidyPerBlock
 }
 
-type txSorter []*tx.Transaction
-
-func (s txSorter) Len() int {
-	return len(s)
-}
-
-func (s txSorter) Swap(i, j int) {
-	s[i], s[j] = s[j], s[i]
-}
-
-func (s txSorter) Less(i, j int) bool {
-	return s[i].FeePerKB < s[j].FeePerKB
-}
-
 func (pow *PowService) GenerateBlock(addr string) (*ledger.Block, error) {
 	nextBlockHeight := ledger.DefaultLedger.Blockchain.GetBestHeight() + 1
 	coinBaseTx, err := pow.CreateCoinbaseTrx(nextBlockHeight, addr)
@@ -179,36 +188,10 @@ func (pow *PowService) GenerateBlock(addr string) (*ledger.Block, error) {
 	}
 
 	msgBlock.Transactions = append(msgBlock.Transactions, coinBaseTx)
-	calcTxsSize := coinBaseTx.GetSize()
-	calcTxsAmount := 1
+	pow.CollectTransactions(msgBlock)
 	totalFee := int64(0)
-	var txPool txSorter
-	txPool = make([]*tx.Transaction, 0)
-	transactionsPool := pow.localNet.GetTxnPool(false)
-	for _, v := range transactionsPool {
-		txPool = append(txPool, v)
-	}
-	sort.Sort(sort.Reverse(txPool))
-
-	for _, tx := range txPool {
-		if (tx.GetSize() + calcTxsSize) > ledger.MaxBlockSize {
-			break
-		}
-		if calcTxsAmount >= config.Parameters.MaxTxInBlock {
-			break
-		}
-
-		if !ledger.IsFinalizedTransaction(tx, nextBlockHeight) {
-			continue
-		}
-		fee := tx.GetFee(ledger.DefaultLedger.Blockchain.AssetID)
-		if fee != int64(tx.Fee) {
-			continue
-		}
-		msgBlock.Transactions = append(msgBlock.Transactions, tx)
-		calcTxsSize = calcTxsSize + tx.GetSize()
-		calcTxsAmount++
-		totalFee += fee
+	for _, tx := range msgBlock.Transactions[1:] {
+		totalFee += int64(tx.Fee)
 	}
 
 	subsidy := calcBlockSubsidy(nextBlockHeight)
@@ -290,7 +273,10 @@ func (pow *PowService) SolveBlock(MsgBlock *ledger.Block, ticker *time.Ticker) b
 	header := MsgBlock.Blockdata
 	targetDifficulty := ledger.CompactToBig(header.Bits)
 
+	var attempts uint64
+	defer func() { hashAttempts.Add(attempts) }()
 	for i := uint32(0); i <= maxNonce; i++ {
+		attempts++
 		select {
 		case <-ticker.C:
 			if MsgBlock.Blockdata.PrevBlockHash.CompareTo(*ledger.DefaultLedger.Blockchain.BestChain.Hash) != 0 {
@@ -384,12 +370,13 @@ func NewPowService(client cl.Client, logDictionary string, localNet protocol.Nod
 		Client:        client,
 		started:       false,
 		manualMining:  false,
-		MsgBlock:      msgBlock{BlockData: make(map[string]*ledger.Block)},
 		ZMQPublish:    make(chan bool, 1),
 		localNet:      localNet,
 		logDictionary: logDictionary,
+		templates:     newTemplateNotifier(),
 	}
 
+	pow.AuxWorks = NewAuxWorkManager(pow)
 	pow.blockPersistCompletedSubscriber = ledger.DefaultLedger.Blockchain.BCEvents.Subscribe(events.EventBlockPersistCompleted, pow.BlockPersistCompleted)
 	pow.RollbackTransactionSubscriber = ledger.DefaultLedger.Blockchain.BCEvents.Subscribe(events.EventRollbackTransaction, pow.RollbackTransaction)
 
@@ -0,0 +1,330 @@
+package pow
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/config"
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/common/metrics"
+	"Elastos.ELA/core/auxpow"
+	"Elastos.ELA/core/ledger"
+	"Elastos.ELA/events"
+)
+
+// A Stratum v1 server for pool software and ASIC miners. The miners solve
+// the header of a merged mining parent block, the extra nonces go to the
+// script of its coinbase after the hash of the block they mine, so the
+// solutions are auxpows of the block as submitauxblock takes them.
+
+const (
+	// the address the server binds to when StratumAddress is not set, the
+	// miners are usually run next to the node or through a proxy
+	stratumDefaultAddress = "127.0.0.1"
+
+	stratumExtraNonce1Size = 4
+	stratumExtraNonce2Size = 4
+
+	// jobs of the current best block kept for the shares of slow miners
+	stratumMaxJobs = 8
+	// a new job with the transactions of the pool is sent this often
+	stratumJobRefreshSecs = 30
+
+	// the difficulty of a worker is retargeted for a share every
+	// stratumShareTargetSecs, at most every stratumRetargetSecs
+	stratumShareTargetSecs = 10
+	stratumRetargetSecs    = 60
+	stratumMinDifficulty   = 0.001
+
+	// the time of a share may be this far ahead of the node
+	stratumMaxTimeOffset = 2 * 60 * 60
+)
+
+var (
+	// the target of a share of difficulty 1, as in bitcoin
+	diff1Target, _ = new(big.Int).SetString("00000000ffff0000000000000000000000000000000000000000000000000000", 16)
+
+	stratumShares = metrics.NewCounterVec("ela_stratum_shares_total",
+		"Shares submitted to the stratum server by result.", "result")
+)
+
+type stratumJob struct {
+	id      string
+	block   *ledger.Block
+	version uint32
+	ntime   uint32
+	// the coinbase of the parent block is coinb1 || extranonce1 ||
+	// extranonce2 || coinb2
+	coinb1 []byte
+	coinb2 []byte
+	target *big.Int
+
+	// the shares submitted for the job, to refuse duplicates
+	shares map[string]struct{}
+}
+
+type StratumServer struct {
+	sync.Mutex
+	pow *PowService
+	// the hashes of the passwords of the StratumUsers
+	users       map[string][sha256.Size]byte
+	sessions    map[*stratumSession]struct{}
+	jobs        map[string]*stratumJob
+	jobOrder    []string
+	current     *stratumJob
+	lastJobID   uint64
+	extraNonce1 uint32
+	newBlock    chan struct{}
+
+	// a block is added to the chain by one share at a time
+	submitMutex sync.Mutex
+}
+
+func NewStratumServer(pow *PowService) *StratumServer {
+	s := newStratumServer(pow, config.Parameters.PowConfiguration.StratumUsers)
+	ledger.DefaultLedger.Blockchain.BCEvents.Subscribe(events.EventBlockPersistCompleted, s.blockPersistCompleted)
+	return s
+}
+
+func newStratumServer(pow *PowService, users []config.StratumUser) *StratumServer {
+	s := &StratumServer{
+		pow:      pow,
+		users:    make(map[string][sha256.Size]byte),
+		sessions: make(map[*stratumSession]struct{}),
+		jobs:     make(map[string]*stratumJob),
+		newBlock: make(chan struct{}, 1),
+	}
+	for _, u := range users {
+		s.users[u.User] = sha256.Sum256([]byte(u.Password))
+	}
+	return s
+}
+
+// Start listens on the StratumAddress and StratumPort of the pow
+// configuration and serves the miners, it does not return unless listening
+// fails.
+func (s *StratumServer) Start() error {
+	host := config.Parameters.PowConfiguration.StratumAddress
+	if host == "" {
+		host = stratumDefaultAddress
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(config.Parameters.PowConfiguration.StratumPort))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Error("Stratum server error: ", err)
+		return err
+	}
+	log.Info("Stratum server listening on ", addr)
+	if len(s.users) == 0 {
+		log.Warn("Stratum server has no StratumUsers, no worker can authorize")
+	}
+
+	go s.jobLoop()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Error("Stratum accept error: ", err)
+			continue
+		}
+		session := s.newSession(conn)
+		go session.serve()
+	}
+}
+
+// blockPersistCompleted is called by the chain, the job is updated out of
+// the event handler.
+func (s *StratumServer) blockPersistCompleted(v interface{}) {
+	select {
+	case s.newBlock <- struct{}{}:
+	default:
+	}
+}
+
+func (s *StratumServer) jobLoop() {
+	ticker := time.NewTicker(time.Second * stratumJobRefreshSecs)
+	defer ticker.Stop()
+
+	s.updateJob()
+	for {
+		select {
+		case <-s.newBlock:
+		case <-ticker.C:
+		}
+		s.updateJob()
+	}
+}
+
+// updateJob creates a job from a new block template and sends it to the
+// miners. The old jobs are dropped when the best block changed.
+func (s *StratumServer) updateJob() {
+	job, err := s.newJob()
+	if err != nil {
+		log.Warn("Stratum job error: ", err)
+		return
+	}
+
+	s.Lock()
+	clean := s.current == nil ||
+		s.current.block.Blockdata.PrevBlockHash != job.block.Blockdata.PrevBlockHash
+	if clean {
+		s.jobs = make(map[string]*stratumJob)
+		s.jobOrder = nil
+	} else if len(s.jobOrder) >= stratumMaxJobs {
+		delete(s.jobs, s.jobOrder[0])
+		s.jobOrder = s.jobOrder[1:]
+	}
+	s.jobs[job.id] = job
+	s.jobOrder = append(s.jobOrder, job.id)
+	s.current = job
+	sessions := make([]*stratumSession, 0, len(s.sessions))
+	for session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.Unlock()
+
+	log.Debugf("Stratum job %s at height %d", job.id, job.block.Blockdata.Height)
+	for _, session := range sessions {
+		session.notify(job, clean)
+	}
+}
+
+// authorize checks the password of a worker, "<user>" or "<user>.<worker>".
+func (s *StratumServer) authorize(worker string, password string) bool {
+	user := worker
+	if i := strings.IndexByte(worker, '.'); i >= 0 {
+		user = worker[:i]
+	}
+	hash, ok := s.users[user]
+	if !ok {
+		return false
+	}
+	given := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare(given[:], hash[:]) == 1
+}
+
+func (s *StratumServer) newJob() (*stratumJob, error) {
+	block, err := s.pow.GenerateBlock(s.pow.PayToAddr)
+	if err != nil {
+		return nil, err
+	}
+	return s.makeJob(block)
+}
+
+// makeJob returns the job of mining the block.
+func (s *StratumServer) makeJob(block *ledger.Block) (*stratumJob, error) {
+	coinbase := getBtcCoinbase(block.Hash())
+	script := coinbase.TxIn[0].SignatureScript
+	coinbase.TxIn[0].SignatureScript = append(script, make([]byte, stratumExtraNonce1Size+stratumExtraNonce2Size)...)
+	buf := new(bytes.Buffer)
+	if err := coinbase.Serialize(buf); err != nil {
+		return nil, err
+	}
+	// the extra nonces end the script, before the sequence, the output
+	// count and the lock time
+	data := buf.Bytes()
+	tail := len(data) - 4 - 1 - 4
+	head := tail - stratumExtraNonce1Size - stratumExtraNonce2Size
+
+	s.Lock()
+	s.lastJobID++
+	id := strconv.FormatUint(s.lastJobID, 16)
+	s.Unlock()
+
+	return &stratumJob{
+		id:      id,
+		block:   block,
+		version: 0x7fffffff,
+		ntime:   uint32(time.Now().Unix()),
+		coinb1:  data[:head],
+		coinb2:  data[tail:],
+		target:  ledger.CompactToBig(block.Blockdata.Bits),
+		shares:  make(map[string]struct{}),
+	}, nil
+}
+
+// getJob returns the job of the id and marks the share, a share submitted
+// twice is an error.
+func (s *StratumServer) getJob(id string, share string) (*stratumJob, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, errStratumJobNotFound
+	}
+	if _, ok := job.shares[share]; ok {
+		return nil, errStratumDuplicateShare
+	}
+	job.shares[share] = struct{}{}
+	return job, nil
+}
+
+func (s *StratumServer) hasJob(id string) bool {
+	s.Lock()
+	defer s.Unlock()
+	_, ok := s.jobs[id]
+	return ok
+}
+
+func (s *StratumServer) currentJob() *stratumJob {
+	s.Lock()
+	defer s.Unlock()
+	return s.current
+}
+
+func (s *StratumServer) newSession(conn net.Conn) *stratumSession {
+	s.Lock()
+	defer s.Unlock()
+
+	s.extraNonce1++
+	extraNonce1 := make([]byte, stratumExtraNonce1Size)
+	binary.BigEndian.PutUint32(extraNonce1, s.extraNonce1)
+	session := newStratumSession(s, conn, extraNonce1)
+	s.sessions[session] = struct{}{}
+	return session
+}
+
+func (s *StratumServer) removeSession(session *stratumSession) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.sessions, session)
+}
+
+// submitBlock adds the block of the job with the solution of a miner to the
+// chain and sends it to the network.
+func (s *StratumServer) submitBlock(job *stratumJob, coinbase *auxpow.BtcTx, header *auxpow.BtcBlockHeader) error {
+	s.submitMutex.Lock()
+	defer s.submitMutex.Unlock()
+
+	blockData := *job.block.Blockdata
+	blockData.AuxPow = *auxpow.NewAuxPow([]Uint256{}, 0, *coinbase, []Uint256{}, 0, *header)
+	block := &ledger.Block{
+		Blockdata:    &blockData,
+		Transactions: job.block.Transactions,
+	}
+	inMainChain, isOrphan, err := ledger.DefaultLedger.Blockchain.AddBlock(block)
+	if err != nil {
+		return err
+	}
+	if isOrphan || !inMainChain {
+		return errors.New("block is not in the main chain")
+	}
+	s.pow.BroadcastBlock(block)
+	return nil
+}
+
+// difficultyToTarget returns the target a share of the difficulty must meet.
+func difficultyToTarget(difficulty float64) *big.Int {
+	target, _ := new(big.Float).Quo(new(big.Float).SetInt(diff1Target), big.NewFloat(difficulty)).Int(nil)
+	return target
+}
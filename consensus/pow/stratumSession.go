@@ -0,0 +1,419 @@
+package pow
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/config"
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/core/auxpow"
+	"Elastos.ELA/core/ledger"
+)
+
+const (
+	// the version bits a miner may roll, as BIP320 leaves them
+	stratumVersionRollingMask = 0x1fffe000
+
+	stratumMaxLineLen = 16 * 1024
+)
+
+// the error codes of stratum
+var (
+	errStratumOther          = &stratumError{20, "Other/Unknown"}
+	errStratumJobNotFound    = &stratumError{21, "Job not found"}
+	errStratumDuplicateShare = &stratumError{22, "Duplicate share"}
+	errStratumLowDifficulty  = &stratumError{23, "Low difficulty share"}
+	errStratumUnauthorized   = &stratumError{24, "Unauthorized worker"}
+	errStratumNotSubscribed  = &stratumError{25, "Not subscribed"}
+)
+
+type stratumError struct {
+	code    int
+	message string
+}
+
+func (e *stratumError) Error() string {
+	return e.message
+}
+
+func (e *stratumError) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.code, e.message, nil})
+}
+
+type stratumRequest struct {
+	ID     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+type stratumResponse struct {
+	ID     interface{}   `json:"id"`
+	Result interface{}   `json:"result"`
+	Error  *stratumError `json:"error"`
+}
+
+type stratumNotification struct {
+	ID     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// stratumSession is the connection of a miner, the workers it authorizes
+// share its extra nonce and its difficulty.
+type stratumSession struct {
+	server      *StratumServer
+	conn        net.Conn
+	extraNonce1 []byte
+
+	writeMutex sync.Mutex
+
+	mu          sync.Mutex
+	subscribed  bool
+	workers     map[string]bool
+	versionMask uint32
+	difficulty  float64
+	// the difficulty in effect when each job was sent
+	jobDifficulty map[string]float64
+	shares        int
+	lastRetarget  time.Time
+}
+
+func newStratumSession(server *StratumServer, conn net.Conn, extraNonce1 []byte) *stratumSession {
+	difficulty := config.Parameters.PowConfiguration.StratumDifficulty
+	if difficulty < stratumMinDifficulty {
+		difficulty = stratumMinDifficulty
+	}
+	return &stratumSession{
+		server:        server,
+		conn:          conn,
+		extraNonce1:   extraNonce1,
+		workers:       make(map[string]bool),
+		difficulty:    difficulty,
+		jobDifficulty: make(map[string]float64),
+		lastRetarget:  time.Now(),
+	}
+}
+
+func (s *stratumSession) serve() {
+	defer func() {
+		s.server.removeSession(s)
+		s.conn.Close()
+	}()
+	log.Info("Stratum miner connected from ", s.conn.RemoteAddr())
+
+	scanner := bufio.NewScanner(s.conn)
+	scanner.Buffer(make([]byte, 0, 1024), stratumMaxLineLen)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var request stratumRequest
+		if err := json.Unmarshal(line, &request); err != nil {
+			log.Warn("Stratum invalid request from ", s.conn.RemoteAddr(), ": ", err)
+			return
+		}
+		result, err := s.handle(&request)
+		var stratumErr *stratumError
+		if err != nil {
+			var ok bool
+			if stratumErr, ok = err.(*stratumError); !ok {
+				stratumErr = &stratumError{errStratumOther.code, err.Error()}
+			}
+			result = nil
+		}
+		if err := s.send(&stratumResponse{ID: request.ID, Result: result, Error: stratumErr}); err != nil {
+			return
+		}
+		if request.Method == "mining.subscribe" && err == nil {
+			s.sendDifficulty()
+			if job := s.server.currentJob(); job != nil {
+				s.notify(job, true)
+			}
+		}
+	}
+	log.Info("Stratum miner disconnected from ", s.conn.RemoteAddr())
+}
+
+func (s *stratumSession) send(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err = s.conn.Write(append(data, '\n'))
+	return err
+}
+
+func (s *stratumSession) handle(request *stratumRequest) (interface{}, error) {
+	switch request.Method {
+	case "mining.subscribe":
+		s.mu.Lock()
+		s.subscribed = true
+		s.mu.Unlock()
+		id := hex.EncodeToString(s.extraNonce1)
+		return []interface{}{
+			[]interface{}{
+				[]interface{}{"mining.set_difficulty", id},
+				[]interface{}{"mining.notify", id},
+			},
+			id,
+			stratumExtraNonce2Size,
+		}, nil
+	case "mining.authorize":
+		if len(request.Params) < 1 {
+			return nil, errStratumOther
+		}
+		worker, ok := request.Params[0].(string)
+		if !ok {
+			return nil, errStratumOther
+		}
+		var password string
+		if len(request.Params) > 1 {
+			password, _ = request.Params[1].(string)
+		}
+		if !s.server.authorize(worker, password) {
+			log.Warn("Stratum worker ", worker, " refused from ", s.conn.RemoteAddr())
+			return nil, errStratumUnauthorized
+		}
+		s.mu.Lock()
+		s.workers[worker] = true
+		s.mu.Unlock()
+		log.Info("Stratum worker ", worker, " authorized from ", s.conn.RemoteAddr())
+		return true, nil
+	case "mining.configure":
+		return s.configure(request.Params), nil
+	case "mining.extranonce.subscribe":
+		return true, nil
+	case "mining.submit":
+		if err := s.submit(request.Params); err != nil {
+			if err == errStratumJobNotFound {
+				stratumShares.Inc("stale")
+			} else {
+				stratumShares.Inc("rejected")
+			}
+			return nil, err
+		}
+		return true, nil
+	default:
+		return nil, &stratumError{errStratumOther.code, "Unknown method " + request.Method}
+	}
+}
+
+// configure answers the extensions of the miner, only version rolling is
+// supported.
+func (s *stratumSession) configure(params []interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	if len(params) < 2 {
+		return result
+	}
+	extensions, _ := params[0].([]interface{})
+	options, _ := params[1].(map[string]interface{})
+	for _, extension := range extensions {
+		if extension != "version-rolling" {
+			continue
+		}
+		mask := uint32(stratumVersionRollingMask)
+		if m, ok := options["version-rolling.mask"].(string); ok {
+			if requested, err := strconv.ParseUint(m, 16, 32); err == nil {
+				mask &= uint32(requested)
+			}
+		}
+		s.mu.Lock()
+		s.versionMask = mask
+		s.mu.Unlock()
+		result["version-rolling"] = true
+		result["version-rolling.mask"] = fmt.Sprintf("%08x", mask)
+	}
+	return result
+}
+
+func (s *stratumSession) sendDifficulty() {
+	s.mu.Lock()
+	difficulty := s.difficulty
+	s.mu.Unlock()
+	s.send(&stratumNotification{Method: "mining.set_difficulty", Params: []interface{}{difficulty}})
+}
+
+// notify sends the job to the miner. The difficulty is retargeted before,
+// so the shares of the job are checked with the difficulty the miner knew.
+func (s *stratumSession) notify(job *stratumJob, clean bool) {
+	s.mu.Lock()
+	if !s.subscribed {
+		s.mu.Unlock()
+		return
+	}
+	retargeted := s.retarget()
+	if clean {
+		s.jobDifficulty = make(map[string]float64)
+	} else if len(s.jobDifficulty) > stratumMaxJobs*2 {
+		// the jobs the server dropped
+		for id := range s.jobDifficulty {
+			if !s.server.hasJob(id) {
+				delete(s.jobDifficulty, id)
+			}
+		}
+	}
+	s.jobDifficulty[job.id] = s.difficulty
+	s.mu.Unlock()
+
+	if retargeted {
+		s.sendDifficulty()
+	}
+	// the parent block has no previous block, the hash is zero
+	prevHash := hex.EncodeToString(make([]byte, 32))
+	s.send(&stratumNotification{Method: "mining.notify", Params: []interface{}{
+		job.id,
+		prevHash,
+		hex.EncodeToString(job.coinb1),
+		hex.EncodeToString(job.coinb2),
+		[]string{},
+		fmt.Sprintf("%08x", job.version),
+		fmt.Sprintf("%08x", job.block.Blockdata.Bits),
+		fmt.Sprintf("%08x", job.ntime),
+		clean,
+	}})
+}
+
+// retarget changes the difficulty so the miner sends a share about every
+// stratumShareTargetSecs, the caller holds the lock.
+func (s *stratumSession) retarget() bool {
+	elapsed := time.Since(s.lastRetarget).Seconds()
+	if elapsed < stratumRetargetSecs {
+		return false
+	}
+	var factor float64
+	if s.shares == 0 {
+		factor = 0.5
+	} else {
+		factor = stratumShareTargetSecs / (elapsed / float64(s.shares))
+	}
+	if factor > 4 {
+		factor = 4
+	} else if factor < 0.25 {
+		factor = 0.25
+	}
+	s.shares = 0
+	s.lastRetarget = time.Now()
+
+	difficulty := s.difficulty * factor
+	if difficulty < stratumMinDifficulty {
+		difficulty = stratumMinDifficulty
+	}
+	if difficulty == s.difficulty {
+		return false
+	}
+	s.difficulty = difficulty
+	return true
+}
+
+// submit checks a share, params are the worker, the job id, extranonce2,
+// ntime, nonce and, with version rolling, the version bits.
+func (s *stratumSession) submit(params []interface{}) error {
+	if len(params) < 5 {
+		return errStratumOther
+	}
+	values := make([]string, len(params))
+	for i, param := range params {
+		value, ok := param.(string)
+		if !ok {
+			return errStratumOther
+		}
+		values[i] = value
+	}
+	worker, jobID := values[0], values[1]
+
+	s.mu.Lock()
+	subscribed, authorized, versionMask := s.subscribed, s.workers[worker], s.versionMask
+	difficulty, ok := s.jobDifficulty[jobID]
+	s.mu.Unlock()
+	switch {
+	case !subscribed:
+		return errStratumNotSubscribed
+	case !authorized:
+		return errStratumUnauthorized
+	case !ok:
+		return errStratumJobNotFound
+	}
+
+	extraNonce2, err := hex.DecodeString(values[2])
+	if err != nil || len(extraNonce2) != stratumExtraNonce2Size {
+		return errors.New("Incorrect size of extranonce2")
+	}
+	ntime, err := strconv.ParseUint(values[3], 16, 32)
+	if err != nil {
+		return errors.New("Invalid ntime")
+	}
+	nonce, err := strconv.ParseUint(values[4], 16, 32)
+	if err != nil {
+		return errors.New("Invalid nonce")
+	}
+	var versionBits uint64
+	if len(values) > 5 && versionMask != 0 {
+		if versionBits, err = strconv.ParseUint(values[5], 16, 32); err != nil {
+			return errors.New("Invalid version bits")
+		}
+		if uint32(versionBits)&^versionMask != 0 {
+			return errors.New("Version bits out of the mask")
+		}
+	}
+
+	share := fmt.Sprintf("%x%x%08x%08x%08x", s.extraNonce1, extraNonce2, ntime, nonce, versionBits)
+	job, err := s.server.getJob(jobID, share)
+	if err != nil {
+		return err
+	}
+	if uint32(ntime) < job.ntime || int64(ntime) > time.Now().Unix()+stratumMaxTimeOffset {
+		return errors.New("ntime out of range")
+	}
+
+	// the coinbase and the header the miner hashed
+	data := make([]byte, 0, len(job.coinb1)+len(s.extraNonce1)+len(extraNonce2)+len(job.coinb2))
+	data = append(data, job.coinb1...)
+	data = append(data, s.extraNonce1...)
+	data = append(data, extraNonce2...)
+	data = append(data, job.coinb2...)
+	coinbase := new(auxpow.BtcTx)
+	if err := coinbase.Deserialize(bytes.NewReader(data)); err != nil {
+		return err
+	}
+	header := &auxpow.BtcBlockHeader{
+		Version:    int32(job.version&^versionMask | uint32(versionBits)),
+		PrevBlock:  Uint256{},
+		MerkleRoot: coinbase.Hash(),
+		Timestamp:  uint32(ntime),
+		Bits:       job.block.Blockdata.Bits,
+		Nonce:      uint32(nonce),
+	}
+	hash := header.Hash()
+	hashNum := ledger.HashToBig(&hash)
+	if hashNum.Cmp(difficultyToTarget(difficulty)) > 0 {
+		return errStratumLowDifficulty
+	}
+
+	s.mu.Lock()
+	s.shares++
+	s.mu.Unlock()
+	stratumShares.Inc("accepted")
+
+	if hashNum.Cmp(job.target) <= 0 {
+		if err := s.server.submitBlock(job, coinbase, header); err != nil {
+			log.Warn("Stratum block of worker ", worker, " refused: ", err)
+			return nil
+		}
+		stratumShares.Inc("block")
+		log.Infof("Stratum worker %s found block %d", worker, job.block.Blockdata.Height)
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package pow
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/config"
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/core/auxpow"
+	"Elastos.ELA/core/ledger"
+)
+
+type stratumMessage struct {
+	ID     interface{}     `json:"id"`
+	Method string          `json:"method"`
+	Params []interface{}   `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  []interface{}   `json:"error"`
+}
+
+// stratumClient is the miner end of a session.
+type stratumClient struct {
+	t        *testing.T
+	conn     net.Conn
+	messages chan *stratumMessage
+	lastID   int
+}
+
+func newStratumClient(t *testing.T, conn net.Conn) *stratumClient {
+	c := &stratumClient{t: t, conn: conn, messages: make(chan *stratumMessage, 16)}
+	go func() {
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			var msg stratumMessage
+			if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+				t.Error(err)
+				return
+			}
+			c.messages <- &msg
+		}
+		close(c.messages)
+	}()
+	return c
+}
+
+func (c *stratumClient) next() *stratumMessage {
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("session closed")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("no message from the session")
+	}
+	return nil
+}
+
+// call sends the request and returns the response.
+func (c *stratumClient) call(method string, params ...interface{}) *stratumMessage {
+	c.lastID++
+	data, _ := json.Marshal(map[string]interface{}{"id": c.lastID, "method": method, "params": params})
+	if _, err := c.conn.Write(append(data, '\n')); err != nil {
+		c.t.Fatal(err)
+	}
+	msg := c.next()
+	if id, _ := msg.ID.(float64); int(id) != c.lastID {
+		c.t.Fatalf("response of %s has id %v", method, msg.ID)
+	}
+	return msg
+}
+
+// errorCode returns the stratum error code of the response, 0 for a result.
+func errorCode(msg *stratumMessage) int {
+	if len(msg.Error) == 0 {
+		return 0
+	}
+	code, _ := msg.Error[0].(float64)
+	return int(code)
+}
+
+func newTestStratumServer(t *testing.T) (*StratumServer, *stratumJob) {
+	log.Init()
+	s := newStratumServer(nil, []config.StratumUser{{User: "pool", Password: "secret"}})
+	block := &ledger.Block{Blockdata: &ledger.Blockdata{Height: 5, Timestamp: 1514000000, Bits: 0x1d00ffff}}
+	job, err := s.makeJob(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.jobs[job.id] = job
+	s.jobOrder = []string{job.id}
+	s.current = job
+	return s, job
+}
+
+// shareHash returns the hash of the header a miner of the session solves.
+func shareHash(t *testing.T, job *stratumJob, extraNonce1, extraNonce2 []byte, ntime, nonce uint32) Uint256 {
+	data := append(append(append(append([]byte{}, job.coinb1...), extraNonce1...), extraNonce2...), job.coinb2...)
+	coinbase := new(auxpow.BtcTx)
+	if err := coinbase.Deserialize(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	header := &auxpow.BtcBlockHeader{
+		Version:    int32(job.version),
+		MerkleRoot: coinbase.Hash(),
+		Timestamp:  ntime,
+		Bits:       job.block.Blockdata.Bits,
+		Nonce:      nonce,
+	}
+	return header.Hash()
+}
+
+func TestStratumAuthorize(t *testing.T) {
+	s, _ := newTestStratumServer(t)
+	for _, c := range []struct {
+		worker, password string
+		ok               bool
+	}{
+		{"pool", "secret", true},
+		{"pool.rig1", "secret", true},
+		{"pool", "wrong", false},
+		{"pool.rig1", "", false},
+		{"other", "secret", false},
+		{"poolx", "secret", false},
+	} {
+		if s.authorize(c.worker, c.password) != c.ok {
+			t.Errorf("worker %s with password %q authorized %v, want %v", c.worker, c.password, !c.ok, c.ok)
+		}
+	}
+	if newStratumServer(nil, nil).authorize("pool", "") {
+		t.Error("worker authorized by a server without users")
+	}
+}
+
+func TestStratumSession(t *testing.T) {
+	s, job := newTestStratumServer(t)
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	session := s.newSession(serverConn)
+	go session.serve()
+	c := newStratumClient(t, clientConn)
+
+	extraNonce2 := "00000001"
+	ntime := fmt.Sprintf("%08x", job.ntime)
+	if code := errorCode(c.call("mining.submit", "pool", job.id, extraNonce2, ntime, "00000000")); code != errStratumNotSubscribed.code {
+		t.Fatalf("submit before subscribe returns error %d", code)
+	}
+
+	// subscribe, the difficulty and the current job follow the response
+	msg := c.call("mining.subscribe", "test/1.0")
+	var result []interface{}
+	if err := json.Unmarshal(msg.Result, &result); err != nil || len(result) != 3 {
+		t.Fatalf("subscribe result %s", msg.Result)
+	}
+	extraNonce1, err := hex.DecodeString(result[1].(string))
+	if err != nil || !bytes.Equal(extraNonce1, session.extraNonce1) {
+		t.Fatalf("extranonce1 is %v, want %x", result[1], session.extraNonce1)
+	}
+	if size, _ := result[2].(float64); size != stratumExtraNonce2Size {
+		t.Fatalf("extranonce2 size is %v", result[2])
+	}
+	msg = c.next()
+	if msg.Method != "mining.set_difficulty" || msg.Params[0] != config.Parameters.PowConfiguration.StratumDifficulty {
+		t.Fatalf("%s %v sent after subscribe, want the difficulty", msg.Method, msg.Params)
+	}
+	msg = c.next()
+	if msg.Method != "mining.notify" || len(msg.Params) != 9 {
+		t.Fatalf("%s %v sent after subscribe, want the job", msg.Method, msg.Params)
+	}
+	if msg.Params[0] != job.id || msg.Params[2] != hex.EncodeToString(job.coinb1) ||
+		msg.Params[3] != hex.EncodeToString(job.coinb2) || msg.Params[7] != ntime || msg.Params[8] != true {
+		t.Fatalf("notify params %v do not match the job", msg.Params)
+	}
+
+	// authorize
+	if code := errorCode(c.call("mining.authorize", "pool.rig1", "wrong")); code != errStratumUnauthorized.code {
+		t.Fatalf("wrong password returns error %d", code)
+	}
+	if code := errorCode(c.call("mining.submit", "pool.rig1", job.id, extraNonce2, ntime, "00000000")); code != errStratumUnauthorized.code {
+		t.Fatalf("submit of a refused worker returns error %d", code)
+	}
+	if msg := c.call("mining.authorize", "pool.rig1", "secret"); string(msg.Result) != "true" {
+		t.Fatalf("authorize returns %s %v", msg.Result, msg.Error)
+	}
+
+	// a share of a low difficulty, which is not a block
+	session.mu.Lock()
+	session.jobDifficulty[job.id] = 1e-9
+	session.mu.Unlock()
+	shareTarget := difficultyToTarget(1e-9)
+	en2, _ := hex.DecodeString(extraNonce2)
+	var share, low string
+	for nonce := uint32(0); share == "" || low == ""; nonce++ {
+		hash := shareHash(t, job, extraNonce1, en2, job.ntime, nonce)
+		hashNum := ledger.HashToBig(&hash)
+		if hashNum.Cmp(job.target) <= 0 {
+			continue
+		}
+		if hashNum.Cmp(shareTarget) <= 0 {
+			if share == "" {
+				share = fmt.Sprintf("%08x", nonce)
+			}
+		} else if low == "" {
+			low = fmt.Sprintf("%08x", nonce)
+		}
+	}
+
+	for _, submit := range []struct {
+		name   string
+		params []interface{}
+		code   int
+	}{
+		{"unknown job", []interface{}{"pool.rig1", "ff", extraNonce2, ntime, share}, errStratumJobNotFound.code},
+		{"short extranonce2", []interface{}{"pool.rig1", job.id, "0001", ntime, share}, errStratumOther.code},
+		{"early ntime", []interface{}{"pool.rig1", job.id, extraNonce2, fmt.Sprintf("%08x", job.ntime-1), share}, errStratumOther.code},
+		{"low difficulty", []interface{}{"pool.rig1", job.id, extraNonce2, ntime, low}, errStratumLowDifficulty.code},
+		{"share", []interface{}{"pool.rig1", job.id, extraNonce2, ntime, share}, 0},
+		{"duplicate", []interface{}{"pool.rig1", job.id, extraNonce2, ntime, share}, errStratumDuplicateShare.code},
+	} {
+		if code := errorCode(c.call("mining.submit", submit.params...)); code != submit.code {
+			t.Errorf("%s returns error %d, want %d", submit.name, code, submit.code)
+		}
+	}
+	session.mu.Lock()
+	shares := session.shares
+	session.mu.Unlock()
+	if shares != 1 {
+		t.Fatalf("%d shares counted, want 1", shares)
+	}
+
+	// a new job of the same block keeps the old ones
+	next, err := s.makeJob(job.block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go session.notify(next, false)
+	msg = c.next()
+	if msg.Method != "mining.notify" || msg.Params[0] != next.id || msg.Params[8] != false {
+		t.Fatalf("%s %v sent for the new job", msg.Method, msg.Params)
+	}
+	session.mu.Lock()
+	_, kept := session.jobDifficulty[job.id]
+	session.mu.Unlock()
+	if !kept {
+		t.Fatal("difficulty of the old job is dropped")
+	}
+}
@@ -0,0 +1,104 @@
+package pow
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/core/ledger"
+	"Elastos.ELA/events"
+)
+
+// BlockTemplate is a block to mine with what an external miner needs to
+// build blocks of its own from it.
+type BlockTemplate struct {
+	Block *ledger.Block
+	// the fee of each transaction, the coinbase first with none
+	Fees []Fixed64
+	// the subsidy of the height and the fees, the foundation takes its
+	// share from it
+	CoinbaseValue Fixed64
+	MinTime       uint32
+	LongPollID    string
+}
+
+// templateNotifier tells the miners waiting on a template that the best
+// block or the transaction pool changed.
+type templateNotifier struct {
+	sync.Mutex
+	updates uint64
+	changed chan struct{}
+	// the hash of the best block
+	bestHash func() Uint256
+}
+
+func newTemplateNotifier() *templateNotifier {
+	n := &templateNotifier{
+		changed:  make(chan struct{}),
+		bestHash: ledger.DefaultLedger.Blockchain.CurrentBlockHash,
+	}
+	ledger.DefaultLedger.Blockchain.BCEvents.Subscribe(events.EventBlockPersistCompleted, n.update)
+	ledger.DefaultLedger.Blockchain.BCEvents.Subscribe(events.EventNewTransactionPutInPool, n.update)
+	return n
+}
+
+func (n *templateNotifier) update(v interface{}) {
+	n.Lock()
+	n.updates++
+	close(n.changed)
+	n.changed = make(chan struct{})
+	n.Unlock()
+}
+
+// longPollID identifies the state a template is made from, the best block
+// and the number of updates of the pool.
+func (n *templateNotifier) longPollID() (string, <-chan struct{}) {
+	n.Lock()
+	defer n.Unlock()
+	hash := n.bestHash()
+	return fmt.Sprintf("%s%d", BytesToHexString(hash.ToArrayReverse()), n.updates), n.changed
+}
+
+// NewBlockTemplate creates a block paying the miner part of the reward to the
+// address.
+func (pow *PowService) NewBlockTemplate(addr string) (*BlockTemplate, error) {
+	// taken before the block, a change while it is made is not missed
+	longPollID, _ := pow.templates.longPollID()
+	block, err := pow.GenerateBlock(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	fees := make([]Fixed64, len(block.Transactions))
+	coinbaseValue := Fixed64(calcBlockSubsidy(block.Blockdata.Height))
+	for i, txn := range block.Transactions[1:] {
+		fees[i+1] = txn.Fee
+		coinbaseValue += txn.Fee
+	}
+	return &BlockTemplate{
+		Block:         block,
+		Fees:          fees,
+		CoinbaseValue: coinbaseValue,
+		MinTime:       uint32(ledger.DefaultLedger.Blockchain.MedianTimePast.Add(time.Second).Unix()),
+		LongPollID:    longPollID,
+	}, nil
+}
+
+// WaitTemplateChange returns when the template of the long poll id is out of
+// date, or after the timeout.
+func (pow *PowService) WaitTemplateChange(longPollID string, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		current, changed := pow.templates.longPollID()
+		if current != longPollID {
+			return
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package pow
+
+import (
+	"testing"
+	"time"
+
+	. "Elastos.ELA/common"
+)
+
+func newTestTemplateService(best *Uint256) *PowService {
+	n := &templateNotifier{
+		changed:  make(chan struct{}),
+		bestHash: func() Uint256 { return *best },
+	}
+	return &PowService{templates: n}
+}
+
+// waitTemplateChange runs the long poll and returns a channel closed when it
+// returns.
+func waitTemplateChange(pow *PowService, longPollID string, timeout time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		pow.WaitTemplateChange(longPollID, timeout)
+		close(done)
+	}()
+	return done
+}
+
+func TestLongPollID(t *testing.T) {
+	best := Uint256{1}
+	pow := newTestTemplateService(&best)
+	id, _ := pow.templates.longPollID()
+	if again, _ := pow.templates.longPollID(); again != id {
+		t.Fatalf("long poll id changed from %s to %s without an update", id, again)
+	}
+	pow.templates.update(nil)
+	updated, _ := pow.templates.longPollID()
+	if updated == id {
+		t.Fatal("long poll id is kept by an update of the pool")
+	}
+	best = Uint256{2}
+	if tip, _ := pow.templates.longPollID(); tip == updated {
+		t.Fatal("long poll id is kept by a new best block")
+	}
+}
+
+func TestWaitTemplateChange(t *testing.T) {
+	best := Uint256{1}
+	pow := newTestTemplateService(&best)
+
+	// a template made before the last update is out of date already
+	stale, _ := pow.templates.longPollID()
+	pow.templates.update(nil)
+	select {
+	case <-waitTemplateChange(pow, stale, time.Minute):
+	case <-time.After(5 * time.Second):
+		t.Fatal("long poll of a stale id waits")
+	}
+
+	// the miner is woken up by the next update
+	id, _ := pow.templates.longPollID()
+	done := waitTemplateChange(pow, id, time.Minute)
+	select {
+	case <-done:
+		t.Fatal("long poll returns before an update")
+	case <-time.After(50 * time.Millisecond):
+	}
+	pow.templates.update(nil)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("long poll is not woken up by the update")
+	}
+
+	// and by the timeout when nothing changes
+	id, _ = pow.templates.longPollID()
+	select {
+	case <-waitTemplateChange(pow, id, 50*time.Millisecond):
+	case <-time.After(5 * time.Second):
+		t.Fatal("long poll does not time out")
+	}
+}
@@ -186,6 +186,12 @@ func (bc *Blockchain) ProcessOrphans(hash *Uint256) error {
 	return nil
 }
 
+func (bc *Blockchain) GetOrphanCount() int {
+	bc.OrphanLock.RLock()
+	defer bc.OrphanLock.RUnlock()
+	return len(bc.Orphans)
+}
+
 func (bc *Blockchain) RemoveOrphanBlock(orphan *OrphanBlock) {
 	bc.OrphanLock.Lock()
 	defer bc.OrphanLock.Unlock()
@@ -612,6 +618,20 @@ func (bc *Blockchain) GetReorganizeNodes(node *BlockNode) (*list.List, *list.Lis
 	return detachNodes, attachNodes
 }
 
+// ReorganizeEvent is sent with EventReorganizeChain when the best chain
+// switches to another branch. Like the other chain events it is delivered
+// asynchronously, a subscriber may get it after the EventBlockPersistCompleted
+// of the attached blocks.
+type ReorganizeEvent struct {
+	// the last block both branches have
+	ForkHash   Uint256
+	ForkHeight uint32
+	// the blocks taken out of the best chain, the old tip first
+	Detached []Uint256
+	// the blocks put into the best chain, the one after the fork first
+	Attached []Uint256
+}
+
 // reorganizeChain reorganizes the block chain by disconnecting the nodes in the
 // detachNodes list and connecting the nodes in the attach list.  It expects
 // that the lists are already in the correct order and are in sync with the
@@ -675,6 +695,24 @@ func (bc *Blockchain) ReorganizeChain(detachNodes, attachNodes *list.List) error
 		delete(bc.BlockCache, *n.Hash)
 	}
 
+	// Notify the subscribers of the blocks taken out of and put into the
+	// best chain, to revert what they did with the detached ones.
+	event := &ReorganizeEvent{}
+	for e := detachNodes.Front(); e != nil; e = e.Next() {
+		event.Detached = append(event.Detached, *e.Value.(*BlockNode).Hash)
+	}
+	for e := attachNodes.Front(); e != nil; e = e.Next() {
+		event.Attached = append(event.Attached, *e.Value.(*BlockNode).Hash)
+	}
+	if attachNodes.Len() > 0 {
+		firstAttachNode := attachNodes.Front().Value.(*BlockNode)
+		event.ForkHash = *firstAttachNode.ParentHash
+		event.ForkHeight = firstAttachNode.Height - 1
+	}
+	log.Infof("REORGANIZE: Chain forks at %x, %d blocks detached, %d attached",
+		event.ForkHash.ToArrayReverse(), len(event.Detached), len(event.Attached))
+	bc.BCEvents.Notify(events.EventReorganizeChain, event)
+
 	// Log the point where the chain forked.
 	//firstAttachNode := attachNodes.Front().Value.(*BlockNode)
 	//forkNode, err := bc.GetPrevNodeFromNode(firstAttachNode)
@@ -1078,6 +1116,48 @@ func (b *Blockchain) LookupNodeInIndex(hash *Uint256) (*BlockNode, bool) {
 	return node, exist
 }
 
+// ChainTip is the last block of a branch of the block index.
+type ChainTip struct {
+	Hash   Uint256
+	Height uint32
+	// the number of blocks from the best chain to the tip, zero for the
+	// best chain itself
+	BranchLen uint32
+	Status    string
+}
+
+// ChainTips returns the best chain and the forks of the block index, the
+// branches forked before the oldest block in memory are not known.
+func (b *Blockchain) ChainTips() []ChainTip {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	b.IndexLock.RLock()
+	defer b.IndexLock.RUnlock()
+
+	var tips []ChainTip
+	for hash, node := range b.Index {
+		if len(node.Children) > 0 {
+			continue
+		}
+		tip := ChainTip{Hash: hash, Height: node.Height}
+		for n := node; n != nil && !n.InMainChain; n = n.Parent {
+			tip.BranchLen++
+		}
+		switch {
+		case tip.BranchLen == 0:
+			tip.Status = "active"
+		case b.BlockCache[hash] != nil:
+			// the blocks of the branch are kept to connect them in a
+			// reorganization
+			tip.Status = "valid-fork"
+		default:
+			tip.Status = "valid-headers"
+		}
+		tips = append(tips, tip)
+	}
+	return tips
+}
+
 func (b *Blockchain) BlockLocatorFromHash(inhash *Uint256) BlockLocator {
 	b.mutex.RLock()
 	defer b.mutex.RUnlock()
@@ -0,0 +1,146 @@
+package ledger
+
+import (
+	"container/list"
+	"testing"
+	"time"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/events"
+)
+
+// testBlockStore keeps the blocks of the test chain, saving and rolling
+// back blocks do nothing.
+type testBlockStore struct {
+	ILedgerStore
+	blocks map[Uint256]*Block
+}
+
+func (s *testBlockStore) GetBlock(hash Uint256) (*Block, error)    { return s.blocks[hash], nil }
+func (s *testBlockStore) SaveBlock(b *Block, ledger *Ledger) error { return nil }
+func (s *testBlockStore) RollbackBlock(hash Uint256) error         { return nil }
+
+type testChain struct {
+	*Blockchain
+	store *testBlockStore
+}
+
+func newTestChain() *testChain {
+	log.Init()
+	store := &testBlockStore{blocks: make(map[Uint256]*Block)}
+	return &testChain{Blockchain: NewBlockchain(0, &Ledger{Store: store}), store: store}
+}
+
+// addNode adds the block on the parent to the index, to the main chain or to
+// the side chain cache.
+func (c *testChain) addNode(parent *BlockNode, mainChain, cached bool) *BlockNode {
+	b := &Block{Blockdata: &Blockdata{Timestamp: 1514000000 + uint32(len(c.Index))}}
+	if parent != nil {
+		b.Blockdata.PrevBlockHash = *parent.Hash
+		b.Blockdata.Height = parent.Height + 1
+	}
+	hash := b.Hash()
+	node := &BlockNode{
+		Hash:        &hash,
+		ParentHash:  &b.Blockdata.PrevBlockHash,
+		Height:      b.Blockdata.Height,
+		Timestamp:   b.Blockdata.Timestamp,
+		InMainChain: mainChain,
+		Parent:      parent,
+	}
+	if parent != nil {
+		parent.Children = append(parent.Children, node)
+	}
+	c.Index[hash] = node
+	c.store.blocks[hash] = b
+	if mainChain {
+		c.BestChain = node
+	}
+	if cached {
+		c.BlockCache[hash] = b
+	}
+	return node
+}
+
+func chainTipsByHash(tips []ChainTip) map[Uint256]ChainTip {
+	byHash := make(map[Uint256]ChainTip)
+	for _, tip := range tips {
+		byHash[tip.Hash] = tip
+	}
+	return byHash
+}
+
+func TestChainTips(t *testing.T) {
+	c := newTestChain()
+	genesis := c.addNode(nil, true, false)
+	a1 := c.addNode(genesis, true, false)
+	a2 := c.addNode(a1, true, false)
+	b1 := c.addNode(genesis, false, true)
+	b2 := c.addNode(b1, false, true)
+	// a block of which only the header is known
+	c1 := c.addNode(a1, false, false)
+
+	tips := chainTipsByHash(c.ChainTips())
+	for _, want := range []ChainTip{
+		{Hash: *a2.Hash, Height: 2, BranchLen: 0, Status: "active"},
+		{Hash: *b2.Hash, Height: 2, BranchLen: 2, Status: "valid-fork"},
+		{Hash: *c1.Hash, Height: 2, BranchLen: 1, Status: "valid-headers"},
+	} {
+		if tip, ok := tips[want.Hash]; !ok || tip != want {
+			t.Errorf("tip %+v, want %+v", tip, want)
+		}
+	}
+	if len(tips) != 3 {
+		t.Fatalf("%d tips, want 3", len(tips))
+	}
+}
+
+func TestReorganizeEvent(t *testing.T) {
+	c := newTestChain()
+	genesis := c.addNode(nil, true, false)
+	a1 := c.addNode(genesis, true, false)
+	a2 := c.addNode(a1, true, false)
+	b1 := c.addNode(genesis, false, true)
+	b2 := c.addNode(b1, false, true)
+	b3 := c.addNode(b2, false, true)
+
+	received := make(chan *ReorganizeEvent, 1)
+	c.BCEvents.Subscribe(events.EventReorganizeChain, func(v interface{}) {
+		received <- v.(*ReorganizeEvent)
+	})
+	detach, attach := list.New(), list.New()
+	detach.PushBack(a2)
+	detach.PushBack(a1)
+	for _, n := range []*BlockNode{b1, b2, b3} {
+		attach.PushBack(n)
+	}
+	if err := c.ReorganizeChain(detach, attach); err != nil {
+		t.Fatal(err)
+	}
+
+	var event *ReorganizeEvent
+	select {
+	case event = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reorganize event")
+	}
+	if event.ForkHash != *genesis.Hash || event.ForkHeight != 0 {
+		t.Fatalf("chain forks at %x %d, want the genesis", event.ForkHash, event.ForkHeight)
+	}
+	if len(event.Detached) != 2 || event.Detached[0] != *a2.Hash || event.Detached[1] != *a1.Hash {
+		t.Fatal("detached blocks are not the old tip first")
+	}
+	if len(event.Attached) != 3 || event.Attached[0] != *b1.Hash || event.Attached[2] != *b3.Hash {
+		t.Fatal("attached blocks are not the one after the fork first")
+	}
+
+	// the old branch is kept to switch back
+	tips := chainTipsByHash(c.ChainTips())
+	if tip := tips[*b3.Hash]; tip.Status != "active" {
+		t.Fatalf("new tip is %q", tip.Status)
+	}
+	if tip := tips[*a2.Hash]; tip.Status != "valid-fork" || tip.BranchLen != 2 {
+		t.Fatalf("old tip is %q with %d blocks", tip.Status, tip.BranchLen)
+	}
+}
@@ -36,6 +36,7 @@ type ILedgerStore interface {
 
 	GetHeaderHashFront() (Uint256, error)
 	GetHeaderHashNext(prevHash Uint256) (Uint256, error)
+	GetHeaderHashes(count int) []Uint256
 	RemoveHeaderListElement(hash Uint256)
 
 	InitLedgerStoreWithGenesisBlock(genesisblock *Block) (uint32, error)
@@ -45,8 +46,10 @@ type ILedgerStore interface {
 	GetUnspentFromProgramHash(programHash Uint168, assetid Uint256) ([]*tx.UTXOUnspent, error)
 	GetUnspentsFromProgramHash(programHash Uint168) (map[Uint256][]*tx.UTXOUnspent, error)
 	GetAssets() map[Uint256]*Asset
+	GetAddressHistory(programHash Uint168, offset, limit uint32) ([]*tx.TxHistory, uint32, error)
 
 	IsTxHashDuplicate(txhash Uint256) bool
 	IsBlockInStore(hash Uint256) bool
+	IsPruned() bool
 	Close()
 }
@@ -0,0 +1,93 @@
+package ledger
+
+import (
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/serialization"
+	"Elastos.ELA/crypto"
+	"errors"
+	"io"
+)
+
+// TxProof proves a transaction is included in a block, it carries the
+// block header so it can be checked against a header chain alone. The
+// transaction count of the block fixes the branch length, so an inner node
+// of the tree can not be passed off as a transaction.
+type TxProof struct {
+	Header       *Blockdata
+	Txid         Uint256
+	Transactions uint32
+	Proof        crypto.MerkleProof
+}
+
+// NewTxProof builds the inclusion proof of txid in the block.
+func NewTxProof(block *Block, txid Uint256) (*TxProof, error) {
+	index := -1
+	hashes := make([]Uint256, 0, len(block.Transactions))
+	for i, txn := range block.Transactions {
+		hash := txn.Hash()
+		if hash == txid {
+			index = i
+		}
+		hashes = append(hashes, hash)
+	}
+	if index < 0 {
+		return nil, errors.New("[TxProof] transaction not found in block")
+	}
+
+	tree, err := crypto.NewMerkleTree(hashes)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := tree.GenerateProof(uint32(index))
+	if err != nil {
+		return nil, err
+	}
+
+	return &TxProof{
+		Header:       block.Blockdata,
+		Txid:         txid,
+		Transactions: uint32(len(block.Transactions)),
+		Proof:        *proof,
+	}, nil
+}
+
+// Verify checks the proof against the TransactionsRoot of its header.
+func (p *TxProof) Verify() error {
+	if p.Proof.Index >= p.Transactions {
+		return errors.New("[TxProof] transaction index out of range")
+	}
+	if len(p.Proof.Hashes) != crypto.MerkleProofDepth(p.Transactions) {
+		return errors.New("[TxProof] merkle branch does not match the transaction count")
+	}
+	if !p.Proof.Verify(p.Txid, p.Header.TransactionsRoot) {
+		return errors.New("[TxProof] merkle root mismatch")
+	}
+	return nil
+}
+
+func (p *TxProof) Serialize(w io.Writer) error {
+	p.Header.Serialize(w)
+	if _, err := p.Txid.Serialize(w); err != nil {
+		return err
+	}
+	if err := serialization.WriteUint32(w, p.Transactions); err != nil {
+		return err
+	}
+	return p.Proof.Serialize(w)
+}
+
+func (p *TxProof) Deserialize(r io.Reader) error {
+	p.Header = new(Blockdata)
+	if err := p.Header.Deserialize(r); err != nil {
+		return err
+	}
+	if err := p.Txid.Deserialize(r); err != nil {
+		return err
+	}
+	transactions, err := serialization.ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	p.Transactions = transactions
+	return p.Proof.Deserialize(r)
+}
@@ -0,0 +1,84 @@
+package ledger
+
+import (
+	"bytes"
+	"testing"
+
+	. "Elastos.ELA/common"
+	tx "Elastos.ELA/core/transaction"
+	"Elastos.ELA/core/transaction/payload"
+	"Elastos.ELA/crypto"
+)
+
+func newProofTestBlock(t *testing.T, count int) *Block {
+	block := &Block{Blockdata: &Blockdata{Height: 1}}
+	var hashes []Uint256
+	for i := 0; i < count; i++ {
+		txn, _ := tx.NewCoinBaseTransaction(&payload.CoinBase{}, uint32(i))
+		block.Transactions = append(block.Transactions, txn)
+		hashes = append(hashes, txn.Hash())
+	}
+	root, err := crypto.ComputeRoot(hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.Blockdata.TransactionsRoot = root
+	return block
+}
+
+func TestTxProof(t *testing.T) {
+	for count := 1; count <= 7; count++ {
+		block := newProofTestBlock(t, count)
+		for _, txn := range block.Transactions {
+			proof, err := NewTxProof(block, txn.Hash())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := proof.Serialize(&buf); err != nil {
+				t.Fatal(err)
+			}
+			decoded := new(TxProof)
+			if err := decoded.Deserialize(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Transactions != uint32(count) || decoded.Txid != txn.Hash() {
+				t.Fatalf("%d transactions: proof decoded as %d transactions", count, decoded.Transactions)
+			}
+			if err := decoded.Verify(); err != nil {
+				t.Fatalf("%d transactions: %s", count, err)
+			}
+		}
+	}
+}
+
+// An inner node of the tree is the hash of 64 bytes, like a transaction
+// could be, its shorter branch must not prove it is in the block.
+func TestTxProofInnerNode(t *testing.T) {
+	block := newProofTestBlock(t, 4)
+	hashes := make([]Uint256, 4)
+	for i, txn := range block.Transactions {
+		hashes[i] = txn.Hash()
+	}
+	left := crypto.DoubleSHA256(hashes[0:2])
+	right := crypto.DoubleSHA256(hashes[2:4])
+
+	proof := &TxProof{
+		Header:       block.Blockdata,
+		Txid:         left,
+		Transactions: 4,
+		Proof:        crypto.MerkleProof{Index: 0, Hashes: []Uint256{right}},
+	}
+	if !proof.Proof.Verify(left, block.Blockdata.TransactionsRoot) {
+		t.Fatal("branch of the inner node does not lead to the root")
+	}
+	if err := proof.Verify(); err == nil {
+		t.Fatal("inner node proven as a transaction")
+	}
+
+	proof.Transactions = 2
+	proof.Proof.Index = 2
+	if err := proof.Verify(); err == nil {
+		t.Fatal("index past the transaction count is accepted")
+	}
+}
@@ -73,6 +73,13 @@ func CheckTransactionSanity(txn *tx.Transaction) ErrCode {
 
 // CheckTransactionContext verifys a transaction with history transaction in ledger
 func CheckTransactionContext(txn *tx.Transaction, ledger *Ledger) ErrCode {
+	return CheckPoolTransactionContext(txn, ledger, nil)
+}
+
+// CheckPoolTransactionContext verifys a transaction of the pool with history
+// transaction in ledger, its inputs may also spend outputs of the unconfirmed
+// transactions in parents. The pool checks those are not spent twice.
+func CheckPoolTransactionContext(txn *tx.Transaction, ledger *Ledger, parents map[common.Uint256]*tx.Transaction) ErrCode {
 	// check if duplicated with transaction in ledger
 	if exist := ledger.Store.IsTxHashDuplicate(txn.Hash()); exist {
 		log.Info("[CheckTransactionContext] duplicate transaction check faild.")
@@ -83,14 +90,29 @@ func CheckTransactionContext(txn *tx.Transaction, ledger *Ledger) ErrCode {
 		return Success
 	}
 
+	// the inputs spending the outputs of the ledger
+	confirmed := *txn
+	confirmed.UTXOInputs = nil
+	for _, input := range txn.UTXOInputs {
+		parent, ok := parents[input.ReferTxID]
+		if !ok {
+			confirmed.UTXOInputs = append(confirmed.UTXOInputs, input)
+			continue
+		}
+		if int(input.ReferTxOutputIndex) >= len(parent.Outputs) || parent.Outputs[input.ReferTxOutputIndex].Value <= 0 {
+			log.Warn("Output of unconfirmed referenced transaction is invalid")
+			return ErrInvalidReferedTxn
+		}
+	}
+
 	// check double spent transaction
-	if IsDoubleSpend(txn, ledger) {
+	if IsDoubleSpend(&confirmed, ledger) {
 		log.Info("[CheckTransactionContext] IsDoubleSpend check faild.")
 		return ErrDoubleSpend
 	}
 
 	// check referenced Output value
-	for _, input := range txn.UTXOInputs {
+	for _, input := range confirmed.UTXOInputs {
 		referHash := input.ReferTxID
 		referTxnOutIndex := input.ReferTxOutputIndex
 		referTxn, _, err := ledger.Store.GetTransaction(referHash)
@@ -2,6 +2,7 @@ package ChainStore
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 
@@ -106,6 +107,27 @@ func (db *ChainStore) PersistCurrentBlock(b *Block) error {
 	return nil
 }
 
+// CurrentBlock reads the hash and height of the current block from the
+// store, it works before the blockchain is loaded.
+func (db *ChainStore) CurrentBlock() (Uint256, uint32, error) {
+	data, err := db.Get([]byte{byte(SYS_CurrentBlock)})
+	if err != nil {
+		return Uint256{}, 0, err
+	}
+
+	r := bytes.NewReader(data)
+	var hash Uint256
+	if err := hash.Deserialize(r); err != nil {
+		return Uint256{}, 0, err
+	}
+	height, err := serialization.ReadUint32(r)
+	if err != nil {
+		return Uint256{}, 0, err
+	}
+
+	return hash, height, nil
+}
+
 func (db *ChainStore) RollbackCurrentBlock(b *Block) error {
 	key := bytes.NewBuffer(nil)
 	key.WriteByte(byte(SYS_CurrentBlock))
@@ -463,3 +485,123 @@ func (db *ChainStore) RollbackUnspend(b *Block) error {
 
 	return nil
 }
+
+// key: IX_Address_History || program hash || height(big endian) || txid || asset id
+// value: tx history
+// the height is stored big endian so that the history of a program hash
+// iterates in block order.
+func getAddressHistoryKey(programHash Uint168, h *tx.TxHistory) []byte {
+	key := bytes.NewBuffer(nil)
+	key.WriteByte(byte(IX_Address_History))
+	programHash.Serialize(key)
+	var height [4]byte
+	binary.BigEndian.PutUint32(height[:], h.Height)
+	key.Write(height[:])
+	h.Txid.Serialize(key)
+	h.AssetID.Serialize(key)
+
+	return key.Bytes()
+}
+
+// getAddressHistories returns the net amount every transaction of the block
+// moved in or out of each program hash, grouped by asset.
+func (db *ChainStore) getAddressHistories(b *Block) (map[Uint168][]*tx.TxHistory, error) {
+	blockTxns := make(map[Uint256]*tx.Transaction, len(b.Transactions))
+	for _, txn := range b.Transactions {
+		blockTxns[txn.Hash()] = txn
+	}
+
+	histories := make(map[Uint168][]*tx.TxHistory)
+	for _, txn := range b.Transactions {
+		if txn.TxType == tx.RegisterAsset {
+			continue
+		}
+
+		amounts := make(map[Uint168]map[Uint256]Fixed64)
+		add := func(programHash Uint168, assetID Uint256, value Fixed64) {
+			if _, ok := amounts[programHash]; !ok {
+				amounts[programHash] = make(map[Uint256]Fixed64)
+			}
+			amounts[programHash][assetID] += value
+		}
+
+		for _, output := range txn.Outputs {
+			add(output.ProgramHash, output.AssetID, output.Value)
+		}
+
+		if !txn.IsCoinBaseTx() {
+			for _, input := range txn.UTXOInputs {
+				referTxn, ok := blockTxns[input.ReferTxID]
+				if !ok {
+					var err error
+					referTxn, _, err = db.GetTransaction(input.ReferTxID)
+					if err != nil {
+						return nil, err
+					}
+				}
+				index := input.ReferTxOutputIndex
+				if int(index) >= len(referTxn.Outputs) {
+					return nil, errors.New(fmt.Sprintf("[addressHistory] invalid output index %d of txid: %x.", index, input.ReferTxID))
+				}
+				referTxnOutput := referTxn.Outputs[index]
+				add(referTxnOutput.ProgramHash, referTxnOutput.AssetID, -referTxnOutput.Value)
+			}
+		}
+
+		txid := txn.Hash()
+		for programHash, assets := range amounts {
+			for assetID, value := range assets {
+				h := &tx.TxHistory{
+					Height:    b.Blockdata.Height,
+					Txid:      txid,
+					AssetID:   assetID,
+					Direction: tx.TxIncoming,
+					Value:     value,
+				}
+				if value < 0 {
+					h.Direction = tx.TxOutgoing
+					h.Value = -value
+				}
+				histories[programHash] = append(histories[programHash], h)
+			}
+		}
+	}
+
+	return histories, nil
+}
+
+func (db *ChainStore) PersistAddressHistory(b *Block) error {
+	histories, err := db.getAddressHistories(b)
+	if err != nil {
+		return err
+	}
+
+	for programHash, list := range histories {
+		for _, h := range list {
+			value := bytes.NewBuffer(nil)
+			h.Serialize(value)
+			if err := db.BatchPut(getAddressHistoryKey(programHash, h), value.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (db *ChainStore) RollbackAddressHistory(b *Block) error {
+	histories, err := db.getAddressHistories(b)
+	if err != nil {
+		return err
+	}
+
+	for programHash, list := range histories {
+		for _, h := range list {
+			if err := db.BatchDelete(getAddressHistoryKey(programHash, h)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
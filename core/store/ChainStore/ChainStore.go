@@ -2,6 +2,7 @@ package ChainStore
 
 import (
 	. "Elastos.ELA/common"
+	"Elastos.ELA/common/config"
 	"Elastos.ELA/common/log"
 	"Elastos.ELA/common/serialization"
 	. "Elastos.ELA/core/asset"
@@ -9,6 +10,7 @@ import (
 	. "Elastos.ELA/core/ledger"
 	. "Elastos.ELA/core/store"
 	. "Elastos.ELA/core/store/LevelDBStore"
+	"Elastos.ELA/core/store/MemoryStore"
 	tx "Elastos.ELA/core/transaction"
 	"Elastos.ELA/core/validation"
 	"Elastos.ELA/events"
@@ -26,6 +28,13 @@ const (
 	HeaderHashListCount = 2000
 	CleanCacheThreshold = 2
 	TaskChanCap         = 4
+
+	// StoreVersion is stored under CFG_Version, an older store is upgraded
+	// when it is opened. Version 0x02 added the address history index.
+	StoreVersion = 0x02
+	// UpgradeBatchBlocks is the number of blocks indexed in one batch while
+	// upgrading a store.
+	UpgradeBatchBlocks = 1000
 )
 
 var (
@@ -64,11 +73,29 @@ type ChainStore struct {
 	currentBlockHeight uint32
 	storedHeaderCount  uint32
 	ledger             *Ledger
+
+	pruneState *pruneState // nil unless PruneDepth is set
+}
+
+// NewStore opens the key-value backend selected by StoreBackend in the
+// config, leveldb is used when it is not set and keeps the chain in DataDir.
+func NewStore() (IStore, error) {
+	switch config.Parameters.StoreBackend {
+	case "", "leveldb":
+		st, err := NewLevelDBStore(config.DataPath("Chain"))
+		if err != nil {
+			return nil, err
+		}
+		return st, nil
+	case "memory":
+		return MemoryStore.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", config.Parameters.StoreBackend)
+	}
 }
 
 func NewLedgerStore() (ILedgerStore, error) {
-	// TODO: read config file decide which db to use.
-	st, err := NewLevelDBStore("Chain")
+	st, err := NewStore()
 	if err != nil {
 		return nil, err
 	}
@@ -85,6 +112,8 @@ func NewLedgerStore() (ILedgerStore, error) {
 		quit:               make(chan chan bool, 1),
 	}
 
+	chain.pruneState = newPruneState(chain)
+
 	go chain.loop()
 
 	return chain, nil
@@ -95,10 +124,17 @@ func (self *ChainStore) Close() {
 	self.quit <- closed
 	<-closed
 
-	self.Close()
+	self.IStore.Close()
 }
 
 func (self *ChainStore) loop() {
+	var pruneTick <-chan time.Time
+	if self.pruneState != nil {
+		ticker := time.NewTicker(PruneInterval * time.Second)
+		defer ticker.Stop()
+		pruneTick = ticker.C
+	}
+
 	for {
 		select {
 		case t := <-self.taskCh:
@@ -113,6 +149,7 @@ func (self *ChainStore) loop() {
 			case *persistBlockTask:
 				self.handlePersistBlockTask(task.block, task.ledger)
 				task.reply <- true
+				self.prune()
 				tcall := float64(time.Now().Sub(now)) / float64(time.Second)
 				log.Debugf("handle block exetime: %g num transactions:%d \n", tcall, len(task.block.Transactions))
 			case *rollbackBlockTask:
@@ -122,6 +159,9 @@ func (self *ChainStore) loop() {
 				log.Debugf("handle block rollback exetime: %g \n", tcall)
 			}
 
+		case <-pruneTick:
+			self.prune()
+
 		case closed := <-self.quit:
 			closed <- true
 			return
@@ -168,11 +208,15 @@ func (bd *ChainStore) InitLedgerStoreWithGenesisBlock(genesisBlock *Block) (uint
 		bd.persist(genesisBlock)
 
 		// put version to db
-		err = bd.Put(prefix, []byte{0x01})
+		err = bd.Put(prefix, []byte{StoreVersion})
 		if err != nil {
 			return 0, err
 		}
 
+	} else if version[0] < StoreVersion {
+		if err := bd.upgrade(version[0]); err != nil {
+			return 0, err
+		}
 	}
 
 	// GenesisBlock should exist in chain
@@ -226,6 +270,52 @@ func (bd *ChainStore) InitLedgerStoreWithGenesisBlock(genesisBlock *Block) (uint
 
 }
 
+// upgrade brings a store written by an older version up to StoreVersion.
+func (bd *ChainStore) upgrade(version byte) error {
+	if version < 0x02 {
+		if err := bd.backfillAddressHistory(); err != nil {
+			return err
+		}
+	}
+	return bd.Put([]byte{byte(CFG_Version)}, []byte{StoreVersion})
+}
+
+// backfillAddressHistory builds the address history index of the blocks
+// persisted before it existed. A pruned store no longer has the spent
+// outputs the history is computed from, its history starts empty and is
+// filled by the blocks persisted from now on.
+func (bd *ChainStore) backfillAddressHistory() error {
+	if bd.IsPruned() {
+		log.Warn("[backfillAddressHistory] the store is pruned, address history is only kept for new blocks")
+		return nil
+	}
+	_, current, err := bd.CurrentBlock()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("[backfillAddressHistory] indexing address history of %d blocks", current+1)
+	bd.NewBatch()
+	for height := uint32(0); height <= current; height++ {
+		b, err := bd.getBlockByHeight(height)
+		if err != nil {
+			return err
+		}
+		if err := bd.PersistAddressHistory(b); err != nil {
+			return err
+		}
+		if height%UpgradeBatchBlocks == UpgradeBatchBlocks-1 || height == current {
+			if err := bd.BatchCommit(); err != nil {
+				return err
+			}
+			log.Infof("[backfillAddressHistory] indexed up to block %d", height)
+			bd.NewBatch()
+		}
+	}
+
+	return nil
+}
+
 func (bd *ChainStore) InitLedgerStore(l *Ledger) error {
 	// TODO: InitLedgerStore
 	bd.ledger = l
@@ -563,6 +653,7 @@ func (db *ChainStore) rollback(b *Block) error {
 	db.RollbackTransactions(b)
 	db.RollbackUnspendUTXOs(b)
 	db.RollbackUnspend(b)
+	db.RollbackAddressHistory(b)
 	db.RollbackCurrentBlock(b)
 	db.BatchFinish()
 
@@ -585,6 +676,7 @@ func (db *ChainStore) persist(b *Block) error {
 	db.PersistTransactions(b)
 	db.PersistUnspendUTXOs(b)
 	db.PersistUnspend(b)
+	db.PersistAddressHistory(b)
 	db.PersistCurrentBlock(b)
 	db.BatchFinish()
 
@@ -618,6 +710,7 @@ func (self *ChainStore) handlePersistHeaderTask(header *Header) {
 	}
 
 	self.addHeader(header)
+	self.ledger.Blockchain.BCEvents.Notify(events.EventNewHeader, header)
 	//} else {
 	//	if !self.verifyHeader(header) {
 	//		return
@@ -650,6 +743,9 @@ func (db *ChainStore) handleRollbackBlockTask(blockHash Uint256) {
 		return
 	}
 	db.rollback(block)
+	if db.pruneState != nil {
+		db.pruneState.refs = nil
+	}
 }
 
 func (self *ChainStore) handlePersistBlockTask(b *Block, ledger *Ledger) {
@@ -803,6 +899,20 @@ func (bd *ChainStore) GetHeaderHashNext(prevHash Uint256) (Uint256, error) {
 	return Uint256{}, errors.New("no element in headerIdx.")
 }
 
+// GetHeaderHashes returns the hashes of the first count headers whose blocks
+// have not been added yet.
+func (bd *ChainStore) GetHeaderHashes(count int) []Uint256 {
+	bd.mu.RLock()
+	defer bd.mu.RUnlock()
+
+	var hashes []Uint256
+	for e := bd.headerIdx.Front(); e != nil && len(hashes) < count; e = e.Next() {
+		header := e.Value.(Header)
+		hashes = append(hashes, header.Blockdata.Hash())
+	}
+	return hashes
+}
+
 func (bd *ChainStore) RemoveHeaderListElement(hash Uint256) {
 	for e := bd.headerIdx.Front(); e != nil; e = e.Next() {
 		n := e.Value.(Header)
@@ -1027,6 +1137,34 @@ func (bd *ChainStore) PersistUnspentWithProgramHash(programHash Uint168, assetid
 	return nil
 }
 
+// GetAddressHistory returns the transactions that touched the program hash,
+// newest first, skipping the first offset entries and returning at most limit
+// of them (0 means no limit). The total number of entries is also returned.
+func (bd *ChainStore) GetAddressHistory(programHash Uint168, offset, limit uint32) ([]*tx.TxHistory, uint32, error) {
+	histories := make([]*tx.TxHistory, 0)
+
+	prefix := []byte{byte(IX_Address_History)}
+	key := append(prefix, programHash.ToArray()...)
+	iter := bd.NewIterator(key)
+	defer iter.Release()
+
+	var total uint32
+	for ok := iter.Last(); ok; ok = iter.Prev() {
+		total++
+		if total <= offset || (limit > 0 && uint32(len(histories)) >= limit) {
+			continue
+		}
+
+		h := new(tx.TxHistory)
+		if err := h.Deserialize(bytes.NewReader(iter.Value())); err != nil {
+			return nil, 0, err
+		}
+		histories = append(histories, h)
+	}
+
+	return histories, total, nil
+}
+
 func (bd *ChainStore) GetAssets() map[Uint256]*Asset {
 	assets := make(map[Uint256]*Asset)
 
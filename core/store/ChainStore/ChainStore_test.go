@@ -0,0 +1,199 @@
+package ChainStore
+
+import (
+	"container/list"
+	"testing"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/config"
+	"Elastos.ELA/common/log"
+	. "Elastos.ELA/core/ledger"
+	"Elastos.ELA/core/store/MemoryStore"
+	tx "Elastos.ELA/core/transaction"
+	"Elastos.ELA/core/transaction/payload"
+	"Elastos.ELA/crypto"
+)
+
+var (
+	testAssetID = Uint256{0x01}
+	testAlice   = Uint168{0x21, 0x01}
+	testBob     = Uint168{0x21, 0x02}
+)
+
+// newTestChainStore returns a store on memory without the persist loop,
+// the blocks are written with persist directly.
+func newTestChainStore() *ChainStore {
+	log.Init()
+	return &ChainStore{
+		IStore:      MemoryStore.NewMemoryStore(),
+		headerIndex: map[uint32]Uint256{},
+		headerCache: map[Uint256]*Header{},
+		headerIdx:   list.New(),
+	}
+}
+
+// testBits is the easiest target below the proof of work limit, about
+// every second parent header meets it.
+const testBits = 0x207fffff
+
+// newTestBlock builds and mines the block on the previous one, its coinbase
+// pays 100 to alice.
+func newTestBlock(t *testing.T, prev *Block, txns ...*tx.Transaction) *Block {
+	var prevHash Uint256
+	var height uint32
+	if prev != nil {
+		prevHash = prev.Hash()
+		height = prev.Blockdata.Height + 1
+	}
+	coinbase, _ := tx.NewCoinBaseTransaction(&payload.CoinBase{}, height)
+	coinbase.Outputs = []*tx.TxOutput{{AssetID: testAssetID, Value: 100, ProgramHash: testAlice}}
+
+	b := &Block{
+		Blockdata: &Blockdata{
+			PrevBlockHash: prevHash,
+			Timestamp:     1514000000 + height,
+			Bits:          testBits,
+			Height:        height,
+		},
+		Transactions: append([]*tx.Transaction{coinbase}, txns...),
+	}
+	var hashes []Uint256
+	for _, txn := range b.Transactions {
+		hashes = append(hashes, txn.Hash())
+	}
+	root, err := crypto.ComputeRoot(hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Blockdata.TransactionsRoot = root
+	for CheckProofOfWork(b.Blockdata, config.Parameters.ChainParam.PowLimit) != nil {
+		b.Blockdata.AuxPow.ParBlockHeader.Nonce++
+	}
+	return b
+}
+
+// newTestTransfer spends the first output of the transaction, paying value
+// to the program hash and the change back to the owner.
+func newTestTransfer(from *tx.Transaction, to Uint168, value Fixed64) *tx.Transaction {
+	output := from.Outputs[0]
+	txn, _ := tx.NewTransferAssetTransaction(
+		[]*tx.UTXOTxInput{{ReferTxID: from.Hash(), ReferTxOutputIndex: 0}},
+		[]*tx.TxOutput{
+			{AssetID: output.AssetID, Value: value, ProgramHash: to},
+			{AssetID: output.AssetID, Value: output.Value - value, ProgramHash: output.ProgramHash},
+		})
+	return txn
+}
+
+// persistTestChain persists a genesis block and a block in which alice pays
+// 30 of her first coinbase to bob.
+func persistTestChain(t *testing.T, bd *ChainStore) []*Block {
+	genesis := newTestBlock(t, nil)
+	block := newTestBlock(t, genesis, newTestTransfer(genesis.Transactions[0], testBob, 30))
+	for _, b := range []*Block{genesis, block} {
+		if err := bd.persist(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return []*Block{genesis, block}
+}
+
+func TestBackfillAddressHistory(t *testing.T) {
+	bd := newTestChainStore()
+	blocks := persistTestChain(t, bd)
+	transfer := blocks[1].Transactions[1].Hash()
+
+	// a store written before the index existed
+	bd.NewBatch()
+	iter := bd.NewIterator([]byte{byte(IX_Address_History)})
+	for iter.Next() {
+		bd.BatchDelete(iter.Key())
+	}
+	iter.Release()
+	if err := bd.BatchCommit(); err != nil {
+		t.Fatal(err)
+	}
+	bd.Put([]byte{byte(CFG_Version)}, []byte{0x01})
+	if _, total, _ := bd.GetAddressHistory(testAlice, 0, 0); total != 0 {
+		t.Fatalf("history of alice has %d entries before the upgrade", total)
+	}
+
+	if err := bd.upgrade(0x01); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := bd.Get([]byte{byte(CFG_Version)}); err != nil || version[0] != StoreVersion {
+		t.Fatalf("store version %x after the upgrade", version)
+	}
+
+	histories, total, err := bd.GetAddressHistory(testAlice, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// newest first: the transfer and the coinbase of block 1, the genesis
+	// coinbase
+	if total != 3 || len(histories) != 3 {
+		t.Fatalf("history of alice has %d entries, want 3", total)
+	}
+	if h := histories[0]; h.Height != 1 || h.Txid != transfer && h.Txid != blocks[1].Transactions[0].Hash() {
+		t.Fatalf("unexpected newest entry %+v", h)
+	}
+	for _, h := range histories {
+		if h.Txid == transfer && (h.Direction != tx.TxOutgoing || h.Value != 30) {
+			t.Fatalf("transfer of alice is %s %d, want outgoing 30", h.Direction, h.Value)
+		}
+	}
+	if h := histories[2]; h.Height != 0 || h.Direction != tx.TxIncoming || h.Value != 100 {
+		t.Fatalf("genesis coinbase of alice is %+v", h)
+	}
+
+	histories, total, err = bd.GetAddressHistory(testBob, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || histories[0].Txid != transfer || histories[0].Direction != tx.TxIncoming || histories[0].Value != 30 {
+		t.Fatalf("history of bob is %d entries, want the incoming transfer", total)
+	}
+}
+
+func TestBackfillAddressHistoryPruned(t *testing.T) {
+	bd := newTestChainStore()
+	persistTestChain(t, bd)
+	bd.Put([]byte{byte(SYS_PrunedHeight)}, []byte{0x01, 0x00, 0x00, 0x00})
+
+	if err := bd.upgrade(0x01); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := bd.Get([]byte{byte(CFG_Version)}); version[0] != StoreVersion {
+		t.Fatal("pruned store is not upgraded")
+	}
+}
+
+func TestGetHeaderHashes(t *testing.T) {
+	bd := newTestChainStore()
+	var headers []Header
+	for i := uint32(1); i <= 4; i++ {
+		header := Header{Blockdata: &Blockdata{Height: i, Timestamp: 1514000000 + i}}
+		headers = append(headers, header)
+		bd.headerIdx.PushBack(header)
+	}
+
+	hashes := bd.GetHeaderHashes(3)
+	if len(hashes) != 3 {
+		t.Fatalf("%d header hashes, want 3", len(hashes))
+	}
+	for i, hash := range hashes {
+		if hash != headers[i].Blockdata.Hash() {
+			t.Fatalf("header hash %d is out of order", i)
+		}
+	}
+
+	// a block connected out of order leaves the others in order
+	bd.RemoveHeaderListElement(headers[2].Blockdata.Hash())
+	hashes = bd.GetHeaderHashes(10)
+	if len(hashes) != 3 || hashes[0] != headers[0].Blockdata.Hash() || hashes[2] != headers[3].Blockdata.Hash() {
+		t.Fatal("header hashes are wrong after an out of order removal")
+	}
+	if len(newTestChainStore().GetHeaderHashes(10)) != 0 {
+		t.Fatal("header hashes of an empty list")
+	}
+}
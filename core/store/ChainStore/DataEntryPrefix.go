@@ -10,15 +10,17 @@ const (
 	DATA_Transaction DataEntryPrefix = 0x02
 
 	// INDEX
-	IX_HeaderHashList DataEntryPrefix = 0x80
-	IX_Unspent        DataEntryPrefix = 0x90
-	IX_Unspent_UTXO   DataEntryPrefix = 0x91
+	IX_HeaderHashList  DataEntryPrefix = 0x80
+	IX_Unspent         DataEntryPrefix = 0x90
+	IX_Unspent_UTXO    DataEntryPrefix = 0x91
+	IX_Address_History DataEntryPrefix = 0x92
 
 	// ASSET
 	ST_Info DataEntryPrefix = 0xc0
 
 	//SYSTEM
 	SYS_CurrentBlock      DataEntryPrefix = 0x40
+	SYS_PrunedHeight      DataEntryPrefix = 0x41
 	SYS_CurrentBookKeeper DataEntryPrefix = 0x42
 
 	//CONFIG
@@ -0,0 +1,183 @@
+package ChainStore
+
+import (
+	"bytes"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/config"
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/common/serialization"
+	. "Elastos.ELA/core/ledger"
+	tx "Elastos.ELA/core/transaction"
+)
+
+const (
+	// PruneBatchBlocks is the number of blocks pruned in one batch, so a
+	// node that turns pruning on does not stall its persist loop.
+	PruneBatchBlocks = 100
+	// PruneInterval is the number of seconds between two prune batches.
+	PruneInterval = 10
+)
+
+// A pruned store keeps every header, the unspent indexes and the full
+// blocks of the last PruneDepth heights. Below that a transaction body is
+// dropped once all of its outputs are spent and none of the spends is
+// within the recent blocks, which still have to be rolled back on a reorg.
+//
+// The prune state is only touched from the persist loop.
+type pruneState struct {
+	depth uint32
+	// next is the lowest height that has not been pruned yet.
+	next uint32
+	// refs counts the spends of each transaction by the recent blocks,
+	// it is valid for the window ending at refsTip.
+	refs    map[Uint256]int
+	refsTip uint32
+}
+
+func newPruneState(bd *ChainStore) *pruneState {
+	if config.Parameters.PruneDepth == 0 {
+		return nil
+	}
+
+	p := &pruneState{depth: config.Parameters.PruneDepth}
+	if data, err := bd.Get([]byte{byte(SYS_PrunedHeight)}); err == nil {
+		p.next, _ = serialization.ReadUint32(bytes.NewReader(data))
+	}
+	log.Infof("Prune mode on, keep %d blocks, pruned below height %d", p.depth, p.next)
+	return p
+}
+
+// IsPruned returns whether transaction data below some height has been
+// dropped from the store.
+func (bd *ChainStore) IsPruned() bool {
+	_, err := bd.Get([]byte{byte(SYS_PrunedHeight)})
+	return err == nil
+}
+
+// prune drops the transaction bodies of up to PruneBatchBlocks blocks that
+// have fallen out of the recent window.
+func (bd *ChainStore) prune() {
+	p := bd.pruneState
+	if p == nil {
+		return
+	}
+
+	tip := bd.GetHeight()
+	if tip < p.depth || p.next > tip-p.depth {
+		return
+	}
+	if err := bd.updatePruneRefs(tip); err != nil {
+		log.Warn("[prune] failed to load recent blocks: ", err)
+		return
+	}
+
+	bd.NewBatch()
+	next := p.next
+	for n := 0; n < PruneBatchBlocks && next <= tip-p.depth; n++ {
+		if err := bd.pruneBlock(next); err != nil {
+			log.Warnf("[prune] block %d: %s", next, err)
+		}
+		next++
+	}
+	value := bytes.NewBuffer(nil)
+	serialization.WriteUint32(value, next)
+	bd.BatchPut([]byte{byte(SYS_PrunedHeight)}, value.Bytes())
+	if err := bd.BatchCommit(); err != nil {
+		log.Error("[prune] failed to commit: ", err)
+		return
+	}
+
+	log.Debugf("[prune] pruned blocks %d to %d", p.next, next-1)
+	p.next = next
+}
+
+// pruneBlock deletes the transactions spent by the block at height that
+// are neither unspent nor spent by a recent block, and the transactions of
+// the block that nothing can ever spend.
+func (bd *ChainStore) pruneBlock(height uint32) error {
+	block, err := bd.getBlockByHeight(height)
+	if err != nil {
+		return err
+	}
+
+	for _, txn := range block.Transactions {
+		if txn.TxType == tx.RegisterAsset {
+			continue
+		}
+		if len(txn.Outputs) == 0 {
+			txid := txn.Hash()
+			bd.BatchDelete(append([]byte{byte(DATA_Transaction)}, txid.ToArray()...))
+		}
+		if txn.IsCoinBaseTx() {
+			continue
+		}
+		for _, input := range txn.UTXOInputs {
+			if bd.pruneState.refs[input.ReferTxID] > 0 {
+				continue
+			}
+			unspentKey := append([]byte{byte(IX_Unspent)}, input.ReferTxID.ToArray()...)
+			if _, err := bd.Get(unspentKey); err == nil {
+				continue
+			}
+			bd.BatchDelete(append([]byte{byte(DATA_Transaction)}, input.ReferTxID.ToArray()...))
+		}
+	}
+
+	return nil
+}
+
+// updatePruneRefs moves the recent window to end at tip, it is rebuilt
+// from scratch unless tip is the block right after the previous one.
+func (bd *ChainStore) updatePruneRefs(tip uint32) error {
+	p := bd.pruneState
+	if p.refs != nil && p.refsTip == tip {
+		return nil
+	}
+
+	if p.refs != nil && p.refsTip+1 == tip {
+		added, err := bd.getBlockByHeight(tip)
+		if err != nil {
+			return err
+		}
+		removed, err := bd.getBlockByHeight(tip - p.depth)
+		if err != nil {
+			return err
+		}
+		addPruneRefs(p.refs, added, 1)
+		addPruneRefs(p.refs, removed, -1)
+		p.refsTip = tip
+		return nil
+	}
+
+	refs := make(map[Uint256]int)
+	for height := tip - p.depth + 1; height <= tip; height++ {
+		block, err := bd.getBlockByHeight(height)
+		if err != nil {
+			return err
+		}
+		addPruneRefs(refs, block, 1)
+	}
+	p.refs = refs
+	p.refsTip = tip
+	return nil
+}
+
+func addPruneRefs(refs map[Uint256]int, b *Block, delta int) {
+	for _, txn := range b.Transactions {
+		for _, input := range txn.UTXOInputs {
+			refs[input.ReferTxID] += delta
+			if refs[input.ReferTxID] <= 0 {
+				delete(refs, input.ReferTxID)
+			}
+		}
+	}
+}
+
+func (bd *ChainStore) getBlockByHeight(height uint32) (*Block, error) {
+	hash, err := bd.GetBlockHash(height)
+	if err != nil {
+		return nil, err
+	}
+	return bd.GetBlock(hash)
+}
@@ -0,0 +1,78 @@
+package ChainStore
+
+import (
+	"bytes"
+	"testing"
+
+	"Elastos.ELA/common/config"
+	. "Elastos.ELA/core/ledger"
+)
+
+func TestPrune(t *testing.T) {
+	bd := newTestChainStore()
+	blocks := persistTestChain(t, bd)
+	genesisCoinbase := blocks[0].Transactions[0].Hash()
+	transfer := blocks[1].Transactions[1].Hash()
+	coinbase := blocks[1].Transactions[0]
+
+	// block 3 spends the whole coinbase of block 1
+	block2 := newTestBlock(t, blocks[1])
+	block3 := newTestBlock(t, block2, newTestTransfer(coinbase, testBob, 100))
+	for _, b := range []*Block{block2, block3} {
+		if err := bd.persist(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the height is moved by the persist loop
+	bd.currentBlockHeight = block3.Blockdata.Height
+
+	bd.pruneState = &pruneState{depth: 1}
+	bd.prune()
+	if !bd.IsPruned() || bd.pruneState.next != 3 {
+		t.Fatalf("pruned below height %d, want 3", bd.pruneState.next)
+	}
+	if _, _, err := bd.GetTransaction(genesisCoinbase); err == nil {
+		t.Fatal("spent genesis coinbase is kept")
+	}
+	if _, _, err := bd.GetTransaction(transfer); err != nil {
+		t.Fatal("transfer with unspent outputs is pruned")
+	}
+	if _, _, err := bd.GetTransaction(coinbase.Hash()); err != nil {
+		t.Fatal("coinbase spent within the recent window is pruned")
+	}
+	for _, b := range []*Block{blocks[0], blocks[1], block2, block3} {
+		if _, err := bd.GetHeader(b.Hash()); err != nil {
+			t.Fatalf("header of block %d is pruned", b.Blockdata.Height)
+		}
+	}
+
+	// once the spend leaves the window the coinbase goes too
+	block4 := newTestBlock(t, block3)
+	if err := bd.persist(block4); err != nil {
+		t.Fatal(err)
+	}
+	bd.currentBlockHeight = block4.Blockdata.Height
+	bd.prune()
+	if bd.pruneState.next != 4 {
+		t.Fatalf("pruned below height %d, want 4", bd.pruneState.next)
+	}
+	if _, _, err := bd.GetTransaction(coinbase.Hash()); err == nil {
+		t.Fatal("coinbase spent below the window is kept")
+	}
+	if ok, _ := bd.ContainsUnspent(transfer, 0); !ok {
+		t.Fatal("unspent output of the transfer is lost")
+	}
+
+	// the spent bodies are gone, a pruned store can not replay its chain
+	if _, err := bd.ExportSnapshot(block4.Blockdata.Height, &bytes.Buffer{}); err == nil {
+		t.Fatal("snapshot exported from a pruned store")
+	}
+
+	// the pruned height survives a restart
+	depth := config.Parameters.PruneDepth
+	config.Parameters.PruneDepth = 1
+	defer func() { config.Parameters.PruneDepth = depth }()
+	if p := newPruneState(bd); p == nil || p.next != 4 {
+		t.Fatal("pruned height is not reloaded")
+	}
+}
@@ -0,0 +1,503 @@
+package ChainStore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/config"
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/common/serialization"
+	. "Elastos.ELA/core/ledger"
+	tx "Elastos.ELA/core/transaction"
+	"Elastos.ELA/core/transaction/payload"
+)
+
+// IntegrityReport is the result of CheckIntegrity.
+type IntegrityReport struct {
+	// StoredHeight is the height recorded in SYS_CurrentBlock.
+	StoredHeight uint32
+	// VerifiedHeight is the height of the last block that is consistent
+	// with its header chain, the indexes are rebuilt up to this block.
+	VerifiedHeight uint32
+	// Problems lists every mismatch found, empty when the store is sound.
+	Problems []string
+	// Repaired is set when the mismatches were written back to the store.
+	Repaired bool
+}
+
+func (r *IntegrityReport) addProblem(format string, a ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, a...))
+}
+
+// chainIndexes holds the indexes recomputed from the stored blocks, keyed
+// by the raw store key. A nil value means only the presence of the key is
+// checked, its content was already verified while walking the blocks.
+type chainIndexes struct {
+	entries map[DataEntryPrefix]map[string][]byte
+	// fixes are entries whose key is correct but whose value has to be
+	// rewritten, such as a transaction stored with the wrong height.
+	fixes map[string][]byte
+}
+
+func newChainIndexes() *chainIndexes {
+	entries := make(map[DataEntryPrefix]map[string][]byte)
+	for _, prefix := range checkedPrefixes {
+		entries[prefix] = make(map[string][]byte)
+	}
+	return &chainIndexes{
+		entries: entries,
+		fixes:   make(map[string][]byte),
+	}
+}
+
+// checkedPrefixes are the key spaces derived from the blocks themselves.
+var checkedPrefixes = []DataEntryPrefix{
+	DATA_BlockHash,
+	DATA_Header,
+	DATA_Transaction,
+	IX_Unspent,
+	IX_Unspent_UTXO,
+	IX_Address_History,
+	ST_Info,
+}
+
+// CheckIntegrity walks every stored block from the genesis block, verifies
+// it against the previous header and its transactions, recomputes the
+// unspent set, the address history and the asset registry from scratch and
+// compares them with what is stored. With repair set the store is rewritten
+// so it matches the recomputed state, blocks past the first inconsistent
+// one are dropped and will be synced again.
+//
+// It must not run while blocks are being persisted, the node calls it at
+// startup before the blockchain is loaded.
+func (bd *ChainStore) CheckIntegrity(repair bool) (*IntegrityReport, error) {
+	if bd.IsPruned() {
+		return nil, errors.New("[CheckIntegrity] the store is pruned, old blocks can not be checked")
+	}
+
+	report := new(IntegrityReport)
+
+	currentHash, height, err := bd.CurrentBlock()
+	if err != nil {
+		return nil, errors.New("[CheckIntegrity] no current block in store, nothing to check")
+	}
+	report.StoredHeight = height
+
+	replay, problem, err := bd.replayChain(math.MaxUint32)
+	if err != nil {
+		return nil, err
+	}
+	if problem != "" {
+		report.addProblem(problem)
+	}
+	indexes := replay.indexes
+	prevHash := replay.tipHash
+	report.VerifiedHeight = replay.tipHeight
+	if report.VerifiedHeight != report.StoredHeight || currentHash != prevHash {
+		report.addProblem("current block is %d %x, last consistent block is %d %x",
+			report.StoredHeight, currentHash.ToArrayReverse(), report.VerifiedHeight, prevHash.ToArrayReverse())
+	}
+
+	// transactions of a block past the last consistent one are dropped
+	// rather than fixed.
+	for key := range indexes.fixes {
+		if _, ok := indexes.entries[DATA_Transaction][key]; !ok {
+			delete(indexes.fixes, key)
+		}
+	}
+
+	stale := make(map[string]bool)
+	for _, prefix := range checkedPrefixes {
+		bd.compareIndex(prefix, indexes.entries[prefix], stale, report)
+	}
+	for key := range indexes.fixes {
+		report.addProblem("%s has a wrong value", describeKey([]byte(key)))
+	}
+
+	if !repair || len(report.Problems) == 0 {
+		return report, nil
+	}
+
+	bd.NewBatch()
+	for key := range stale {
+		bd.BatchDelete([]byte(key))
+	}
+	for _, prefix := range checkedPrefixes {
+		for key, value := range indexes.entries[prefix] {
+			if value != nil {
+				bd.BatchPut([]byte(key), value)
+			}
+		}
+	}
+	for key, value := range indexes.fixes {
+		bd.BatchPut([]byte(key), value)
+	}
+	current := bytes.NewBuffer(nil)
+	prevHash.Serialize(current)
+	serialization.WriteUint32(current, report.VerifiedHeight)
+	bd.BatchPut([]byte{byte(SYS_CurrentBlock)}, current.Bytes())
+	if err := bd.BatchCommit(); err != nil {
+		return nil, err
+	}
+
+	bd.mu.Lock()
+	bd.currentBlockHeight = report.VerifiedHeight
+	bd.mu.Unlock()
+	report.Repaired = true
+
+	return report, nil
+}
+
+// chainReplay is the chain state rebuilt by replaying the stored blocks.
+type chainReplay struct {
+	indexes   *chainIndexes
+	unspents  map[Uint256][]uint16
+	utxos     map[string][]*tx.UTXOUnspent
+	txHeights map[Uint256]uint32
+	tipHash   Uint256
+	tipHeight uint32
+}
+
+// replayChain replays the stored blocks from the genesis block up to the
+// stop height, or up to the first inconsistent block in which case the
+// reason is returned along with the state before it.
+func (bd *ChainStore) replayChain(stop uint32) (*chainReplay, string, error) {
+	replay := &chainReplay{
+		indexes:   newChainIndexes(),
+		unspents:  make(map[Uint256][]uint16),
+		utxos:     make(map[string][]*tx.UTXOUnspent),
+		txHeights: make(map[Uint256]uint32),
+	}
+
+	var problem string
+	var verified bool
+	for height := uint32(0); height <= stop; height++ {
+		var block *Block
+		block, problem = bd.loadCheckedBlock(height, replay.tipHash, replay.txHeights, replay.indexes)
+		if block == nil {
+			break
+		}
+		if problem = bd.checkBlockInputs(block, replay.unspents, replay.txHeights); problem != "" {
+			break
+		}
+		if problem = bd.applyBlock(block, replay.unspents, replay.utxos, replay.txHeights, replay.indexes); problem != "" {
+			break
+		}
+
+		replay.tipHash = block.Hash()
+		replay.tipHeight = height
+		verified = true
+		if height%10000 == 0 {
+			log.Infof("[replayChain] replayed block %d", height)
+		}
+	}
+	if !verified {
+		return nil, "", errors.New("[replayChain] genesis block is missing from the store")
+	}
+
+	for txid, list := range replay.unspents {
+		key := append([]byte{byte(IX_Unspent)}, txid.ToArray()...)
+		replay.indexes.entries[IX_Unspent][string(key)] = canonicalValue(IX_Unspent, ToByteArray(list))
+	}
+	for key, list := range replay.utxos {
+		w := bytes.NewBuffer(nil)
+		serialization.WriteVarUint(w, uint64(len(list)))
+		for _, u := range list {
+			u.Serialize(w)
+		}
+		replay.indexes.entries[IX_Unspent_UTXO][key] = canonicalValue(IX_Unspent_UTXO, w.Bytes())
+	}
+
+	return replay, problem, nil
+}
+
+// loadCheckedBlock reads the block stored at height and checks it links to
+// prevHash, carries valid proof of work and that every transaction it lists
+// is stored and hashes to the listed hash. A nil block is returned when the
+// walk has to stop at this height, with the reason unless the chain simply
+// ends here.
+func (bd *ChainStore) loadCheckedBlock(height uint32, prevHash Uint256, txHeights map[Uint256]uint32, indexes *chainIndexes) (*Block, string) {
+	hash, err := bd.GetBlockHash(height)
+	if err != nil {
+		return nil, ""
+	}
+
+	key := append([]byte{byte(DATA_Header)}, hash.ToArray()...)
+	data, err := bd.Get(key)
+	if err != nil {
+		return nil, fmt.Sprintf("block %d %x has no header", height, hash.ToArrayReverse())
+	}
+	r := bytes.NewReader(data)
+	if _, err := serialization.ReadUint64(r); err != nil {
+		return nil, fmt.Sprintf("block %d %x has a corrupted header", height, hash.ToArrayReverse())
+	}
+	block := new(Block)
+	if err := block.FromTrimmedData(r); err != nil {
+		return nil, fmt.Sprintf("block %d %x has a corrupted header", height, hash.ToArrayReverse())
+	}
+
+	// FromTrimmedData recomputes the transactions root from the listed
+	// transaction hashes, so a hash match also checks the merkle root.
+	if block.Hash() != hash {
+		return nil, fmt.Sprintf("block %d %x does not match its stored hash", height, hash.ToArrayReverse())
+	}
+	if block.Blockdata.Height != height {
+		return nil, fmt.Sprintf("block %x is stored at height %d but claims %d", hash.ToArrayReverse(), height, block.Blockdata.Height)
+	}
+	if block.Blockdata.PrevBlockHash != prevHash {
+		return nil, fmt.Sprintf("block %d %x does not link to the previous block", height, hash.ToArrayReverse())
+	}
+	if height > 0 {
+		if err := CheckProofOfWork(block.Blockdata, config.Parameters.ChainParam.PowLimit); err != nil {
+			return nil, fmt.Sprintf("block %d %x: %s", height, hash.ToArrayReverse(), err)
+		}
+	}
+
+	for i, trimmed := range block.Transactions {
+		txid := trimmed.Hash()
+		txKey := append([]byte{byte(DATA_Transaction)}, txid.ToArray()...)
+		txn, txHeight, err := bd.GetTransaction(txid)
+		if err != nil {
+			return nil, fmt.Sprintf("block %d %x: transaction %x is missing", height, hash.ToArrayReverse(), txid.ToArrayReverse())
+		}
+		if txn.Hash() != txid {
+			return nil, fmt.Sprintf("block %d %x: transaction %x is corrupted", height, hash.ToArrayReverse(), txid.ToArrayReverse())
+		}
+		if _, ok := txHeights[txid]; ok {
+			return nil, fmt.Sprintf("block %d %x: transaction %x is already in the chain", height, hash.ToArrayReverse(), txid.ToArrayReverse())
+		}
+		if txHeight != height {
+			w := bytes.NewBuffer(nil)
+			serialization.WriteUint32(w, height)
+			txn.Serialize(w)
+			indexes.fixes[string(txKey)] = w.Bytes()
+		}
+		block.Transactions[i] = txn
+	}
+
+	return block, ""
+}
+
+// checkBlockInputs checks that every input of the block spends an output
+// of an earlier block that is still unspent.
+func (bd *ChainStore) checkBlockInputs(b *Block, unspents map[Uint256][]uint16, txHeights map[Uint256]uint32) string {
+	height := b.Blockdata.Height
+	hash := b.Hash()
+
+	spent := make(map[tx.UTXOTxInput]bool)
+	for _, txn := range b.Transactions {
+		if txn.TxType == tx.RegisterAsset || txn.IsCoinBaseTx() {
+			continue
+		}
+		txid := txn.Hash()
+		for _, input := range txn.UTXOInputs {
+			referTxn, _, err := bd.GetTransaction(input.ReferTxID)
+			if _, ok := txHeights[input.ReferTxID]; err != nil || !ok || int(input.ReferTxOutputIndex) >= len(referTxn.Outputs) {
+				return fmt.Sprintf("block %d %x: transaction %x spends unknown output %x:%d", height, hash.ToArrayReverse(),
+					txid.ToArrayReverse(), input.ReferTxID.ToArrayReverse(), input.ReferTxOutputIndex)
+			}
+
+			found := false
+			for _, index := range unspents[input.ReferTxID] {
+				if index == input.ReferTxOutputIndex {
+					found = true
+					break
+				}
+			}
+			if !found || spent[*input] {
+				return fmt.Sprintf("block %d %x: transaction %x double spends %x:%d", height, hash.ToArrayReverse(),
+					txid.ToArrayReverse(), input.ReferTxID.ToArrayReverse(), input.ReferTxOutputIndex)
+			}
+			spent[*input] = true
+		}
+	}
+
+	return ""
+}
+
+// applyBlock adds the block to the recomputed indexes, mirroring what
+// persist writes for it. The inputs must have been checked already.
+func (bd *ChainStore) applyBlock(b *Block, unspents map[Uint256][]uint16, utxos map[string][]*tx.UTXOUnspent, txHeights map[Uint256]uint32, indexes *chainIndexes) string {
+	height := b.Blockdata.Height
+	hash := b.Hash()
+
+	histories, err := bd.getAddressHistories(b)
+	if err != nil {
+		return fmt.Sprintf("block %d %x: %s", height, hash.ToArrayReverse(), err)
+	}
+
+	key := bytes.NewBuffer(nil)
+	key.WriteByte(byte(DATA_BlockHash))
+	serialization.WriteUint32(key, height)
+	indexes.entries[DATA_BlockHash][key.String()] = hash.ToArray()
+	indexes.entries[DATA_Header][string(append([]byte{byte(DATA_Header)}, hash.ToArray()...))] = nil
+
+	for _, txn := range b.Transactions {
+		txid := txn.Hash()
+		txHeights[txid] = height
+		indexes.entries[DATA_Transaction][string(append([]byte{byte(DATA_Transaction)}, txid.ToArray()...))] = nil
+
+		if txn.TxType == tx.RegisterAsset {
+			w := bytes.NewBuffer(nil)
+			txn.Payload.(*payload.RegisterAsset).Asset.Serialize(w)
+			indexes.entries[ST_Info][string(append([]byte{byte(ST_Info)}, txid.ToArray()...))] = w.Bytes()
+			continue
+		}
+
+		for index, output := range txn.Outputs {
+			unspents[txid] = append(unspents[txid], uint16(index))
+			utxoKey := utxoIndexKey(output.ProgramHash, output.AssetID, height)
+			utxos[utxoKey] = append(utxos[utxoKey], &tx.UTXOUnspent{
+				Txid:  txid,
+				Index: uint32(index),
+				Value: output.Value,
+			})
+		}
+
+		if txn.IsCoinBaseTx() {
+			continue
+		}
+		for _, input := range txn.UTXOInputs {
+			list := unspents[input.ReferTxID]
+			for i, index := range list {
+				if index == input.ReferTxOutputIndex {
+					unspents[input.ReferTxID] = append(list[:i], list[i+1:]...)
+					break
+				}
+			}
+			if len(unspents[input.ReferTxID]) == 0 {
+				delete(unspents, input.ReferTxID)
+			}
+
+			referTxn, _, _ := bd.GetTransaction(input.ReferTxID)
+			referHeight := txHeights[input.ReferTxID]
+			output := referTxn.Outputs[input.ReferTxOutputIndex]
+			utxoKey := utxoIndexKey(output.ProgramHash, output.AssetID, referHeight)
+			utxoList := utxos[utxoKey]
+			for i, u := range utxoList {
+				if u.Txid == input.ReferTxID && u.Index == uint32(input.ReferTxOutputIndex) {
+					utxos[utxoKey] = append(utxoList[:i], utxoList[i+1:]...)
+					break
+				}
+			}
+			if len(utxos[utxoKey]) == 0 {
+				delete(utxos, utxoKey)
+			}
+		}
+	}
+
+	for programHash, list := range histories {
+		for _, h := range list {
+			value := bytes.NewBuffer(nil)
+			h.Serialize(value)
+			indexes.entries[IX_Address_History][string(getAddressHistoryKey(programHash, h))] = value.Bytes()
+		}
+	}
+
+	return ""
+}
+
+// compareIndex reports the stored entries under prefix that differ from
+// the expected ones, stored keys that should not exist are added to stale.
+func (bd *ChainStore) compareIndex(prefix DataEntryPrefix, expected map[string][]byte, stale map[string]bool, report *IntegrityReport) {
+	seen := make(map[string]bool, len(expected))
+
+	iter := bd.NewIterator([]byte{byte(prefix)})
+	for iter.Next() {
+		key := string(iter.Key())
+		value, ok := expected[key]
+		if !ok {
+			stale[key] = true
+			report.addProblem("%s should not exist", describeKey(iter.Key()))
+			continue
+		}
+		seen[key] = true
+		if value != nil && !bytes.Equal(canonicalValue(prefix, iter.Value()), value) {
+			report.addProblem("%s has a wrong value", describeKey(iter.Key()))
+		}
+	}
+	iter.Release()
+
+	for key := range expected {
+		if !seen[key] {
+			report.addProblem("%s is missing", describeKey([]byte(key)))
+		}
+	}
+}
+
+// key: IX_Unspent_UTXO || program hash || asset id || height
+func utxoIndexKey(programHash Uint168, assetID Uint256, height uint32) string {
+	key := bytes.NewBuffer(nil)
+	key.WriteByte(byte(IX_Unspent_UTXO))
+	programHash.Serialize(key)
+	assetID.Serialize(key)
+	serialization.WriteUint32(key, height)
+	return key.String()
+}
+
+// canonicalValue sorts the lists stored in the unspent indexes, their order
+// depends on the spend history and is not meaningful.
+func canonicalValue(prefix DataEntryPrefix, value []byte) []byte {
+	switch prefix {
+	case IX_Unspent:
+		list, err := GetUint16Array(value)
+		if err != nil {
+			return value
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+		return ToByteArray(list)
+	case IX_Unspent_UTXO:
+		r := bytes.NewReader(value)
+		count, err := serialization.ReadVarUint(r, 0)
+		if err != nil {
+			return value
+		}
+		list := make([]*tx.UTXOUnspent, count)
+		for i := range list {
+			list[i] = new(tx.UTXOUnspent)
+			if err := list[i].Deserialize(r); err != nil {
+				return value
+			}
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Txid != list[j].Txid {
+				return bytes.Compare(list[i].Txid[:], list[j].Txid[:]) < 0
+			}
+			return list[i].Index < list[j].Index
+		})
+		w := bytes.NewBuffer(nil)
+		serialization.WriteVarUint(w, count)
+		for _, u := range list {
+			u.Serialize(w)
+		}
+		return w.Bytes()
+	}
+	return value
+}
+
+func describeKey(key []byte) string {
+	var name string
+	switch DataEntryPrefix(key[0]) {
+	case DATA_BlockHash:
+		name = "block hash"
+	case DATA_Header:
+		name = "block"
+	case DATA_Transaction:
+		name = "transaction"
+	case IX_Unspent:
+		name = "unspent index"
+	case IX_Unspent_UTXO:
+		name = "utxo index"
+	case IX_Address_History:
+		name = "address history"
+	case ST_Info:
+		name = "asset"
+	default:
+		name = "entry"
+	}
+	return fmt.Sprintf("%s %x", name, key[1:])
+}
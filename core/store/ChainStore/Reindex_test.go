@@ -0,0 +1,66 @@
+package ChainStore
+
+import (
+	"testing"
+
+	. "Elastos.ELA/common"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	bd := newTestChainStore()
+	blocks := persistTestChain(t, bd)
+
+	report, err := bd.CheckIntegrity(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 0 {
+		t.Fatalf("persisted chain has problems: %v", report.Problems)
+	}
+	if report.VerifiedHeight != uint32(len(blocks)-1) {
+		t.Fatalf("verified height %d, want %d", report.VerifiedHeight, len(blocks)-1)
+	}
+}
+
+func TestReindex(t *testing.T) {
+	bd := newTestChainStore()
+	blocks := persistTestChain(t, bd)
+	genesisCoinbase := blocks[0].Transactions[0].Hash()
+	spendable := blocks[1].Transactions[0].Hash()
+	unspentKey := append([]byte{byte(IX_Unspent)}, spendable.ToArray()...)
+	unspent, _ := bd.Get(unspentKey)
+
+	// lose an unspent entry and mark the spent genesis coinbase unspent
+	bd.Delete(unspentKey)
+	bd.Put(append([]byte{byte(IX_Unspent)}, genesisCoinbase.ToArray()...), ToByteArray([]uint16{0}))
+
+	report, err := bd.CheckIntegrity(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 2 || report.Repaired {
+		t.Fatalf("found problems %v, want 2", report.Problems)
+	}
+
+	report, err = bd.CheckIntegrity(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Repaired || report.VerifiedHeight != uint32(len(blocks)-1) {
+		t.Fatalf("store repaired %t up to %d", report.Repaired, report.VerifiedHeight)
+	}
+	if value, err := bd.Get(unspentKey); err != nil || string(value) != string(unspent) {
+		t.Fatal("unspent entry is not restored")
+	}
+	if ok, _ := bd.ContainsUnspent(genesisCoinbase, 0); ok {
+		t.Fatal("spent output is still unspent")
+	}
+
+	report, err = bd.CheckIntegrity(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 0 {
+		t.Fatalf("repaired store has problems: %v", report.Problems)
+	}
+}
@@ -0,0 +1,351 @@
+package ChainStore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/config"
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/common/serialization"
+	. "Elastos.ELA/core/ledger"
+)
+
+const (
+	SnapshotMagic   = 0x504e5345 // "ESNP"
+	SnapshotVersion = 1
+)
+
+// snapshotPrefixes are the key spaces carried in a snapshot besides the
+// header chain: the unspent indexes, the transactions that still have
+// unspent outputs and the asset registry with its register transactions.
+var snapshotPrefixes = []DataEntryPrefix{
+	IX_Unspent,
+	IX_Unspent_UTXO,
+	DATA_Transaction,
+	ST_Info,
+}
+
+// A snapshot is laid out as
+//
+//	magic || version || height || block hash
+//	header count || trimmed block of every height, genesis first
+//	entry count || key, value of every entry in key order
+//	commitment
+//
+// The commitment is the double SHA256 of the entry section, it is checked
+// against the third field of the checkpoint at the snapshot height in
+// AddCheckpoints, "<height>:<block hash>:<commitment>".
+
+// ExportSnapshot writes the unspent set, the asset registry and the header
+// chain as of height to w and returns the commitment of the snapshot. The
+// state is rebuilt by replaying the stored blocks, so the store must not be
+// pruned.
+func (bd *ChainStore) ExportSnapshot(height uint32, w io.Writer) (Uint256, error) {
+	if bd.IsPruned() {
+		return Uint256{}, errors.New("[ExportSnapshot] the store is pruned, old blocks can not be replayed")
+	}
+	_, current, err := bd.CurrentBlock()
+	if err != nil {
+		return Uint256{}, err
+	}
+	if height > current {
+		return Uint256{}, fmt.Errorf("[ExportSnapshot] height %d is above the current height %d", height, current)
+	}
+
+	replay, problem, err := bd.replayChain(height)
+	if err != nil {
+		return Uint256{}, err
+	}
+	if problem != "" || replay.tipHeight != height {
+		return Uint256{}, fmt.Errorf("[ExportSnapshot] chain is inconsistent, run reindex first: %s", problem)
+	}
+
+	entries := make(map[string][]byte)
+	for _, prefix := range []DataEntryPrefix{IX_Unspent, IX_Unspent_UTXO, ST_Info} {
+		for key, value := range replay.indexes.entries[prefix] {
+			entries[key] = value
+		}
+	}
+	// the register asset transactions are kept along with the registry
+	txids := make([]Uint256, 0, len(replay.unspents))
+	for txid := range replay.unspents {
+		txids = append(txids, txid)
+	}
+	for key := range replay.indexes.entries[ST_Info] {
+		assetID, _ := Uint256ParseFromBytes([]byte(key[1:]))
+		txids = append(txids, assetID)
+	}
+	for _, txid := range txids {
+		txn, _, err := bd.GetTransaction(txid)
+		if err != nil {
+			return Uint256{}, err
+		}
+		value := bytes.NewBuffer(nil)
+		serialization.WriteUint32(value, replay.txHeights[txid])
+		txn.Serialize(value)
+		entries[string(append([]byte{byte(DATA_Transaction)}, txid.ToArray()...))] = value.Bytes()
+	}
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	serialization.WriteUint32(w, SnapshotMagic)
+	serialization.WriteUint32(w, SnapshotVersion)
+	serialization.WriteUint32(w, height)
+	if _, err := replay.tipHash.Serialize(w); err != nil {
+		return Uint256{}, err
+	}
+
+	if err := serialization.WriteVarUint(w, uint64(height)+1); err != nil {
+		return Uint256{}, err
+	}
+	for h := uint32(0); h <= height; h++ {
+		hash, err := bd.GetBlockHash(h)
+		if err != nil {
+			return Uint256{}, err
+		}
+		data, err := bd.Get(append([]byte{byte(DATA_Header)}, hash.ToArray()...))
+		if err != nil {
+			return Uint256{}, err
+		}
+		if err := serialization.WriteVarBytes(w, data); err != nil {
+			return Uint256{}, err
+		}
+	}
+
+	hasher := sha256.New()
+	ew := io.MultiWriter(w, hasher)
+	if err := serialization.WriteVarUint(ew, uint64(len(keys))); err != nil {
+		return Uint256{}, err
+	}
+	for _, key := range keys {
+		if err := serialization.WriteVarBytes(ew, []byte(key)); err != nil {
+			return Uint256{}, err
+		}
+		if err := serialization.WriteVarBytes(ew, entries[key]); err != nil {
+			return Uint256{}, err
+		}
+	}
+	commitment := Uint256(sha256.Sum256(hasher.Sum(nil)))
+	if _, err := commitment.Serialize(w); err != nil {
+		return Uint256{}, err
+	}
+
+	return commitment, nil
+}
+
+// ImportSnapshot loads a snapshot written by ExportSnapshot into an empty
+// store. The header chain must end at the block of a checkpoint and the
+// snapshot must match the commitment of that checkpoint. The node resumes
+// syncing from the snapshot height, blocks below it are not kept.
+//
+// The address history is not part of a snapshot, it would have to be
+// trusted rather than checked against the unspent set. The history of an
+// imported store starts at the snapshot height.
+func (bd *ChainStore) ImportSnapshot(reader io.Reader) (uint32, error) {
+	if _, current, err := bd.CurrentBlock(); err == nil && current > 0 {
+		return 0, errors.New("[ImportSnapshot] the store already holds a chain")
+	}
+
+	r := fullReader{reader}
+	magic, err := serialization.ReadUint32(r)
+	if err != nil || magic != SnapshotMagic {
+		return 0, errors.New("[ImportSnapshot] not a snapshot file")
+	}
+	version, err := serialization.ReadUint32(r)
+	if err != nil || version != SnapshotVersion {
+		return 0, fmt.Errorf("[ImportSnapshot] unsupported snapshot version %d", version)
+	}
+	height, err := serialization.ReadUint32(r)
+	if err != nil {
+		return 0, err
+	}
+	var blockHash Uint256
+	if err := blockHash.Deserialize(r); err != nil {
+		return 0, err
+	}
+
+	checkpointHash, commitment, ok := snapshotCheckpoint(height)
+	if !ok {
+		return 0, fmt.Errorf("[ImportSnapshot] no checkpoint with a snapshot commitment at height %d", height)
+	}
+	if checkpointHash != blockHash {
+		return 0, fmt.Errorf("[ImportSnapshot] snapshot block %x does not match the checkpoint", blockHash.ToArrayReverse())
+	}
+
+	bd.NewBatch()
+	iter := bd.NewIterator(nil)
+	for iter.Next() {
+		bd.BatchDelete(iter.Key())
+	}
+	iter.Release()
+
+	count, err := serialization.ReadVarUint(r, 0)
+	if err != nil {
+		return 0, err
+	}
+	if count != uint64(height)+1 {
+		return 0, errors.New("[ImportSnapshot] header chain does not end at the snapshot height")
+	}
+	var prevHash Uint256
+	for h := uint32(0); h <= height; h++ {
+		data, err := serialization.ReadVarBytes(r)
+		if err != nil {
+			return 0, err
+		}
+		hash, err := checkSnapshotHeader(data, h, prevHash)
+		if err != nil {
+			return 0, err
+		}
+		key := bytes.NewBuffer(nil)
+		key.WriteByte(byte(DATA_BlockHash))
+		serialization.WriteUint32(key, h)
+		bd.BatchPut(key.Bytes(), hash.ToArray())
+		bd.BatchPut(append([]byte{byte(DATA_Header)}, hash.ToArray()...), data)
+		prevHash = hash
+	}
+	if prevHash != blockHash {
+		return 0, errors.New("[ImportSnapshot] header chain does not end at the snapshot block")
+	}
+
+	hasher := sha256.New()
+	er := fullReader{io.TeeReader(r, hasher)}
+	count, err = serialization.ReadVarUint(er, 0)
+	if err != nil {
+		return 0, err
+	}
+	var lastKey []byte
+	for i := uint64(0); i < count; i++ {
+		key, err := serialization.ReadVarBytes(er)
+		if err != nil {
+			return 0, err
+		}
+		value, err := serialization.ReadVarBytes(er)
+		if err != nil {
+			return 0, err
+		}
+		if !isSnapshotKey(key) || bytes.Compare(key, lastKey) <= 0 {
+			return 0, fmt.Errorf("[ImportSnapshot] unexpected entry %x", key)
+		}
+		bd.BatchPut(key, value)
+		lastKey = key
+	}
+	var stored Uint256
+	if err := stored.Deserialize(r); err != nil {
+		return 0, err
+	}
+	computed := Uint256(sha256.Sum256(hasher.Sum(nil)))
+	if computed != stored || computed != commitment {
+		return 0, fmt.Errorf("[ImportSnapshot] snapshot commitment %x does not match the checkpoint", computed.ToArrayReverse())
+	}
+
+	current := bytes.NewBuffer(nil)
+	blockHash.Serialize(current)
+	serialization.WriteUint32(current, height)
+	bd.BatchPut([]byte{byte(SYS_CurrentBlock)}, current.Bytes())
+	pruned := bytes.NewBuffer(nil)
+	serialization.WriteUint32(pruned, height+1)
+	bd.BatchPut([]byte{byte(SYS_PrunedHeight)}, pruned.Bytes())
+	bd.BatchPut([]byte{byte(CFG_Version)}, []byte{StoreVersion})
+	if err := bd.BatchCommit(); err != nil {
+		return 0, err
+	}
+
+	bd.mu.Lock()
+	bd.currentBlockHeight = height
+	bd.mu.Unlock()
+	if bd.pruneState != nil {
+		bd.pruneState.next = height + 1
+	}
+	log.Infof("Imported snapshot at height %d, block %x", height, blockHash.ToArrayReverse())
+	log.Infof("Address history is only kept from height %d", height+1)
+
+	return height, nil
+}
+
+// checkSnapshotHeader checks a trimmed block of the snapshot header chain
+// and returns its hash.
+func checkSnapshotHeader(data []byte, height uint32, prevHash Uint256) (Uint256, error) {
+	r := bytes.NewReader(data)
+	if _, err := serialization.ReadUint64(r); err != nil {
+		return Uint256{}, err
+	}
+	block := new(Block)
+	if err := block.FromTrimmedData(r); err != nil {
+		return Uint256{}, err
+	}
+	hash := block.Hash()
+	if block.Blockdata.Height != height || block.Blockdata.PrevBlockHash != prevHash {
+		return Uint256{}, fmt.Errorf("[ImportSnapshot] header %d %x does not link to the previous header", height, hash.ToArrayReverse())
+	}
+	if height > 0 {
+		if err := CheckProofOfWork(block.Blockdata, config.Parameters.ChainParam.PowLimit); err != nil {
+			return Uint256{}, err
+		}
+	}
+	return hash, nil
+}
+
+func isSnapshotKey(key []byte) bool {
+	if len(key) == 0 {
+		return false
+	}
+	for _, prefix := range snapshotPrefixes {
+		if DataEntryPrefix(key[0]) == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotCheckpoint returns the block hash and the snapshot commitment of
+// the checkpoint at height, if AddCheckpoints has one with a commitment.
+func snapshotCheckpoint(height uint32) (Uint256, Uint256, bool) {
+	for _, checkpoint := range config.Parameters.AddCheckpoints {
+		parts := strings.Split(checkpoint, ":")
+		if len(parts) != 3 {
+			continue
+		}
+		h, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil || uint32(h) != height {
+			continue
+		}
+		blockHash, err := uint256FromReversedHex(parts[1])
+		if err != nil {
+			continue
+		}
+		commitment, err := uint256FromReversedHex(parts[2])
+		if err != nil {
+			continue
+		}
+		return blockHash, commitment, true
+	}
+	return Uint256{}, Uint256{}, false
+}
+
+func uint256FromReversedHex(s string) (Uint256, error) {
+	b, err := HexStringToBytesReverse(s)
+	if err != nil {
+		return Uint256{}, err
+	}
+	return Uint256ParseFromBytes(b)
+}
+
+// fullReader makes every Read fill the whole buffer, the serialization
+// helpers assume a single Read returns all the bytes asked for.
+type fullReader struct {
+	r io.Reader
+}
+
+func (f fullReader) Read(p []byte) (int, error) {
+	return io.ReadFull(f.r, p)
+}
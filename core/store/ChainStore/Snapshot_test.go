@@ -0,0 +1,122 @@
+package ChainStore
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/config"
+	. "Elastos.ELA/core/ledger"
+)
+
+// exportTestSnapshot exports the snapshot of the tip of the chain and adds
+// its checkpoint to the configuration, the returned func removes it.
+func exportTestSnapshot(t *testing.T, bd *ChainStore, tip *Block) ([]byte, func()) {
+	var buf bytes.Buffer
+	commitment, err := bd.ExportSnapshot(tip.Blockdata.Height, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := tip.Hash()
+	checkpoints := config.Parameters.AddCheckpoints
+	config.Parameters.AddCheckpoints = append([]string{fmt.Sprintf("%d:%s:%s", tip.Blockdata.Height,
+		BytesToHexString(hash.ToArrayReverse()), BytesToHexString(commitment.ToArrayReverse()))}, checkpoints...)
+	return buf.Bytes(), func() { config.Parameters.AddCheckpoints = checkpoints }
+}
+
+func TestSnapshot(t *testing.T) {
+	source := newTestChainStore()
+	blocks := persistTestChain(t, source)
+	tip := blocks[len(blocks)-1]
+	transfer := blocks[1].Transactions[1]
+	snapshot, restore := exportTestSnapshot(t, source, tip)
+	defer restore()
+
+	bd := newTestChainStore()
+	height, err := bd.ImportSnapshot(bytes.NewReader(snapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != tip.Blockdata.Height {
+		t.Fatalf("imported height %d, want %d", height, tip.Blockdata.Height)
+	}
+	if hash, current, err := bd.CurrentBlock(); err != nil || hash != tip.Hash() || current != height {
+		t.Fatal("current block is not the snapshot block")
+	}
+	if !bd.IsPruned() {
+		t.Fatal("imported store is not pruned")
+	}
+	if version, _ := bd.Get([]byte{byte(CFG_Version)}); version[0] != StoreVersion {
+		t.Fatalf("imported store has version %x", version)
+	}
+
+	// the unspent set of the source and the transactions it spends from
+	for _, output := range []struct {
+		txid  Uint256
+		index uint16
+		want  bool
+	}{
+		{transfer.Hash(), 0, true},
+		{transfer.Hash(), 1, true},
+		{blocks[0].Transactions[0].Hash(), 0, false},
+		{tip.Transactions[0].Hash(), 0, true},
+	} {
+		ok, _ := bd.ContainsUnspent(output.txid, output.index)
+		if ok != output.want {
+			t.Fatalf("output %x:%d unspent %t, want %t", output.txid.ToArrayReverse(), output.index, ok, output.want)
+		}
+		if _, _, err := bd.GetTransaction(output.txid); (err == nil) != output.want {
+			t.Fatalf("transaction %x kept %t, want %t", output.txid.ToArrayReverse(), err == nil, output.want)
+		}
+	}
+	unspents, err := bd.GetUnspentFromProgramHash(testBob, testAssetID)
+	if err != nil || len(unspents) != 1 || unspents[0].Value != 30 {
+		t.Fatal("unspent outputs of bob are not imported")
+	}
+
+	// the header chain
+	for _, b := range blocks {
+		if hash, err := bd.GetBlockHash(b.Blockdata.Height); err != nil || hash != b.Hash() {
+			t.Fatalf("block hash of height %d is not imported", b.Blockdata.Height)
+		}
+	}
+
+	// the address history is not carried
+	if _, total, _ := bd.GetAddressHistory(testBob, 0, 0); total != 0 {
+		t.Fatalf("imported store has %d history entries of bob", total)
+	}
+
+	if _, err := bd.ImportSnapshot(bytes.NewReader(snapshot)); err == nil {
+		t.Fatal("snapshot imported into a store holding a chain")
+	}
+}
+
+func TestSnapshotRejected(t *testing.T) {
+	source := newTestChainStore()
+	blocks := persistTestChain(t, source)
+	tip := newTestBlock(t, blocks[1])
+	if err := source.persist(tip); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, restore := exportTestSnapshot(t, source, tip)
+	defer restore()
+
+	// a changed entry no longer matches the commitment, the last byte of a
+	// snapshot is part of the commitment itself
+	tampered := append([]byte{}, snapshot...)
+	tampered[len(tampered)-40] ^= 0x01
+	if _, err := newTestChainStore().ImportSnapshot(bytes.NewReader(tampered)); err == nil {
+		t.Fatal("tampered snapshot imported")
+	}
+
+	truncated := snapshot[:len(snapshot)-1]
+	if _, err := newTestChainStore().ImportSnapshot(bytes.NewReader(truncated)); err == nil {
+		t.Fatal("truncated snapshot imported")
+	}
+
+	restore()
+	if _, err := newTestChainStore().ImportSnapshot(bytes.NewReader(snapshot)); err == nil {
+		t.Fatal("snapshot without a checkpoint imported")
+	}
+}
@@ -1,14 +1,19 @@
 package LevelDBStore
 
 import (
+	"Elastos.ELA/common/metrics"
 	. "Elastos.ELA/core/store"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/errors"
 	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
+	"time"
 )
 
+var batchCommitSeconds = metrics.NewHistogram("ela_leveldb_batch_commit_seconds",
+	"Time taken to write a batch to LevelDB.", metrics.DefaultBuckets)
+
 type LevelDBStore struct {
 	db    *leveldb.DB // LevelDB instance
 	batch *leveldb.Batch
@@ -71,6 +76,7 @@ func (self *LevelDBStore) BatchDelete(key []byte) error {
 }
 
 func (self *LevelDBStore) BatchCommit() error {
+	defer batchCommitSeconds.ObserveSince(time.Now())
 	err := self.db.Write(self.batch, nil)
 	if err != nil {
 		return err
@@ -0,0 +1,162 @@
+package MemoryStore
+
+import (
+	. "Elastos.ELA/core/store"
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrNotFound and ErrClosed carry the same text as their leveldb
+	// counterparts so callers see no difference between the backends.
+	ErrNotFound = errors.New("leveldb: not found")
+	ErrClosed   = errors.New("leveldb: closed")
+)
+
+type batchOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// MemoryStore is an IStore kept entirely in memory, it is meant for tests
+// and throwaway nodes where nothing needs to survive a restart.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	db     map[string][]byte
+	batch  []batchOp
+	closed bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		db:    make(map[string][]byte),
+		batch: nil,
+	}
+}
+
+func (self *MemoryStore) Put(key []byte, value []byte) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.closed {
+		return ErrClosed
+	}
+	self.db[string(key)] = copyBytes(value)
+	return nil
+}
+
+func (self *MemoryStore) Get(key []byte) ([]byte, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	if self.closed {
+		return nil, ErrClosed
+	}
+	value, ok := self.db[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyBytes(value), nil
+}
+
+func (self *MemoryStore) Delete(key []byte) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.closed {
+		return ErrClosed
+	}
+	delete(self.db, string(key))
+	return nil
+}
+
+func (self *MemoryStore) NewBatch() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.batch = make([]batchOp, 0)
+	return nil
+}
+
+func (self *MemoryStore) BatchPut(key []byte, value []byte) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.batch = append(self.batch, batchOp{key: copyBytes(key), value: copyBytes(value)})
+	return nil
+}
+
+func (self *MemoryStore) BatchDelete(key []byte) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.batch = append(self.batch, batchOp{key: copyBytes(key), delete: true})
+	return nil
+}
+
+// BatchCommit applies the recorded operations in order under a single
+// lock, readers observe either none or all of them.
+func (self *MemoryStore) BatchCommit() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.closed {
+		return ErrClosed
+	}
+	for _, op := range self.batch {
+		if op.delete {
+			delete(self.db, string(op.key))
+		} else {
+			self.db[string(op.key)] = op.value
+		}
+	}
+	return nil
+}
+
+func (self *MemoryStore) Close() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.closed = true
+	self.db = nil
+	self.batch = nil
+	return nil
+}
+
+// NewIterator returns an iterator over a snapshot of the keys starting
+// with prefix, later writes to the store are not visible through it.
+func (self *MemoryStore) NewIterator(prefix []byte) IIterator {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	keys := make([]string, 0)
+	for k := range self.db {
+		if bytes.HasPrefix([]byte(k), prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	values := make([][]byte, len(keys))
+	for i, k := range keys {
+		values[i] = self.db[k]
+	}
+
+	return &Iterator{
+		keys:   keys,
+		values: values,
+		pos:    -1,
+	}
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
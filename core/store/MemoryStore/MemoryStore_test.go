@@ -0,0 +1,74 @@
+package MemoryStore
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMemoryStoreBatch(t *testing.T) {
+	st := NewMemoryStore()
+	st.Put([]byte("a"), []byte("1"))
+
+	st.NewBatch()
+	st.BatchPut([]byte("b"), []byte("2"))
+	st.BatchDelete([]byte("a"))
+	if _, err := st.Get([]byte("b")); err != ErrNotFound {
+		t.Fatal("batch visible before commit")
+	}
+	if err := st.BatchCommit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Get([]byte("a")); err != ErrNotFound {
+		t.Fatal("batch delete not applied")
+	}
+	if v, err := st.Get([]byte("b")); err != nil || !bytes.Equal(v, []byte("2")) {
+		t.Fatal("batch put not applied")
+	}
+}
+
+func TestMemoryStoreIterator(t *testing.T) {
+	st := NewMemoryStore()
+	for _, k := range []string{"x", "p3", "p1", "q", "p2"} {
+		st.Put([]byte(k), []byte(k))
+	}
+
+	iter := st.NewIterator([]byte("p"))
+	var keys []string
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	if len(keys) != 3 || keys[0] != "p1" || keys[1] != "p2" || keys[2] != "p3" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	// after running off the end Prev comes back to the last key
+	if !iter.Prev() || string(iter.Key()) != "p3" {
+		t.Fatal("Prev after end should move to last")
+	}
+	if !iter.Seek([]byte("p15")) || string(iter.Key()) != "p2" {
+		t.Fatal("Seek should land on the next greater key")
+	}
+	if iter.Seek([]byte("p4")) {
+		t.Fatal("Seek past the last key should fail")
+	}
+	if !iter.Last() || string(iter.Value()) != "p3" {
+		t.Fatal("Last should move to p3")
+	}
+	for iter.Prev() {
+	}
+	if iter.Key() != nil || !iter.Next() || string(iter.Key()) != "p1" {
+		t.Fatal("Next after start should move to first")
+	}
+	iter.Release()
+	if iter.Next() || iter.First() {
+		t.Fatal("released iterator should be exhausted")
+	}
+
+	// writes after the iterator was created are not visible through it
+	iter = st.NewIterator(nil)
+	st.Put([]byte("z"), nil)
+	if !iter.Last() || string(iter.Key()) != "x" {
+		t.Fatal("iterator should not see later writes")
+	}
+	iter.Release()
+}
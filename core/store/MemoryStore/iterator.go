@@ -0,0 +1,83 @@
+package MemoryStore
+
+import (
+	"sort"
+)
+
+// Iterator walks a sorted snapshot of keys. As with leveldb it starts
+// positioned before the first key, Next from there moves to the first key,
+// and once it runs off the end Prev moves back to the last key.
+type Iterator struct {
+	keys     []string
+	values   [][]byte
+	pos      int
+	released bool
+}
+
+func (it *Iterator) valid() bool {
+	return !it.released && it.pos >= 0 && it.pos < len(it.keys)
+}
+
+func (it *Iterator) Next() bool {
+	if it.released || it.pos >= len(it.keys) {
+		return false
+	}
+	it.pos++
+	return it.valid()
+}
+
+func (it *Iterator) Prev() bool {
+	if it.released || it.pos < 0 {
+		return false
+	}
+	it.pos--
+	return it.valid()
+}
+
+func (it *Iterator) First() bool {
+	if it.released {
+		return false
+	}
+	it.pos = 0
+	if len(it.keys) == 0 {
+		it.pos = -1
+	}
+	return it.valid()
+}
+
+func (it *Iterator) Last() bool {
+	if it.released {
+		return false
+	}
+	it.pos = len(it.keys) - 1
+	return it.valid()
+}
+
+// Seek moves to the first key greater than or equal to key.
+func (it *Iterator) Seek(key []byte) bool {
+	if it.released {
+		return false
+	}
+	it.pos = sort.SearchStrings(it.keys, string(key))
+	return it.valid()
+}
+
+func (it *Iterator) Key() []byte {
+	if !it.valid() {
+		return nil
+	}
+	return []byte(it.keys[it.pos])
+}
+
+func (it *Iterator) Value() []byte {
+	if !it.valid() {
+		return nil
+	}
+	return it.values[it.pos]
+}
+
+func (it *Iterator) Release() {
+	it.released = true
+	it.keys = nil
+	it.values = nil
+}
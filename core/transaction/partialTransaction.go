@@ -0,0 +1,358 @@
+package transaction
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/serialization"
+	ct "Elastos.ELA/core/contract"
+	sig "Elastos.ELA/core/signature"
+	"Elastos.ELA/crypto"
+	"Elastos.ELA/vm/opcode"
+)
+
+const PartialTransactionVersion byte = 0x00
+
+// PartialTransaction is a transaction on its way from the node which created
+// it to its signers. Besides the unsigned transaction it carries the
+// transactions its inputs spend and the redeem scripts of its program hashes,
+// so it can be checked and signed on a machine without the chain, and the
+// signatures collected so far.
+type PartialTransaction struct {
+	Transaction *Transaction
+	// the transactions whose outputs the inputs spend
+	PrevTransactions []*Transaction
+	// the outputs spent by the inputs, in the order of the inputs, taken
+	// from the previous transactions
+	References []*TxOutput
+	Context    *ct.ContractContext
+}
+
+// offlineTransaction gives the program hashes of the transaction from the
+// references it was created with instead of the ledger.
+type offlineTransaction struct {
+	*Transaction
+	references []*TxOutput
+}
+
+func (tx *offlineTransaction) GetProgramHashes() ([]Uint168, error) {
+	return tx.programHashes(tx.references)
+}
+
+// NewPartialTransaction creates the container of an unsigned transaction, the
+// previous transactions are the ones its inputs spend. The redeem scripts may
+// miss the ones of single sign addresses, the signer fills them in from its
+// key.
+func NewPartialTransaction(txn *Transaction, prevTransactions []*Transaction, redeemScripts map[Uint168][]byte) (*PartialTransaction, error) {
+	ptx := &PartialTransaction{Transaction: txn, PrevTransactions: prevTransactions}
+	if err := ptx.newContext(); err != nil {
+		return nil, err
+	}
+	for i, programHash := range ptx.Context.ProgramHashes {
+		code, ok := redeemScripts[programHash]
+		if !ok {
+			continue
+		}
+		if err := checkRedeemScript(programHash, code); err != nil {
+			return nil, err
+		}
+		ptx.Context.Codes[i] = code
+	}
+	return ptx, nil
+}
+
+func (ptx *PartialTransaction) newContext() error {
+	references, err := ptx.references()
+	if err != nil {
+		return err
+	}
+	ptx.References = references
+	data := &offlineTransaction{Transaction: ptx.Transaction, references: references}
+	if _, err := data.GetProgramHashes(); err != nil {
+		return err
+	}
+	ptx.Context = ct.NewContractContext(data)
+	return nil
+}
+
+// references returns the outputs spent by the inputs. The previous
+// transactions are found by their hashes, so the outputs cannot be made up.
+func (ptx *PartialTransaction) references() ([]*TxOutput, error) {
+	prevTransactions := make(map[Uint256]*Transaction)
+	for _, txn := range ptx.PrevTransactions {
+		prevTransactions[txn.Hash()] = txn
+	}
+	references := make([]*TxOutput, 0, len(ptx.Transaction.UTXOInputs))
+	for _, input := range ptx.Transaction.UTXOInputs {
+		txn, ok := prevTransactions[input.ReferTxID]
+		if !ok {
+			return nil, errors.New("previous transaction of an input is missing")
+		}
+		if int(input.ReferTxOutputIndex) >= len(txn.Outputs) {
+			return nil, errors.New("input refers to a missing output")
+		}
+		references = append(references, txn.Outputs[input.ReferTxOutputIndex])
+	}
+	return references, nil
+}
+
+// checkRedeemScript tells if the code is the redeem script of the program
+// hash, by the prefix of the hash as the validation does.
+func checkRedeemScript(programHash Uint168, code []byte) error {
+	var signType int
+	switch programHash[0] {
+	case 33:
+		signType = 1
+	case 18:
+		signType = 2
+	case 75:
+		signType = 3
+	default:
+		return errors.New("invalid address prefix")
+	}
+	hash, err := ToCodeHash(code, signType)
+	if err != nil {
+		return err
+	}
+	if hash != programHash {
+		return errors.New("redeem script does not match its program hash")
+	}
+	return nil
+}
+
+// Sign adds the signatures of the signer to the programs it is a key of, it
+// returns the number of signatures added. Custom scripts are left to the
+// tools which know their parameters.
+func (ptx *PartialTransaction) Sign(signer sig.Signer) (int, error) {
+	references, err := ptx.references()
+	if err != nil {
+		return 0, err
+	}
+	for i, output := range references {
+		if *output != *ptx.References[i] {
+			return 0, errors.New("references are not the outputs of the previous transactions")
+		}
+	}
+
+	script, err := ct.CreateSignatureRedeemScript(signer.PubKey())
+	if err != nil {
+		return 0, err
+	}
+	signerHash, err := ToCodeHash(script, 1)
+	if err != nil {
+		return 0, err
+	}
+	publicKey, err := signer.PubKey().EncodePoint(true)
+	if err != nil {
+		return 0, err
+	}
+
+	context := ptx.Context
+	message := sig.GetHashData(context.Data)
+	signed := 0
+	for i, programHash := range context.ProgramHashes {
+		code := context.Codes[i]
+		if code == nil && programHash == signerHash {
+			code = script
+		}
+		contract := &ct.Contract{Code: code, ProgramHash: programHash}
+		index := -1
+		switch contract.GetType() {
+		case ct.SignatureContract:
+			if programHash != signerHash || context.Parameters[i] != nil {
+				continue
+			}
+			contract.Parameters = []ct.ContractParameterType{ct.Signature}
+			index = 0
+		case ct.MultiSigContract:
+			if !multiSigHasKey(code, publicKey) {
+				continue
+			}
+			contract.Parameters = make([]ct.ContractParameterType, int(code[0])-int(opcode.PUSH1)+1)
+			for j := range contract.Parameters {
+				contract.Parameters[j] = ct.Signature
+			}
+			if context.Parameters[i] == nil {
+				index = 0
+				break
+			}
+			signedAlready := false
+			for j, parameter := range context.Parameters[i] {
+				if parameter == nil {
+					if index < 0 {
+						index = j
+					}
+				} else if crypto.Verify(*signer.PubKey(), message, parameter) == nil {
+					signedAlready = true
+				}
+			}
+			if signedAlready || index < 0 {
+				continue
+			}
+		default:
+			continue
+		}
+
+		signature, err := sig.SignBySigner(context.Data, signer)
+		if err != nil {
+			return signed, err
+		}
+		if err := context.Add(contract, index, signature); err != nil {
+			return signed, err
+		}
+		signed++
+	}
+	return signed, nil
+}
+
+// multiSigHasKey tells if the public key is one of the keys of the multisig
+// redeem script, m || n * (0x21 || public key) || n || CHECKMULTISIG.
+func multiSigHasKey(code []byte, publicKey []byte) bool {
+	for i := 1; i+34 <= len(code) && code[i] == 33; i += 34 {
+		if bytes.Equal(code[i+1:i+34], publicKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// SignatureCount returns the number of signatures the program of the index
+// has and the number it needs, which is unknown (zero) while its redeem
+// script is missing.
+func (ptx *PartialTransaction) SignatureCount(index int) (have, need int) {
+	parameters := ptx.Context.Parameters[index]
+	for _, parameter := range parameters {
+		if parameter != nil {
+			have++
+		}
+	}
+	if parameters != nil {
+		return have, len(parameters)
+	}
+	contract := &ct.Contract{Code: ptx.Context.Codes[index]}
+	switch contract.GetType() {
+	case ct.SignatureContract:
+		need = 1
+	case ct.MultiSigContract:
+		need = int(contract.Code[0]) - int(opcode.PUSH1) + 1
+	}
+	return have, need
+}
+
+func (ptx *PartialTransaction) IsCompleted() bool {
+	return ptx.Context.IsCompleted()
+}
+
+// Finalize sets the programs built from the signatures to the transaction,
+// which can then be sent to the network.
+func (ptx *PartialTransaction) Finalize() (*Transaction, error) {
+	if !ptx.IsCompleted() {
+		return nil, errors.New("transaction is not fully signed")
+	}
+	ptx.Transaction.SetPrograms(ptx.Context.GetPrograms())
+	return ptx.Transaction, nil
+}
+
+func (ptx *PartialTransaction) Serialize(w io.Writer) error {
+	if err := serialization.WriteUint8(w, PartialTransactionVersion); err != nil {
+		return err
+	}
+	if err := ptx.Transaction.Serialize(w); err != nil {
+		return err
+	}
+	if err := serialization.WriteVarUint(w, uint64(len(ptx.PrevTransactions))); err != nil {
+		return err
+	}
+	for _, txn := range ptx.PrevTransactions {
+		if err := txn.Serialize(w); err != nil {
+			return err
+		}
+	}
+	context := ptx.Context
+	for i := range context.ProgramHashes {
+		if err := serialization.WriteVarBytes(w, context.Codes[i]); err != nil {
+			return err
+		}
+		if err := serialization.WriteVarUint(w, uint64(len(context.Parameters[i]))); err != nil {
+			return err
+		}
+		for _, parameter := range context.Parameters[i] {
+			if err := serialization.WriteVarBytes(w, parameter); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (ptx *PartialTransaction) Deserialize(r io.Reader) error {
+	version, err := serialization.ReadUint8(r)
+	if err != nil {
+		return err
+	}
+	if version != PartialTransactionVersion {
+		return errors.New("unknown partial transaction version")
+	}
+	ptx.Transaction = new(Transaction)
+	if err := ptx.Transaction.Deserialize(r); err != nil {
+		return err
+	}
+	// each input spends an output of one of the previous transactions
+	count, err := serialization.ReadVarUint(r, 0)
+	if err != nil {
+		return err
+	}
+	if count > uint64(len(ptx.Transaction.UTXOInputs)) {
+		return errors.New("more previous transactions than inputs")
+	}
+	ptx.PrevTransactions = make([]*Transaction, 0, count)
+	for i := uint64(0); i < count; i++ {
+		txn := new(Transaction)
+		if err := txn.Deserialize(r); err != nil {
+			return err
+		}
+		ptx.PrevTransactions = append(ptx.PrevTransactions, txn)
+	}
+	if err := ptx.newContext(); err != nil {
+		return err
+	}
+
+	context := ptx.Context
+	for i, programHash := range context.ProgramHashes {
+		code, err := serialization.ReadVarBytes(r)
+		if err != nil {
+			return err
+		}
+		if len(code) > 0 {
+			if err := checkRedeemScript(programHash, code); err != nil {
+				return err
+			}
+			context.Codes[i] = code
+		}
+		// the redeem script tells the number of signatures
+		count, err := serialization.ReadVarUint(r, math.MaxUint8)
+		if err != nil {
+			return errors.New("too many signatures")
+		}
+		if count == 0 {
+			continue
+		}
+		if _, need := ptx.SignatureCount(i); count != uint64(need) {
+			return errors.New("number of signatures does not match the redeem script")
+		}
+		context.Parameters[i] = make([][]byte, count)
+		for j := range context.Parameters[i] {
+			parameter, err := serialization.ReadVarBytes(r)
+			if err != nil {
+				return err
+			}
+			if len(parameter) > 0 {
+				context.Parameters[i][j] = parameter
+			}
+		}
+	}
+	return nil
+}
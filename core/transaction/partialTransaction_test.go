@@ -0,0 +1,185 @@
+package transaction
+
+import (
+	"bytes"
+	"testing"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/log"
+	ct "Elastos.ELA/core/contract"
+	sig "Elastos.ELA/core/signature"
+	"Elastos.ELA/crypto"
+)
+
+type testSigner struct {
+	privateKey []byte
+	publicKey  crypto.PubKey
+}
+
+func (s *testSigner) PrivKey() []byte        { return s.privateKey }
+func (s *testSigner) PubKey() *crypto.PubKey { return &s.publicKey }
+
+func newTestSigner(t *testing.T) *testSigner {
+	privateKey, publicKey, err := crypto.GenKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{privateKey, publicKey}
+}
+
+func roundTrip(t *testing.T, ptx *PartialTransaction) *PartialTransaction {
+	var buffer bytes.Buffer
+	if err := ptx.Serialize(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	decoded := new(PartialTransaction)
+	if err := decoded.Deserialize(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+// newTestSpend returns a transaction spending the two outputs of a previous
+// one, paid to the program hashes.
+func newTestSpend(first, second Uint168) (*Transaction, []*Transaction) {
+	prev, _ := NewTransferAssetTransaction([]*UTXOTxInput{{ReferTxID: Uint256{1}}},
+		[]*TxOutput{{Value: 10, ProgramHash: first}, {Value: 20, ProgramHash: second}})
+	inputs := []*UTXOTxInput{{ReferTxID: prev.Hash(), ReferTxOutputIndex: 0}, {ReferTxID: prev.Hash(), ReferTxOutputIndex: 1}}
+	txn, _ := NewTransferAssetTransaction(inputs, []*TxOutput{{Value: 29, ProgramHash: first}})
+	return txn, []*Transaction{prev}
+}
+
+func TestPartialTransaction(t *testing.T) {
+	log.Init()
+	signers := []*testSigner{newTestSigner(t), newTestSigner(t), newTestSigner(t)}
+
+	// a single sign address whose redeem script the creator does not know,
+	// and a 2 of 3 multisig address
+	single, _ := ct.CreateSignatureRedeemScript(signers[0].PubKey())
+	singleHash, _ := ToCodeHash(single, 1)
+	multi, err := ct.CreateMultiSigRedeemScript(2, []*crypto.PubKey{signers[0].PubKey(), signers[1].PubKey(), signers[2].PubKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	multiHash, _ := ToCodeHash(multi, 2)
+
+	txn, prev := newTestSpend(singleHash, multiHash)
+	ptx, err := NewPartialTransaction(txn, prev, map[Uint168][]byte{multiHash: multi})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewPartialTransaction(txn, prev, map[Uint168][]byte{singleHash: multi}); err == nil {
+		t.Error("redeem script of another address accepted")
+	}
+
+	expected := []int{2, 1, 0}
+	for i, signer := range signers {
+		ptx = roundTrip(t, ptx)
+		count, err := ptx.Sign(signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != expected[i] {
+			t.Errorf("signer %d added %d signatures, expected %d", i, count, expected[i])
+		}
+		if i == 0 {
+			if count, _ := ptx.Sign(signer); count != 0 {
+				t.Error("signed twice with the same key")
+			}
+			if ptx.IsCompleted() {
+				t.Error("completed with one signature of the multisig")
+			}
+			if _, err := ptx.Finalize(); err == nil {
+				t.Error("finalized without all the signatures")
+			}
+		}
+	}
+
+	if !ptx.IsCompleted() {
+		t.Fatal("not completed")
+	}
+	signed, err := ptx.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := sig.GetHashData(signed)
+	for i, programHash := range ptx.Context.ProgramHashes {
+		program := signed.Programs[i]
+		if checkRedeemScript(programHash, program.Code) != nil {
+			t.Errorf("program %d is not the one of its program hash", i)
+		}
+		for j, signature := range ptx.Context.Parameters[i] {
+			valid := false
+			for _, signer := range signers {
+				if crypto.Verify(*signer.PubKey(), message, signature) == nil {
+					valid = true
+				}
+			}
+			if !valid {
+				t.Errorf("signature %d of program %d is invalid", j, i)
+			}
+		}
+	}
+}
+
+func TestPartialTransactionRejected(t *testing.T) {
+	log.Init()
+	signers := []*testSigner{newTestSigner(t), newTestSigner(t)}
+	single, _ := ct.CreateSignatureRedeemScript(signers[0].PubKey())
+	singleHash, _ := ToCodeHash(single, 1)
+	multi, _ := ct.CreateMultiSigRedeemScript(2, []*crypto.PubKey{signers[0].PubKey(), signers[1].PubKey()})
+	multiHash, _ := ToCodeHash(multi, 2)
+	txn, prev := newTestSpend(singleHash, multiHash)
+
+	if _, err := NewPartialTransaction(txn, nil, nil); err == nil {
+		t.Error("created without the previous transactions")
+	}
+	ptx, err := NewPartialTransaction(txn, prev, map[Uint168][]byte{singleHash: single, multiHash: multi})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *ptx.References[1] != *prev[0].Outputs[1] {
+		t.Fatal("references are not taken from the previous transaction")
+	}
+	var buffer bytes.Buffer
+	if err := ptx.Serialize(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	raw := buffer.Bytes()
+	decode := func(data []byte) error {
+		return new(PartialTransaction).Deserialize(bytes.NewReader(data))
+	}
+	if err := decode(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	// a previous transaction changed on the way no longer matches the input
+	var prevBuffer bytes.Buffer
+	prev[0].Serialize(&prevBuffer)
+	at := bytes.Index(raw, prevBuffer.Bytes()) + prevBuffer.Len() - 1
+	tampered := append([]byte{}, raw...)
+	tampered[at] ^= 1
+	if err := decode(tampered); err == nil {
+		t.Error("previous transaction with another hash accepted")
+	}
+
+	// the number of signatures is the one of the redeem script
+	for _, count := range [][]byte{{0x01}, {0x05}, {0xfd, 0xff, 0xff}, {0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}} {
+		bad := append(append([]byte{}, raw[:len(raw)-1]...), count...)
+		if err := decode(bad); err == nil {
+			t.Errorf("signature count %x accepted", count)
+		}
+	}
+
+	for _, size := range []int{len(raw) - 1, len(raw) - 2, len(raw) / 2} {
+		if err := decode(raw[:size]); err == nil {
+			t.Errorf("truncated to %d bytes accepted", size)
+		}
+	}
+
+	// references replaced after the creation are not signed
+	ptx.References[0] = &TxOutput{Value: 1000, ProgramHash: singleHash}
+	if _, err := ptx.Sign(signers[0]); err == nil {
+		t.Error("signed references which are not the previous outputs")
+	}
+}
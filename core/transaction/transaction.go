@@ -251,8 +251,9 @@ func (tx *Transaction) DeserializeUnsignedWithoutType(r io.Reader) error {
 	if Len > uint64(0) {
 		for i := uint64(0); i < Len; i++ {
 			output := new(TxOutput)
-			output.Deserialize(r)
-
+			if err := output.Deserialize(r); err != nil {
+				return err
+			}
 			tx.Outputs = append(tx.Outputs, output)
 		}
 	}
@@ -288,14 +289,24 @@ func (tx *Transaction) GetProgramHashes() ([]Uint168, error) {
 	if tx == nil {
 		return []Uint168{}, errors.New("[Transaction],GetProgramHashes transaction is nil.")
 	}
-	hashs := []Uint168{}
-	uniqHashes := []Uint168{}
 	// add inputUTXO's transaction
 	referenceWithUTXO_Output, err := tx.GetReference()
 	if err != nil {
 		return nil, errors.New("[Transaction], GetProgramHashes failed.")
 	}
+	references := []*TxOutput{}
 	for _, output := range referenceWithUTXO_Output {
+		references = append(references, output)
+	}
+	return tx.programHashes(references)
+}
+
+// programHashes returns the program hashes to sign for, given the outputs the
+// inputs spend.
+func (tx *Transaction) programHashes(references []*TxOutput) ([]Uint168, error) {
+	hashs := []Uint168{}
+	uniqHashes := []Uint168{}
+	for _, output := range references {
 		programHash := output.ProgramHash
 		hashs = append(hashs, programHash)
 	}
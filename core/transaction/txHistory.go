@@ -0,0 +1,65 @@
+package transaction
+
+import (
+	"Elastos.ELA/common"
+	"Elastos.ELA/common/serialization"
+	"io"
+)
+
+type TxDirection byte
+
+const (
+	TxIncoming TxDirection = 0x00
+	TxOutgoing TxDirection = 0x01
+)
+
+func (d TxDirection) String() string {
+	switch d {
+	case TxIncoming:
+		return "incoming"
+	case TxOutgoing:
+		return "outgoing"
+	}
+	return "unknown"
+}
+
+// TxHistory is the net effect of one transaction on one program hash
+// for a single asset.
+type TxHistory struct {
+	Height    uint32
+	Txid      common.Uint256
+	AssetID   common.Uint256
+	Direction TxDirection
+	Value     common.Fixed64
+}
+
+func (h *TxHistory) Serialize(w io.Writer) {
+	serialization.WriteUint32(w, h.Height)
+	h.Txid.Serialize(w)
+	h.AssetID.Serialize(w)
+	serialization.WriteUint8(w, uint8(h.Direction))
+	h.Value.Serialize(w)
+}
+
+func (h *TxHistory) Deserialize(r io.Reader) error {
+	height, err := serialization.ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	h.Height = height
+
+	if err := h.Txid.Deserialize(r); err != nil {
+		return err
+	}
+	if err := h.AssetID.Deserialize(r); err != nil {
+		return err
+	}
+
+	direction, err := serialization.ReadUint8(r)
+	if err != nil {
+		return err
+	}
+	h.Direction = TxDirection(direction)
+
+	return h.Value.Deserialize(r)
+}
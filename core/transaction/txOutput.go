@@ -21,10 +21,17 @@ func (o *TxOutput) Serialize(w io.Writer) {
 	o.ProgramHash.Serialize(w)
 }
 
-func (o *TxOutput) Deserialize(r io.Reader) {
-	o.AssetID.Deserialize(r)
-	o.Value.Deserialize(r)
-	temp, _ := serialization.ReadUint32(r)
+func (o *TxOutput) Deserialize(r io.Reader) error {
+	if err := o.AssetID.Deserialize(r); err != nil {
+		return err
+	}
+	if err := o.Value.Deserialize(r); err != nil {
+		return err
+	}
+	temp, err := serialization.ReadUint32(r)
+	if err != nil {
+		return err
+	}
 	o.OutputLock = uint32(temp)
-	o.ProgramHash.Deserialize(r)
+	return o.ProgramHash.Deserialize(r)
 }
@@ -0,0 +1,271 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	. "Elastos.ELA/common"
+
+	"github.com/itchyny/base58-go"
+)
+
+// Hierarchical deterministic keys as in BIP32, on the P-256 curve. The
+// master key and the invalid child cases follow SLIP-0010 for nist256p1, so
+// the keys match the ones other tools derive for this curve.
+
+const (
+	HardenedKeyStart = 0x80000000
+
+	extendedKeyLen = 78
+)
+
+var (
+	masterKeySeed = []byte("Nist256p1 seed")
+
+	// the version bytes of the serialized keys, they start with eprv and
+	// epub. The xprv and xpub versions of BIP32 are not used, those keys
+	// are on secp256k1 and tools would derive other keys from them.
+	privateKeyVersion = []byte{0x03, 0x12, 0x6f, 0x7f}
+	publicKeyVersion  = []byte{0x03, 0x12, 0x73, 0xb9}
+)
+
+type ExtendedKey struct {
+	// 32 bytes private key or 33 bytes compressed public key
+	key       []byte
+	chainCode []byte
+	depth     uint8
+	parentFP  []byte
+	index     uint32
+	isPrivate bool
+}
+
+// NewMasterKey creates the root key of the tree from a seed of 16 to 64
+// bytes.
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, errors.New("invalid seed length")
+	}
+	data := seed
+	for {
+		mac := hmac.New(sha512.New, masterKeySeed)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		k := new(big.Int).SetBytes(sum[:32])
+		if k.Sign() != 0 && k.Cmp(algSet.EccParams.N) < 0 {
+			return &ExtendedKey{
+				key:       sum[:32],
+				chainCode: sum[32:],
+				parentFP:  []byte{0, 0, 0, 0},
+				isPrivate: true,
+			}, nil
+		}
+		data = sum
+	}
+}
+
+func (k *ExtendedKey) IsPrivate() bool {
+	return k.isPrivate
+}
+
+func (k *ExtendedKey) pubKeyBytes() []byte {
+	if !k.isPrivate {
+		return k.key
+	}
+	x, y := algSet.Curve.ScalarBaseMult(k.key)
+	encoded, _ := (&PubKey{X: x, Y: y}).EncodePoint(true)
+	return encoded
+}
+
+func (k *ExtendedKey) fingerprint() []byte {
+	hash, _ := ToCodeHash(k.pubKeyBytes(), 1)
+	return hash[1:5]
+}
+
+// Child derives the child key with the index, indexes from HardenedKeyStart
+// on are hardened and can only be derived from a private key.
+func (k *ExtendedKey) Child(i uint32) (*ExtendedKey, error) {
+	if k.depth == 0xff {
+		return nil, errors.New("maximum derivation depth reached")
+	}
+	hardened := i >= HardenedKeyStart
+	if hardened && !k.isPrivate {
+		return nil, errors.New("cannot derive a hardened key from a public key")
+	}
+
+	data := make([]byte, 0, 37)
+	if hardened {
+		data = append(data, 0x00)
+		data = append(data, k.key...)
+	} else {
+		data = append(data, k.pubKeyBytes()...)
+	}
+	data = append(data, ser32(i)...)
+
+	curve := algSet.Curve
+	n := algSet.EccParams.N
+	for {
+		mac := hmac.New(sha512.New, k.chainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		il := new(big.Int).SetBytes(sum[:32])
+
+		child := &ExtendedKey{
+			chainCode: sum[32:],
+			depth:     k.depth + 1,
+			parentFP:  k.fingerprint(),
+			index:     i,
+			isPrivate: k.isPrivate,
+		}
+		valid := il.Cmp(n) < 0
+		if valid && k.isPrivate {
+			key := new(big.Int).Add(il, new(big.Int).SetBytes(k.key))
+			key.Mod(key, n)
+			if valid = key.Sign() != 0; valid {
+				child.key = paddedBytes(key)
+			}
+		} else if valid {
+			parent, err := DecodePoint(k.key)
+			if err != nil {
+				return nil, err
+			}
+			x, y := curve.ScalarBaseMult(sum[:32])
+			x, y = curve.Add(x, y, parent.X, parent.Y)
+			if valid = x.Sign() != 0 || y.Sign() != 0; valid {
+				child.key, _ = (&PubKey{X: x, Y: y}).EncodePoint(true)
+			}
+		}
+		if valid {
+			return child, nil
+		}
+		// SLIP-0010: retry with the right half of the hash
+		data = append([]byte{0x01}, sum[32:]...)
+		data = append(data, ser32(i)...)
+	}
+}
+
+// Derive derives the key at the path below k.
+func (k *ExtendedKey) Derive(path ...uint32) (*ExtendedKey, error) {
+	key := k
+	for _, i := range path {
+		var err error
+		if key, err = key.Child(i); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// Neuter returns the extended public key of k.
+func (k *ExtendedKey) Neuter() *ExtendedKey {
+	if !k.isPrivate {
+		return k
+	}
+	return &ExtendedKey{
+		key:       k.pubKeyBytes(),
+		chainCode: k.chainCode,
+		depth:     k.depth,
+		parentFP:  k.parentFP,
+		index:     k.index,
+	}
+}
+
+func (k *ExtendedKey) PrivateKey() ([]byte, error) {
+	if !k.isPrivate {
+		return nil, errors.New("not a private key")
+	}
+	return k.key, nil
+}
+
+func (k *ExtendedKey) PublicKey() (*PubKey, error) {
+	return DecodePoint(k.pubKeyBytes())
+}
+
+// String encodes the key the way BIP32 does, with base58 check.
+func (k *ExtendedKey) String() string {
+	buf := new(bytes.Buffer)
+	if k.isPrivate {
+		buf.Write(privateKeyVersion)
+	} else {
+		buf.Write(publicKeyVersion)
+	}
+	buf.WriteByte(k.depth)
+	buf.Write(k.parentFP)
+	binary.Write(buf, binary.BigEndian, k.index)
+	buf.Write(k.chainCode)
+	if k.isPrivate {
+		buf.WriteByte(0x00)
+	}
+	buf.Write(k.key)
+	checksum := doubleSha256(buf.Bytes())
+	buf.Write(checksum[:4])
+
+	encoded, _ := base58.BitcoinEncoding.Encode([]byte(new(big.Int).SetBytes(buf.Bytes()).String()))
+	return string(encoded)
+}
+
+func ParseExtendedKey(s string) (*ExtendedKey, error) {
+	decoded, err := base58.BitcoinEncoding.Decode([]byte(s))
+	if err != nil {
+		return nil, err
+	}
+	x, ok := new(big.Int).SetString(string(decoded), 10)
+	if !ok {
+		return nil, errors.New("invalid extended key")
+	}
+	data := x.Bytes()
+	if len(data) != extendedKeyLen+4 {
+		return nil, errors.New("invalid extended key length")
+	}
+	payload, checksum := data[:extendedKeyLen], data[extendedKeyLen:]
+	if sum := doubleSha256(payload); !bytes.Equal(sum[:4], checksum) {
+		return nil, errors.New("invalid extended key checksum")
+	}
+
+	k := &ExtendedKey{
+		depth:     payload[4],
+		parentFP:  payload[5:9],
+		index:     binary.BigEndian.Uint32(payload[9:13]),
+		chainCode: payload[13:45],
+	}
+	keyData := payload[45:]
+	switch {
+	case bytes.Equal(payload[:4], privateKeyVersion) && keyData[0] == 0x00:
+		key := new(big.Int).SetBytes(keyData[1:])
+		if key.Sign() == 0 || key.Cmp(algSet.EccParams.N) >= 0 {
+			return nil, errors.New("invalid private key")
+		}
+		k.key = keyData[1:]
+		k.isPrivate = true
+	case bytes.Equal(payload[:4], publicKeyVersion) && (keyData[0] == COMPEVENFLAG || keyData[0] == COMPODDFLAG):
+		if _, err := DecodePoint(keyData); err != nil {
+			return nil, err
+		}
+		k.key = keyData
+	default:
+		return nil, errors.New("unknown extended key version")
+	}
+	return k, nil
+}
+
+func paddedBytes(k *big.Int) []byte {
+	b := make([]byte, 32)
+	kb := k.Bytes()
+	copy(b[32-len(kb):], kb)
+	return b
+}
+
+func ser32(i uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, i)
+	return b
+}
+
+func doubleSha256(data []byte) [32]byte {
+	temp := sha256.Sum256(data)
+	return sha256.Sum256(temp[:])
+}
@@ -0,0 +1,101 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// test vector 1 of SLIP-0010 for nist256p1
+func TestExtendedKeyDerivation(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	vectors := []struct {
+		path      []uint32
+		chainCode string
+		private   string
+		public    string
+	}{
+		{nil,
+			"beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea",
+			"612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2",
+			"0266874dc6ade47b3ecd096745ca09bcd29638dd52c2c12117b11ed3e458cfa9e8"},
+		{[]uint32{HardenedKeyStart},
+			"3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11",
+			"6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c",
+			"0384610f5ecffe8fda089363a41f56a5c7ffc1d81b59a612d0d649b2d22355590c"},
+	}
+
+	master, err := NewMasterKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vectors {
+		key, err := master.Derive(v.path...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(key.chainCode) != v.chainCode {
+			t.Errorf("path %v: chain code %x", v.path, key.chainCode)
+		}
+		if hex.EncodeToString(key.key) != v.private {
+			t.Errorf("path %v: private key %x", v.path, key.key)
+		}
+		if hex.EncodeToString(key.pubKeyBytes()) != v.public {
+			t.Errorf("path %v: public key %x", v.path, key.pubKeyBytes())
+		}
+	}
+
+	// public derivation gives the public key of the private child
+	parent, _ := master.Child(HardenedKeyStart)
+	private, _ := parent.Child(1)
+	public, err := parent.Neuter().Child(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(private.pubKeyBytes(), public.key) || !bytes.Equal(private.chainCode, public.chainCode) {
+		t.Error("public derivation mismatch")
+	}
+
+	for _, key := range []*ExtendedKey{private, public} {
+		parsed, err := ParseExtendedKey(key.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.String() != key.String() {
+			t.Errorf("extended key %s decoded as %s", key.String(), parsed.String())
+		}
+	}
+	if !strings.HasPrefix(private.String(), "eprv") || !strings.HasPrefix(public.String(), "epub") {
+		t.Errorf("extended keys %s and %s have the wrong prefix", private.String(), public.String())
+	}
+
+	// a secp256k1 key of BIP32 is not taken for a key of this curve
+	xpub := "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+	if _, err := ParseExtendedKey(xpub); err == nil {
+		t.Error("BIP32 extended key accepted")
+	}
+}
+
+// test vector of BIP39
+func TestMnemonicSeed(t *testing.T) {
+	mnemonic, err := EntropyToMnemonic(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mnemonic != "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about" {
+		t.Fatalf("mnemonic %s", mnemonic)
+	}
+	seed, err := MnemonicToSeed(mnemonic, "TREZOR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"
+	if hex.EncodeToString(seed) != expected {
+		t.Errorf("seed %x", seed)
+	}
+
+	if _, err := MnemonicToEntropy("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon"); err == nil {
+		t.Error("bad checksum accepted")
+	}
+}
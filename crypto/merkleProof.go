@@ -0,0 +1,115 @@
+package crypto
+
+import (
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/serialization"
+	"errors"
+	"io"
+)
+
+// MaxMerkleProofDepth bounds the branch length accepted when deserializing
+// a proof, a tree this deep holds more leaves than any block can.
+const MaxMerkleProofDepth = 32
+
+// MerkleProof is the branch from a leaf up to the root of a MerkleTree.
+// Index is the position of the leaf, its bits select at each level whether
+// the sibling is on the left or the right.
+type MerkleProof struct {
+	Index  uint32
+	Hashes []Uint256
+}
+
+// GenerateProof returns the proof of inclusion of the leaf at index.
+func (t *MerkleTree) GenerateProof(index uint32) (*MerkleProof, error) {
+	height := t.Depth - 1
+	if height < MaxMerkleProofDepth && index >= 1<<height {
+		return nil, errors.New("GenerateProof index out of range.")
+	}
+
+	// walk down from the root, the sibling hashes are collected top down
+	// and reversed afterwards so the proof reads from the leaf up.
+	hashes := make([]Uint256, height)
+	node := t.Root
+	for level := height; level > 0; level-- {
+		if (index>>(level-1))&1 == 0 {
+			hashes[level-1] = node.Right.Hash
+			node = node.Left
+		} else {
+			// an odd node is paired with itself, so there is no
+			// leaf at this index.
+			if node.Right == node.Left {
+				return nil, errors.New("GenerateProof index out of range.")
+			}
+			hashes[level-1] = node.Left.Hash
+			node = node.Right
+		}
+	}
+
+	return &MerkleProof{
+		Index:  index,
+		Hashes: hashes,
+	}, nil
+}
+
+// MerkleProofDepth returns the branch length of every leaf of a tree with
+// the given number of leaves.
+func MerkleProofDepth(leaves uint32) int {
+	depth := 0
+	for width := uint64(leaves); width > 1; width = (width + 1) / 2 {
+		depth++
+	}
+	return depth
+}
+
+// ComputeRoot returns the root hash implied by the proof for the leaf.
+func (p *MerkleProof) ComputeRoot(leaf Uint256) Uint256 {
+	hash := leaf
+	for i, sibling := range p.Hashes {
+		if (p.Index>>uint(i))&1 == 0 {
+			hash = DoubleSHA256([]Uint256{hash, sibling})
+		} else {
+			hash = DoubleSHA256([]Uint256{sibling, hash})
+		}
+	}
+	return hash
+}
+
+// Verify checks that the leaf is included in the tree with the given root.
+func (p *MerkleProof) Verify(leaf, root Uint256) bool {
+	return p.ComputeRoot(leaf) == root
+}
+
+func (p *MerkleProof) Serialize(w io.Writer) error {
+	if err := serialization.WriteUint32(w, p.Index); err != nil {
+		return err
+	}
+	if err := serialization.WriteVarUint(w, uint64(len(p.Hashes))); err != nil {
+		return err
+	}
+	for _, hash := range p.Hashes {
+		if _, err := hash.Serialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *MerkleProof) Deserialize(r io.Reader) error {
+	index, err := serialization.ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	count, err := serialization.ReadVarUint(r, MaxMerkleProofDepth)
+	if err != nil {
+		return err
+	}
+
+	p.Index = index
+	p.Hashes = make([]Uint256, count)
+	for i := range p.Hashes {
+		if err := p.Hashes[i].Deserialize(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
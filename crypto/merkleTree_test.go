@@ -2,6 +2,7 @@ package crypto
 
 import (
 	. "Elastos.ELA/common"
+	"bytes"
 	"crypto/sha256"
 	"fmt"
 	"testing"
@@ -24,3 +25,44 @@ func TestHash(t *testing.T) {
 	fmt.Printf("[Root Hash]:%x\n", x)
 
 }
+
+func TestMerkleProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		var data []Uint256
+		for i := 0; i < n; i++ {
+			data = append(data, Uint256(sha256.Sum256([]byte{byte(i)})))
+		}
+		root, _ := ComputeRoot(data)
+		tree, _ := NewMerkleTree(data)
+
+		for i := 0; i < n; i++ {
+			proof, err := tree.GenerateProof(uint32(i))
+			if err != nil {
+				t.Fatalf("%d leaves, index %d: %v", n, i, err)
+			}
+			if !proof.Verify(data[i], root) {
+				t.Errorf("%d leaves, index %d: proof does not verify", n, i)
+			}
+			if len(proof.Hashes) != MerkleProofDepth(uint32(n)) {
+				t.Errorf("%d leaves, index %d: branch of %d hashes, depth is %d", n, i, len(proof.Hashes), MerkleProofDepth(uint32(n)))
+			}
+			if i > 0 && proof.Verify(data[i-1], root) {
+				t.Errorf("%d leaves, index %d: proof verifies wrong leaf", n, i)
+			}
+
+			buf := new(bytes.Buffer)
+			proof.Serialize(buf)
+			var p MerkleProof
+			if err := p.Deserialize(buf); err != nil {
+				t.Fatal(err)
+			}
+			if !p.Verify(data[i], root) {
+				t.Errorf("%d leaves, index %d: deserialized proof does not verify", n, i)
+			}
+		}
+
+		if _, err := tree.GenerateProof(uint32(n)); err == nil {
+			t.Errorf("%d leaves: expected error for index %d", n, n)
+		}
+	}
+}
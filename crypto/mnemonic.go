@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/golang/crypto/pbkdf2"
+)
+
+// Mnemonic sentences of BIP39 with the english word list.
+
+var wordIndexes = make(map[string]int, len(mnemonicWords))
+
+func init() {
+	for i, w := range mnemonicWords {
+		wordIndexes[w] = i
+	}
+}
+
+// NewMnemonic returns a random sentence of bits/32*3 words, bits is a
+// multiple of 32 between 128 and 256.
+func NewMnemonic(bits int) (string, error) {
+	if bits%32 != 0 || bits < 128 || bits > 256 {
+		return "", errors.New("invalid entropy length")
+	}
+	entropy := make([]byte, bits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", err
+	}
+	return EntropyToMnemonic(entropy)
+}
+
+func EntropyToMnemonic(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if bits%32 != 0 || bits < 128 || bits > 256 {
+		return "", errors.New("invalid entropy length")
+	}
+	checksumBits := uint(bits / 32)
+	hash := sha256.Sum256(entropy)
+
+	// entropy followed by the first bits of its hash, read 11 bits a word
+	n := new(big.Int).SetBytes(entropy)
+	n.Lsh(n, checksumBits)
+	n.Or(n, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	count := (bits + int(checksumBits)) / 11
+	words := make([]string, count)
+	mask := big.NewInt(2047)
+	for i := count - 1; i >= 0; i-- {
+		words[i] = mnemonicWords[new(big.Int).And(n, mask).Int64()]
+		n.Rsh(n, 11)
+	}
+	return strings.Join(words, " "), nil
+}
+
+// MnemonicToEntropy checks the words and the checksum of the sentence and
+// returns its entropy.
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words)%3 != 0 || len(words) < 12 || len(words) > 24 {
+		return nil, errors.New("invalid number of mnemonic words")
+	}
+	n := new(big.Int)
+	for _, w := range words {
+		index, ok := wordIndexes[w]
+		if !ok {
+			return nil, errors.New("invalid mnemonic word \"" + w + "\"")
+		}
+		n.Lsh(n, 11)
+		n.Or(n, big.NewInt(int64(index)))
+	}
+
+	checksumBits := uint(len(words) / 3)
+	checksum := new(big.Int).And(n, big.NewInt(1<<checksumBits-1)).Int64()
+	n.Rsh(n, checksumBits)
+	entropy := make([]byte, int(checksumBits)*4)
+	nb := n.Bytes()
+	copy(entropy[len(entropy)-len(nb):], nb)
+
+	hash := sha256.Sum256(entropy)
+	if int64(hash[0]>>(8-checksumBits)) != checksum {
+		return nil, errors.New("invalid mnemonic checksum")
+	}
+	return entropy, nil
+}
+
+// MnemonicToSeed checks the sentence and returns the 64 bytes seed of the
+// master key, the passphrase may be empty.
+func MnemonicToSeed(mnemonic, passphrase string) ([]byte, error) {
+	if _, err := MnemonicToEntropy(mnemonic); err != nil {
+		return nil, err
+	}
+	sentence := strings.Join(strings.Fields(mnemonic), " ")
+	return pbkdf2.Key([]byte(sentence), []byte("mnemonic"+passphrase), 2048, 64, sha512.New), nil
+}
@@ -24,6 +24,7 @@ const (
 	ErrInvalidReferedTxn    ErrCode = 45017
 	ErrIneffectiveCoinbase  ErrCode = 45018
 	ErrUTXOLocked           ErrCode = 45019
+	ErrTxPoolFull           ErrCode = 45020
 	SessionExpired          ErrCode = 41001
 	IllegalDataFormat       ErrCode = 41003
 	OauthTimeout            ErrCode = 41004
@@ -32,9 +33,11 @@ const (
 	InvalidToken            ErrCode = 42003
 	InvalidTransaction      ErrCode = 43001
 	InvalidAsset            ErrCode = 43002
+	InvalidBlock            ErrCode = 43003
 	UnknownTransaction      ErrCode = 44001
 	UnknownAsset            ErrCode = 44002
 	UnknownBlock            ErrCode = 44003
+	StaleBlock              ErrCode = 44004
 	InternalError           ErrCode = 45002
 )
 
@@ -49,9 +52,11 @@ var ErrMap = map[ErrCode]string{
 	InvalidToken:            "Verify token error",
 	InvalidTransaction:      "Invalid transaction",
 	InvalidAsset:            "Invalid asset",
+	InvalidBlock:            "Invalid block",
 	UnknownTransaction:      "Unknown Transaction",
 	UnknownAsset:            "Unknown asset",
 	UnknownBlock:            "Unknown Block",
+	StaleBlock:              "Stale block",
 	InternalError:           "Internal error",
 	ErrInvalidInput:         "INTERNAL ERROR, ErrInvalidInput",
 	ErrInvalidOutput:        "INTERNAL ERROR, ErrInvalidOutput",
@@ -67,6 +72,7 @@ var ErrMap = map[ErrCode]string{
 	ErrUnknownReferedTxn:    "INTERNAL ERROR, ErrUnknownReferedTxn",
 	ErrInvalidReferedTxn:    "INTERNAL ERROR, ErrInvalidReferedTxn",
 	ErrIneffectiveCoinbase:  "INTERNAL ERROR, ErrIneffectiveCoinbase",
+	ErrTxPoolFull:           "INTERNAL ERROR, ErrTxPoolFull",
 }
 
 func (err ErrCode) Error() string {
@@ -105,6 +111,8 @@ func (err ErrCode) Error() string {
 		return "ineffective coinbase"
 	case ErrUTXOLocked:
 		return "unspend utxo locked"
+	case ErrTxPoolFull:
+		return "transaction pool is full"
 	}
 
 	return fmt.Sprintf("Unknown error? Error code = %d", err)
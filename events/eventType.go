@@ -10,4 +10,6 @@ const (
 	EventNodeDisconnect          EventType = 4
 	EventRollbackTransaction     EventType = 5
 	EventNewTransactionPutInPool EventType = 6
+	EventReorganizeChain         EventType = 7
+	EventNewHeader               EventType = 8
 )
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"flag"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 	"time"
 
 	"Elastos.ELA/account"
@@ -14,6 +17,7 @@ import (
 	"Elastos.ELA/core/transaction"
 	"Elastos.ELA/net"
 	"Elastos.ELA/net/httpjsonrpc"
+	"Elastos.ELA/net/httpmetrics"
 	"Elastos.ELA/net/httpnodeinfo"
 	"Elastos.ELA/net/httprestful"
 	"Elastos.ELA/net/httpwebsocket"
@@ -24,6 +28,8 @@ const (
 	DefaultMultiCoreNum = 4
 )
 
+var reindex = flag.Bool("reindex", false, "verify the chain database and rebuild its indexes before starting")
+
 func init() {
 	log.Init(log.Path, log.Stdout)
 	var coreNum int
@@ -45,16 +51,25 @@ func handleLogFile() {
 			bc := ledger.DefaultLedger.Blockchain
 			log.Info("[", len(bc.Index), len(bc.BlockCache), len(bc.Orphans), "]")
 			//ledger.DefaultLedger.Blockchain.DumpState()
-			isNeedNewFile := log.CheckIfNeedNewFile()
-			if isNeedNewFile {
-				log.ClosePrintLog()
-				log.Init(log.Path, os.Stdout)
-			}
 		} //for end
 	}()
 
 }
 
+func reindexChainStore() error {
+	log.Info("Verify the chain database and rebuild its indexes")
+	report, err := ledger.DefaultLedger.Store.(*ChainStore.ChainStore).CheckIntegrity(true)
+	if err != nil {
+		return err
+	}
+	for _, problem := range report.Problems {
+		log.Warn(problem)
+	}
+	log.Infof("Reindex done, stored height: %d, verified height: %d, problems: %d",
+		report.StoredHeight, report.VerifiedHeight, len(report.Problems))
+	return nil
+}
+
 func startConsensus(client account.Client, noder protocol.Noder) {
 	log.Info("Start POW Services")
 	powServices := pow.NewPowService(client, "logPow", noder)
@@ -62,6 +77,16 @@ func startConsensus(client account.Client, noder protocol.Noder) {
 	if config.Parameters.PowConfiguration.AutoMining {
 		go powServices.Start()
 	}
+	if config.Parameters.PowConfiguration.StratumStart {
+		go pow.NewStratumServer(powServices).Start()
+	}
+}
+
+// waitForSignal blocks until the process is interrupted or terminated.
+func waitForSignal() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
 }
 
 func main() {
@@ -70,6 +95,7 @@ func main() {
 	//var blockChain *ledger.Blockchain
 	var err error
 	var noder protocol.Noder
+	flag.Parse()
 	log.Trace("Node version: ", config.Version)
 	log.Info("1. BlockChain init")
 	ledger.DefaultLedger = new(ledger.Ledger)
@@ -80,6 +106,12 @@ func main() {
 		os.Exit(1)
 	}
 	ledger.DefaultLedger.Store.InitLedgerStore(ledger.DefaultLedger)
+	if *reindex {
+		if err := reindexChainStore(); err != nil {
+			log.Fatal(err, " reindex failed")
+			os.Exit(1)
+		}
+	}
 	transaction.TxStore = ledger.DefaultLedger.Store
 	_, err = ledger.NewBlockchainWithGenesisBlock()
 	if err != nil {
@@ -98,6 +130,10 @@ func main() {
 		log.Fatal(err)
 		goto ERROR
 	}
+	if acct == nil {
+		log.Fatal("The wallet has no main account, a watch-only wallet can't run a node.")
+		goto ERROR
+	}
 	httpjsonrpc.Wallet = client
 	log.Info("3. Start the P2P networks")
 	noder = net.StartProtocol(acct.PublicKey)
@@ -116,7 +152,14 @@ func main() {
 	if config.Parameters.HttpInfoStart {
 		go httpnodeinfo.StartServer(noder)
 	}
-	select {}
+	if config.Parameters.HttpMetricsStart {
+		go httpmetrics.StartServer(noder)
+	}
+
+	waitForSignal()
+	log.Info("Shutting down")
+	noder.Stop()
+	return
 ERROR:
 	os.Exit(1)
 }
@@ -0,0 +1,286 @@
+package bloom
+
+import (
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/serialization"
+	tx "Elastos.ELA/core/transaction"
+	"bytes"
+	"math"
+	"sync"
+)
+
+// BloomUpdateType specifies how the filter is updated when a match is found
+type BloomUpdateType uint8
+
+const (
+	// BloomUpdateNone indicates the filter is not adjusted when a match is
+	// found.
+	BloomUpdateNone BloomUpdateType = 0
+
+	// BloomUpdateAll indicates if the filter matches any data element in an
+	// output, the outpoint is added to the filter.
+	BloomUpdateAll BloomUpdateType = 1
+
+	// BloomUpdateP2PubkeyOnly indicates the outpoint is only added to the
+	// filter when the matched output pays to a standard signature program.
+	BloomUpdateP2PubkeyOnly BloomUpdateType = 2
+)
+
+const (
+	// MaxFilterLoadHashFuncs is the maximum number of hash functions to
+	// load into the bloom filter.
+	MaxFilterLoadHashFuncs = 50
+
+	// MaxFilterLoadFilterSize is the maximum size in bytes a filter may be.
+	MaxFilterLoadFilterSize = 36000
+
+	// MaxFilterAddDataSize is the maximum byte size of a data element to
+	// add to the bloom filter.
+	MaxFilterAddDataSize = 520
+
+	// standard signature program hash prefix, see common.ToCodeHash
+	standardPrefix = 0x21
+
+	ln2Squared = math.Ln2 * math.Ln2
+)
+
+// Filter defines a bloom filter that provides easy manipulation of raw
+// filter data.
+type Filter struct {
+	mtx       sync.Mutex
+	data      []byte
+	hashFuncs uint32
+	tweak     uint32
+	flags     BloomUpdateType
+}
+
+// NewFilter creates a new bloom filter instance, mainly to be used by SPV
+// clients. The tweak parameter is a random value added to the seed value.
+// The false positive rate is the probability of a false positive where 1.0
+// is "match everything" and zero is unachievable.
+func NewFilter(elements, tweak uint32, fprate float64, flags BloomUpdateType) *Filter {
+	// Massage the false positive rate to sane values.
+	if fprate > 1.0 {
+		fprate = 1.0
+	}
+	if fprate < 1e-9 {
+		fprate = 1e-9
+	}
+
+	// Calculate the size of the filter in bytes for the given number of
+	// elements and false positive rate.
+	dataLen := uint32(-1 * float64(elements) * math.Log(fprate) / ln2Squared / 8)
+	if dataLen > MaxFilterLoadFilterSize {
+		dataLen = MaxFilterLoadFilterSize
+	}
+	if dataLen == 0 {
+		dataLen = 1
+	}
+
+	// Calculate the number of hash functions based on the size of the
+	// filter and the number of elements.
+	hashFuncs := uint32(float64(dataLen*8) / float64(elements) * math.Ln2)
+	if hashFuncs > MaxFilterLoadHashFuncs {
+		hashFuncs = MaxFilterLoadHashFuncs
+	}
+	if hashFuncs == 0 {
+		hashFuncs = 1
+	}
+
+	return &Filter{
+		data:      make([]byte, dataLen),
+		hashFuncs: hashFuncs,
+		tweak:     tweak,
+		flags:     flags,
+	}
+}
+
+// LoadFilter creates a new Filter instance with the given raw filter
+// parameters, as received in a filterload message.
+func LoadFilter(data []byte, hashFuncs, tweak uint32, flags BloomUpdateType) *Filter {
+	return &Filter{
+		data:      data,
+		hashFuncs: hashFuncs,
+		tweak:     tweak,
+		flags:     flags,
+	}
+}
+
+// IsLoaded returns true if a filter is loaded, otherwise false. An empty
+// filter counts as not loaded, it has no bit to hash to.
+func (bf *Filter) IsLoaded() bool {
+	bf.mtx.Lock()
+	defer bf.mtx.Unlock()
+
+	return len(bf.data) > 0
+}
+
+// Reload loads a new filter replacing any existing filter.
+func (bf *Filter) Reload(filter *Filter) {
+	filter.mtx.Lock()
+	data, hashFuncs, tweak, flags := filter.data, filter.hashFuncs, filter.tweak, filter.flags
+	filter.mtx.Unlock()
+
+	bf.mtx.Lock()
+	bf.data = data
+	bf.hashFuncs = hashFuncs
+	bf.tweak = tweak
+	bf.flags = flags
+	bf.mtx.Unlock()
+}
+
+// Unload unloads the bloom filter.
+func (bf *Filter) Unload() {
+	bf.mtx.Lock()
+	bf.data = nil
+	bf.hashFuncs = 0
+	bf.tweak = 0
+	bf.flags = BloomUpdateNone
+	bf.mtx.Unlock()
+}
+
+// Data returns the raw filter parameters, as sent in a filterload message.
+func (bf *Filter) Data() ([]byte, uint32, uint32, BloomUpdateType) {
+	bf.mtx.Lock()
+	defer bf.mtx.Unlock()
+
+	return bf.data, bf.hashFuncs, bf.tweak, bf.flags
+}
+
+// hash returns the bit offset in the bloom filter which corresponds to the
+// passed data for the given independent hash function number.
+func (bf *Filter) hash(hashNum uint32, data []byte) uint32 {
+	// bitcoind: 0xfba4c795 chosen as it guarantees a reasonable bit
+	// difference between hashNum values.
+	mm := MurmurHash3(hashNum*0xfba4c795+bf.tweak, data)
+	return mm % (uint32(len(bf.data)) << 3)
+}
+
+// matches returns true if the bloom filter might contain the passed data and
+// false if it definitely does not.
+//
+// This function MUST be called with the filter lock held.
+func (bf *Filter) matches(data []byte) bool {
+	if len(bf.data) == 0 {
+		return false
+	}
+
+	for i := uint32(0); i < bf.hashFuncs; i++ {
+		idx := bf.hash(i, data)
+		if bf.data[idx>>3]&(1<<(idx&7)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches returns true if the bloom filter might contain the passed data and
+// false if it definitely does not.
+func (bf *Filter) Matches(data []byte) bool {
+	bf.mtx.Lock()
+	defer bf.mtx.Unlock()
+
+	return bf.matches(data)
+}
+
+// add adds the passed byte slice to the bloom filter.
+//
+// This function MUST be called with the filter lock held.
+func (bf *Filter) add(data []byte) {
+	if len(bf.data) == 0 {
+		return
+	}
+
+	for i := uint32(0); i < bf.hashFuncs; i++ {
+		idx := bf.hash(i, data)
+		bf.data[idx>>3] |= 1 << (idx & 7)
+	}
+}
+
+// Add adds the passed byte slice to the bloom filter.
+func (bf *Filter) Add(data []byte) {
+	bf.mtx.Lock()
+	defer bf.mtx.Unlock()
+
+	bf.add(data)
+}
+
+// AddOutPoint adds the passed transaction outpoint to the bloom filter.
+func (bf *Filter) AddOutPoint(txid Uint256, index uint16) {
+	bf.mtx.Lock()
+	defer bf.mtx.Unlock()
+
+	bf.add(outPointBytes(txid, index))
+}
+
+// outPointBytes serializes an outpoint the same way as it appears in an
+// UTXO input, which is the representation SPV clients add to their filter.
+func outPointBytes(txid Uint256, index uint16) []byte {
+	buf := bytes.NewBuffer(nil)
+	txid.Serialize(buf)
+	serialization.WriteUint16(buf, index)
+	return buf.Bytes()
+}
+
+// matchTxAndUpdate returns true if the bloom filter matches data within the
+// passed transaction, otherwise false is returned. If the filter does match
+// the passed transaction, it will also update the filter depending on the
+// bloom update flags set via the loaded filter if needed.
+//
+// This function MUST be called with the filter lock held.
+func (bf *Filter) matchTxAndUpdate(txn *tx.Transaction) bool {
+	// Check if the filter matches the hash of the transaction.
+	hash := txn.Hash()
+	matched := bf.matches(hash.ToArray())
+
+	// Check if the filter matches any of the program hashes the outputs
+	// pay to. When the update flags say so, the outpoint is added to the
+	// filter so that later transactions spending it are matched as well.
+	for i, output := range txn.Outputs {
+		if !bf.matches(output.ProgramHash.ToArray()) {
+			continue
+		}
+
+		matched = true
+		switch bf.flags {
+		case BloomUpdateAll:
+			bf.add(outPointBytes(hash, uint16(i)))
+		case BloomUpdateP2PubkeyOnly:
+			if output.ProgramHash[0] == standardPrefix {
+				bf.add(outPointBytes(hash, uint16(i)))
+			}
+		}
+	}
+
+	// Nothing more to do if a match has already been made.
+	if matched {
+		return true
+	}
+
+	// At this point, the transaction and none of the data elements in the
+	// outputs match, so check the previous outpoints the inputs spend and
+	// the programs that unlock them.
+	for _, input := range txn.UTXOInputs {
+		if bf.matches(outPointBytes(input.ReferTxID, input.ReferTxOutputIndex)) {
+			return true
+		}
+	}
+	for _, program := range txn.Programs {
+		if bf.matches(program.Code) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchTxAndUpdate returns true if the bloom filter matches data within the
+// passed transaction, otherwise false is returned. If the filter does match
+// the passed transaction, it will also update the filter depending on the
+// bloom update flags set via the loaded filter if needed.
+func (bf *Filter) MatchTxAndUpdate(txn *tx.Transaction) bool {
+	bf.mtx.Lock()
+	defer bf.mtx.Unlock()
+
+	return bf.matchTxAndUpdate(txn)
+}
@@ -0,0 +1,76 @@
+package bloom
+
+import (
+	"testing"
+
+	. "Elastos.ELA/common"
+	tx "Elastos.ELA/core/transaction"
+	"Elastos.ELA/core/transaction/payload"
+)
+
+// newTestTx returns a distinct transaction paying to the program hash.
+func newTestTx(n uint32, programHash Uint168, inputs ...*tx.UTXOTxInput) *tx.Transaction {
+	if len(inputs) == 0 {
+		txn, _ := tx.NewCoinBaseTransaction(&payload.CoinBase{}, n)
+		txn.Outputs = []*tx.TxOutput{{Value: 1, ProgramHash: programHash}}
+		return txn
+	}
+	txn, _ := tx.NewTransferAssetTransaction(inputs, []*tx.TxOutput{{Value: 1, ProgramHash: programHash}})
+	txn.LockTime = n
+	return txn
+}
+
+func TestFilterMatchTxAndUpdate(t *testing.T) {
+	watched := Uint168{standardPrefix, 0x01}
+	other := Uint168{standardPrefix, 0x02}
+
+	filter := NewFilter(10, 0, 0.000001, BloomUpdateAll)
+	filter.Add(watched.ToArray())
+
+	paying := newTestTx(1, watched)
+	if !filter.MatchTxAndUpdate(paying) {
+		t.Fatal("transaction paying to the watched program hash is not matched")
+	}
+	unrelated := newTestTx(2, other)
+	if filter.MatchTxAndUpdate(unrelated) {
+		t.Fatal("unrelated transaction is matched")
+	}
+	// the outpoint of the match was added, so its spend is matched too
+	spending := newTestTx(3, other, &tx.UTXOTxInput{ReferTxID: paying.Hash(), ReferTxOutputIndex: 0})
+	if !filter.MatchTxAndUpdate(spending) {
+		t.Fatal("transaction spending a matched output is not matched")
+	}
+
+	filter = NewFilter(10, 0, 0.000001, BloomUpdateNone)
+	filter.Add(watched.ToArray())
+	filter.MatchTxAndUpdate(paying)
+	if filter.MatchTxAndUpdate(spending) {
+		t.Fatal("filter without updates matched the spend of an output")
+	}
+
+	hash := unrelated.Hash()
+	filter.Add(hash.ToArray())
+	if !filter.MatchTxAndUpdate(unrelated) {
+		t.Fatal("transaction of a watched txid is not matched")
+	}
+}
+
+func TestFilterEmpty(t *testing.T) {
+	filter := LoadFilter([]byte{}, 10, 0, BloomUpdateAll)
+	if filter.IsLoaded() {
+		t.Fatal("empty filter is loaded")
+	}
+	filter.Add([]byte{0x01})
+	if filter.Matches([]byte{0x01}) || filter.MatchTxAndUpdate(newTestTx(1, Uint168{})) {
+		t.Fatal("empty filter matched")
+	}
+
+	filter.Reload(NewFilter(10, 0, 0.01, BloomUpdateNone))
+	if !filter.IsLoaded() {
+		t.Fatal("reloaded filter is not loaded")
+	}
+	filter.Unload()
+	if filter.IsLoaded() {
+		t.Fatal("unloaded filter is loaded")
+	}
+}
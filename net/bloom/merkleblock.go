@@ -0,0 +1,275 @@
+package bloom
+
+import (
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/serialization"
+	"Elastos.ELA/core/ledger"
+	"Elastos.ELA/crypto"
+	"errors"
+	"io"
+)
+
+// MaxTxPerBlock bounds the transaction count a merkle block may claim, a
+// transaction takes at least this many bytes in a serialized block.
+const MaxTxPerBlock = 1024 * 1024 * 8 / 10
+
+// MerkleBlock is the block header plus a partial merkle tree which proves
+// the matched transactions are included in the block.
+type MerkleBlock struct {
+	Header       *ledger.Blockdata
+	Transactions uint32
+	Hashes       []*Uint256
+	Flags        []byte
+}
+
+type merkleBuilder struct {
+	numTx       uint32
+	matchedBits []byte
+	bits        []byte
+	finalHashes []*Uint256
+}
+
+// calcTreeWidth calculates the number of nodes at the given height of a
+// merkle tree, height 0 being the leaves.
+func calcTreeWidth(numTx uint32, height uint32) uint32 {
+	return (numTx + (1 << height) - 1) >> height
+}
+
+// treeHeight returns the height of the root of a merkle tree with numTx
+// leaves.
+func treeHeight(numTx uint32) uint32 {
+	var height uint32
+	for calcTreeWidth(numTx, height) > 1 {
+		height++
+	}
+	return height
+}
+
+// includesMatch reports whether any of the leaves under the node at the
+// given height and position was matched by the filter.
+func (m *merkleBuilder) includesMatch(height, pos uint32) bool {
+	for p := pos << height; p < (pos+1)<<height && p < m.numTx; p++ {
+		if m.matchedBits[p] != 0x00 {
+			return true
+		}
+	}
+	return false
+}
+
+// traverseAndBuild walks the merkle tree depth first, recording a flag bit
+// per visited node and the hashes needed to rebuild the root.
+func (m *merkleBuilder) traverseAndBuild(node *crypto.MerkleTreeNode, height, pos uint32) {
+	var isParent byte
+	if m.includesMatch(height, pos) {
+		isParent = 0x01
+	}
+	m.bits = append(m.bits, isParent)
+
+	// A leaf, or a node with no matches below it, only needs its hash.
+	if height == 0 || isParent == 0x00 {
+		hash := node.Hash
+		m.finalHashes = append(m.finalHashes, &hash)
+		return
+	}
+
+	m.traverseAndBuild(node.Left, height-1, pos*2)
+	// An odd node is paired with itself, see crypto.levelUp, so there is
+	// no right child to descend into.
+	if pos*2+1 < calcTreeWidth(m.numTx, height-1) {
+		m.traverseAndBuild(node.Right, height-1, pos*2+1)
+	}
+}
+
+// NewMerkleBlock returns a new MerkleBlock for the given block and the
+// indexes of the transactions that matched the filter.
+func NewMerkleBlock(block *ledger.Block, filter *Filter) (*MerkleBlock, []uint32, error) {
+	numTx := uint32(len(block.Transactions))
+	if numTx == 0 {
+		return nil, nil, errors.New("[MerkleBlock] block has no transactions")
+	}
+
+	hashes := make([]Uint256, 0, numTx)
+	matchedBits := make([]byte, 0, numTx)
+	var matchedIndexes []uint32
+	for i, txn := range block.Transactions {
+		if filter.MatchTxAndUpdate(txn) {
+			matchedBits = append(matchedBits, 0x01)
+			matchedIndexes = append(matchedIndexes, uint32(i))
+		} else {
+			matchedBits = append(matchedBits, 0x00)
+		}
+		hashes = append(hashes, txn.Hash())
+	}
+
+	tree, err := crypto.NewMerkleTree(hashes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mBlock := merkleBuilder{
+		numTx:       numTx,
+		matchedBits: matchedBits,
+	}
+	mBlock.traverseAndBuild(tree.Root, treeHeight(numTx), 0)
+
+	msg := &MerkleBlock{
+		Header:       block.Blockdata,
+		Transactions: numTx,
+		Hashes:       mBlock.finalHashes,
+		Flags:        make([]byte, (len(mBlock.bits)+7)/8),
+	}
+	for i := uint32(0); i < uint32(len(mBlock.bits)); i++ {
+		msg.Flags[i/8] |= mBlock.bits[i] << (i % 8)
+	}
+	return msg, matchedIndexes, nil
+}
+
+type merkleExtractor struct {
+	block    *MerkleBlock
+	bitsUsed uint32
+	hashUsed uint32
+	matches  []*Uint256
+}
+
+func (m *merkleExtractor) nextBit() (byte, error) {
+	if m.bitsUsed/8 >= uint32(len(m.block.Flags)) {
+		return 0, errors.New("[MerkleBlock] overflowed the flags array")
+	}
+	bit := (m.block.Flags[m.bitsUsed/8] >> (m.bitsUsed % 8)) & 0x01
+	m.bitsUsed++
+	return bit, nil
+}
+
+func (m *merkleExtractor) nextHash() (*Uint256, error) {
+	if m.hashUsed >= uint32(len(m.block.Hashes)) {
+		return nil, errors.New("[MerkleBlock] overflowed the hash array")
+	}
+	hash := m.block.Hashes[m.hashUsed]
+	m.hashUsed++
+	return hash, nil
+}
+
+// traverseAndExtract is the reverse of traverseAndBuild, it rebuilds the
+// node hash at the given height and position and collects matched leaves.
+func (m *merkleExtractor) traverseAndExtract(height, pos uint32) (*Uint256, error) {
+	isParent, err := m.nextBit()
+	if err != nil {
+		return nil, err
+	}
+
+	if height == 0 || isParent == 0x00 {
+		hash, err := m.nextHash()
+		if err != nil {
+			return nil, err
+		}
+		if height == 0 && isParent == 0x01 {
+			m.matches = append(m.matches, hash)
+		}
+		return hash, nil
+	}
+
+	left, err := m.traverseAndExtract(height-1, pos*2)
+	if err != nil {
+		return nil, err
+	}
+	right := left
+	if pos*2+1 < calcTreeWidth(m.block.Transactions, height-1) {
+		right, err = m.traverseAndExtract(height-1, pos*2+1)
+		if err != nil {
+			return nil, err
+		}
+		// The right branch must differ from the left one, otherwise the
+		// same transactions could be proven twice.
+		if *left == *right {
+			return nil, errors.New("[MerkleBlock] invalid duplicated right branch")
+		}
+	}
+
+	hash := crypto.DoubleSHA256([]Uint256{*left, *right})
+	return &hash, nil
+}
+
+// ExtractMatches rebuilds the merkle root from the partial merkle tree and
+// returns the hashes of the matched transactions. The caller must check the
+// returned root against the header's TransactionsRoot.
+func (msg *MerkleBlock) ExtractMatches() (Uint256, []*Uint256, error) {
+	if msg.Transactions == 0 {
+		return Uint256{}, nil, errors.New("[MerkleBlock] no transactions")
+	}
+	if msg.Transactions > MaxTxPerBlock {
+		return Uint256{}, nil, errors.New("[MerkleBlock] too many transactions")
+	}
+	if uint32(len(msg.Hashes)) > msg.Transactions {
+		return Uint256{}, nil, errors.New("[MerkleBlock] more hashes than transactions")
+	}
+	if len(msg.Flags)*8 < len(msg.Hashes) {
+		return Uint256{}, nil, errors.New("[MerkleBlock] fewer flag bits than hashes")
+	}
+
+	m := merkleExtractor{block: msg}
+	root, err := m.traverseAndExtract(treeHeight(msg.Transactions), 0)
+	if err != nil {
+		return Uint256{}, nil, err
+	}
+
+	// All flag bytes and hashes must have been consumed.
+	if (m.bitsUsed+7)/8 != uint32(len(msg.Flags)) {
+		return Uint256{}, nil, errors.New("[MerkleBlock] not all flag bits consumed")
+	}
+	if m.hashUsed != uint32(len(msg.Hashes)) {
+		return Uint256{}, nil, errors.New("[MerkleBlock] not all hashes consumed")
+	}
+	return *root, m.matches, nil
+}
+
+func (msg *MerkleBlock) Serialize(w io.Writer) error {
+	msg.Header.Serialize(w)
+	err := serialization.WriteUint32(w, msg.Transactions)
+	if err != nil {
+		return err
+	}
+
+	err = serialization.WriteUint32(w, uint32(len(msg.Hashes)))
+	if err != nil {
+		return err
+	}
+	for _, hash := range msg.Hashes {
+		if _, err := hash.Serialize(w); err != nil {
+			return err
+		}
+	}
+
+	return serialization.WriteVarBytes(w, msg.Flags)
+}
+
+func (msg *MerkleBlock) Deserialize(r io.Reader) error {
+	msg.Header = new(ledger.Blockdata)
+	err := msg.Header.Deserialize(r)
+	if err != nil {
+		return err
+	}
+
+	msg.Transactions, err = serialization.ReadUint32(r)
+	if err != nil {
+		return err
+	}
+
+	count, err := serialization.ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	if count > msg.Transactions {
+		return errors.New("[MerkleBlock] more hashes than transactions")
+	}
+	msg.Hashes = make([]*Uint256, 0, count)
+	for i := uint32(0); i < count; i++ {
+		var hash Uint256
+		if err := hash.Deserialize(r); err != nil {
+			return err
+		}
+		msg.Hashes = append(msg.Hashes, &hash)
+	}
+
+	msg.Flags, err = serialization.ReadVarBytes(r)
+	return err
+}
@@ -0,0 +1,123 @@
+package bloom
+
+import (
+	"bytes"
+	"testing"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/core/ledger"
+	"Elastos.ELA/crypto"
+)
+
+// newTestBlock returns a block of count transactions, the ones at the
+// indexes pay to the watched program hash.
+func newTestBlock(t *testing.T, count int, watched Uint168, indexes ...int) *ledger.Block {
+	block := &ledger.Block{Blockdata: &ledger.Blockdata{Height: 1}}
+	var hashes []Uint256
+	for i := 0; i < count; i++ {
+		programHash := Uint168{0x12, byte(i)}
+		for _, index := range indexes {
+			if index == i {
+				programHash = watched
+			}
+		}
+		txn := newTestTx(uint32(i), programHash)
+		block.Transactions = append(block.Transactions, txn)
+		hashes = append(hashes, txn.Hash())
+	}
+	root, err := crypto.ComputeRoot(hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.Blockdata.TransactionsRoot = root
+	return block
+}
+
+func TestMerkleBlock(t *testing.T) {
+	watched := Uint168{0x12, 0xff}
+	tests := []struct {
+		count   int
+		matches []int
+	}{
+		{1, []int{0}},
+		{1, nil},
+		{2, []int{1}},
+		{5, []int{0, 4}},
+		{7, []int{2, 3, 6}},
+		{16, []int{15}},
+		{17, []int{16}},
+	}
+	for _, test := range tests {
+		block := newTestBlock(t, test.count, watched, test.matches...)
+		filter := NewFilter(10, 0, 0.000001, BloomUpdateNone)
+		filter.Add(watched.ToArray())
+
+		mBlock, indexes, err := NewMerkleBlock(block, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(indexes) != len(test.matches) {
+			t.Fatalf("%d transactions: matched %v, want %v", test.count, indexes, test.matches)
+		}
+
+		var buf bytes.Buffer
+		if err := mBlock.Serialize(&buf); err != nil {
+			t.Fatal(err)
+		}
+		decoded := new(MerkleBlock)
+		if err := decoded.Deserialize(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		root, matches, err := decoded.ExtractMatches()
+		if err != nil {
+			t.Fatalf("%d transactions: %s", test.count, err)
+		}
+		if root != block.Blockdata.TransactionsRoot {
+			t.Fatalf("%d transactions: merkle root does not match the block", test.count)
+		}
+		if len(matches) != len(test.matches) {
+			t.Fatalf("%d transactions: extracted %d matches, want %d", test.count, len(matches), len(test.matches))
+		}
+		for i, index := range test.matches {
+			if *matches[i] != block.Transactions[index].Hash() {
+				t.Fatalf("%d transactions: match %d is not transaction %d", test.count, i, index)
+			}
+		}
+	}
+}
+
+func TestMerkleBlockMalformed(t *testing.T) {
+	watched := Uint168{0x12, 0xff}
+	block := newTestBlock(t, 7, watched, 2)
+	filter := NewFilter(10, 0, 0.000001, BloomUpdateNone)
+	filter.Add(watched.ToArray())
+	mBlock, _, err := NewMerkleBlock(block, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := *mBlock
+	tampered.Hashes = mBlock.Hashes[:len(mBlock.Hashes)-1]
+	if _, _, err := tampered.ExtractMatches(); err == nil {
+		t.Fatal("merkle block missing a hash is accepted")
+	}
+
+	tampered = *mBlock
+	tampered.Flags = append(append([]byte{}, mBlock.Flags...), 0x00)
+	if _, _, err := tampered.ExtractMatches(); err == nil {
+		t.Fatal("merkle block with unused flag bytes is accepted")
+	}
+
+	tampered = *mBlock
+	tampered.Transactions = 3
+	if root, _, err := tampered.ExtractMatches(); err == nil && root == block.Blockdata.TransactionsRoot {
+		t.Fatal("merkle block with a wrong transaction count proves the root")
+	}
+
+	tampered = *mBlock
+	tampered.Transactions = 0
+	if _, _, err := tampered.ExtractMatches(); err == nil {
+		t.Fatal("merkle block without transactions is accepted")
+	}
+}
@@ -3,53 +3,94 @@ package httpjsonrpc
 import (
 	. "Elastos.ELA/common/config"
 	"Elastos.ELA/common/log"
+	"net"
 	"net/http"
 	"strconv"
 )
 
+// DefaultBindAddress is the address the server binds to when BindAddress is
+// not set and there are no accounts, a server anyone may call is not served
+// to other hosts unless configured.
+const DefaultBindAddress = "127.0.0.1"
+
+// bindAddress returns the address the server listens on.
+func bindAddress(config RpcConfiguration, auth *rpcAuth) string {
+	if config.BindAddress == "" && len(auth.users) == 0 {
+		return DefaultBindAddress
+	}
+	return config.BindAddress
+}
+
 func StartRPCServer() {
 	http.HandleFunc("/", Handle)
 
 	// get interfaces
 	HandleFunc("getbestblockhash", getBestBlockHash)
-	HandleFunc("getblock", getBlock)
+	HandleFunc("getblock", getBlock, "block")
 	HandleFunc("getblockcount", getBlockCount)
-	HandleFunc("getblockhash", getBlockHash)
+	HandleFunc("getblockhash", getBlockHash, "height")
+	HandleFunc("getchaintips", getChainTips)
 	HandleFunc("getconnectioncount", getConnectionCount)
 	HandleFunc("getrawmempool", getRawMemPool)
-	HandleFunc("getrawtransaction", getRawTransaction)
+	HandleFunc("getrawtransaction", getRawTransaction, "txid")
+	HandleFunc("getaddresshistory", getAddressHistory, "address", "offset", "limit")
+	HandleFunc("gettxoutproof", getTxOutProof, "txid", "blockhash")
+	HandleFunc("verifytxoutproof", verifyTxOutProof, "proof")
 	HandleFunc("getneighbor", getNeighbor)
 	HandleFunc("getnodestate", getNodeState)
 	HandleFunc("getversion", getVersion)
+	HandleFunc("listbanned", listBanned)
 
 	// set interfaces
-	HandleFunc("setdebuginfo", setDebugInfo)
-	HandleFunc("sendtransaction", sendTransaction)
-	HandleFunc("sendbatchouttransaction", sendBatchOutTransaction)
-	HandleFunc("sendrawtransaction", sendRawTransaction)
-	HandleFunc("submitblock", submitBlock)
-	HandleFunc("createmultisigtransaction", createMultiSignTransaction)
-	HandleFunc("createbatchoutmultisigtransaction", createBatchOutMultiSignTransaction)
-	HandleFunc("signmultisigtransaction", signMultiSignTransaction)
+	HandleFunc("setdebuginfo", setDebugInfo, "level", "module")
+	HandleFunc("setban", setBan, "ip", "command", "bantime")
+	HandleFunc("clearbanned", clearBanned)
+	HandleFunc("sendtransaction", sendTransaction, "asset", "address", "value", "fee", "utxolock")
+	HandleFunc("sendbatchouttransaction", sendBatchOutTransaction, "asset", "outputs", "fee", "utxolock")
+	HandleFunc("sendrawtransaction", sendRawTransaction, "data")
+	HandleFunc("submitblock", submitBlock, "data")
+	HandleFunc("createmultisigtransaction", createMultiSignTransaction, "asset", "from", "address", "value", "fee")
+	HandleFunc("createbatchoutmultisigtransaction", createBatchOutMultiSignTransaction, "asset", "from", "outputs", "fee")
+	HandleFunc("signmultisigtransaction", signMultiSignTransaction, "data")
+	HandleFunc("createunsignedtransaction", createUnsignedTransaction, "asset", "from", "outputs", "fee")
 
 	// mining interfaces
 	HandleFunc("getinfo", getInfo)
 	HandleFunc("help", auxHelp)
-	HandleFunc("submitauxblock", submitAuxBlock)
-	HandleFunc("createauxblock", createAuxBlock)
-	HandleFunc("togglecpumining", toggleCpuMining)
-	HandleFunc("manualmining", manualCpuMining)
+	HandleFunc("submitauxblock", submitAuxBlock, "blockhash", "auxpow")
+	HandleFunc("createauxblock", createAuxBlock, "paytoaddress", "parentchain")
+	HandleFunc("getblocktemplate", getBlockTemplate, "template_request")
+	HandleFunc("togglecpumining", toggleCpuMining, "mining")
+	HandleFunc("manualmining", manualCpuMining, "count")
 
 	// wallet interfaces
 	HandleFunc("addaccount", addAccount)
-	HandleFunc("deleteaccount", deleteAccount)
+	HandleFunc("deleteaccount", deleteAccount, "address")
+	HandleFunc("listtransactions", listTransactions, "offset", "limit")
 	//cross chain
-	HandleFunc("depositunlockTransaction", depositunlockTransaction)
-	HandleFunc("withdrawTransaction", withdrawTransaction)
-	HandleFunc("deposittosideTransaction", deposittosideTransaction)
-	HandleFunc("withdrawunlockTransaction", withdrawunlockTransaction)
-	// TODO: only listen to localhost
-	err := http.ListenAndServe(":"+strconv.Itoa(Parameters.HttpJsonPort), nil)
+	HandleFunc("depositunlockTransaction", depositunlockTransaction, "asset", "from", "address", "publickey", "value", "fee", "secret")
+	HandleFunc("withdrawTransaction", withdrawTransaction, "asset", "from", "address", "publickeya", "publickeys", "value", "fee", "secret")
+	HandleFunc("deposittosideTransaction", deposittosideTransaction, "asset", "from", "address", "publickeya", "publickeys", "value", "fee", "secret")
+	HandleFunc("withdrawunlockTransaction", withdrawunlockTransaction, "asset", "from", "address", "publickeya", "publickeys", "value", "fee", "secret")
+
+	rpcConfig := Parameters.RpcConfiguration
+	var err error
+	auth, err = newRpcAuth(rpcConfig)
+	if err != nil {
+		log.Fatal("RPC auth: ", err.Error())
+		return
+	}
+	if len(auth.users) == 0 {
+		log.Warn("RPC server runs without authentication")
+	}
+
+	address := net.JoinHostPort(bindAddress(rpcConfig, auth), strconv.Itoa(Parameters.HttpJsonPort))
+	log.Info("RPC server listens on ", address)
+	if rpcConfig.EnableTLS {
+		err = http.ListenAndServeTLS(address, Parameters.CertPath, Parameters.KeyPath, nil)
+	} else {
+		err = http.ListenAndServe(address, nil)
+	}
 	if err != nil {
 		log.Fatal("ListenAndServe: ", err.Error())
 	}
@@ -0,0 +1,155 @@
+package httpjsonrpc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	. "Elastos.ELA/common"
+	. "Elastos.ELA/common/config"
+	"Elastos.ELA/common/log"
+)
+
+const CookieUser = "__cookie__"
+
+// rpcMethodGroups are the names that can be used in the method list of a
+// rpc user instead of listing the methods one by one.
+var rpcMethodGroups = map[string][]string{
+	"@read": {
+		"getbestblockhash", "getblock", "getblockcount", "getblockhash",
+		"getchaintips",
+		"getconnectioncount", "getrawmempool", "getrawtransaction",
+		"getaddresshistory", "gettxoutproof", "verifytxoutproof",
+		"getneighbor", "getnodestate", "getversion", "getinfo", "help",
+		"listbanned",
+	},
+	"@send": {
+		"sendrawtransaction", "submitblock",
+	},
+	"@mining": {
+		"createauxblock", "submitauxblock", "getblocktemplate",
+		"togglecpumining", "manualmining",
+	},
+	"@wallet": {
+		"sendtransaction", "sendbatchouttransaction",
+		"createmultisigtransaction", "createbatchoutmultisigtransaction",
+		"signmultisigtransaction", "addaccount", "deleteaccount",
+		"listtransactions", "createunsignedtransaction",
+		"depositunlockTransaction", "withdrawTransaction",
+		"deposittosideTransaction", "withdrawunlockTransaction",
+	},
+	"@admin": {
+		"setdebuginfo", "setban", "clearbanned",
+	},
+}
+
+type rpcUser struct {
+	// the password is kept hashed so comparing it takes the same time
+	// whatever the length of the input
+	password [sha256.Size]byte
+	// methods is nil when the user may call every method
+	methods map[string]bool
+}
+
+func (u *rpcUser) allowed(method string) bool {
+	return u.methods == nil || u.methods[method]
+}
+
+// rpcAuth holds the accounts of the rpc server, no authentication is done
+// when there are none.
+type rpcAuth struct {
+	users map[string]*rpcUser
+}
+
+func newRpcAuth(config RpcConfiguration) (*rpcAuth, error) {
+	auth := &rpcAuth{users: make(map[string]*rpcUser)}
+	for _, u := range config.Users {
+		if u.User == "" || u.User == CookieUser {
+			return nil, errors.New("invalid rpc user name \"" + u.User + "\"")
+		}
+		user := &rpcUser{password: sha256.Sum256([]byte(u.Password))}
+		if len(u.Methods) > 0 {
+			user.methods = make(map[string]bool)
+			for _, method := range u.Methods {
+				if group, ok := rpcMethodGroups[method]; ok {
+					for _, m := range group {
+						user.methods[m] = true
+					}
+				} else if strings.HasPrefix(method, "@") {
+					return nil, errors.New("unknown rpc method group " + method)
+				} else {
+					user.methods[method] = true
+				}
+			}
+		}
+		auth.users[u.User] = user
+	}
+
+	if config.CookieFile != "" {
+		password, err := writeCookie(config.CookieFile)
+		if err != nil {
+			return nil, err
+		}
+		auth.users[CookieUser] = &rpcUser{password: sha256.Sum256([]byte(password))}
+	}
+
+	return auth, nil
+}
+
+// authenticate returns the user of the request, it is nil when the server
+// has no accounts.
+func (a *rpcAuth) authenticate(r *http.Request) (*rpcUser, bool) {
+	if len(a.users) == 0 {
+		return nil, true
+	}
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, false
+	}
+	user, ok := a.users[name]
+	if !ok {
+		return nil, false
+	}
+	hash := sha256.Sum256([]byte(password))
+	if subtle.ConstantTimeCompare(hash[:], user.password[:]) != 1 {
+		return nil, false
+	}
+	return user, true
+}
+
+// writeCookie creates a random password for the cookie user, local tools
+// that can read the cookie file get full access to the rpc server.
+func writeCookie(path string) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	password := BytesToHexString(secret)
+	if err := ioutil.WriteFile(path, []byte(CookieUser+":"+password), 0600); err != nil {
+		return "", err
+	}
+	log.Info("RPC cookie written to ", path)
+	return password, nil
+}
+
+// readCookie returns the user and password in the cookie file of the
+// configuration, if there is one.
+func readCookie() (string, string, bool) {
+	path := Parameters.RpcConfiguration.CookieFile
+	if path == "" {
+		return "", "", false
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimSpace(string(data)), ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
@@ -0,0 +1,114 @@
+package httpjsonrpc
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	. "Elastos.ELA/common/config"
+)
+
+func newTestAuthRequest(user, password string) *http.Request {
+	r, _ := http.NewRequest("POST", "/", nil)
+	if user != "" {
+		r.SetBasicAuth(user, password)
+	}
+	return r
+}
+
+func TestRpcAuthBasic(t *testing.T) {
+	auth, err := newRpcAuth(RpcConfiguration{Users: []RpcUser{{User: "alice", Password: "secret"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		user, password string
+		ok             bool
+	}{
+		{"", "", false},
+		{"alice", "wrong", false},
+		{"alice", "secre", false},
+		{"bob", "secret", false},
+		{"alice", "secret", true},
+	} {
+		user, ok := auth.authenticate(newTestAuthRequest(c.user, c.password))
+		if ok != c.ok || (ok && user != auth.users["alice"]) {
+			t.Fatalf("user %q with password %q authenticated %t, want %t", c.user, c.password, ok, c.ok)
+		}
+	}
+
+	// a server without accounts lets everyone in
+	open, _ := newRpcAuth(RpcConfiguration{})
+	if user, ok := open.authenticate(newTestAuthRequest("", "")); !ok || user != nil {
+		t.Fatal("request to a server without accounts is rejected")
+	}
+}
+
+func TestRpcAuthCookie(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".cookie")
+	rpcConfig := Parameters.RpcConfiguration
+	Parameters.RpcConfiguration = RpcConfiguration{CookieFile: path}
+	defer func() { Parameters.RpcConfiguration = rpcConfig }()
+
+	auth, err := newRpcAuth(Parameters.RpcConfiguration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, password, ok := readCookie()
+	if !ok || name != CookieUser {
+		t.Fatalf("cookie file has user %q", name)
+	}
+	user, ok := auth.authenticate(newTestAuthRequest(name, password))
+	if !ok || !user.allowed("setban") {
+		t.Fatal("cookie user may not call every method")
+	}
+	if _, ok := auth.authenticate(newTestAuthRequest(name, password+"0")); ok {
+		t.Fatal("cookie user authenticated with a wrong password")
+	}
+
+	// the cookie user can not be configured
+	if _, err := newRpcAuth(RpcConfiguration{Users: []RpcUser{{User: CookieUser}}}); err == nil {
+		t.Fatal("account named as the cookie user accepted")
+	}
+}
+
+func TestRpcAuthMethodGroups(t *testing.T) {
+	auth, err := newRpcAuth(RpcConfiguration{Users: []RpcUser{
+		{User: "reader", Password: "r", Methods: []string{"@read", "sendrawtransaction"}},
+		{User: "admin", Password: "a"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := auth.users["reader"]
+	for _, method := range rpcMethodGroups["@read"] {
+		if !reader.allowed(method) {
+			t.Fatalf("method %s of the group is not allowed", method)
+		}
+	}
+	if !reader.allowed("sendrawtransaction") || reader.allowed("submitblock") || reader.allowed("setban") {
+		t.Fatal("reader may call methods out of its list")
+	}
+	if !auth.users["admin"].allowed("setban") {
+		t.Fatal("user without a method list may not call every method")
+	}
+
+	if _, err := newRpcAuth(RpcConfiguration{Users: []RpcUser{{User: "x", Methods: []string{"@unknown"}}}}); err == nil {
+		t.Fatal("unknown method group accepted")
+	}
+}
+
+func TestRpcBindAddress(t *testing.T) {
+	open, _ := newRpcAuth(RpcConfiguration{})
+	if address := bindAddress(RpcConfiguration{}, open); address != DefaultBindAddress {
+		t.Fatalf("server without accounts binds to %q", address)
+	}
+	if address := bindAddress(RpcConfiguration{BindAddress: "0.0.0.0"}, open); address != "0.0.0.0" {
+		t.Fatalf("configured address is replaced by %q", address)
+	}
+	config := RpcConfiguration{Users: []RpcUser{{User: "alice", Password: "secret"}}}
+	auth, _ := newRpcAuth(config)
+	if address := bindAddress(config, auth); address != "" {
+		t.Fatalf("server with accounts binds to %q", address)
+	}
+}
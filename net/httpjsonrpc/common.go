@@ -2,13 +2,18 @@ package httpjsonrpc
 
 import (
 	. "Elastos.ELA/common"
+	"Elastos.ELA/common/config"
 	"Elastos.ELA/common/log"
 	"Elastos.ELA/consensus/pow"
 	. "Elastos.ELA/core/transaction"
 	tx "Elastos.ELA/core/transaction"
 	. "Elastos.ELA/errors"
 	. "Elastos.ELA/net/protocol"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -19,10 +24,12 @@ import (
 
 func init() {
 	mainMux.m = make(map[string]func([]interface{}) map[string]interface{})
+	mainMux.params = make(map[string][]string)
 }
 
 //an instance of the multiplexer
 var mainMux ServeMux
+var auth *rpcAuth
 var node Noder
 var Pow *pow.PowService
 
@@ -30,9 +37,17 @@ var Pow *pow.PowService
 type ServeMux struct {
 	sync.RWMutex
 	m               map[string]func([]interface{}) map[string]interface{}
+	params          map[string][]string
 	defaultFunction func(http.ResponseWriter, *http.Request)
 }
 
+type rpcRequest struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
 type TxAttributeInfo struct {
 	Usage TransactionAttributeUsage
 	Data  string
@@ -127,6 +142,38 @@ type TxoutInfo struct {
 	Txout tx.TxOutput
 }
 
+type TxHistoryInfo struct {
+	Txid            string
+	Height          uint32
+	AssetID         string
+	Direction       string
+	Value           string
+	Confirminations uint32
+}
+
+type AddressHistoryInfo struct {
+	Address string
+	Total   uint32
+	History []TxHistoryInfo
+}
+
+type WalletTxInfo struct {
+	Txid            string
+	AssetID         string
+	Direction       string
+	Amount          string
+	Fee             string
+	Height          uint32
+	Timestamp       uint32
+	Confirminations uint32
+	Label           string
+}
+
+type WalletHistoryInfo struct {
+	Total        uint32
+	Transactions []WalletTxInfo
+}
+
 type NodeInfo struct {
 	State    uint   // node status
 	Port     uint16 // The nodes's port
@@ -156,11 +203,14 @@ func RegistPowService(p *pow.PowService) {
 	}
 }
 
-//a function to register functions to be called for specific rpc calls
-func HandleFunc(pattern string, handler func([]interface{}) map[string]interface{}) {
+//a function to register functions to be called for specific rpc calls,
+//params are the names of the positional parameters of the handler which
+//are used to accept named (object) parameters
+func HandleFunc(pattern string, handler func([]interface{}) map[string]interface{}, params ...string) {
 	mainMux.Lock()
 	defer mainMux.Unlock()
 	mainMux.m[pattern] = handler
+	mainMux.params[pattern] = params
 }
 
 //a function to be called if the request is not a HTTP JSON RPC call
@@ -173,6 +223,16 @@ func SetDefaultFunc(def func(http.ResponseWriter, *http.Request)) {
 func Handle(w http.ResponseWriter, r *http.Request) {
 	mainMux.RLock()
 	defer mainMux.RUnlock()
+	var user *rpcUser
+	if auth != nil {
+		var ok bool
+		if user, ok = auth.authenticate(r); !ok {
+			log.Warn("HTTP JSON RPC Handle - unauthorized request from ", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Basic realm="jsonrpc"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+	}
 	//JSON RPC commands should be POSTs
 	if r.Method != "POST" {
 		if mainMux.defaultFunction != nil {
@@ -203,47 +263,172 @@ func Handle(w http.ResponseWriter, r *http.Request) {
 		log.Error("HTTP JSON RPC Handle - ioutil.ReadAll: ", err)
 		return
 	}
-	request := make(map[string]interface{})
-	err = json.Unmarshal(body, &request)
-	if err != nil {
-		log.Error("HTTP JSON RPC Handle - json.Unmarshal: ", err)
+
+	var response interface{}
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		//a batch is answered with the array of the responses of its calls,
+		//notifications are left out
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			log.Warn("HTTP JSON RPC Handle - json.Unmarshal: ", err)
+			response = errorResponse(nil, RpcParseError, "Parse error", nil)
+		} else if len(batch) == 0 {
+			response = errorResponse(nil, RpcInvalidRequest, "Invalid Request", "empty batch")
+		} else {
+			responses := make([]map[string]interface{}, 0, len(batch))
+			for _, raw := range batch {
+				if resp := handleRequest(raw, user); resp != nil {
+					responses = append(responses, resp)
+				}
+			}
+			if len(responses) > 0 {
+				response = responses
+			}
+		}
+	} else {
+		if resp := handleRequest(body, user); resp != nil {
+			response = resp
+		}
+	}
+	if response == nil {
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	//get the corresponding function
-	function, ok := mainMux.m[request["method"].(string)]
-	if ok {
-		response := function(request["params"].([]interface{}))
-		data, err := json.Marshal(map[string]interface{}{
-			"jsonpc": "2.0",
-			"result": response["result"],
-			"id":     request["id"],
-		})
-		if err != nil {
-			log.Error("HTTP JSON RPC Handle - json.Marshal: ", err)
-			return
+	data, err := json.Marshal(response)
+	if err != nil {
+		log.Error("HTTP JSON RPC Handle - json.Marshal: ", err)
+		data, _ = json.Marshal(errorResponse(nil, RpcInternalError, "Internal error", nil))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+//handleRequest answers a single request of a call, it returns nil for a
+//notification, which is a request without id
+func handleRequest(raw json.RawMessage, user *rpcUser) map[string]interface{} {
+	var request rpcRequest
+	if err := json.Unmarshal(raw, &request); err != nil {
+		if _, ok := err.(*json.SyntaxError); ok {
+			return errorResponse(nil, RpcParseError, "Parse error", nil)
 		}
-		w.Write(data)
-	} else {
-		//if the function does not exist
-		log.Warn("HTTP JSON RPC Handle - No function to call for ", request["method"])
-		data, err := json.Marshal(map[string]interface{}{
-			"result": nil,
-			"error": map[string]interface{}{
-				"code":    -32601,
-				"message": "Method not found",
-				"data":    "The called method was not found on the server",
-			},
-			"id": request["id"],
-		})
-		if err != nil {
-			log.Error("HTTP JSON RPC Handle - json.Marshal: ", err)
-			return
+		return errorResponse(nil, RpcInvalidRequest, "Invalid Request", err.Error())
+	}
+	id := request.ID
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	//requests without the version member are accepted for the clients of
+	//JSON-RPC 1.0
+	if request.JsonRpc != "" && request.JsonRpc != "2.0" {
+		return errorResponse(id, RpcInvalidRequest, "Invalid Request", "jsonrpc must be \"2.0\"")
+	}
+	if request.Method == "" {
+		return errorResponse(id, RpcInvalidRequest, "Invalid Request", "missing method")
+	}
+
+	function, ok := mainMux.m[request.Method]
+	if !ok {
+		log.Warn("HTTP JSON RPC Handle - No function to call for ", request.Method)
+		return notificationFilter(request.ID, errorResponse(id, RpcMethodNotFound, "Method not found",
+			"The called method was not found on the server"))
+	}
+	if user != nil && !user.allowed(request.Method) {
+		log.Warn("HTTP JSON RPC Handle - method not allowed: ", request.Method)
+		return notificationFilter(request.ID, errorResponse(id, RpcMethodNotAllowed, "Method not allowed", nil))
+	}
+
+	params, errResp := decodeParams(request.Method, request.Params)
+	if errResp != nil {
+		return notificationFilter(request.ID, errorResponse(id, errResp.Code, errResp.Message, errResp.Data))
+	}
+
+	response := callHandler(request.Method, function, params)
+	if rpcErr, ok := response["error"].(*RpcError); ok {
+		return notificationFilter(request.ID, errorResponse(id, rpcErr.Code, rpcErr.Message, rpcErr.Data))
+	}
+	return notificationFilter(request.ID, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"result":  response["result"],
+		"id":      id,
+	})
+}
+
+//decodeParams turns the params member into the positional parameters of the
+//handler, named parameters are placed by the names the method registered
+func decodeParams(method string, raw json.RawMessage) ([]interface{}, *RpcError) {
+	var value interface{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, &RpcError{Code: RpcInvalidRequest, Message: "Invalid Request", Data: err.Error()}
 		}
-		w.Write(data)
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return []interface{}{}, nil
+	case []interface{}:
+		return v, nil
+	case map[string]interface{}:
+		names := mainMux.params[method]
+		params := make([]interface{}, 0, len(names))
+		for name, param := range v {
+			index := -1
+			for i, n := range names {
+				if n == name {
+					index = i
+					break
+				}
+			}
+			if index < 0 {
+				return nil, &RpcError{Code: RpcInvalidParams, Message: "Invalid params",
+					Data: fmt.Sprintf("unknown parameter %q", name)}
+			}
+			for len(params) <= index {
+				params = append(params, nil)
+			}
+			params[index] = param
+		}
+		return params, nil
+	default:
+		return nil, &RpcError{Code: RpcInvalidRequest, Message: "Invalid Request",
+			Data: "params must be an array or an object"}
+	}
+}
+
+//callHandler runs the handler of method, a panic of the handler is turned
+//into an internal error instead of dropping the connection
+func callHandler(method string, function func([]interface{}) map[string]interface{},
+	params []interface{}) (response map[string]interface{}) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Errorf("HTTP JSON RPC Handle - %s panic: %v", method, err)
+			response = ElaRpcError(InternalError, fmt.Sprint(err))
+		}
+	}()
+	return function(params)
+}
+
+func errorResponse(id json.RawMessage, code int, message string, data interface{}) map[string]interface{} {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"error":   &RpcError{Code: code, Message: message, Data: data},
+		"id":      id,
 	}
 }
 
+//notificationFilter drops the response of a notification
+func notificationFilter(id json.RawMessage, response map[string]interface{}) map[string]interface{} {
+	if id == nil {
+		return nil
+	}
+	return response
+}
+
 func responsePacking(result interface{}) map[string]interface{} {
 	resp := map[string]interface{}{
 		"result": result,
@@ -254,20 +439,34 @@ func responsePacking(result interface{}) map[string]interface{} {
 // Call sends RPC request to server
 func Call(address string, method string, id interface{}, params []interface{}) ([]byte, error) {
 	data, err := json.Marshal(map[string]interface{}{
-		"method": method,
-		"id":     id,
-		"params": params,
+		"jsonrpc": "2.0",
+		"method":  method,
+		"id":      id,
+		"params":  params,
 	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Marshal JSON request: %v\n", err)
 		return nil, err
 	}
-	resp, err := http.Post(address, "application/json", strings.NewReader(string(data)))
+	req, err := http.NewRequest("POST", address, strings.NewReader(string(data)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "POST request: %v\n", err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if user, password, ok := readCookie(); ok {
+		req.SetBasicAuth(user, password)
+	}
+	resp, err := rpcClient().Do(req)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "POST request: %v\n", err)
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		fmt.Fprintf(os.Stderr, "POST request: unauthorized, check the rpc cookie file\n")
+		return nil, errors.New("rpc request unauthorized")
+	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -278,6 +477,24 @@ func Call(address string, method string, id interface{}, params []interface{}) (
 	return body, nil
 }
 
+// rpcClient trusts the certificates of CAPath besides the system ones when
+// the server runs TLS, the sample certificates are self signed.
+func rpcClient() *http.Client {
+	if !config.Parameters.RpcConfiguration.EnableTLS {
+		return http.DefaultClient
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if caData, err := ioutil.ReadFile(config.Parameters.CAPath); err == nil {
+		pool.AppendCertsFromPEM(caData)
+	}
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+}
+
 func VerifyAndSendTx(txn *tx.Transaction) ErrCode {
 	// if transaction is verified unsucessfully then will not put it into transaction pool
 	if errCode := node.AppendTxnPool(txn); errCode != Success {
@@ -0,0 +1,173 @@
+package httpjsonrpc
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"Elastos.ELA/common/log"
+)
+
+func init() {
+	log.Init()
+	HandleFunc("test_echo", func(params []interface{}) map[string]interface{} {
+		return ElaRpc(params)
+	}, "first", "second")
+	HandleFunc("test_fail", func(params []interface{}) map[string]interface{} {
+		return ElaRpcInvalidParameter
+	})
+	HandleFunc("test_panic", func(params []interface{}) map[string]interface{} {
+		panic("test panic")
+	})
+}
+
+// serveTestRequest posts body to the dispatcher, it returns the status and
+// the decoded response.
+func serveTestRequest(t *testing.T, body string, user *rpcUser) (int, interface{}) {
+	if user != nil {
+		auth = &rpcAuth{users: map[string]*rpcUser{"test": user}}
+		defer func() { auth = nil }()
+	}
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	if user != nil {
+		r.SetBasicAuth("test", "password")
+	}
+	w := httptest.NewRecorder()
+	Handle(w, r)
+
+	var response interface{}
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("response %q is not json: %s", w.Body.String(), err)
+		}
+	}
+	return w.Code, response
+}
+
+func TestHandle(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		body   string
+		result string
+		code   int
+	}{
+		{"positional params", `{"jsonrpc":"2.0","method":"test_echo","params":[1,"a"],"id":1}`, `[1,"a"]`, 0},
+		{"named params", `{"jsonrpc":"2.0","method":"test_echo","params":{"second":"b","first":2},"id":1}`, `[2,"b"]`, 0},
+		{"named params with a gap", `{"jsonrpc":"2.0","method":"test_echo","params":{"second":"b"},"id":1}`, `[null,"b"]`, 0},
+		{"no params", `{"jsonrpc":"2.0","method":"test_echo","id":"x"}`, `[]`, 0},
+		{"json-rpc 1.0", `{"method":"test_echo","params":[3],"id":1}`, `[3]`, 0},
+		{"unknown named param", `{"jsonrpc":"2.0","method":"test_echo","params":{"third":1},"id":1}`, "", RpcInvalidParams},
+		{"scalar params", `{"jsonrpc":"2.0","method":"test_echo","params":1,"id":1}`, "", RpcInvalidRequest},
+		{"parse error", `{"jsonrpc":"2.0","method":`, "", RpcParseError},
+		{"wrong version", `{"jsonrpc":"1.5","method":"test_echo","id":1}`, "", RpcInvalidRequest},
+		{"missing method", `{"jsonrpc":"2.0","id":1}`, "", RpcInvalidRequest},
+		{"not an object", `"test_echo"`, "", RpcInvalidRequest},
+		{"unknown method", `{"jsonrpc":"2.0","method":"test_none","id":1}`, "", RpcMethodNotFound},
+		{"handler error", `{"jsonrpc":"2.0","method":"test_fail","id":1}`, "", RpcInvalidParams},
+		{"handler panic", `{"jsonrpc":"2.0","method":"test_panic","id":1}`, "", RpcInternalError},
+		{"empty batch", `[]`, "", RpcInvalidRequest},
+		{"broken batch", `[{"jsonrpc":"2.0"`, "", RpcParseError},
+	} {
+		status, response := serveTestRequest(t, test.body, nil)
+		resp, ok := response.(map[string]interface{})
+		if status != http.StatusOK || !ok {
+			t.Fatalf("%s: status %d, response %v", test.name, status, response)
+		}
+		if resp["jsonrpc"] != "2.0" {
+			t.Fatalf("%s: response version %v", test.name, resp["jsonrpc"])
+		}
+		if test.code != 0 {
+			rpcErr, _ := resp["error"].(map[string]interface{})
+			if rpcErr == nil || int(rpcErr["code"].(float64)) != test.code {
+				t.Fatalf("%s: error %v, want code %d", test.name, resp["error"], test.code)
+			}
+			if _, ok := resp["result"]; ok {
+				t.Fatalf("%s: error response has a result", test.name)
+			}
+			continue
+		}
+		result, _ := json.Marshal(resp["result"])
+		if string(result) != test.result || resp["error"] != nil {
+			t.Fatalf("%s: result %s error %v, want %s", test.name, result, resp["error"], test.result)
+		}
+	}
+}
+
+func TestHandleID(t *testing.T) {
+	for _, id := range []string{`1`, `"a"`, `null`} {
+		_, response := serveTestRequest(t, `{"jsonrpc":"2.0","method":"test_echo","id":`+id+`}`, nil)
+		got, _ := json.Marshal(response.(map[string]interface{})["id"])
+		if string(got) != id {
+			t.Fatalf("id %s answered with id %s", id, got)
+		}
+	}
+	// the id of a request that can not be parsed is unknown
+	_, response := serveTestRequest(t, `{"id":1,`, nil)
+	if id := response.(map[string]interface{})["id"]; id != nil {
+		t.Fatalf("parse error answered with id %v", id)
+	}
+}
+
+func TestHandleNotification(t *testing.T) {
+	for _, body := range []string{
+		`{"jsonrpc":"2.0","method":"test_echo","params":[1]}`,
+		`{"jsonrpc":"2.0","method":"test_none"}`,
+		`{"jsonrpc":"2.0","method":"test_fail"}`,
+		`[{"jsonrpc":"2.0","method":"test_echo"},{"jsonrpc":"2.0","method":"test_fail"}]`,
+	} {
+		if status, response := serveTestRequest(t, body, nil); status != http.StatusNoContent || response != nil {
+			t.Fatalf("notification %s answered with %d %v", body, status, response)
+		}
+	}
+}
+
+func TestHandleBatch(t *testing.T) {
+	body := `[
+		{"jsonrpc":"2.0","method":"test_echo","params":[1],"id":1},
+		{"jsonrpc":"2.0","method":"test_echo","params":[2]},
+		{"jsonrpc":"2.0","method":"test_none","id":3},
+		1,
+		{"jsonrpc":"2.0","method":"test_echo","params":{"first":5},"id":5}
+	]`
+	status, response := serveTestRequest(t, body, nil)
+	responses, ok := response.([]interface{})
+	if status != http.StatusOK || !ok {
+		t.Fatalf("batch answered with %d %v", status, response)
+	}
+	// the notification is left out, the others are answered in order
+	want := []struct {
+		id   interface{}
+		code int
+	}{{1.0, 0}, {3.0, RpcMethodNotFound}, {nil, RpcInvalidRequest}, {5.0, 0}}
+	if len(responses) != len(want) {
+		t.Fatalf("batch has %d responses, want %d", len(responses), len(want))
+	}
+	for i, w := range want {
+		resp := responses[i].(map[string]interface{})
+		if resp["id"] != w.id {
+			t.Fatalf("response %d has id %v, want %v", i, resp["id"], w.id)
+		}
+		rpcErr, _ := resp["error"].(map[string]interface{})
+		if w.code == 0 && rpcErr != nil || w.code != 0 && (rpcErr == nil || int(rpcErr["code"].(float64)) != w.code) {
+			t.Fatalf("response %d has error %v, want code %d", i, resp["error"], w.code)
+		}
+	}
+}
+
+func TestHandleMethodNotAllowed(t *testing.T) {
+	user := &rpcUser{password: sha256.Sum256([]byte("password")), methods: map[string]bool{"test_fail": true}}
+
+	_, response := serveTestRequest(t, `{"jsonrpc":"2.0","method":"test_echo","id":1}`, user)
+	rpcErr, _ := response.(map[string]interface{})["error"].(map[string]interface{})
+	if rpcErr == nil || int(rpcErr["code"].(float64)) != RpcMethodNotAllowed {
+		t.Fatalf("method outside the user's list answered with %v", response)
+	}
+	_, response = serveTestRequest(t, `{"jsonrpc":"2.0","method":"test_fail","id":1}`, user)
+	rpcErr, _ = response.(map[string]interface{})["error"].(map[string]interface{})
+	if rpcErr == nil || int(rpcErr["code"].(float64)) != RpcInvalidParams {
+		t.Fatalf("allowed method answered with %v", response)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	. "Elastos.ELA/common"
 	"Elastos.ELA/common/config"
 	"Elastos.ELA/common/log"
+	"Elastos.ELA/consensus/pow"
 	"Elastos.ELA/core/contract"
 	"Elastos.ELA/core/contract/program"
 	"Elastos.ELA/core/ledger"
@@ -14,6 +15,7 @@ import (
 	"Elastos.ELA/core/transaction/payload"
 	"Elastos.ELA/crypto"
 	. "Elastos.ELA/errors"
+	"Elastos.ELA/net/protocol"
 	"bytes"
 	"encoding/json"
 	"errors"
@@ -26,7 +28,8 @@ import (
 )
 
 const (
-	AUXBLOCK_GENERATED_INTERVAL_SECONDS = 60
+	// a long poll of getblocktemplate returns the same template after this
+	LONGPOLL_TIMEOUT_SECONDS = 120
 )
 
 type BatchOut struct {
@@ -53,9 +56,6 @@ func (sc sortedCoins) Less(i, j int) bool {
 }
 
 var Wallet account.Client
-var PreChainHeight uint64
-var PreTime int64
-var PreTransactionCount int
 
 func TransArryByteToHexString(ptx *tx.Transaction) *Transactions {
 
@@ -168,7 +168,7 @@ func getBestBlockHash(params []interface{}) map[string]interface{} {
 //   {"jsonrpc": "2.0", "method": "getblock", "params": ["aabbcc.."], "id": 0}
 func getBlock(params []interface{}) map[string]interface{} {
 	if len(params) < 1 {
-		return ElaRpcNil
+		return ElaRpcInvalidParameter
 	}
 	var err error
 	var hash Uint256
@@ -236,11 +236,38 @@ func getBlockCount(params []interface{}) map[string]interface{} {
 	return ElaRpc(ledger.DefaultLedger.Blockchain.BlockHeight + 1)
 }
 
+// A JSON example for getchaintips method as following:
+//   {"jsonrpc": "2.0", "method": "getchaintips", "params": [], "id": 0}
+// Status is "active" for the best chain, "valid-fork" for a fork whose blocks
+// the node keeps and "valid-headers" for one it no longer does.
+func getChainTips(params []interface{}) map[string]interface{} {
+	type ChainTip struct {
+		Height    uint32 `json:"height"`
+		Hash      string `json:"hash"`
+		BranchLen uint32 `json:"branchlen"`
+		Status    string `json:"status"`
+	}
+	tips := ledger.DefaultLedger.Blockchain.ChainTips()
+	sort.Slice(tips, func(i, j int) bool {
+		return tips[i].Height > tips[j].Height
+	})
+	result := make([]ChainTip, 0, len(tips))
+	for _, tip := range tips {
+		result = append(result, ChainTip{
+			Height:    tip.Height,
+			Hash:      BytesToHexString(tip.Hash.ToArrayReverse()),
+			BranchLen: tip.BranchLen,
+			Status:    tip.Status,
+		})
+	}
+	return ElaRpc(result)
+}
+
 // A JSON example for getblockhash method as following:
 //   {"jsonrpc": "2.0", "method": "getblockhash", "params": [1], "id": 0}
 func getBlockHash(params []interface{}) map[string]interface{} {
 	if len(params) < 1 {
-		return ElaRpcNil
+		return ElaRpcInvalidParameter
 	}
 	switch params[0].(type) {
 	case float64:
@@ -275,7 +302,7 @@ func getRawMemPool(params []interface{}) map[string]interface{} {
 //   {"jsonrpc": "2.0", "method": "getrawtransaction", "params": ["transactioin hash in hex"], "id": 0}
 func getRawTransaction(params []interface{}) map[string]interface{} {
 	if len(params) < 1 {
-		return ElaRpcNil
+		return ElaRpcInvalidParameter
 	}
 	switch params[0].(type) {
 	case string:
@@ -314,11 +341,312 @@ func getRawTransaction(params []interface{}) map[string]interface{} {
 	}
 }
 
+// confirmations of a transaction in the block at height, a record can be
+// ahead of the best height while a reorganization is in progress.
+func confirmations(bestHeight, height uint32) uint32 {
+	if height > bestHeight {
+		return 0
+	}
+	return bestHeight - height + 1
+}
+
+func GetAddressHistoryInfo(address string, offset, limit uint32) (*AddressHistoryInfo, error) {
+	programHash, err := ToScriptHash(address)
+	if err != nil {
+		return nil, err
+	}
+	histories, total, err := ledger.DefaultLedger.Store.GetAddressHistory(programHash, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	bestHeight := ledger.DefaultLedger.Blockchain.GetBestHeight()
+	info := &AddressHistoryInfo{
+		Address: address,
+		Total:   total,
+		History: make([]TxHistoryInfo, 0, len(histories)),
+	}
+	for _, h := range histories {
+		info.History = append(info.History, TxHistoryInfo{
+			Txid:            BytesToHexString(h.Txid.ToArrayReverse()),
+			Height:          h.Height,
+			AssetID:         BytesToHexString(h.AssetID.ToArrayReverse()),
+			Direction:       h.Direction.String(),
+			Value:           h.Value.String(),
+			Confirminations: confirmations(bestHeight, h.Height),
+		})
+	}
+
+	return info, nil
+}
+
+// A JSON example for getaddresshistory method as following:
+//   {"jsonrpc": "2.0", "method": "getaddresshistory", "params": ["address", offset, limit], "id": 0}
+// offset and limit are optional, a limit of 0 returns the whole history.
+func getAddressHistory(params []interface{}) map[string]interface{} {
+	if len(params) < 1 {
+		return ElaRpcInvalidParameter
+	}
+	var address string
+	switch params[0].(type) {
+	case string:
+		address = params[0].(string)
+	default:
+		return ElaRpcInvalidParameter
+	}
+
+	var offset, limit uint32
+	if len(params) > 1 {
+		switch params[1].(type) {
+		case float64:
+			offset = uint32(params[1].(float64))
+		case nil:
+		default:
+			return ElaRpcInvalidParameter
+		}
+	}
+	if len(params) > 2 {
+		switch params[2].(type) {
+		case float64:
+			limit = uint32(params[2].(float64))
+		case nil:
+		default:
+			return ElaRpcInvalidParameter
+		}
+	}
+
+	info, err := GetAddressHistoryInfo(address, offset, limit)
+	if err != nil {
+		return ElaRpcInvalidParameter
+	}
+
+	return ElaRpc(info)
+}
+
+// A JSON example for listtransactions method as following:
+//   {"jsonrpc": "2.0", "method": "listtransactions", "params": [offset, limit], "id": 0}
+// the transactions of the wallet are listed newest first, offset and limit
+// are optional, a limit of 0 returns the whole history.
+func listTransactions(params []interface{}) map[string]interface{} {
+	var offset, limit uint32
+	if len(params) > 0 {
+		switch params[0].(type) {
+		case float64:
+			offset = uint32(params[0].(float64))
+		case nil:
+		default:
+			return ElaRpcInvalidParameter
+		}
+	}
+	if len(params) > 1 {
+		switch params[1].(type) {
+		case float64:
+			limit = uint32(params[1].(float64))
+		case nil:
+		default:
+			return ElaRpcInvalidParameter
+		}
+	}
+	if Wallet == nil {
+		return ElaRpcWalletNotOpened
+	}
+
+	records, total := Wallet.GetHistory(offset, limit)
+	bestHeight := ledger.DefaultLedger.Blockchain.GetBestHeight()
+	info := &WalletHistoryInfo{
+		Total:        total,
+		Transactions: make([]WalletTxInfo, 0, len(records)),
+	}
+	for _, r := range records {
+		info.Transactions = append(info.Transactions, WalletTxInfo{
+			Txid:            r.TxID,
+			AssetID:         r.AssetID,
+			Direction:       r.Direction,
+			Amount:          r.Amount.String(),
+			Fee:             r.Fee.String(),
+			Height:          r.Height,
+			Timestamp:       r.Timestamp,
+			Confirminations: confirmations(bestHeight, r.Height),
+			Label:           r.Label,
+		})
+	}
+
+	return ElaRpc(info)
+}
+
+// GetTxOutProof builds the inclusion proof of the transaction. The block
+// hash is optional, by default the block containing the transaction is used.
+func GetTxOutProof(txid Uint256, blockHash *Uint256) (*ledger.TxProof, error) {
+	if blockHash == nil {
+		_, height, err := ledger.DefaultLedger.Store.GetTransaction(txid)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := ledger.DefaultLedger.Store.GetBlockHash(height)
+		if err != nil {
+			return nil, err
+		}
+		blockHash = &hash
+	}
+
+	block, err := ledger.DefaultLedger.Store.GetBlock(*blockHash)
+	if err != nil {
+		return nil, err
+	}
+	return ledger.NewTxProof(block, txid)
+}
+
+// VerifyTxOutProof checks the proof and that its block is in the main chain.
+// The transaction count of the proof is not committed to by the header, it
+// is checked against the stored block unless the store pruned it.
+func VerifyTxOutProof(proof *ledger.TxProof) error {
+	if err := proof.Verify(); err != nil {
+		return err
+	}
+	hash, err := ledger.DefaultLedger.Store.GetBlockHash(proof.Header.Height)
+	if err != nil || hash != proof.Header.Hash() {
+		return errors.New("block not found in main chain")
+	}
+	block, err := ledger.DefaultLedger.Store.GetBlock(hash)
+	if err == nil && uint32(len(block.Transactions)) != proof.Transactions {
+		return errors.New("transaction count does not match the block")
+	}
+	return nil
+}
+
+// A JSON example for gettxoutproof method as following:
+//   {"jsonrpc": "2.0", "method": "gettxoutproof", "params": ["transaction hash in hex", "block hash in hex"], "id": 0}
+// the block hash is optional.
+func getTxOutProof(params []interface{}) map[string]interface{} {
+	if len(params) < 1 {
+		return ElaRpcInvalidParameter
+	}
+	var txid Uint256
+	switch params[0].(type) {
+	case string:
+		hex, err := HexStringToBytesReverse(params[0].(string))
+		if err != nil {
+			return ElaRpcInvalidParameter
+		}
+		if err := txid.Deserialize(bytes.NewReader(hex)); err != nil {
+			return ElaRpcInvalidTransaction
+		}
+	default:
+		return ElaRpcInvalidParameter
+	}
+
+	var blockHash *Uint256
+	if len(params) > 1 {
+		switch params[1].(type) {
+		case string:
+			hex, err := HexStringToBytesReverse(params[1].(string))
+			if err != nil {
+				return ElaRpcInvalidParameter
+			}
+			blockHash = new(Uint256)
+			if err := blockHash.Deserialize(bytes.NewReader(hex)); err != nil {
+				return ElaRpcInvalidHash
+			}
+		case nil:
+		default:
+			return ElaRpcInvalidParameter
+		}
+	}
+
+	proof, err := GetTxOutProof(txid, blockHash)
+	if err != nil {
+		return ElaRpcUnknownTransaction
+	}
+	w := bytes.NewBuffer(nil)
+	if err := proof.Serialize(w); err != nil {
+		return ElaRpcInternalError
+	}
+
+	return ElaRpc(BytesToHexString(w.Bytes()))
+}
+
+// A JSON example for verifytxoutproof method as following:
+//   {"jsonrpc": "2.0", "method": "verifytxoutproof", "params": ["proof in hex"], "id": 0}
+// it returns the proven transaction hash, or an error telling why the proof
+// is not valid.
+func verifyTxOutProof(params []interface{}) map[string]interface{} {
+	if len(params) < 1 {
+		return ElaRpcInvalidParameter
+	}
+	switch params[0].(type) {
+	case string:
+		hex, err := HexStringToBytes(params[0].(string))
+		if err != nil {
+			return ElaRpcInvalidParameter
+		}
+		var proof ledger.TxProof
+		if err := proof.Deserialize(bytes.NewReader(hex)); err != nil {
+			return ElaRpcInvalidParameter
+		}
+		if err := VerifyTxOutProof(&proof); err != nil {
+			return ElaRpcError(Error, "invalid proof: "+err.Error())
+		}
+		return ElaRpc(BytesToHexString(proof.Txid.ToArrayReverse()))
+	default:
+		return ElaRpcInvalidParameter
+	}
+}
+
 func getNeighbor(params []interface{}) map[string]interface{} {
 	addr, _ := node.GetNeighborAddrs()
 	return ElaRpc(addr)
 }
 
+func listBanned(params []interface{}) map[string]interface{} {
+	return ElaRpc(node.GetBannedAddrs())
+}
+
+// A JSON example for setban method as following:
+//   {"jsonrpc": "2.0", "method": "setban", "params": ["ip", "add", bantime], "id": 0}
+// the command is "add" or "remove", bantime is in seconds and optional.
+func setBan(params []interface{}) map[string]interface{} {
+	if len(params) < 2 {
+		return ElaRpcInvalidParameter
+	}
+	addr, ok := params[0].(string)
+	if !ok {
+		return ElaRpcInvalidParameter
+	}
+	command, ok := params[1].(string)
+	if !ok {
+		return ElaRpcInvalidParameter
+	}
+	banTime := time.Duration(protocol.BANDURATION) * time.Second
+	if len(params) > 2 {
+		switch params[2].(type) {
+		case float64:
+			banTime = time.Duration(params[2].(float64)) * time.Second
+		case nil:
+		default:
+			return ElaRpcInvalidParameter
+		}
+	}
+
+	switch command {
+	case "add":
+		if err := node.BanAddr(addr, banTime, "manually banned"); err != nil {
+			return ElaRpcError(InvalidParams, err.Error())
+		}
+	case "remove":
+		if !node.UnbanAddr(addr) {
+			return ElaRpcError(InvalidParams, "address is not banned")
+		}
+	default:
+		return ElaRpcInvalidParameter
+	}
+	return ElaRpcSuccess
+}
+
+func clearBanned(params []interface{}) map[string]interface{} {
+	node.ClearBannedAddrs()
+	return ElaRpcSuccess
+}
+
 func getNodeState(params []interface{}) map[string]interface{} {
 	n := NodeInfo{
 		State:    uint(node.GetState()),
@@ -339,129 +667,221 @@ func setDebugInfo(params []interface{}) map[string]interface{} {
 	if len(params) < 1 {
 		return ElaRpcInvalidParameter
 	}
-	switch params[0].(type) {
-	case float64:
-		level := params[0].(float64)
+	level, ok := params[0].(float64)
+	if !ok {
+		return ElaRpcInvalidParameter
+	}
+	// without a module the level applies to the modules that have no level
+	// of their own
+	if len(params) < 2 || params[1] == nil {
 		if err := log.Log.SetDebugLevel(int(level)); err != nil {
 			return ElaRpcInvalidParameter
 		}
-	default:
+		return ElaRpcSuccess
+	}
+	module, ok := params[1].(string)
+	if !ok {
 		return ElaRpcInvalidParameter
 	}
+	if err := log.Log.SetModuleLevel(module, int(level)); err != nil {
+		return ElaRpcError(InvalidParams, err.Error())
+	}
 	return ElaRpcSuccess
 }
 
+// submitauxblock returns an error of code StaleBlock when the block is no
+// longer on the tip, the parent should mine a new one, and InvalidBlock when
+// the auxpow or the block is invalid.
 func submitAuxBlock(params []interface{}) map[string]interface{} {
-	auxPow, blockHash := "", ""
-	switch params[0].(type) {
-	case string:
-		blockHash = params[0].(string)
-		if _, ok := Pow.MsgBlock.BlockData[blockHash]; !ok {
-			log.Trace("[json-rpc:submitAuxBlock] receive invalid block hash value:", blockHash)
-			return ElaRpcInvalidHash
-		}
-
-	default:
+	if len(params) < 2 {
+		return ElaRpcInvalidParameter
+	}
+	blockHash, ok := params[0].(string)
+	if !ok {
+		return ElaRpcInvalidParameter
+	}
+	auxPow, ok := params[1].(string)
+	if !ok {
+		return ElaRpcInvalidParameter
+	}
+	hashBytes, err := HexStringToBytes(blockHash)
+	if err != nil {
+		return ElaRpcInvalidHash
+	}
+	hash, err := Uint256ParseFromBytes(hashBytes)
+	if err != nil {
+		return ElaRpcInvalidHash
+	}
+	auxPowData, err := HexStringToBytes(auxPow)
+	if err != nil {
 		return ElaRpcInvalidParameter
 	}
 
-	switch params[1].(type) {
-	case string:
-		auxPow = params[1].(string)
-		temp, _ := HexStringToBytes(auxPow)
-		r := bytes.NewBuffer(temp)
-		Pow.MsgBlock.BlockData[blockHash].Blockdata.AuxPow.Deserialize(r)
-		_, _, err := ledger.DefaultLedger.Blockchain.AddBlock(Pow.MsgBlock.BlockData[blockHash])
-		if err != nil {
-			log.Trace(err)
-			return ElaRpcInternalError
-		}
-
-		Pow.MsgBlock.Mutex.Lock()
-		for key := range Pow.MsgBlock.BlockData {
-			delete(Pow.MsgBlock.BlockData, key)
-		}
-		Pow.MsgBlock.Mutex.Unlock()
-		log.Trace("AddBlock called finished and Pow.MsgBlock.BlockData has been deleted completely")
-
+	block, err := Pow.AuxWorks.SubmitWork(hash, auxPowData)
+	switch err.(type) {
+	case nil:
+	case *pow.AuxWorkRejected:
+		log.Warn("[json-rpc:submitAuxBlock] ", blockHash, " ", err)
+		return ElaRpcError(InvalidBlock, err.Error())
 	default:
-		return ElaRpcInvalidParameter
+		switch err {
+		case pow.ErrAuxWorkStale:
+			log.Debug("[json-rpc:submitAuxBlock] stale block hash:", blockHash)
+			return ElaRpcError(StaleBlock, err.Error())
+		case pow.ErrAuxWorkUnknown:
+			log.Trace("[json-rpc:submitAuxBlock] receive invalid block hash value:", blockHash)
+			return ElaRpcInvalidHash
+		}
+		return ElaRpcError(InternalError, err.Error())
 	}
-	log.Info(auxPow, blockHash)
+	Pow.BroadcastBlock(block)
 	return ElaRpcSuccess
 }
 
-func generateAuxBlock(addr string) (*ledger.Block, string, bool) {
-	msgBlock := &ledger.Block{}
-
-	if node.GetHeight() == 0 || PreChainHeight != node.GetHeight() || (time.Now().Unix()-PreTime > AUXBLOCK_GENERATED_INTERVAL_SECONDS && Pow.GetTransactionCount() != PreTransactionCount) {
-		if PreChainHeight != node.GetHeight() {
-			PreChainHeight = node.GetHeight()
-			PreTime = time.Now().Unix()
-			PreTransactionCount = Pow.GetTransactionCount()
-		}
-
-		currentTxsCount := Pow.CollectTransactions(msgBlock)
-		if 0 == currentTxsCount {
-			return nil, "currentTxs is nil", false
-		}
-
-		msgBlock, err := Pow.GenerateBlock(addr)
-		if nil != err {
-			return nil, "msgBlock generate err", false
+// A JSON example for createauxblock method as following:
+//   {"jsonrpc": "2.0", "method": "createauxblock", "params": ["address", "parent chain"], "id": 0}
+// The parent chain is any name a pool gives its parent chain, so the works
+// of its parents do not replace each other.
+func createAuxBlock(params []interface{}) map[string]interface{} {
+	if len(params) < 1 {
+		return ElaRpcInvalidParameter
+	}
+	payToAddr, ok := params[0].(string)
+	if !ok {
+		return ElaRpcInvalidParameter
+	}
+	parentChain := ""
+	if len(params) > 1 && params[1] != nil {
+		if parentChain, ok = params[1].(string); !ok {
+			return ElaRpcInvalidParameter
 		}
-
-		curHash := msgBlock.Hash()
-		curHashStr := BytesToHexString(curHash.ToArray())
-
-		Pow.MsgBlock.Mutex.Lock()
-		Pow.MsgBlock.BlockData[curHashStr] = msgBlock
-		Pow.MsgBlock.Mutex.Unlock()
-
-		PreChainHeight = node.GetHeight()
-		PreTime = time.Now().Unix()
-		PreTransactionCount = currentTxsCount // Don't Call GetTransactionCount()
-
-		return msgBlock, curHashStr, true
 	}
-	return nil, "", false
-}
+	if _, err := ToScriptHash(payToAddr); err != nil {
+		return ElaRpcError(InvalidParams, "invalid address")
+	}
 
-func createAuxBlock(params []interface{}) map[string]interface{} {
-	msgBlock, curHashStr, _ := generateAuxBlock(config.Parameters.PowConfiguration.PayToAddr)
-	if nil == msgBlock {
-		return ElaRpcNil
+	msgBlock, err := Pow.AuxWorks.GetWork(payToAddr, parentChain)
+	if err != nil {
+		return ElaRpcError(InternalError, "create aux block error: "+err.Error())
+	}
+	// the coinbase pays the foundation first and the miner second
+	if len(msgBlock.Transactions) == 0 || len(msgBlock.Transactions[0].Outputs) < 2 {
+		return ElaRpcError(InternalError, "create aux block error: coinbase has no miner output")
 	}
+	curHash := msgBlock.Hash()
 
 	type AuxBlock struct {
 		ChainId           int    `json:"chainid"`
-		Height            uint64 `json:"height"`
-		CoinBaseValue     int    `json:"coinbasevalue"`
+		Height            uint32 `json:"height"`
+		CoinBaseValue     int64  `json:"coinbasevalue"`
 		Bits              string `json:"bits"`
 		Hash              string `json:"hash"`
 		PreviousBlockHash string `json:"previousblockhash"`
 	}
+	SendToAux := AuxBlock{
+		ChainId:           pow.AuxChainID,
+		Height:            msgBlock.Blockdata.Height,
+		CoinBaseValue:     int64(msgBlock.Transactions[0].Outputs[1].Value),
+		Bits:              fmt.Sprintf("%x", msgBlock.Blockdata.Bits), //difficulty
+		Hash:              BytesToHexString(curHash.ToArray()),
+		PreviousBlockHash: BytesToHexString(msgBlock.Blockdata.PrevBlockHash.ToArray()),
+	}
+	return ElaRpc(&SendToAux)
+}
 
-	switch params[0].(type) {
-	case string:
-		Pow.PayToAddr = params[0].(string)
-
-		preHash := ledger.DefaultLedger.Blockchain.CurrentBlockHash()
-		preHashStr := BytesToHexString(preHash.ToArray())
+type TemplateTransaction struct {
+	Data    string `json:"data"`
+	Hash    string `json:"hash"`
+	Fee     int64  `json:"fee"`
+	Depends []int  `json:"depends"`
+}
 
-		SendToAux := AuxBlock{
-			ChainId:           1,
-			Height:            node.GetHeight(),
-			CoinBaseValue:     1,                                          //transaction content
-			Bits:              fmt.Sprintf("%x", msgBlock.Blockdata.Bits), //difficulty
-			Hash:              curHashStr,
-			PreviousBlockHash: preHashStr}
-		return ElaRpc(&SendToAux)
+type BlockTemplate struct {
+	Version           uint32                `json:"version"`
+	PreviousBlockHash string                `json:"previousblockhash"`
+	Transactions      []TemplateTransaction `json:"transactions"`
+	CoinbaseTxn       TemplateTransaction   `json:"coinbasetxn"`
+	CoinbaseValue     int64                 `json:"coinbasevalue"`
+	Target            string                `json:"target"`
+	Bits              string                `json:"bits"`
+	Height            uint32                `json:"height"`
+	MinTime           uint32                `json:"mintime"`
+	CurTime           uint32                `json:"curtime"`
+	Mutable           []string              `json:"mutable"`
+	NonceRange        string                `json:"noncerange"`
+	SizeLimit         int                   `json:"sizelimit"`
+	LongPollID        string                `json:"longpollid"`
+}
 
-	default:
-		return ElaRpcInvalidParameter
+// A JSON example for getblocktemplate method as following:
+//   {"jsonrpc": "2.0", "method": "getblocktemplate", "params": [{"longpollid": "id of the last template"}], "id": 0}
+// With a long poll id the call returns when the best block or the transaction
+// pool changed since that template.
+func getBlockTemplate(params []interface{}) map[string]interface{} {
+	if len(params) > 0 && params[0] != nil {
+		request, ok := params[0].(map[string]interface{})
+		if !ok {
+			return ElaRpcInvalidParameter
+		}
+		if mode, ok := request["mode"]; ok && mode != "template" {
+			return ElaRpcError(InvalidParams, "unsupported mode")
+		}
+		if longPollID, ok := request["longpollid"]; ok {
+			id, ok := longPollID.(string)
+			if !ok {
+				return ElaRpcInvalidParameter
+			}
+			Pow.WaitTemplateChange(id, LONGPOLL_TIMEOUT_SECONDS*time.Second)
+		}
+	}
 
+	template, err := Pow.NewBlockTemplate(Pow.PayToAddr)
+	if err != nil {
+		return ElaRpcError(InternalError, "create block template error: "+err.Error())
+	}
+	block := template.Block
+
+	// the transactions spent by later ones, by their 1 based index
+	index := make(map[Uint256]int)
+	transactions := make([]TemplateTransaction, 0, len(block.Transactions))
+	for i, txn := range block.Transactions {
+		var buffer bytes.Buffer
+		txn.Serialize(&buffer)
+		hash := txn.Hash()
+		depends := []int{}
+		for _, input := range txn.UTXOInputs {
+			if j, ok := index[input.ReferTxID]; ok {
+				depends = append(depends, j)
+			}
+		}
+		transactions = append(transactions, TemplateTransaction{
+			Data:    BytesToHexString(buffer.Bytes()),
+			Hash:    BytesToHexString(hash.ToArrayReverse()),
+			Fee:     int64(template.Fees[i]),
+			Depends: depends,
+		})
+		if i > 0 {
+			index[hash] = i
+		}
 	}
+
+	blockData := block.Blockdata
+	return ElaRpc(&BlockTemplate{
+		Version:           blockData.Version,
+		PreviousBlockHash: BytesToHexString(blockData.PrevBlockHash.ToArrayReverse()),
+		Transactions:      transactions[1:],
+		CoinbaseTxn:       transactions[0],
+		CoinbaseValue:     int64(template.CoinbaseValue),
+		Target:            fmt.Sprintf("%064x", ledger.CompactToBig(blockData.Bits)),
+		Bits:              fmt.Sprintf("%08x", blockData.Bits),
+		Height:            blockData.Height,
+		MinTime:           template.MinTime,
+		CurTime:           blockData.Timestamp,
+		Mutable:           []string{"time", "transactions", "prevblock"},
+		NonceRange:        "00000000ffffffff",
+		SizeLimit:         ledger.MaxBlockSize,
+		LongPollID:        template.LongPollID,
+	})
 }
 
 func getInfo(params []interface{}) map[string]interface{} {
@@ -508,20 +928,20 @@ func getVersion(params []interface{}) map[string]interface{} {
 
 func addAccount(params []interface{}) map[string]interface{} {
 	if Wallet == nil {
-		return ElaRpc("open wallet first")
+		return ElaRpcWalletNotOpened
 	}
 	account, err := Wallet.CreateAccount()
 	if err != nil {
-		return ElaRpc("create account error:" + err.Error())
+		return ElaRpcError(InternalError, "create account error: "+err.Error())
 	}
 
 	if err := Wallet.CreateContract(account); err != nil {
-		return ElaRpc("create contract error:" + err.Error())
+		return ElaRpcError(InternalError, "create contract error: "+err.Error())
 	}
 
 	address, err := account.ProgramHash.ToAddress()
 	if err != nil {
-		return ElaRpc("generate address error:" + err.Error())
+		return ElaRpcError(InternalError, "generate address error: "+err.Error())
 	}
 
 	return ElaRpc(address)
@@ -529,7 +949,7 @@ func addAccount(params []interface{}) map[string]interface{} {
 
 func deleteAccount(params []interface{}) map[string]interface{} {
 	if len(params) < 1 {
-		return ElaRpcNil
+		return ElaRpcInvalidParameter
 	}
 	var address string
 	switch params[0].(type) {
@@ -539,26 +959,29 @@ func deleteAccount(params []interface{}) map[string]interface{} {
 		return ElaRpcInvalidParameter
 	}
 	if Wallet == nil {
-		return ElaRpc("open wallet first")
+		return ElaRpcWalletNotOpened
 	}
 	programHash, err := ToScriptHash(address)
 	if err != nil {
-		return ElaRpc("invalid address:" + err.Error())
+		return ElaRpcError(InvalidParams, "invalid address: "+err.Error())
 	}
 	if err := Wallet.DeleteAccount(programHash); err != nil {
-		return ElaRpc("Delete account error:" + err.Error())
+		return ElaRpcError(InternalError, "delete account error: "+err.Error())
 	}
 	if err := Wallet.DeleteContract(programHash); err != nil {
-		return ElaRpc("Delete contract error:" + err.Error())
+		return ElaRpcError(InternalError, "delete contract error: "+err.Error())
 	}
 	if err := Wallet.DeleteCoinsData(programHash); err != nil {
-		return ElaRpc("Delete coins error:" + err.Error())
+		return ElaRpcError(InternalError, "delete coins error: "+err.Error())
 	}
 
 	return ElaRpc(true)
 }
 
 func toggleCpuMining(params []interface{}) map[string]interface{} {
+	if len(params) < 1 {
+		return ElaRpcInvalidParameter
+	}
 	var isMining bool
 	switch params[0].(type) {
 	case bool:
@@ -578,6 +1001,9 @@ func toggleCpuMining(params []interface{}) map[string]interface{} {
 }
 
 func manualCpuMining(params []interface{}) map[string]interface{} {
+	if len(params) < 1 {
+		return ElaRpcInvalidParameter
+	}
 	var numBlocks uint32
 	switch params[0].(type) {
 	case float64:
@@ -594,7 +1020,7 @@ func manualCpuMining(params []interface{}) map[string]interface{} {
 
 	blockHashes, err := Pow.ManualMining(numBlocks)
 	if err != nil {
-		return ElaRpcFailed
+		return ElaRpcError(InternalError, "manual mining error: "+err.Error())
 	}
 
 	for i, hash := range blockHashes {
@@ -608,8 +1034,8 @@ func manualCpuMining(params []interface{}) map[string]interface{} {
 }
 
 func sendTransaction(params []interface{}) map[string]interface{} {
-	if len(params) < 4 {
-		return ElaRpcNil
+	if len(params) < 5 {
+		return ElaRpcInvalidParameter
 	}
 
 	var asset, address, value, fee, utxolock string
@@ -644,7 +1070,7 @@ func sendTransaction(params []interface{}) map[string]interface{} {
 		return ElaRpcInvalidParameter
 	}
 	if Wallet == nil {
-		return ElaRpc("error : wallet is not opened")
+		return ElaRpcWalletNotOpened
 	}
 
 	batchOut := BatchOut{
@@ -653,27 +1079,27 @@ func sendTransaction(params []interface{}) map[string]interface{} {
 	}
 	tmp, err := HexStringToBytesReverse(asset)
 	if err != nil {
-		return ElaRpc("error: invalid asset ID")
+		return ElaRpcError(InvalidParams, "invalid asset ID")
 	}
 	var assetID Uint256
 	if err := assetID.Deserialize(bytes.NewReader(tmp)); err != nil {
-		return ElaRpc("error: invalid asset hash")
+		return ElaRpcError(InvalidAsset, "invalid asset hash")
 	}
 	txn, err := MakeTransferTransaction(Wallet, assetID, fee, utxolock, batchOut)
 	if err != nil {
-		return ElaRpc("error: " + err.Error())
+		return ElaRpcError(InvalidTransaction, err.Error())
 	}
 
 	if errCode := VerifyAndSendTx(txn); errCode != Success {
-		return ElaRpc("error: " + errCode.Error())
+		return ElaRpcError(errCode, errCode.Error())
 	}
 	txHash := txn.Hash()
 	return ElaRpc(BytesToHexString(txHash.ToArrayReverse()))
 }
 
 func sendBatchOutTransaction(params []interface{}) map[string]interface{} {
-	if len(params) < 3 {
-		return ElaRpcNil
+	if len(params) < 4 {
+		return ElaRpcInvalidParameter
 	}
 	var asset, fee, utxolock string
 	var batchOutArray []interface{}
@@ -702,34 +1128,34 @@ func sendBatchOutTransaction(params []interface{}) map[string]interface{} {
 		return ElaRpcInvalidParameter
 	}
 	if Wallet == nil {
-		return ElaRpc("error : wallet is not opened")
+		return ElaRpcWalletNotOpened
 	}
 
 	content, err := json.Marshal(batchOutArray)
 	if err != nil {
-		return ElaRpc("error : batch out marshal failed")
+		return ElaRpcError(InvalidParams, "batch out marshal failed")
 	}
 	batchOut := []BatchOut{}
 	err = json.Unmarshal(content, &batchOut)
 	if err != nil {
-		return ElaRpc("error : batch out unmarshal failed")
+		return ElaRpcError(InvalidParams, "batch out unmarshal failed")
 	}
 
 	tmp, err := HexStringToBytesReverse(asset)
 	if err != nil {
-		return ElaRpc("error: invalid asset ID")
+		return ElaRpcError(InvalidParams, "invalid asset ID")
 	}
 	var assetID Uint256
 	if err := assetID.Deserialize(bytes.NewReader(tmp)); err != nil {
-		return ElaRpc("error: invalid asset hash")
+		return ElaRpcError(InvalidAsset, "invalid asset hash")
 	}
 	txn, err := MakeTransferTransaction(Wallet, assetID, fee, utxolock, batchOut...)
 	if err != nil {
-		return ElaRpc("error: " + err.Error())
+		return ElaRpcError(InvalidTransaction, err.Error())
 	}
 
 	if errCode := VerifyAndSendTx(txn); errCode != Success {
-		return ElaRpc("error: " + errCode.Error())
+		return ElaRpcError(errCode, errCode.Error())
 	}
 	txHash := txn.Hash()
 	return ElaRpc(BytesToHexString(txHash.ToArrayReverse()))
@@ -739,7 +1165,7 @@ func sendBatchOutTransaction(params []interface{}) map[string]interface{} {
 //   {"jsonrpc": "2.0", "method": "sendrawtransaction", "params": ["raw transactioin in hex"], "id": 0}
 func sendRawTransaction(params []interface{}) map[string]interface{} {
 	if len(params) < 1 {
-		return ElaRpcNil
+		return ElaRpcInvalidParameter
 	}
 	var hash Uint256
 	switch params[0].(type) {
@@ -755,7 +1181,7 @@ func sendRawTransaction(params []interface{}) map[string]interface{} {
 		}
 		hash = txn.Hash()
 		if errCode := VerifyAndSendTx(&txn); errCode != Success {
-			return ElaRpc(errCode.Error())
+			return ElaRpcError(errCode, errCode.Error())
 		}
 	default:
 		return ElaRpcInvalidParameter
@@ -765,20 +1191,35 @@ func sendRawTransaction(params []interface{}) map[string]interface{} {
 
 // A JSON example for submitblock method as following:
 //   {"jsonrpc": "2.0", "method": "submitblock", "params": ["raw block in hex"], "id": 0}
+// submitblock takes a block built by a miner, from a template of
+// getblocktemplate or of its own.
 func submitBlock(params []interface{}) map[string]interface{} {
 	if len(params) < 1 {
-		return ElaRpcNil
+		return ElaRpcInvalidParameter
 	}
 	switch params[0].(type) {
 	case string:
 		str := params[0].(string)
-		hex, _ := HexStringToBytes(str)
+		hex, err := HexStringToBytes(str)
+		if err != nil {
+			return ElaRpcInvalidParameter
+		}
 		var block ledger.Block
 		if err := block.Deserialize(bytes.NewReader(hex)); err != nil {
 			return ElaRpcInvalidBlock
 		}
-		if _, _, err := ledger.DefaultLedger.Blockchain.AddBlock(&block); err != nil {
-			return ElaRpcInvalidBlock
+		hash := block.Hash()
+		if exists, _ := ledger.DefaultLedger.Blockchain.BlockExists(&hash); exists ||
+			ledger.DefaultLedger.Blockchain.IsKnownOrphan(&hash) {
+			return ElaRpcError(Error, "duplicate")
+		}
+		_, isOrphan, err := ledger.DefaultLedger.Blockchain.AddBlock(&block)
+		if err != nil {
+			return ElaRpcError(Error, "rejected: "+err.Error())
+		}
+		// the previous block is unknown, the block is kept until it comes
+		if isOrphan {
+			return ElaRpc("inconclusive")
 		}
 		if err := node.Xmit(&block); err != nil {
 			return ElaRpcInternalError
@@ -791,7 +1232,7 @@ func submitBlock(params []interface{}) map[string]interface{} {
 
 func signMultiSignTransaction(params []interface{}) map[string]interface{} {
 	if len(params) < 1 {
-		return ElaRpcNil
+		return ElaRpcInvalidParameter
 	}
 	var signedrawtxn string
 	switch params[0].(type) {
@@ -805,12 +1246,12 @@ func signMultiSignTransaction(params []interface{}) map[string]interface{} {
 	var txn tx.Transaction
 	txn.Deserialize(bytes.NewReader(rawtxn))
 	if len(txn.Programs) <= 0 {
-		return ElaRpc("error: missing the first signature")
+		return ElaRpcError(InvalidTransaction, "missing the first signature")
 	}
 
 	_, needSign, err := txn.ParseTransactionSig()
 	if err != nil {
-		return ElaRpc("error: " + err.Error())
+		return ElaRpcError(InvalidTransaction, err.Error())
 	}
 
 	if needSign > 0 {
@@ -824,7 +1265,7 @@ func signMultiSignTransaction(params []interface{}) map[string]interface{} {
 		}
 
 		if acct == nil {
-			return ElaRpc("error: no available account detected")
+			return ElaRpcError(Error, "no available account detected")
 		} else {
 			sig, _ := signature.SignBySigner(&txn, acct)
 			txn.AppendNewSignature(sig)
@@ -838,7 +1279,7 @@ func signMultiSignTransaction(params []interface{}) map[string]interface{} {
 
 func createMultiSignTransaction(params []interface{}) map[string]interface{} {
 	if len(params) < 5 {
-		return ElaRpcNil
+		return ElaRpcInvalidParameter
 	}
 	var asset, from, address, value, fee string
 	switch params[0].(type) {
@@ -873,7 +1314,7 @@ func createMultiSignTransaction(params []interface{}) map[string]interface{} {
 	}
 
 	if Wallet == nil {
-		return ElaRpc("error : wallet is not opened")
+		return ElaRpcWalletNotOpened
 	}
 
 	batchOut := BatchOut{
@@ -882,15 +1323,15 @@ func createMultiSignTransaction(params []interface{}) map[string]interface{} {
 	}
 	tmp, err := HexStringToBytesReverse(asset)
 	if err != nil {
-		return ElaRpc("error: invalid asset ID")
+		return ElaRpcError(InvalidParams, "invalid asset ID")
 	}
 	var assetID Uint256
 	if err := assetID.Deserialize(bytes.NewReader(tmp)); err != nil {
-		return ElaRpc("error: invalid asset hash")
+		return ElaRpcError(InvalidAsset, "invalid asset hash")
 	}
 	txn, err := MakeMultisigTransferTransaction(Wallet, assetID, from, fee, batchOut)
 	if err != nil {
-		return ElaRpc("error:" + err.Error())
+		return ElaRpcError(InvalidTransaction, err.Error())
 	}
 
 	var buffer bytes.Buffer
@@ -899,7 +1340,7 @@ func createMultiSignTransaction(params []interface{}) map[string]interface{} {
 }
 func depositunlockTransaction(params []interface{}) map[string]interface{} {
 	if len(params) < 7 {
-		return ElaRpcNil
+		return ElaRpcInvalidParameter
 	}
 	var asset, from, address, key, value, fee, s string
 	switch params[0].(type) {
@@ -946,7 +1387,7 @@ func depositunlockTransaction(params []interface{}) map[string]interface{} {
 	}
 
 	if Wallet == nil {
-		return ElaRpc("error : wallet is not opened")
+		return ElaRpcWalletNotOpened
 	}
 
 	batchOut := BatchOut{
@@ -955,33 +1396,30 @@ func depositunlockTransaction(params []interface{}) map[string]interface{} {
 	}
 	tmp, err := HexStringToBytesReverse(asset)
 	if err != nil {
-		return ElaRpc("error: invalid asset ID")
+		return ElaRpcError(InvalidParams, "invalid asset ID")
 	}
 	var assetID Uint256
 	if err := assetID.Deserialize(bytes.NewReader(tmp)); err != nil {
-		return ElaRpc("error: invalid asset hash")
+		return ElaRpcError(InvalidAsset, "invalid asset hash")
 	}
 	txn, err := MakeScriptTransferTransaction(Wallet, assetID, from, fee, batchOut)
 	if err != nil {
-		return ElaRpc("error:" + err.Error())
+		return ElaRpcError(InvalidTransaction, err.Error())
 	}
 	//append code and parameter
 	byteKey, err := HexStringToBytes(key)
 	if err != nil {
-		fmt.Print("error: invalid public key")
-		return nil
+		return ElaRpcError(InvalidParams, "invalid public key")
 	}
 	rawKey, err := crypto.DecodePoint(byteKey)
 	if err != nil {
-		fmt.Print("error: invalid encoded public key")
-		return nil
+		return ElaRpcError(InvalidParams, "invalid encoded public key")
 	}
 	programs := make([]*program.Program, 1)
 	hash, _ := HexStringToBytes(s)
 	code, err := contract.CreateUnlockScriptRedeemScript(hash, rawKey, 100)
 	if err != nil {
-		fmt.Printf("error: %s\n", err.Error())
-		return nil
+		return ElaRpcError(InternalError, err.Error())
 	}
 	fmt.Printf("Code: %s\n", BytesToHexString(code))
 	programs[0] = &program.Program{
@@ -997,7 +1435,7 @@ func depositunlockTransaction(params []interface{}) map[string]interface{} {
 
 func withdrawTransaction(params []interface{}) map[string]interface{} {
 	if len(params) < 8 {
-		return ElaRpcNil
+		return ElaRpcInvalidParameter
 	}
 	var asset, from, address, keyA, keyS, value, fee, s string
 	switch params[0].(type) {
@@ -1050,7 +1488,7 @@ func withdrawTransaction(params []interface{}) map[string]interface{} {
 	}
 
 	if Wallet == nil {
-		return ElaRpc("error : wallet is not opened")
+		return ElaRpcWalletNotOpened
 	}
 
 	batchOut := BatchOut{
@@ -1059,43 +1497,38 @@ func withdrawTransaction(params []interface{}) map[string]interface{} {
 	}
 	tmp, err := HexStringToBytesReverse(asset)
 	if err != nil {
-		return ElaRpc("error: invalid asset ID")
+		return ElaRpcError(InvalidParams, "invalid asset ID")
 	}
 	var assetID Uint256
 	if err := assetID.Deserialize(bytes.NewReader(tmp)); err != nil {
-		return ElaRpc("error: invalid asset hash")
+		return ElaRpcError(InvalidAsset, "invalid asset hash")
 	}
 	txn, err := MakeScriptTransferTransaction(Wallet, assetID, from, fee, batchOut)
 	if err != nil {
-		return ElaRpc("error:" + err.Error())
+		return ElaRpcError(InvalidTransaction, err.Error())
 	}
 	//append code and parameter
 	byteKeyA, err := HexStringToBytes(keyA)
 	if err != nil {
-		fmt.Print("error: invalid public key")
-		return nil
+		return ElaRpcError(InvalidParams, "invalid public key")
 	}
 	rawKeyA, err := crypto.DecodePoint(byteKeyA)
 	if err != nil {
-		fmt.Print("error: invalid encoded public key")
-		return nil
+		return ElaRpcError(InvalidParams, "invalid encoded public key")
 	}
 	byteKeyS, err := HexStringToBytes(keyS)
 	if err != nil {
-		fmt.Print("error: invalid public key")
-		return nil
+		return ElaRpcError(InvalidParams, "invalid public key")
 	}
 	rawKeyS, err := crypto.DecodePoint(byteKeyS)
 	if err != nil {
-		fmt.Print("error: invalid encoded public key")
-		return nil
+		return ElaRpcError(InvalidParams, "invalid encoded public key")
 	}
 	programs := make([]*program.Program, 1)
 	hash, _ := HexStringToBytes(s)
 	code, err := contract.CreateWithdrawScriptRedeemScript(hash, rawKeyA, rawKeyS, 100)
 	if err != nil {
-		fmt.Printf("error: %s\n", err.Error())
-		return nil
+		return ElaRpcError(InternalError, err.Error())
 	}
 	fmt.Printf("Code: %s\n", BytesToHexString(code))
 	programs[0] = &program.Program{
@@ -1165,7 +1598,7 @@ func withdrawunlockTransaction(params []interface{}) map[string]interface{} {
 	}
 
 	if Wallet == nil {
-		return ElaRpc("error : wallet is not opened")
+		return ElaRpcWalletNotOpened
 	}
 
 	batchOut := BatchOut{
@@ -1174,43 +1607,38 @@ func withdrawunlockTransaction(params []interface{}) map[string]interface{} {
 	}
 	tmp, err := HexStringToBytesReverse(asset)
 	if err != nil {
-		return ElaRpc("error: invalid asset ID")
+		return ElaRpcError(InvalidParams, "invalid asset ID")
 	}
 	var assetID Uint256
 	if err := assetID.Deserialize(bytes.NewReader(tmp)); err != nil {
-		return ElaRpc("error: invalid asset hash")
+		return ElaRpcError(InvalidAsset, "invalid asset hash")
 	}
 	txn, err := MakeScriptTransferTransaction(Wallet, assetID, from, fee, batchOut)
 	if err != nil {
-		return ElaRpc("error:" + err.Error())
+		return ElaRpcError(InvalidTransaction, err.Error())
 	}
 	//append code and parameter
 	byteKeyA, err := HexStringToBytes(keyA)
 	if err != nil {
-		fmt.Print("error: invalid public key")
-		return nil
+		return ElaRpcError(InvalidParams, "invalid public key")
 	}
 	rawKeyA, err := crypto.DecodePoint(byteKeyA)
 	if err != nil {
-		fmt.Print("error: invalid encoded public key")
-		return nil
+		return ElaRpcError(InvalidParams, "invalid encoded public key")
 	}
 	byteKeyS, err := HexStringToBytes(keyS)
 	if err != nil {
-		fmt.Print("error: invalid public key")
-		return nil
+		return ElaRpcError(InvalidParams, "invalid public key")
 	}
 	rawKeyS, err := crypto.DecodePoint(byteKeyS)
 	if err != nil {
-		fmt.Print("error: invalid encoded public key")
-		return nil
+		return ElaRpcError(InvalidParams, "invalid encoded public key")
 	}
 	programs := make([]*program.Program, 1)
 	hash, _ := HexStringToBytes(s)
 	code, err := contract.CreateWithdrawUnlockScriptRedeemScript(hash, rawKeyS, rawKeyA, 1000)
 	if err != nil {
-		fmt.Printf("error: %s\n", err.Error())
-		return nil
+		return ElaRpcError(InternalError, err.Error())
 	}
 
 	fmt.Printf("Code: %s\n", BytesToHexString(code))
@@ -1280,7 +1708,7 @@ func deposittosideTransaction(params []interface{}) map[string]interface{} {
 	}
 
 	if Wallet == nil {
-		return ElaRpc("error : wallet is not opened")
+		return ElaRpcWalletNotOpened
 	}
 
 	batchOut := BatchOut{
@@ -1289,44 +1717,39 @@ func deposittosideTransaction(params []interface{}) map[string]interface{} {
 	}
 	tmp, err := HexStringToBytesReverse(asset)
 	if err != nil {
-		return ElaRpc("error: invalid asset ID")
+		return ElaRpcError(InvalidParams, "invalid asset ID")
 	}
 	var assetID Uint256
 	if err := assetID.Deserialize(bytes.NewReader(tmp)); err != nil {
-		return ElaRpc("error: invalid asset hash")
+		return ElaRpcError(InvalidAsset, "invalid asset hash")
 	}
 	txn, err := MakeScriptTransferTransaction(Wallet, assetID, from, fee, batchOut)
 	if err != nil {
-		return ElaRpc("error:" + err.Error())
+		return ElaRpcError(InvalidTransaction, err.Error())
 	}
 	//append code and parameter
 	byteKeyA, err := HexStringToBytes(keyA)
 	if err != nil {
-		fmt.Print("error: invalid public key")
-		return nil
+		return ElaRpcError(InvalidParams, "invalid public key")
 	}
 	rawKeyA, err := crypto.DecodePoint(byteKeyA)
 	if err != nil {
-		fmt.Print("error: invalid encoded public key")
-		return nil
+		return ElaRpcError(InvalidParams, "invalid encoded public key")
 	}
 	byteKeyS, err := HexStringToBytes(keyS)
 	if err != nil {
-		fmt.Print("error: invalid public key")
-		return nil
+		return ElaRpcError(InvalidParams, "invalid public key")
 	}
 	rawKeyS, err := crypto.DecodePoint(byteKeyS)
 	if err != nil {
-		fmt.Print("error: invalid encoded public key")
-		return nil
+		return ElaRpcError(InvalidParams, "invalid encoded public key")
 	}
 
 	programs := make([]*program.Program, 1)
 	hash, _ := HexStringToBytes(s)
 	code, err := contract.CreateDepositScriptRedeemScript(hash, rawKeyS, rawKeyA, 1000)
 	if err != nil {
-		fmt.Printf("error: %s\n", err.Error())
-		return nil
+		return ElaRpcError(InternalError, err.Error())
 	}
 
 	fmt.Printf("Code: %s\n", BytesToHexString(code))
@@ -1424,7 +1847,7 @@ func MakeScriptTransferTransaction(wallet account.Client, assetID Uint256, from
 
 func createBatchOutMultiSignTransaction(params []interface{}) map[string]interface{} {
 	if len(params) < 4 {
-		return ElaRpcNil
+		return ElaRpcInvalidParameter
 	}
 	var asset, from, fee string
 	var batchOutArray []interface{}
@@ -1453,31 +1876,31 @@ func createBatchOutMultiSignTransaction(params []interface{}) map[string]interfa
 		return ElaRpcInvalidParameter
 	}
 	if Wallet == nil {
-		return ElaRpc("error : wallet is not opened")
+		return ElaRpcWalletNotOpened
 	}
 
 	content, err := json.Marshal(batchOutArray)
 	if err != nil {
-		return ElaRpc("error : batch out marshal failed")
+		return ElaRpcError(InvalidParams, "batch out marshal failed")
 	}
 	batchOut := []BatchOut{}
 	err = json.Unmarshal(content, &batchOut)
 	if err != nil {
-		return ElaRpc("error : batch out unmarshal failed")
+		return ElaRpcError(InvalidParams, "batch out unmarshal failed")
 	}
 
 	tmp, err := HexStringToBytesReverse(asset)
 	if err != nil {
-		return ElaRpc("error: invalid asset ID")
+		return ElaRpcError(InvalidParams, "invalid asset ID")
 	}
 	var assetID Uint256
 	if err := assetID.Deserialize(bytes.NewReader(tmp)); err != nil {
-		return ElaRpc("error: invalid asset hash")
+		return ElaRpcError(InvalidAsset, "invalid asset hash")
 	}
 
 	txn, err := MakeMultisigTransferTransaction(Wallet, assetID, from, fee, batchOut...)
 	if err != nil {
-		return ElaRpc("error:" + err.Error())
+		return ElaRpcError(InvalidTransaction, err.Error())
 	}
 
 	var buffer bytes.Buffer
@@ -1485,6 +1908,179 @@ func createBatchOutMultiSignTransaction(params []interface{}) map[string]interfa
 	return ElaRpc(BytesToHexString(buffer.Bytes()))
 }
 
+// A JSON example for createunsignedtransaction method as following:
+//   {"jsonrpc": "2.0", "method": "createunsignedtransaction", "params": ["asset", "from", [{"Address": "address", "Value": "value"}], "fee"], "id": 0}
+// from is a watch-only address of the wallet, the transaction is returned in
+// a partial transaction with what an offline signer needs to sign it.
+func createUnsignedTransaction(params []interface{}) map[string]interface{} {
+	if len(params) < 4 {
+		return ElaRpcInvalidParameter
+	}
+	var asset, from, fee string
+	var batchOutArray []interface{}
+	switch params[0].(type) {
+	case string:
+		asset = params[0].(string)
+	default:
+		return ElaRpcInvalidParameter
+	}
+	switch params[1].(type) {
+	case string:
+		from = params[1].(string)
+	default:
+		return ElaRpcInvalidParameter
+	}
+	switch params[2].(type) {
+	case []interface{}:
+		batchOutArray = params[2].([]interface{})
+	default:
+		return ElaRpcInvalidParameter
+	}
+	switch params[3].(type) {
+	case string:
+		fee = params[3].(string)
+	default:
+		return ElaRpcInvalidParameter
+	}
+	if Wallet == nil {
+		return ElaRpcWalletNotOpened
+	}
+
+	content, err := json.Marshal(batchOutArray)
+	if err != nil {
+		return ElaRpcError(InvalidParams, "batch out marshal failed")
+	}
+	batchOut := []BatchOut{}
+	err = json.Unmarshal(content, &batchOut)
+	if err != nil {
+		return ElaRpcError(InvalidParams, "batch out unmarshal failed")
+	}
+
+	tmp, err := HexStringToBytesReverse(asset)
+	if err != nil {
+		return ElaRpcError(InvalidParams, "invalid asset ID")
+	}
+	var assetID Uint256
+	if err := assetID.Deserialize(bytes.NewReader(tmp)); err != nil {
+		return ElaRpcError(InvalidAsset, "invalid asset hash")
+	}
+
+	txn, err := MakeWatchOnlyTransferTransaction(Wallet, assetID, from, fee, batchOut...)
+	if err != nil {
+		return ElaRpcError(InvalidTransaction, err.Error())
+	}
+	ptx, err := MakePartialTransaction(Wallet, txn)
+	if err != nil {
+		return ElaRpcError(InvalidTransaction, err.Error())
+	}
+
+	var buffer bytes.Buffer
+	if err := ptx.Serialize(&buffer); err != nil {
+		return ElaRpcError(InvalidTransaction, err.Error())
+	}
+	return ElaRpc(BytesToHexString(buffer.Bytes()))
+}
+
+// MakePartialTransaction puts an unsigned transaction in a partial transaction
+// with the transactions it spends and the redeem scripts the wallet knows.
+func MakePartialTransaction(wallet account.Client, txn *transaction.Transaction) (*transaction.PartialTransaction, error) {
+	var prevTransactions []*transaction.Transaction
+	added := make(map[Uint256]bool)
+	redeemScripts := make(map[Uint168][]byte)
+	for _, input := range txn.UTXOInputs {
+		prev, _, err := ledger.DefaultLedger.Store.GetTransaction(input.ReferTxID)
+		if err != nil {
+			return nil, errors.New("unknown transaction input")
+		}
+		if int(input.ReferTxOutputIndex) >= len(prev.Outputs) {
+			return nil, errors.New("unknown transaction input")
+		}
+		if !added[input.ReferTxID] {
+			added[input.ReferTxID] = true
+			prevTransactions = append(prevTransactions, prev)
+		}
+		output := prev.Outputs[input.ReferTxOutputIndex]
+		if script := wallet.GetRedeemScript(output.ProgramHash); script != nil {
+			redeemScripts[output.ProgramHash] = script
+		}
+	}
+	return transaction.NewPartialTransaction(txn, prevTransactions, redeemScripts)
+}
+
+// MakeWatchOnlyTransferTransaction spends the coins of a watch-only address,
+// the changes go back to it. The transaction is not signed.
+func MakeWatchOnlyTransferTransaction(wallet account.Client, assetID Uint256, from string, fee string, batchOut ...BatchOut) (*transaction.Transaction, error) {
+	if len(batchOut) == 0 {
+		return nil, errors.New("nil outputs")
+	}
+	spendAddress, err := ToScriptHash(from)
+	if err != nil {
+		return nil, errors.New("invalid sender address")
+	}
+
+	var expected Fixed64
+	input := []*transaction.UTXOTxInput{}
+	output := []*transaction.TxOutput{}
+	txnfee, err := StringToFixed64(fee)
+	if err != nil || txnfee <= 0 {
+		return nil, errors.New("invalid transation fee")
+	}
+	expected += txnfee
+	// construct transaction outputs
+	for _, o := range batchOut {
+		outputValue, err := StringToFixed64(o.Value)
+		if err != nil {
+			return nil, err
+		}
+		expected += outputValue
+		address, err := ToScriptHash(o.Address)
+		if err != nil {
+			return nil, errors.New("invalid receiver address")
+		}
+		output = append(output, &transaction.TxOutput{
+			AssetID:     assetID,
+			Value:       outputValue,
+			ProgramHash: address,
+		})
+	}
+	// construct transaction inputs and changes
+	sorted := sortAvailableCoinsByValue(wallet.GetCoins(), account.WatchOnly)
+	for _, coinItem := range sorted {
+		if coinItem.coin.Output.AssetID != assetID || coinItem.coin.Output.ProgramHash != spendAddress {
+			continue
+		}
+		input = append(input, coinItem.input)
+		if coinItem.coin.Output.Value > expected {
+			// if any, the changes output of transaction will be the last one
+			output = append(output, &transaction.TxOutput{
+				AssetID:     assetID,
+				Value:       coinItem.coin.Output.Value - expected,
+				ProgramHash: spendAddress,
+			})
+			expected = 0
+			break
+		}
+		expected -= coinItem.coin.Output.Value
+		if expected == 0 {
+			break
+		}
+	}
+	if expected > 0 {
+		return nil, errors.New("available token is not enough")
+	}
+
+	// construct transaction
+	txn, err := transaction.NewTransferAssetTransaction(input, output)
+	if err != nil {
+		return nil, err
+	}
+	txAttr := transaction.NewTxAttribute(transaction.Nonce, []byte(strconv.FormatInt(rand.Int63(), 10)))
+	txn.Attributes = make([]*transaction.TxAttribute, 0)
+	txn.Attributes = append(txn.Attributes, &txAttr)
+
+	return txn, nil
+}
+
 func MakeTransferTransaction(wallet account.Client, assetID Uint256, fee string, lock string, batchOut ...BatchOut) (*transaction.Transaction, error) {
 	// get main account which is used to receive changes
 	mainAccount, err := wallet.GetDefaultAccount()
@@ -1691,8 +2287,8 @@ func sortAvailableCoinsByValue(coins map[*transaction.UTXOTxInput]*account.Coin,
 }
 
 func deposittransaction(params []interface{}) map[string]interface{} {
-	if len(params) < 5 {
-		return ElaRpcNil
+	if len(params) < 6 {
+		return ElaRpcInvalidParameter
 	}
 	var asset, from, address, value, fee, s string
 	switch params[0].(type) {
@@ -1733,7 +2329,7 @@ func deposittransaction(params []interface{}) map[string]interface{} {
 	}
 
 	if Wallet == nil {
-		return ElaRpc("error : wallet is not opened")
+		return ElaRpcWalletNotOpened
 	}
 
 	batchOut := BatchOut{
@@ -1743,15 +2339,15 @@ func deposittransaction(params []interface{}) map[string]interface{} {
 
 	tmp, err := HexStringToBytesReverse(asset)
 	if err != nil {
-		return ElaRpc("error: invalid asset ID")
+		return ElaRpcError(InvalidParams, "invalid asset ID")
 	}
 	var assetID Uint256
 	if err := assetID.Deserialize(bytes.NewReader(tmp)); err != nil {
-		return ElaRpc("error: invalid asset hash")
+		return ElaRpcError(InvalidAsset, "invalid asset hash")
 	}
 	txn, err := MakedepositTransaction(Wallet, assetID, from, fee, s, batchOut)
 	if err != nil {
-		return ElaRpc("error:" + err.Error())
+		return ElaRpcError(InvalidTransaction, err.Error())
 	}
 
 	var buffer bytes.Buffer
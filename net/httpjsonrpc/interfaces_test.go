@@ -0,0 +1,165 @@
+package httpjsonrpc
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"Elastos.ELA/account"
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/core/ledger"
+	"Elastos.ELA/core/transaction"
+	"Elastos.ELA/core/transaction/payload"
+)
+
+// testBlockStore knows the blocks of the set only, and the main chain
+// hashes of the heights.
+type testBlockStore struct {
+	ledger.ILedgerStore
+	blocks map[Uint256]bool
+	hashes map[uint32]Uint256
+}
+
+func (s *testBlockStore) IsBlockInStore(hash Uint256) bool { return s.blocks[hash] }
+
+func (s *testBlockStore) GetBlockHash(height uint32) (Uint256, error) {
+	hash, ok := s.hashes[height]
+	if !ok {
+		return Uint256{}, errors.New("unknown height")
+	}
+	return hash, nil
+}
+
+func newTestSubmitBlock(timestamp uint32) (*ledger.Block, string) {
+	coinbase, _ := transaction.NewCoinBaseTransaction(&payload.CoinBase{}, 1)
+	block := &ledger.Block{
+		Blockdata:    &ledger.Blockdata{PrevBlockHash: Uint256{1}, Timestamp: timestamp, Height: 1},
+		Transactions: []*transaction.Transaction{coinbase},
+	}
+	block.RebuildMerkleRoot()
+	var buf bytes.Buffer
+	block.Serialize(&buf)
+	return block, BytesToHexString(buf.Bytes())
+}
+
+// rpcErrorMessage returns the message of the error response, "" for a result.
+func rpcErrorMessage(response map[string]interface{}) string {
+	if err, ok := response["error"].(*RpcError); ok {
+		return err.Message
+	}
+	return ""
+}
+
+func TestSortAvailableCoins(t *testing.T) {
+	saved := ledger.DefaultLedger
+	ledger.DefaultLedger = &ledger.Ledger{Blockchain: &ledger.Blockchain{BlockHeight: 10}}
+	defer func() { ledger.DefaultLedger = saved }()
+
+	coin := func(value Fixed64, addrType account.AddressType, height uint32) *account.Coin {
+		return &account.Coin{Output: &transaction.TxOutput{Value: value}, AddressType: addrType, Height: height}
+	}
+	coins := map[*transaction.UTXOTxInput]*account.Coin{
+		{ReferTxID: Uint256{1}}: coin(5, account.SingleSign, 0),
+		{ReferTxID: Uint256{2}}: coin(3, account.SingleSign, 10),
+		{ReferTxID: Uint256{3}}: coin(1, account.WatchOnly, 0),
+		{ReferTxID: Uint256{4}}: coin(2, account.MultiSign, 0),
+		// immature coinbase
+		{ReferTxID: Uint256{5}}: coin(4, account.SingleSign, 11),
+		{ReferTxID: Uint256{6}}: coin(6, account.WatchOnly, 0),
+	}
+
+	// the wallet does not spend watch-only coins
+	sorted := sortAvailableCoinsByValue(coins, account.SingleSign)
+	if len(sorted) != 2 || sorted[0].coin.Output.Value != 3 || sorted[1].coin.Output.Value != 5 {
+		t.Fatalf("single sign coins are %v, want the mature ones smallest first", sorted)
+	}
+	for _, item := range sorted {
+		if item.coin.AddressType == account.WatchOnly {
+			t.Fatal("watch-only coin is selected")
+		}
+	}
+
+	// they are only spent in unsigned transactions of the watched address
+	sorted = sortAvailableCoinsByValue(coins, account.WatchOnly)
+	if len(sorted) != 2 || sorted[0].coin.Output.Value != 1 || sorted[1].coin.Output.Value != 6 {
+		t.Fatalf("watch-only coins are %v, want 1 and 6", sorted)
+	}
+}
+
+func TestSubmitBlockRejected(t *testing.T) {
+	log.Init()
+	saved := ledger.DefaultLedger
+	defer func() { ledger.DefaultLedger = saved }()
+	store := &testBlockStore{blocks: make(map[Uint256]bool)}
+	ledger.DefaultLedger = &ledger.Ledger{Store: store}
+	ledger.DefaultLedger.Blockchain = ledger.NewBlockchain(0, ledger.DefaultLedger)
+
+	known, knownHex := newTestSubmitBlock(1514000000)
+	store.blocks[known.Hash()] = true
+	orphan, orphanHex := newTestSubmitBlock(1514000001)
+	ledger.DefaultLedger.Blockchain.Orphans[orphan.Hash()] = &ledger.OrphanBlock{Block: orphan}
+	_, invalidHex := newTestSubmitBlock(1514000002)
+
+	for _, c := range []struct {
+		name   string
+		params []interface{}
+		want   string
+	}{
+		{"no block", nil, "invalid parameter"},
+		{"not a string", []interface{}{1}, "invalid parameter"},
+		{"not hex", []interface{}{"xyz"}, "invalid parameter"},
+		{"truncated", []interface{}{knownHex[:20]}, "invalid block"},
+		{"known block", []interface{}{knownHex}, "duplicate"},
+		{"known orphan", []interface{}{orphanHex}, "duplicate"},
+		// the proof of work of the block is missing
+		{"invalid block", []interface{}{invalidHex}, "rejected: "},
+	} {
+		message := rpcErrorMessage(submitBlock(c.params))
+		if message == "" || !strings.HasPrefix(message, c.want) {
+			t.Errorf("submit of %s returns %q, want %q", c.name, message, c.want)
+		}
+	}
+	if len(ledger.DefaultLedger.Blockchain.Orphans) != 1 {
+		t.Fatal("rejected block is kept as an orphan")
+	}
+}
+
+func TestVerifyTxOutProofRejected(t *testing.T) {
+	log.Init()
+	saved := ledger.DefaultLedger
+	defer func() { ledger.DefaultLedger = saved }()
+	store := &testBlockStore{hashes: make(map[uint32]Uint256)}
+	ledger.DefaultLedger = &ledger.Ledger{Store: store}
+
+	block, _ := newTestSubmitBlock(1514000000)
+	proof, err := ledger.NewTxProof(block, block.Transactions[0].Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	proof.Serialize(&buf)
+	proofHex := BytesToHexString(buf.Bytes())
+	proof.Txid = Uint256{0x01}
+	buf.Reset()
+	proof.Serialize(&buf)
+	tamperedHex := BytesToHexString(buf.Bytes())
+
+	// the block of the proof is not in the main chain
+	store.hashes[1] = Uint256{0x02}
+	for _, c := range []struct {
+		name   string
+		params []interface{}
+		want   string
+	}{
+		{"no proof", nil, "invalid parameter"},
+		{"tampered", []interface{}{tamperedHex}, "invalid proof: "},
+		{"not in main chain", []interface{}{proofHex}, "invalid proof: block not found in main chain"},
+	} {
+		message := rpcErrorMessage(verifyTxOutProof(c.params))
+		if message == "" || !strings.HasPrefix(message, c.want) {
+			t.Errorf("verify of %s returns %q, want %q", c.name, message, c.want)
+		}
+	}
+}
@@ -1,25 +1,70 @@
 package httpjsonrpc
 
+import (
+	. "Elastos.ELA/errors"
+)
+
 var (
-	ElaRpcInvalidHash        = responsePacking("invalid hash")
-	ElaRpcInvalidBlock       = responsePacking("invalid block")
-	ElaRpcInvalidTransaction = responsePacking("invalid transaction")
-	ElaRpcInvalidParameter   = responsePacking("invalid parameter")
+	ElaRpcInvalidHash        = ElaRpcError(InvalidParams, "invalid hash")
+	ElaRpcInvalidBlock       = ElaRpcError(Error, "invalid block")
+	ElaRpcInvalidTransaction = ElaRpcError(InvalidTransaction, "invalid transaction")
+	ElaRpcInvalidParameter   = ElaRpcError(InvalidParams, "invalid parameter")
 
-	ElaRpcUnknownBlock       = responsePacking("unknown block")
-	ElaRpcUnknownTransaction = responsePacking("unknown transaction")
+	ElaRpcUnknownBlock       = ElaRpcError(UnknownBlock, "unknown block")
+	ElaRpcUnknownTransaction = ElaRpcError(UnknownTransaction, "unknown transaction")
 
 	ElaRpcNil           = responsePacking(nil)
-	ElaRpcUnsupported   = responsePacking("Unsupported")
-	ElaRpcInternalError = responsePacking("internal error")
-	ElaRpcIOError       = responsePacking("internal IO error")
-	ElaRpcAPIError      = responsePacking("internal API error")
+	ElaRpcUnsupported   = ElaRpcError(InvalidMethod, "Unsupported")
+	ElaRpcInternalError = ElaRpcError(InternalError, "internal error")
+	ElaRpcIOError       = ElaRpcError(InternalError, "internal IO error")
+	ElaRpcAPIError      = ElaRpcError(InternalError, "internal API error")
 	ElaRpcSuccess       = responsePacking(true)
 	ElaRpcFailed        = responsePacking(false)
 
 	// error code for wallet
-	ElaRpcWalletAlreadyExists = responsePacking("wallet already exist")
-	ElaRpcWalletNotExists     = responsePacking("wallet doesn't exist")
+	ElaRpcWalletAlreadyExists = ElaRpcError(Error, "wallet already exist")
+	ElaRpcWalletNotExists     = ElaRpcError(Error, "wallet doesn't exist")
+	ElaRpcWalletNotOpened     = ElaRpcError(Error, "wallet is not opened")
 
 	ElaRpc = responsePacking
 )
+
+// JSON-RPC 2.0 reserved error codes
+const (
+	RpcParseError     = -32700
+	RpcInvalidRequest = -32600
+	RpcMethodNotFound = -32601
+	RpcInvalidParams  = -32602
+	RpcInternalError  = -32603
+
+	// implementation defined server errors
+	RpcMethodNotAllowed = -32000
+)
+
+type RpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// ElaRpcError packs an error response of a rpc handler, the error code of
+// the response is mapped from code.
+func ElaRpcError(code ErrCode, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"error": &RpcError{Code: rpcErrorCode(code), Message: message},
+	}
+}
+
+// rpcErrorCode maps the node error codes which have a counterpart among the
+// reserved codes to it, the others are kept as they are.
+func rpcErrorCode(code ErrCode) int {
+	switch code {
+	case InvalidMethod:
+		return RpcMethodNotFound
+	case InvalidParams:
+		return RpcInvalidParams
+	case InternalError:
+		return RpcInternalError
+	}
+	return int(code)
+}
@@ -0,0 +1,79 @@
+package httpmetrics
+
+import (
+	"Elastos.ELA/common/config"
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/common/metrics"
+	"Elastos.ELA/core/ledger"
+	. "Elastos.ELA/net/protocol"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+var stateNames = map[uint32]string{
+	INIT:       "init",
+	HAND:       "hand",
+	HANDSHAKE:  "handshake",
+	HANDSHAKED: "handshaked",
+	ESTABLISH:  "establish",
+	INACTIVITY: "inactivity",
+}
+
+func registerGauges(node Noder) {
+	metrics.NewGaugeFunc("ela_chain_height", "Height of the best block.", func() float64 {
+		return float64(ledger.DefaultLedger.Blockchain.BlockHeight)
+	})
+	metrics.NewGaugeFunc("ela_header_height", "Height of the best known header.", func() float64 {
+		return float64(ledger.DefaultLedger.Store.GetHeaderHeight())
+	})
+	metrics.NewGaugeFunc("ela_orphan_blocks", "Blocks waiting for their parent.", func() float64 {
+		return float64(ledger.DefaultLedger.Blockchain.GetOrphanCount())
+	})
+	metrics.NewGaugeFunc("ela_mempool_transactions", "Transactions in the pool.", func() float64 {
+		return float64(node.GetTransactionCount())
+	})
+	metrics.NewGaugeFunc("ela_mempool_bytes", "Serialized size of the transactions in the pool.", func() float64 {
+		return float64(node.GetTxnPoolSize())
+	})
+	metrics.NewGaugeVecFunc("ela_peers", "Neighbor connections by state.", "state", func() map[string]float64 {
+		values := make(map[string]float64)
+		for _, name := range stateNames {
+			values[name] = 0
+		}
+		for state, count := range node.GetNbrStateCnt() {
+			name, ok := stateNames[state]
+			if !ok {
+				name = strconv.Itoa(int(state))
+			}
+			values[name] = float64(count)
+		}
+		return values
+	})
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics.WriteAll(w)
+}
+
+// DefaultAddress is the address the metrics server binds to when
+// HttpMetricsAddress is not set, the metrics tell about the peers and the
+// pool so they are not served to other hosts unless configured.
+const DefaultAddress = "127.0.0.1"
+
+// StartServer serves the metrics in the Prometheus text format on /metrics.
+func StartServer(node Noder) {
+	registerGauges(node)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsHandler)
+	host := config.Parameters.HttpMetricsAddress
+	if host == "" {
+		host = DefaultAddress
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(config.Parameters.HttpMetricsPort)))
+	log.Info("Metrics server listening on ", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Error("Metrics server error: ", err)
+	}
+}
@@ -104,19 +104,25 @@ func GetTotalIssued(cmd map[string]interface{}) map[string]interface{} {
 	return resp
 }
 */
-func GetBlockInfo(block *ledger.Block) BlockInfo {
-	hash := block.Hash()
-	blockHead := &BlockHead{
-		Version:          block.Blockdata.Version,
-		PrevBlockHash:    BytesToHexString(block.Blockdata.PrevBlockHash.ToArrayReverse()),
-		TransactionsRoot: BytesToHexString(block.Blockdata.TransactionsRoot.ToArrayReverse()),
-		Bits:             block.Blockdata.Bits,
-		Timestamp:        block.Blockdata.Timestamp,
-		Height:           block.Blockdata.Height,
-		Nonce:            block.Blockdata.Nonce,
+// GetBlockHead returns the header fields of the block info.
+func GetBlockHead(blockdata *ledger.Blockdata) *BlockHead {
+	hash := blockdata.Hash()
+	return &BlockHead{
+		Version:          blockdata.Version,
+		PrevBlockHash:    BytesToHexString(blockdata.PrevBlockHash.ToArrayReverse()),
+		TransactionsRoot: BytesToHexString(blockdata.TransactionsRoot.ToArrayReverse()),
+		Bits:             blockdata.Bits,
+		Timestamp:        blockdata.Timestamp,
+		Height:           blockdata.Height,
+		Nonce:            blockdata.Nonce,
 
 		Hash: BytesToHexString(hash.ToArrayReverse()),
 	}
+}
+
+func GetBlockInfo(block *ledger.Block) BlockInfo {
+	hash := block.Hash()
+	blockHead := GetBlockHead(block.Blockdata)
 
 	trans := make([]*Transactions, len(block.Transactions))
 	for i := 0; i < len(block.Transactions); i++ {
@@ -139,6 +145,33 @@ func GetBlockInfo(block *ledger.Block) BlockInfo {
 	}
 	return b
 }
+
+// ReorganizeInfo is the reorganization notified to the websocket sessions and
+// the notice server, the hashes are in the order of ledger.ReorganizeEvent.
+type ReorganizeInfo struct {
+	ForkHash   string
+	ForkHeight uint32
+	Detached   []string
+	Attached   []string
+}
+
+// GetReorganizeInfo converts the event to the hashes shown to the clients.
+func GetReorganizeInfo(event *ledger.ReorganizeEvent) ReorganizeInfo {
+	info := ReorganizeInfo{
+		ForkHash:   BytesToHexString(event.ForkHash.ToArrayReverse()),
+		ForkHeight: event.ForkHeight,
+		Detached:   make([]string, len(event.Detached)),
+		Attached:   make([]string, len(event.Attached)),
+	}
+	for i, hash := range event.Detached {
+		info.Detached[i] = BytesToHexString(hash.ToArrayReverse())
+	}
+	for i, hash := range event.Attached {
+		info.Attached[i] = BytesToHexString(hash.ToArrayReverse())
+	}
+	return info
+}
+
 func GetBlockTransactions(block *ledger.Block) interface{} {
 	trans := make([]string, len(block.Transactions))
 	for i := 0; i < len(block.Transactions); i++ {
@@ -416,6 +449,83 @@ func GetUnspendOutput(cmd map[string]interface{}) map[string]interface{} {
 	resp["Result"] = UTXOoutputs
 	return resp
 }
+func GetAddressHistory(cmd map[string]interface{}) map[string]interface{} {
+	resp := ResponsePack(Success)
+	addr, ok := cmd["Addr"].(string)
+	if !ok {
+		resp["Error"] = InvalidParams
+		return resp
+	}
+	var offset, limit uint64
+	if param, ok := cmd["Offset"].(string); ok && len(param) > 0 {
+		var err error
+		if offset, err = strconv.ParseUint(param, 10, 32); err != nil {
+			resp["Error"] = InvalidParams
+			return resp
+		}
+	}
+	if param, ok := cmd["Limit"].(string); ok && len(param) > 0 {
+		var err error
+		if limit, err = strconv.ParseUint(param, 10, 32); err != nil {
+			resp["Error"] = InvalidParams
+			return resp
+		}
+	}
+	info, err := GetAddressHistoryInfo(addr, uint32(offset), uint32(limit))
+	if err != nil {
+		resp["Error"] = InvalidParams
+		return resp
+	}
+	resp["Result"] = info
+	return resp
+}
+
+func GetTransactionProof(cmd map[string]interface{}) map[string]interface{} {
+	resp := ResponsePack(Success)
+
+	str, ok := cmd["Hash"].(string)
+	if !ok {
+		resp["Error"] = InvalidParams
+		return resp
+	}
+	bys, err := HexStringToBytesReverse(str)
+	if err != nil {
+		resp["Error"] = InvalidParams
+		return resp
+	}
+	var txid Uint256
+	if err := txid.Deserialize(bytes.NewReader(bys)); err != nil {
+		resp["Error"] = InvalidTransaction
+		return resp
+	}
+
+	var blockHash *Uint256
+	if str, ok := cmd["Blockhash"].(string); ok && len(str) > 0 {
+		bys, err := HexStringToBytesReverse(str)
+		if err != nil {
+			resp["Error"] = InvalidParams
+			return resp
+		}
+		blockHash = new(Uint256)
+		if err := blockHash.Deserialize(bytes.NewReader(bys)); err != nil {
+			resp["Error"] = InvalidParams
+			return resp
+		}
+	}
+
+	proof, err := GetTxOutProof(txid, blockHash)
+	if err != nil {
+		resp["Error"] = UnknownTransaction
+		return resp
+	}
+	w := bytes.NewBuffer(nil)
+	if err := proof.Serialize(w); err != nil {
+		resp["Error"] = InternalError
+		return resp
+	}
+	resp["Result"] = BytesToHexString(w.Bytes())
+	return resp
+}
 
 //Transaction
 func GetTransactionByHash(cmd map[string]interface{}) map[string]interface{} {
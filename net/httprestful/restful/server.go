@@ -42,11 +42,13 @@ const (
 	Api_Getblockhash        = "/api/v1/block/hash/:height"
 	Api_GetTotalIssued      = "/api/v1/totalissued/:assetid"
 	Api_Gettransaction      = "/api/v1/transaction/:hash"
+	Api_GetTxOutProof       = "/api/v1/transaction/proof/:hash"
 	Api_Getasset            = "/api/v1/asset/:hash"
 	Api_GetBalanceByAddr    = "/api/v1/asset/balances/:addr"
 	Api_GetBalancebyAsset   = "/api/v1/asset/balance/:addr/:assetid"
 	Api_GetUTXObyAsset      = "/api/v1/asset/utxo/:addr/:assetid"
 	Api_GetUTXObyAddr       = "/api/v1/asset/utxos/:addr"
+	Api_GetAddressHistory   = "/api/v1/asset/history/:addr"
 	Api_SendRawTx           = "/api/v1/transaction"
 	Api_GetTransactionPool  = "/api/v1/transactionpool"
 	Api_SendRcdTxByTrans    = "/api/v1/custom/transaction/record"
@@ -149,12 +151,14 @@ func (rt *restServer) registryMethod() {
 		Api_GetTransactionPool:  {name: "gettransactionpool", handler: GetTransactionPool},
 		//Api_GetTotalIssued:      {name: "gettotalissued", handler: GetTotalIssued},
 		Api_Gettransaction:    {name: "gettransaction", handler: GetTransactionByHash},
+		Api_GetTxOutProof:     {name: "gettxoutproof", handler: GetTransactionProof},
 		Api_Getasset:          {name: "getasset", handler: GetAssetByHash},
 		Api_GetContract:       {name: "getcontract", handler: GetContract},
 		Api_GetUTXObyAddr:     {name: "getutxobyaddr", handler: GetUnspends},
 		Api_GetUTXObyAsset:    {name: "getutxobyasset", handler: GetUnspendOutput},
 		Api_GetBalanceByAddr:  {name: "getbalancebyaddr", handler: GetBalanceByAddr},
 		Api_GetBalancebyAsset: {name: "getbalancebyasset", handler: GetBalanceByAsset},
+		Api_GetAddressHistory: {name: "getaddresshistory", handler: GetAddressHistory},
 		Api_OauthServerUrl:    {name: "getoauthserverurl", handler: GetOauthServerUrl},
 		Api_NoticeServerUrl:   {name: "getnoticeserverurl", handler: GetNoticeServerUrl},
 		Api_Restart:           {name: "restart", handler: rt.Restart},
@@ -194,6 +198,8 @@ func (rt *restServer) getPath(url string) string {
 		return Api_Getblockbyhash
 	} else if strings.Contains(url, strings.TrimRight(Api_GetTotalIssued, ":assetid")) {
 		return Api_GetTotalIssued
+	} else if strings.Contains(url, strings.TrimRight(Api_GetTxOutProof, ":hash")) {
+		return Api_GetTxOutProof
 	} else if strings.Contains(url, strings.TrimRight(Api_Gettransaction, ":hash")) {
 		return Api_Gettransaction
 	} else if strings.Contains(url, strings.TrimRight(Api_GetContract, ":hash")) {
@@ -206,6 +212,8 @@ func (rt *restServer) getPath(url string) string {
 		return Api_GetUTXObyAddr
 	} else if strings.Contains(url, strings.TrimRight(Api_GetUTXObyAsset, ":addr/:assetid")) {
 		return Api_GetUTXObyAsset
+	} else if strings.Contains(url, strings.TrimRight(Api_GetAddressHistory, ":addr")) {
+		return Api_GetAddressHistory
 	} else if strings.Contains(url, strings.TrimRight(Api_Getasset, ":hash")) {
 		return Api_Getasset
 	} else if strings.Contains(url, strings.TrimRight(Api_GetStateUpdate, ":namespace/:key")) {
@@ -242,6 +250,10 @@ func (rt *restServer) getParams(r *http.Request, url string, req map[string]inte
 		req["Hash"] = getParam(r, "hash")
 		req["Raw"] = r.FormValue("raw")
 		break
+	case Api_GetTxOutProof:
+		req["Hash"] = getParam(r, "hash")
+		req["Blockhash"] = r.FormValue("blockhash")
+		break
 	case Api_GetContract:
 		req["Hash"] = getParam(r, "hash")
 		req["Raw"] = r.FormValue("raw")
@@ -264,6 +276,11 @@ func (rt *restServer) getParams(r *http.Request, url string, req map[string]inte
 		req["Addr"] = getParam(r, "addr")
 		req["Assetid"] = getParam(r, "assetid")
 		break
+	case Api_GetAddressHistory:
+		req["Addr"] = getParam(r, "addr")
+		req["Offset"] = r.FormValue("offset")
+		req["Limit"] = r.FormValue("limit")
+		break
 	case Api_Restart:
 		break
 	case Api_SendRawTx:
@@ -372,7 +389,7 @@ func (rt *restServer) response(w http.ResponseWriter, resp map[string]interface{
 	resp["Desc"] = ErrMap[resp["Error"].(ErrCode)]
 	data, err := json.Marshal(resp)
 	if err != nil {
-		log.Fatal("HTTP Handle - json.Marshal: %v", err)
+		log.Fatalf("HTTP Handle - json.Marshal: %v", err)
 		return
 	}
 	rt.write(w, data)
@@ -2,7 +2,9 @@ package httprestful
 
 import (
 	. "Elastos.ELA/common/config"
+	"Elastos.ELA/common/log"
 	"Elastos.ELA/core/ledger"
+	. "Elastos.ELA/errors"
 	"Elastos.ELA/events"
 	"Elastos.ELA/net/httprestful/common"
 	. "Elastos.ELA/net/httprestful/restful"
@@ -13,6 +15,7 @@ import (
 func StartServer(n Noder) {
 	common.SetNode(n)
 	ledger.DefaultLedger.Blockchain.BCEvents.Subscribe(events.EventBlockPersistCompleted, SendBlock2NoticeServer)
+	ledger.DefaultLedger.Blockchain.BCEvents.Subscribe(events.EventReorganizeChain, SendReorganize2NoticeServer)
 	func() {
 		rest := InitRestServer(common.CheckAccessToken)
 		go rest.Start()
@@ -35,3 +38,21 @@ func SendBlock2NoticeServer(v interface{}) {
 		}
 	}()
 }
+
+// SendReorganize2NoticeServer posts the blocks which left and joined the best
+// chain, so the notice server can revert what it did for the detached ones.
+// The post may come after the ones of the attached blocks.
+func SendReorganize2NoticeServer(v interface{}) {
+	event, ok := v.(*ledger.ReorganizeEvent)
+	if !ok || len(Parameters.NoticeServerUrl) == 0 {
+		return
+	}
+	go func() {
+		req := common.ResponsePack(Success)
+		req["Action"] = "reorg"
+		req["Result"] = common.GetReorganizeInfo(event)
+		if _, err := common.PostRequest(req, Parameters.NoticeServerUrl); err != nil {
+			log.Warn("Post reorganize to notice server error: ", err)
+		}
+	}()
+}
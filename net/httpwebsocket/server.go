@@ -26,6 +26,8 @@ func StartServer(n Noder) {
 	common.SetNode(n)
 	ledger.DefaultLedger.Blockchain.BCEvents.Subscribe(events.EventBlockPersistCompleted, SendBlock2WSclient)
 	ledger.DefaultLedger.Blockchain.BCEvents.Subscribe(events.EventNewTransactionPutInPool, SendTransaction2WSclient)
+	ledger.DefaultLedger.Blockchain.BCEvents.Subscribe(events.EventReorganizeChain, SendReorganize2WSclient)
+	ledger.DefaultLedger.Blockchain.BCEvents.Subscribe(events.EventNewHeader, SendHeader2WSclient)
 	go func() {
 		ws = websocket.InitWsServer(common.CheckAccessToken)
 		ws.Start()
@@ -38,6 +40,21 @@ func SendTransaction2WSclient(v interface{}) {
 			PushNewTransaction(v)
 		}()
 	}
+	if trx, ok := v.(*transaction.Transaction); ok && ws != nil {
+		ws.NotifyTransaction(trx)
+	}
+}
+
+func SendReorganize2WSclient(v interface{}) {
+	if event, ok := v.(*ledger.ReorganizeEvent); ok && ws != nil {
+		ws.NotifyReorganize(event)
+	}
+}
+
+func SendHeader2WSclient(v interface{}) {
+	if header, ok := v.(*ledger.Header); ok && ws != nil {
+		ws.NotifyHeader(header)
+	}
 }
 
 func SendBlock2WSclient(v interface{}) {
@@ -51,6 +68,9 @@ func SendBlock2WSclient(v interface{}) {
 			PushBlockTransactions(v)
 		}()
 	}
+	if block, ok := v.(*ledger.Block); ok && ws != nil {
+		ws.NotifyBlock(block)
+	}
 }
 func Stop() {
 	if ws == nil {
@@ -1,9 +1,10 @@
 package websocket
 
 import (
+	. "Elastos.ELA/common"
 	. "Elastos.ELA/common/config"
-	. "Elastos.ELA/errors"
 	"Elastos.ELA/common/log"
+	. "Elastos.ELA/errors"
 	. "Elastos.ELA/net/httprestful/common"
 	. "Elastos.ELA/net/httpwebsocket/session"
 	"context"
@@ -16,8 +17,8 @@ import (
 	"sync"
 	"time"
 
-	"github.com/gorilla/websocket"
 	errors2 "Elastos.ELA/errors"
+	"github.com/gorilla/websocket"
 )
 
 type handler func(map[string]interface{}) map[string]interface{}
@@ -34,14 +35,19 @@ type WsServer struct {
 	SessionList      *SessionList
 	ActionMap        map[string]Handler
 	TxHashMap        map[string]string //key: txHash   value:sessionid
+	subscriptions    map[string]*subscription
 	checkAccessToken func(auth_type, access_token string) (string, errors2.ErrCode, interface{})
+	// the headers sent to the header topic before their blocks arrived
+	announced map[Uint256]uint32
 }
 
 func InitWsServer(checkAccessToken func(string, string) (string, errors2.ErrCode, interface{})) *WsServer {
 	ws := &WsServer{
-		Upgrader:    websocket.Upgrader{},
-		SessionList: NewSessionList(),
-		TxHashMap:   make(map[string]string),
+		Upgrader:      websocket.Upgrader{},
+		SessionList:   NewSessionList(),
+		TxHashMap:     make(map[string]string),
+		subscriptions: make(map[string]*subscription),
+		announced:     make(map[Uint256]uint32),
 	}
 	ws.checkAccessToken = checkAccessToken
 	return ws
@@ -143,6 +149,9 @@ func (ws *WsServer) registryMethod() {
 
 		"gettxhashmap":    {handler: gettxhashmap},
 		"getsessioncount": {handler: getsessioncount},
+
+		"subscribe":   {handler: ws.subscribe},
+		"unsubscribe": {handler: ws.unsubscribe},
 	}
 	ws.ActionMap = actionMap
 }
@@ -187,7 +196,7 @@ func (ws *WsServer) checkSessionsTimeout(done chan bool) {
 
 }
 
-//webSocketHandler
+// webSocketHandler
 func (ws *WsServer) webSocketHandler(w http.ResponseWriter, r *http.Request) {
 	wsConn, err := ws.Upgrader.Upgrade(w, r, nil)
 
@@ -204,6 +213,7 @@ func (ws *WsServer) webSocketHandler(w http.ResponseWriter, r *http.Request) {
 
 	defer func() {
 		ws.deleteTxHashs(nsSession.GetSessionId())
+		ws.deleteSubscription(nsSession.GetSessionId())
 		ws.SessionList.CloseSession(nsSession)
 		if err := recover(); err != nil {
 			log.Fatal("websocket recover:", err)
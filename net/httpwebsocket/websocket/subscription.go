@@ -0,0 +1,397 @@
+package websocket
+
+import (
+	. "Elastos.ELA/common"
+	"Elastos.ELA/core/ledger"
+	tx "Elastos.ELA/core/transaction"
+	. "Elastos.ELA/errors"
+	"Elastos.ELA/net/httpjsonrpc"
+	. "Elastos.ELA/net/httprestful/common"
+)
+
+// The topics a session subscribes to with the subscribe action, a
+// notification has the topic as its action.
+const (
+	TopicNewHeader    = "newheader"
+	TopicNewBlock     = "newblock"
+	TopicNewTx        = "newtx"
+	TopicAddress      = "address"
+	TopicConfirmation = "confirmation"
+	TopicReorg        = "reorg"
+
+	// the addresses and the transactions a session may watch
+	maxSubscribedAddresses = 1000
+	maxSubscribedTxs       = 1000
+)
+
+type subscription struct {
+	topics map[string]bool
+	// the program hashes of the watched addresses
+	addresses map[Uint168]string
+	// the watched transactions with the confirmations they are waited for
+	confirmations map[Uint256]uint32
+}
+
+func newSubscription() *subscription {
+	return &subscription{
+		topics:        make(map[string]bool),
+		addresses:     make(map[Uint168]string),
+		confirmations: make(map[Uint256]uint32),
+	}
+}
+
+// A JSON example for subscribe action as following:
+//
+//	{"Action": "subscribe", "Topic": "newblock"}
+//	{"Action": "subscribe", "Topic": "address", "Addresses": ["address", ...]}
+//	{"Action": "subscribe", "Topic": "confirmation", "Hash": "txid", "Depth": 6}
+//
+// A newheader notification comes when a header is accepted during
+// headers-first sync, or with its block otherwise. A confirmation
+// subscription returns the confirmations of the transaction, it is notified
+// once when it has the depth. A reorg notification has the fork
+// and the blocks which left and joined the best chain, the old tip first and
+// the one after the fork first. It may come after the notifications of the
+// attached blocks:
+//
+//	{"Action": "reorg", "Result": {"ForkHash": "hash", "ForkHeight": 10,
+//	  "Detached": ["hash", ...], "Attached": ["hash", ...]}}
+func (ws *WsServer) subscribe(cmd map[string]interface{}) map[string]interface{} {
+	resp := ResponsePack(Success)
+	sessionID := cmd["Userid"].(string)
+	topic, _ := cmd["Topic"].(string)
+	switch topic {
+	case TopicNewHeader, TopicNewBlock, TopicNewTx, TopicReorg:
+		ws.updateSubscription(sessionID, func(s *subscription) {
+			s.topics[topic] = true
+		})
+		resp["Result"] = true
+	case TopicAddress:
+		programHashes, addresses, ok := parseAddresses(cmd["Addresses"])
+		if !ok || len(programHashes) == 0 {
+			return ResponsePack(InvalidParams)
+		}
+		full := false
+		ws.updateSubscription(sessionID, func(s *subscription) {
+			for i, programHash := range programHashes {
+				if _, ok := s.addresses[programHash]; !ok && len(s.addresses) >= maxSubscribedAddresses {
+					full = true
+					return
+				}
+				s.addresses[programHash] = addresses[i]
+			}
+			s.topics[topic] = true
+		})
+		if full {
+			resp["Error"] = Error
+			resp["Result"] = "too many addresses"
+			return resp
+		}
+		resp["Result"] = true
+	case TopicConfirmation:
+		hash, ok := parseTxHash(cmd["Hash"])
+		if !ok {
+			return ResponsePack(InvalidParams)
+		}
+		depth := uint32(1)
+		if d, ok := cmd["Depth"].(float64); ok && d >= 1 {
+			depth = uint32(d)
+		}
+		confirmations := getConfirmations(hash)
+		resp["Result"] = confirmations
+		if confirmations >= depth {
+			return resp
+		}
+		full := false
+		ws.updateSubscription(sessionID, func(s *subscription) {
+			if _, ok := s.confirmations[hash]; !ok && len(s.confirmations) >= maxSubscribedTxs {
+				full = true
+				return
+			}
+			s.confirmations[hash] = depth
+			s.topics[topic] = true
+		})
+		if full {
+			resp["Error"] = Error
+			resp["Result"] = "too many transactions"
+		}
+	default:
+		return ResponsePack(InvalidParams)
+	}
+	return resp
+}
+
+// unsubscribe takes the same commands as subscribe, without addresses or
+// hash it removes the whole topic.
+func (ws *WsServer) unsubscribe(cmd map[string]interface{}) map[string]interface{} {
+	sessionID := cmd["Userid"].(string)
+	topic, _ := cmd["Topic"].(string)
+	switch topic {
+	case TopicNewHeader, TopicNewBlock, TopicNewTx, TopicReorg:
+		ws.updateSubscription(sessionID, func(s *subscription) {
+			delete(s.topics, topic)
+		})
+	case TopicAddress:
+		programHashes, _, ok := parseAddresses(cmd["Addresses"])
+		if !ok {
+			return ResponsePack(InvalidParams)
+		}
+		ws.updateSubscription(sessionID, func(s *subscription) {
+			if len(programHashes) == 0 {
+				s.addresses = make(map[Uint168]string)
+			}
+			for _, programHash := range programHashes {
+				delete(s.addresses, programHash)
+			}
+			s.topics[topic] = len(s.addresses) > 0
+		})
+	case TopicConfirmation:
+		ws.updateSubscription(sessionID, func(s *subscription) {
+			if cmd["Hash"] == nil {
+				s.confirmations = make(map[Uint256]uint32)
+			} else if hash, ok := parseTxHash(cmd["Hash"]); ok {
+				delete(s.confirmations, hash)
+			}
+			s.topics[topic] = len(s.confirmations) > 0
+		})
+	default:
+		return ResponsePack(InvalidParams)
+	}
+	resp := ResponsePack(Success)
+	resp["Result"] = true
+	return resp
+}
+
+// updateSubscription runs the change on the subscription of the session,
+// which is created on the first use.
+func (ws *WsServer) updateSubscription(sessionID string, change func(s *subscription)) {
+	ws.Lock()
+	defer ws.Unlock()
+	s, ok := ws.subscriptions[sessionID]
+	if !ok {
+		s = newSubscription()
+		ws.subscriptions[sessionID] = s
+	}
+	change(s)
+}
+
+func (ws *WsServer) deleteSubscription(sessionID string) {
+	ws.Lock()
+	defer ws.Unlock()
+	delete(ws.subscriptions, sessionID)
+}
+
+// subscribers returns the sessions of the topic.
+func (ws *WsServer) subscribers(topic string) []string {
+	ws.RLock()
+	defer ws.RUnlock()
+	var sessionIDs []string
+	for sessionID, s := range ws.subscriptions {
+		if s.topics[topic] {
+			sessionIDs = append(sessionIDs, sessionID)
+		}
+	}
+	return sessionIDs
+}
+
+func (ws *WsServer) pushTopic(topic string, result interface{}, sessionIDs []string) {
+	for _, sessionID := range sessionIDs {
+		resp := ResponsePack(Success)
+		resp["Action"] = topic
+		resp["Result"] = result
+		ws.response(sessionID, resp)
+	}
+}
+
+// NotifyHeader sends a header accepted during headers-first sync to the
+// sessions of the header topic, its block does not send it again.
+func (ws *WsServer) NotifyHeader(header *ledger.Header) {
+	ws.Lock()
+	ws.announced[header.Blockdata.Hash()] = header.Blockdata.Height
+	ws.Unlock()
+	if sessionIDs := ws.subscribers(TopicNewHeader); len(sessionIDs) > 0 {
+		ws.pushTopic(TopicNewHeader, GetBlockHead(header.Blockdata), sessionIDs)
+	}
+}
+
+// NotifyBlock sends a block added to the chain to the sessions of the block,
+// address and confirmation topics, and of the header topic unless its header
+// was sent before.
+func (ws *WsServer) NotifyBlock(block *ledger.Block) {
+	ws.Lock()
+	_, announced := ws.announced[block.Hash()]
+	for hash, height := range ws.announced {
+		if height <= block.Blockdata.Height {
+			delete(ws.announced, hash)
+		}
+	}
+	ws.Unlock()
+	if sessionIDs := ws.subscribers(TopicNewHeader); len(sessionIDs) > 0 && !announced {
+		ws.pushTopic(TopicNewHeader, GetBlockHead(block.Blockdata), sessionIDs)
+	}
+	if sessionIDs := ws.subscribers(TopicNewBlock); len(sessionIDs) > 0 {
+		ws.pushTopic(TopicNewBlock, GetBlockInfo(block), sessionIDs)
+	}
+	height := block.Blockdata.Height
+	for _, txn := range block.Transactions {
+		ws.notifyAddresses(txn, height)
+	}
+	ws.notifyConfirmations()
+}
+
+// NotifyTransaction sends a transaction of the pool to the sessions of the
+// transaction and address topics.
+func (ws *WsServer) NotifyTransaction(txn *tx.Transaction) {
+	if sessionIDs := ws.subscribers(TopicNewTx); len(sessionIDs) > 0 {
+		ws.pushTopic(TopicNewTx, httpjsonrpc.TransArryByteToHexString(txn), sessionIDs)
+	}
+	ws.notifyAddresses(txn, 0)
+}
+
+// NotifyReorganize tells the sessions of the reorg topic the blocks which left
+// and joined the best chain.
+func (ws *WsServer) NotifyReorganize(event *ledger.ReorganizeEvent) {
+	if sessionIDs := ws.subscribers(TopicReorg); len(sessionIDs) > 0 {
+		ws.pushTopic(TopicReorg, GetReorganizeInfo(event), sessionIDs)
+	}
+}
+
+// notifyAddresses sends the transaction to the sessions watching the
+// addresses it spends from or pays to, the height is zero in the pool.
+func (ws *WsServer) notifyAddresses(txn *tx.Transaction, height uint32) {
+	sessionIDs := ws.subscribers(TopicAddress)
+	if len(sessionIDs) == 0 {
+		return
+	}
+	programHashes := make(map[Uint168]struct{})
+	for _, output := range txn.Outputs {
+		programHashes[output.ProgramHash] = struct{}{}
+	}
+	if references, err := txn.GetReference(); err == nil {
+		for _, output := range references {
+			programHashes[output.ProgramHash] = struct{}{}
+		}
+	}
+
+	var info interface{}
+	for _, sessionID := range sessionIDs {
+		ws.RLock()
+		var addresses []string
+		if s, ok := ws.subscriptions[sessionID]; ok {
+			for programHash := range programHashes {
+				if address, ok := s.addresses[programHash]; ok {
+					addresses = append(addresses, address)
+				}
+			}
+		}
+		ws.RUnlock()
+		if len(addresses) == 0 {
+			continue
+		}
+		if info == nil {
+			info = httpjsonrpc.TransArryByteToHexString(txn)
+		}
+		ws.pushTopic(TopicAddress, map[string]interface{}{
+			"Addresses":   addresses,
+			"Height":      height,
+			"Transaction": info,
+		}, []string{sessionID})
+	}
+}
+
+// notifyConfirmations sends the watched transactions which got their depth,
+// they are not watched any more. The transactions are looked up in the store
+// without holding the lock of the server.
+func (ws *WsServer) notifyConfirmations() {
+	watched := make(map[Uint256]uint32)
+	ws.RLock()
+	for _, s := range ws.subscriptions {
+		for hash := range s.confirmations {
+			watched[hash] = 0
+		}
+	}
+	ws.RUnlock()
+	if len(watched) == 0 {
+		return
+	}
+	for hash := range watched {
+		watched[hash] = getConfirmations(hash)
+	}
+
+	type confirmed struct {
+		sessionID     string
+		hash          Uint256
+		confirmations uint32
+	}
+	var notifications []confirmed
+	ws.Lock()
+	for sessionID, s := range ws.subscriptions {
+		for hash, depth := range s.confirmations {
+			// a transaction watched meanwhile waits for the next block
+			if confirmations, ok := watched[hash]; ok && confirmations >= depth {
+				notifications = append(notifications, confirmed{sessionID, hash, confirmations})
+				delete(s.confirmations, hash)
+			}
+		}
+		s.topics[TopicConfirmation] = len(s.confirmations) > 0
+	}
+	ws.Unlock()
+
+	for _, n := range notifications {
+		ws.pushTopic(TopicConfirmation, map[string]interface{}{
+			"Hash":          BytesToHexString(n.hash.ToArrayReverse()),
+			"Confirmations": n.confirmations,
+		}, []string{n.sessionID})
+	}
+}
+
+// getConfirmations returns the confirmations of the transaction, zero while
+// it is not in the chain.
+func getConfirmations(hash Uint256) uint32 {
+	_, height, err := ledger.DefaultLedger.Store.GetTransaction(hash)
+	if err != nil {
+		return 0
+	}
+	return ledger.DefaultLedger.Blockchain.GetBestHeight() - height + 1
+}
+
+func parseTxHash(v interface{}) (Uint256, bool) {
+	str, ok := v.(string)
+	if !ok {
+		return Uint256{}, false
+	}
+	bys, err := HexStringToBytesReverse(str)
+	if err != nil {
+		return Uint256{}, false
+	}
+	hash, err := Uint256ParseFromBytes(bys)
+	if err != nil {
+		return Uint256{}, false
+	}
+	return hash, true
+}
+
+func parseAddresses(v interface{}) ([]Uint168, []string, bool) {
+	if v == nil {
+		return nil, nil, true
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, nil, false
+	}
+	programHashes := make([]Uint168, 0, len(list))
+	addresses := make([]string, 0, len(list))
+	for _, item := range list {
+		address, ok := item.(string)
+		if !ok {
+			return nil, nil, false
+		}
+		programHash, err := ToScriptHash(address)
+		if err != nil {
+			return nil, nil, false
+		}
+		programHashes = append(programHashes, programHash)
+		addresses = append(addresses, address)
+	}
+	return programHashes, addresses, true
+}
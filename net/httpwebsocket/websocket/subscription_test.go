@@ -0,0 +1,264 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/core/ledger"
+	tx "Elastos.ELA/core/transaction"
+	. "Elastos.ELA/errors"
+
+	"github.com/gorilla/websocket"
+)
+
+// testTxStore knows the heights of the transactions of the set, the lookups
+// must not be done under the lock of the server.
+type testTxStore struct {
+	ledger.ILedgerStore
+	t       *testing.T
+	ws      *WsServer
+	heights map[Uint256]uint32
+}
+
+func (s *testTxStore) GetTransaction(hash Uint256) (*tx.Transaction, uint32, error) {
+	if !s.ws.TryLock() {
+		s.t.Error("transaction looked up under the lock of the server")
+	} else {
+		s.ws.Unlock()
+	}
+	height, ok := s.heights[hash]
+	if !ok {
+		return nil, 0, errors.New("unknown transaction")
+	}
+	return new(tx.Transaction), height, nil
+}
+
+type testWsClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+	id   string
+}
+
+func newTestWsServer(t *testing.T) (*WsServer, *httptest.Server) {
+	log.Init()
+	ws := InitWsServer(func(string, string) (string, ErrCode, interface{}) { return "", 0, nil })
+	ws.registryMethod()
+	return ws, httptest.NewServer(http.HandlerFunc(ws.webSocketHandler))
+}
+
+func dialTestWsClient(t *testing.T, server *httptest.Server) *testWsClient {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &testWsClient{t: t, conn: conn}
+	c.id, _ = c.call(map[string]interface{}{"Action": "heartbeat"})["Result"].(string)
+	return c
+}
+
+func (c *testWsClient) next() map[string]interface{} {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := c.conn.ReadMessage()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		c.t.Fatal(err)
+	}
+	return resp
+}
+
+// call sends the request and returns the response of its action.
+func (c *testWsClient) call(req map[string]interface{}) map[string]interface{} {
+	data, _ := json.Marshal(req)
+	if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		c.t.Fatal(err)
+	}
+	resp := c.next()
+	if resp["Action"] != req["Action"] {
+		c.t.Fatalf("%v received for the %v request", resp["Action"], req["Action"])
+	}
+	return resp
+}
+
+// expectNothing checks no notification comes before the next response.
+func (c *testWsClient) expectNothing() {
+	c.call(map[string]interface{}{"Action": "heartbeat"})
+}
+
+func errorCode(resp map[string]interface{}) ErrCode {
+	code, _ := resp["Error"].(float64)
+	return ErrCode(code)
+}
+
+func TestSubscribe(t *testing.T) {
+	ws, server := newTestWsServer(t)
+	defer server.Close()
+	c := dialTestWsClient(t, server)
+	defer c.conn.Close()
+
+	for _, req := range []map[string]interface{}{
+		{"Action": "subscribe"},
+		{"Action": "subscribe", "Topic": "unknown"},
+		{"Action": "subscribe", "Topic": TopicAddress},
+		{"Action": "subscribe", "Topic": TopicAddress, "Addresses": []string{"invalid"}},
+		{"Action": "subscribe", "Topic": TopicConfirmation},
+		{"Action": "unsubscribe", "Topic": "unknown"},
+	} {
+		if code := errorCode(c.call(req)); code != InvalidParams {
+			t.Errorf("%v returns error %d, want invalid params", req, code)
+		}
+	}
+
+	watchedHash, otherHash := Uint168{0x21, 1}, Uint168{0x21, 2}
+	watched, _ := watchedHash.ToAddress()
+	other, _ := otherHash.ToAddress()
+	for _, req := range []map[string]interface{}{
+		{"Action": "subscribe", "Topic": TopicNewBlock},
+		{"Action": "subscribe", "Topic": TopicAddress, "Addresses": []string{watched, other}},
+		{"Action": "unsubscribe", "Topic": TopicAddress, "Addresses": []string{other}},
+	} {
+		if resp := c.call(req); errorCode(resp) != Success || resp["Result"] != true {
+			t.Fatalf("%v returns %v", req, resp)
+		}
+	}
+	ws.RLock()
+	s := ws.subscriptions[c.id]
+	if s == nil || !s.topics[TopicNewBlock] || !s.topics[TopicAddress] || len(s.addresses) != 1 {
+		t.Fatalf("subscription is %+v", s)
+	}
+	ws.RUnlock()
+
+	// the topic goes with the last address
+	c.call(map[string]interface{}{"Action": "unsubscribe", "Topic": TopicAddress, "Addresses": []string{watched}})
+	c.call(map[string]interface{}{"Action": "unsubscribe", "Topic": TopicNewBlock})
+	ws.RLock()
+	if s.topics[TopicNewBlock] || s.topics[TopicAddress] || len(s.addresses) != 0 {
+		t.Fatalf("subscription is %+v after unsubscribe", s)
+	}
+	ws.RUnlock()
+
+	// the subscription is dropped with the session
+	c.conn.Close()
+	for i := 0; i < 100; i++ {
+		ws.RLock()
+		_, ok := ws.subscriptions[c.id]
+		ws.RUnlock()
+		if !ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("subscription of a closed session is kept")
+}
+
+func TestNotifyReorganize(t *testing.T) {
+	ws, server := newTestWsServer(t)
+	defer server.Close()
+	subscriber := dialTestWsClient(t, server)
+	defer subscriber.conn.Close()
+	other := dialTestWsClient(t, server)
+	defer other.conn.Close()
+
+	subscriber.call(map[string]interface{}{"Action": "subscribe", "Topic": TopicReorg})
+	other.call(map[string]interface{}{"Action": "subscribe", "Topic": TopicNewBlock})
+
+	event := &ledger.ReorganizeEvent{
+		ForkHash:   Uint256{1},
+		ForkHeight: 10,
+		Detached:   []Uint256{{3}, {2}},
+		Attached:   []Uint256{{4}, {5}, {6}},
+	}
+	ws.NotifyReorganize(event)
+	resp := subscriber.next()
+	if resp["Action"] != TopicReorg {
+		t.Fatalf("%v received, want the reorg", resp["Action"])
+	}
+	result, _ := resp["Result"].(map[string]interface{})
+	detached, _ := result["Detached"].([]interface{})
+	attached, _ := result["Attached"].([]interface{})
+	old := Uint256{3}
+	if result["ForkHash"] != BytesToHexString(event.ForkHash.ToArrayReverse()) || result["ForkHeight"] != 10.0 ||
+		len(detached) != 2 || len(attached) != 3 || detached[0] != BytesToHexString(old.ToArrayReverse()) {
+		t.Fatalf("reorg notification is %v", result)
+	}
+	other.expectNothing()
+
+	subscriber.call(map[string]interface{}{"Action": "unsubscribe", "Topic": TopicReorg})
+	ws.NotifyReorganize(event)
+	subscriber.expectNothing()
+}
+
+func TestNotifyHeader(t *testing.T) {
+	ws, server := newTestWsServer(t)
+	defer server.Close()
+	c := dialTestWsClient(t, server)
+	defer c.conn.Close()
+	c.call(map[string]interface{}{"Action": "subscribe", "Topic": TopicNewHeader})
+
+	// a header accepted in headers-first sync is sent once
+	synced := &ledger.Block{Blockdata: &ledger.Blockdata{Height: 10}}
+	ws.NotifyHeader(&ledger.Header{Blockdata: synced.Blockdata})
+	resp := c.next()
+	result, _ := resp["Result"].(map[string]interface{})
+	hash := synced.Hash()
+	if resp["Action"] != TopicNewHeader || result["Hash"] != BytesToHexString(hash.ToArrayReverse()) {
+		t.Fatalf("%v received, want the header", resp)
+	}
+	ws.NotifyBlock(synced)
+	c.expectNothing()
+	if len(ws.announced) != 0 {
+		t.Fatal("header of a persisted block is kept")
+	}
+
+	// a block whose header was not announced sends it
+	ws.NotifyBlock(&ledger.Block{Blockdata: &ledger.Blockdata{Height: 11}})
+	if resp := c.next(); resp["Action"] != TopicNewHeader {
+		t.Fatalf("%v received, want the header of the block", resp["Action"])
+	}
+}
+
+func TestNotifyConfirmations(t *testing.T) {
+	ws, server := newTestWsServer(t)
+	defer server.Close()
+	c := dialTestWsClient(t, server)
+	defer c.conn.Close()
+
+	defaultLedger := ledger.DefaultLedger
+	defer func() { ledger.DefaultLedger = defaultLedger }()
+	store := &testTxStore{t: t, ws: ws, heights: make(map[Uint256]uint32)}
+	ledger.DefaultLedger = &ledger.Ledger{Store: store}
+	ledger.DefaultLedger.Blockchain = ledger.NewBlockchain(10, ledger.DefaultLedger)
+
+	txid := Uint256{0x01}
+	hash := BytesToHexString(txid.ToArrayReverse())
+	resp := c.call(map[string]interface{}{"Action": "subscribe", "Topic": TopicConfirmation, "Hash": hash, "Depth": 2})
+	if resp["Result"] != 0.0 {
+		t.Fatalf("unconfirmed transaction has %v confirmations", resp["Result"])
+	}
+
+	store.heights[txid] = 10
+	ws.notifyConfirmations()
+	c.expectNothing()
+
+	ledger.DefaultLedger.Blockchain.UpdateBestHeight(11)
+	ws.notifyConfirmations()
+	resp = c.next()
+	result, _ := resp["Result"].(map[string]interface{})
+	if resp["Action"] != TopicConfirmation || result["Hash"] != hash || result["Confirmations"] != 2.0 {
+		t.Fatalf("%v received, want 2 confirmations", resp)
+	}
+	ws.RLock()
+	if s := ws.subscriptions[c.id]; len(s.confirmations) != 0 || s.topics[TopicConfirmation] {
+		t.Fatal("notified transaction is still watched")
+	}
+	ws.RUnlock()
+}
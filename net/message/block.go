@@ -6,11 +6,13 @@ import (
 	"Elastos.ELA/common/log"
 	"Elastos.ELA/core/ledger"
 	"Elastos.ELA/events"
+	"Elastos.ELA/net/bloom"
 	. "Elastos.ELA/net/protocol"
 	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
 	"errors"
+	"time"
 )
 
 type blockReq struct {
@@ -32,6 +34,7 @@ func (msg block) Handle(node Noder) error {
 	//log.Tracef("hash is %x", hash.ToArrayReverse())
 	if node.LocalNode().IsNeighborNoder(node) == false {
 		log.Trace("received headers message from unknown peer")
+		node.AddBanScore(BANSCOREUNSOLICITED, "block from unknown peer")
 		return errors.New("received headers message from unknown peer")
 	}
 
@@ -63,14 +66,21 @@ func (msg block) Handle(node Noder) error {
 	node.LocalNode().DeleteRequestedBlock(hash)
 	isOrphan := false
 	var err error
+	start := time.Now()
 	if isFastAdd {
 		_, isOrphan, err = ledger.DefaultLedger.Blockchain.AddBlockFast(&msg.blk)
 	} else {
 		_, isOrphan, err = ledger.DefaultLedger.Blockchain.AddBlock(&msg.blk)
 	}
+	blockValidationSeconds.ObserveSince(start)
 
 	if err != nil {
 		log.Warn("Block add failed: ", err, " ,block hash is ", hash.ToArrayReverse())
+		// a block we already have is not the peer's fault
+		exists, _ := ledger.DefaultLedger.Blockchain.BlockExists(&hash)
+		if !exists && !ledger.DefaultLedger.Blockchain.IsKnownOrphan(&hash) {
+			node.AddBanScore(BANSCOREINVALIDBLOCK, "invalid block: "+err.Error())
+		}
 		return err
 	}
 	//relay
@@ -95,10 +105,7 @@ func (msg block) Handle(node Noder) error {
 	}
 
 	if !isCheckpointBlock {
-		requestedBlocks := node.LocalNode().GetRequestBlockList()
-		if err == nil && len(requestedBlocks) < MinInFlightBlocks {
-			fetchHeaderBlocks(node)
-		}
+		node.LocalNode().ScheduleBlockDownloads()
 		return nil
 	}
 
@@ -124,28 +131,6 @@ func (msg block) Handle(node Noder) error {
 	return nil
 }
 
-func fetchHeaderBlocks(node Noder) {
-	// Nothing to do if there is no start header.
-	preHash, err := ledger.DefaultLedger.Store.GetHeaderHashFront()
-	if err != nil {
-		log.Warn("fetchHeaderBlocks called with no start header")
-		return
-	}
-
-	for {
-		err := ReqBlkData(node, preHash)
-		if err != nil {
-			log.Error("failed build a new getdata")
-		}
-		nextHash, erro := ledger.DefaultLedger.Store.GetHeaderHashNext(preHash)
-		if erro != nil {
-			break
-		} else {
-			preHash = nextHash
-		}
-	}
-}
-
 func (msg dataReq) Handle(node Noder) error {
 	log.Debug()
 	reqtype := common.InventoryType(msg.dataType)
@@ -167,6 +152,38 @@ func (msg dataReq) Handle(node Noder) error {
 		}
 		node.Tx(buf)
 
+	case common.FILTEREDBLOCK:
+		filter := node.GetFilter()
+		if !filter.IsLoaded() {
+			return nil
+		}
+		block, err := NewBlockFromHash(hash)
+		if err != nil {
+			log.Debug("Can't get block from hash: ", hash, " ,send not found message")
+			b, err := NewNotFound(hash)
+			node.Tx(b)
+			return err
+		}
+		merkle, matchedIndexes, err := bloom.NewMerkleBlock(block, filter)
+		if err != nil {
+			return err
+		}
+		buf, err := NewMerkleBlockMsg(merkle)
+		if err != nil {
+			return err
+		}
+		node.Tx(buf)
+
+		// Send the matched transactions right after the merkle block so
+		// the light client does not need to request them separately.
+		for _, i := range matchedIndexes {
+			buf, err := NewTxn(block.Transactions[i])
+			if err != nil {
+				return err
+			}
+			node.Tx(buf)
+		}
+
 	case common.TRANSACTION:
 		txn, err := NewTxnFromHash(hash)
 		if err != nil {
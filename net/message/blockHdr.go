@@ -244,9 +244,11 @@ func (msg blkHeader) Handle(node Noder) error {
 	log.Debug()
 	//If received headers message from unknown peer, return
 	if node.LocalNode().IsNeighborNoder(node) == false {
+		node.AddBanScore(BANSCOREUNSOLICITED, "headers from unknown peer")
 		return errors.New("received headers message from unknown peer")
 	}
 	if node.LocalNode().GetHeaderFisrtModeStatus() == false {
+		node.AddBanScore(BANSCOREUNSOLICITED, "unrequested headers")
 		node.SetState(INACTIVITY)
 		conn := node.GetConn()
 		conn.Close()
@@ -259,6 +261,7 @@ func (msg blkHeader) Handle(node Noder) error {
 	err := ledger.DefaultLedger.Store.AddHeaders(msg.blkHdr, ledger.DefaultLedger)
 	if err != nil {
 		log.Warn("Add block Header error")
+		node.AddBanScore(BANSCOREINVALIDHEADER, "invalid headers: "+err.Error())
 		node.SetState(INACTIVITY)
 		conn := node.GetConn()
 		conn.Close()
@@ -274,6 +277,7 @@ func (msg blkHeader) Handle(node Noder) error {
 				if bytes.Equal(msgBlkHash[:], nextCheckpointHash[:]) == true {
 					receivedCheckpoint = true
 				} else {
+					node.AddBanScore(BANSCOREINVALIDHEADER, "header does not match checkpoint")
 					node.SetState(INACTIVITY)
 					conn := node.GetConn()
 					conn.Close()
@@ -283,7 +287,7 @@ func (msg blkHeader) Handle(node Noder) error {
 		}
 	}
 	if receivedCheckpoint {
-		fetchHeaderBlocks(node)
+		node.LocalNode().ScheduleBlockDownloads()
 		return nil
 	}
 
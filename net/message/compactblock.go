@@ -0,0 +1,511 @@
+package message
+
+import (
+	"Elastos.ELA/common"
+	"Elastos.ELA/common/config"
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/common/serialization"
+	"Elastos.ELA/core/ledger"
+	"Elastos.ELA/core/transaction"
+	"Elastos.ELA/crypto"
+	. "Elastos.ELA/net/protocol"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// A compact block carries the block header, a 6 bytes short ID for each
+// transaction and the coinbase in full. The receiver rebuilds the block
+// from the transactions in its pool and asks the sender for the missing
+// ones with getblocktxn, the sender answers with blocktxn.
+const (
+	shortIDLen = 6
+	// compactBlockTimeout is how long a partly rebuilt block waits for the
+	// blocktxn answer.
+	compactBlockTimeout = 30 * time.Second
+	// maxPeerPendingCompactBlocks and maxPendingCompactBlocks bound the
+	// partial blocks kept for a peer and for all of them, a compact block
+	// over the limits is requested in full.
+	maxPeerPendingCompactBlocks = 3
+	maxPendingCompactBlocks     = 100
+)
+
+type prefilledTxn struct {
+	index uint32
+	txn   *transaction.Transaction
+}
+
+type compactBlock struct {
+	msgHdr
+	header    ledger.Blockdata
+	nonce     uint64
+	shortIDs  []uint64
+	prefilled []prefilledTxn
+}
+
+type blockTxnReq struct {
+	msgHdr
+	hash    common.Uint256
+	indexes []uint32
+}
+
+type blockTxn struct {
+	msgHdr
+	hash common.Uint256
+	txns []*transaction.Transaction
+}
+
+// partialBlock is a compact block waiting for its missing transactions.
+type partialBlock struct {
+	blk     *ledger.Block
+	missing []uint32
+	created time.Time
+}
+
+// pendingKey identifies a partial block by the peer it is requested from,
+// several peers may announce the same block.
+type pendingKey struct {
+	hash common.Uint256
+	peer uint64
+}
+
+var pendingCompactBlocks = struct {
+	sync.Mutex
+	blocks map[pendingKey]*partialBlock
+}{blocks: make(map[pendingKey]*partialBlock)}
+
+// addPendingCompactBlock keeps the partial block until the blocktxn of the
+// peer arrives, the partial blocks that timed out are dropped. It returns
+// false when the peer or all peers have too many partial blocks already.
+func addPendingCompactBlock(peer uint64, blk *ledger.Block, missing []uint32) bool {
+	pendingCompactBlocks.Lock()
+	defer pendingCompactBlocks.Unlock()
+	now := time.Now()
+	key := pendingKey{blk.Hash(), peer}
+	peerCount := 0
+	for k, pb := range pendingCompactBlocks.blocks {
+		if now.Sub(pb.created) > compactBlockTimeout {
+			delete(pendingCompactBlocks.blocks, k)
+			continue
+		}
+		if k.peer == peer && k != key {
+			peerCount++
+		}
+	}
+	if _, ok := pendingCompactBlocks.blocks[key]; !ok {
+		if peerCount >= maxPeerPendingCompactBlocks ||
+			len(pendingCompactBlocks.blocks) >= maxPendingCompactBlocks {
+			return false
+		}
+	}
+	pendingCompactBlocks.blocks[key] = &partialBlock{
+		blk:     blk,
+		missing: missing,
+		created: now,
+	}
+	return true
+}
+
+// takePendingCompactBlock removes and returns the partial block requested
+// from the peer.
+func takePendingCompactBlock(peer uint64, hash common.Uint256) (*partialBlock, bool) {
+	pendingCompactBlocks.Lock()
+	defer pendingCompactBlocks.Unlock()
+	key := pendingKey{hash, peer}
+	pb, ok := pendingCompactBlocks.blocks[key]
+	delete(pendingCompactBlocks.blocks, key)
+	return pb, ok
+}
+
+// shortIDKey makes the short IDs depend on the block and a random nonce, so
+// collisions can not be made in advance and differ from block to block.
+func shortIDKey(hash common.Uint256, nonce uint64) []byte {
+	buf := bytes.NewBuffer(hash.ToArray())
+	serialization.WriteUint64(buf, nonce)
+	key := sha256.Sum256(buf.Bytes())
+	return key[:]
+}
+
+func shortID(key []byte, txid common.Uint256) uint64 {
+	sum := sha256.Sum256(append(append([]byte{}, key...), txid.ToArray()...))
+	var id [8]byte
+	copy(id[:], sum[:shortIDLen])
+	return binary.LittleEndian.Uint64(id[:])
+}
+
+func newMsgBuffer(cmd string, payload []byte) ([]byte, error) {
+	var hdr msgHdr
+	hdr.init(cmd, checkSum(payload), uint32(len(payload)))
+	hdrBuf, err := hdr.Serialization()
+	if err != nil {
+		return nil, err
+	}
+	return append(hdrBuf, payload...), nil
+}
+
+// NewCompactBlock builds the cmpctblock message of a block, the coinbase is
+// always sent in full.
+func NewCompactBlock(bk *ledger.Block) ([]byte, error) {
+	log.Debug()
+	var msg compactBlock
+	msg.header = *bk.Blockdata
+	msg.nonce = uint64(rand.Int63())
+	key := shortIDKey(bk.Hash(), msg.nonce)
+	for i, txn := range bk.Transactions {
+		if txn.IsCoinBaseTx() {
+			msg.prefilled = append(msg.prefilled, prefilledTxn{index: uint32(i), txn: txn})
+			continue
+		}
+		msg.shortIDs = append(msg.shortIDs, shortID(key, txn.Hash()))
+	}
+
+	p := bytes.NewBuffer(nil)
+	if err := msg.serializePayload(p); err != nil {
+		return nil, err
+	}
+	return newMsgBuffer("cmpctblock", p.Bytes())
+}
+
+func (msg *compactBlock) serializePayload(w io.Writer) error {
+	msg.header.Serialize(w)
+	serialization.WriteUint64(w, msg.nonce)
+	if err := serialization.WriteVarUint(w, uint64(len(msg.shortIDs))); err != nil {
+		return err
+	}
+	for _, id := range msg.shortIDs {
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], id)
+		if _, err := w.Write(buf[:shortIDLen]); err != nil {
+			return err
+		}
+	}
+	if err := serialization.WriteVarUint(w, uint64(len(msg.prefilled))); err != nil {
+		return err
+	}
+	for _, p := range msg.prefilled {
+		serialization.WriteUint32(w, p.index)
+		if err := p.txn.Serialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (msg compactBlock) Verify(buf []byte) error {
+	return msg.msgHdr.Verify(buf)
+}
+
+func (msg compactBlock) Serialization() ([]byte, error) {
+	hdrBuf, err := msg.msgHdr.Serialization()
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(hdrBuf)
+	err = msg.serializePayload(buf)
+	return buf.Bytes(), err
+}
+
+func (msg *compactBlock) Deserialization(p []byte) error {
+	buf := bytes.NewBuffer(p)
+	err := binary.Read(buf, binary.LittleEndian, &(msg.msgHdr))
+	if err != nil {
+		return errors.New("Parse cmpctblock message hdr error")
+	}
+	if err := msg.header.Deserialize(buf); err != nil {
+		return err
+	}
+	if msg.nonce, err = serialization.ReadUint64(buf); err != nil {
+		return err
+	}
+	maxTxns := uint64(config.Parameters.MaxBlockSize)
+	count, err := serialization.ReadVarUint(buf, maxTxns)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < count; i++ {
+		var id [8]byte
+		if _, err := io.ReadFull(buf, id[:shortIDLen]); err != nil {
+			return err
+		}
+		msg.shortIDs = append(msg.shortIDs, binary.LittleEndian.Uint64(id[:]))
+	}
+	count, err = serialization.ReadVarUint(buf, maxTxns)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < count; i++ {
+		index, err := serialization.ReadUint32(buf)
+		if err != nil {
+			return err
+		}
+		txn := new(transaction.Transaction)
+		if err := txn.Deserialize(buf); err != nil {
+			return err
+		}
+		msg.prefilled = append(msg.prefilled, prefilledTxn{index: index, txn: txn})
+	}
+	return nil
+}
+
+// rebuild fills the block from the prefilled transactions and the pool, it
+// returns the indexes of the transactions that are still missing.
+func (msg *compactBlock) rebuild(txnPool map[common.Uint256]*transaction.Transaction) (*ledger.Block, []uint32, error) {
+	total := len(msg.shortIDs) + len(msg.prefilled)
+	txns := make([]*transaction.Transaction, total)
+	for _, p := range msg.prefilled {
+		if int(p.index) >= total || txns[p.index] != nil {
+			return nil, nil, errors.New("invalid prefilled transaction index in cmpctblock")
+		}
+		txns[p.index] = p.txn
+	}
+
+	// Two pool transactions with the same short ID can not be told apart,
+	// such a slot is requested from the peer like a missing one.
+	header := msg.header
+	key := shortIDKey(header.Hash(), msg.nonce)
+	pool := make(map[uint64]*transaction.Transaction)
+	for txid, txn := range txnPool {
+		id := shortID(key, txid)
+		if _, ok := pool[id]; ok {
+			pool[id] = nil
+			continue
+		}
+		pool[id] = txn
+	}
+
+	var missing []uint32
+	next := 0
+	for i := range txns {
+		if txns[i] != nil {
+			continue
+		}
+		if txn := pool[msg.shortIDs[next]]; txn != nil {
+			txns[i] = txn
+		} else {
+			missing = append(missing, uint32(i))
+		}
+		next++
+	}
+	return &ledger.Block{Blockdata: &header, Transactions: txns}, missing, nil
+}
+
+func (msg compactBlock) Handle(node Noder) error {
+	if node.LocalNode().IsNeighborNoder(node) == false {
+		node.AddBanScore(BANSCOREUNSOLICITED, "cmpctblock from unknown peer")
+		return errors.New("received cmpctblock message from unknown peer")
+	}
+	header := msg.header
+	hash := header.Hash()
+	if ledger.DefaultLedger.BlockInLedger(hash) {
+		ReceiveDuplicateBlockCnt++
+		return nil
+	}
+	// nothing is kept for a header without its proof of work, a block
+	// whose parent is unknown can not be connected and is fetched in full
+	if err := ledger.CheckProofOfWork(&header, config.Parameters.ChainParam.PowLimit); err != nil {
+		node.AddBanScore(BANSCOREINVALIDHEADER, "cmpctblock header: "+err.Error())
+		return err
+	}
+	if !ledger.DefaultLedger.BlockInLedger(header.PrevBlockHash) {
+		log.Debugf("Compact block %x has an unknown parent, request the full block", hash.ToArrayReverse())
+		return ReqBlkData(node, hash)
+	}
+
+	blk, missing, err := msg.rebuild(node.LocalNode().GetTxnPool(false))
+	if err != nil {
+		node.AddBanScore(BANSCOREMALFORMED, "invalid prefilled transaction index")
+		return err
+	}
+	if len(missing) == 0 {
+		return completeCompactBlock(node, blk)
+	}
+
+	log.Debugf("Compact block %x misses %d of %d transactions", hash.ToArrayReverse(), len(missing), len(blk.Transactions))
+	if !addPendingCompactBlock(node.GetID(), blk, missing) {
+		log.Debugf("Too many pending compact blocks, request the full block %x", hash.ToArrayReverse())
+		return ReqBlkData(node, hash)
+	}
+
+	buf, err := NewBlockTxnReq(hash, missing)
+	if err != nil {
+		return err
+	}
+	node.Tx(buf)
+	return nil
+}
+
+// completeCompactBlock hands a rebuilt block to the block handler. A block
+// whose transactions do not match the merkle root was rebuilt from a wrong
+// pool transaction, it is fetched in full instead.
+func completeCompactBlock(node Noder, blk *ledger.Block) error {
+	hash := blk.Hash()
+	txids := make([]common.Uint256, 0, len(blk.Transactions))
+	for _, txn := range blk.Transactions {
+		txids = append(txids, txn.Hash())
+	}
+	root, err := crypto.ComputeRoot(txids)
+	if err != nil || root != blk.Blockdata.TransactionsRoot {
+		log.Debugf("Compact block %x does not match its merkle root, request the full block", hash.ToArrayReverse())
+		return ReqBlkData(node, hash)
+	}
+
+	var msg block
+	msg.blk = *blk
+	return msg.Handle(node)
+}
+
+func NewBlockTxnReq(hash common.Uint256, indexes []uint32) ([]byte, error) {
+	p := bytes.NewBuffer(nil)
+	hash.Serialize(p)
+	serialization.WriteVarUint(p, uint64(len(indexes)))
+	for _, index := range indexes {
+		serialization.WriteUint32(p, index)
+	}
+	return newMsgBuffer("getblocktxn", p.Bytes())
+}
+
+func (msg blockTxnReq) Verify(buf []byte) error {
+	return msg.msgHdr.Verify(buf)
+}
+
+func (msg blockTxnReq) Serialization() ([]byte, error) {
+	hdrBuf, err := msg.msgHdr.Serialization()
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(hdrBuf)
+	msg.hash.Serialize(buf)
+	serialization.WriteVarUint(buf, uint64(len(msg.indexes)))
+	for _, index := range msg.indexes {
+		serialization.WriteUint32(buf, index)
+	}
+	return buf.Bytes(), nil
+}
+
+func (msg *blockTxnReq) Deserialization(p []byte) error {
+	buf := bytes.NewBuffer(p)
+	err := binary.Read(buf, binary.LittleEndian, &(msg.msgHdr))
+	if err != nil {
+		return errors.New("Parse getblocktxn message hdr error")
+	}
+	if err := msg.hash.Deserialize(buf); err != nil {
+		return err
+	}
+	count, err := serialization.ReadVarUint(buf, uint64(config.Parameters.MaxBlockSize))
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < count; i++ {
+		index, err := serialization.ReadUint32(buf)
+		if err != nil {
+			return err
+		}
+		msg.indexes = append(msg.indexes, index)
+	}
+	return nil
+}
+
+func (msg blockTxnReq) Handle(node Noder) error {
+	blk, err := NewBlockFromHash(msg.hash)
+	if err != nil {
+		b, err := NewNotFound(msg.hash)
+		if err != nil {
+			return err
+		}
+		node.Tx(b)
+		return nil
+	}
+	txns := make([]*transaction.Transaction, 0, len(msg.indexes))
+	for _, index := range msg.indexes {
+		if int(index) >= len(blk.Transactions) {
+			node.AddBanScore(BANSCOREMALFORMED, "getblocktxn index out of range")
+			return errors.New("getblocktxn index out of range")
+		}
+		txns = append(txns, blk.Transactions[index])
+	}
+	buf, err := NewBlockTxn(msg.hash, txns)
+	if err != nil {
+		return err
+	}
+	node.Tx(buf)
+	return nil
+}
+
+func NewBlockTxn(hash common.Uint256, txns []*transaction.Transaction) ([]byte, error) {
+	p := bytes.NewBuffer(nil)
+	hash.Serialize(p)
+	serialization.WriteVarUint(p, uint64(len(txns)))
+	for _, txn := range txns {
+		if err := txn.Serialize(p); err != nil {
+			return nil, err
+		}
+	}
+	return newMsgBuffer("blocktxn", p.Bytes())
+}
+
+func (msg blockTxn) Verify(buf []byte) error {
+	return msg.msgHdr.Verify(buf)
+}
+
+func (msg blockTxn) Serialization() ([]byte, error) {
+	hdrBuf, err := msg.msgHdr.Serialization()
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(hdrBuf)
+	msg.hash.Serialize(buf)
+	serialization.WriteVarUint(buf, uint64(len(msg.txns)))
+	for _, txn := range msg.txns {
+		if err := txn.Serialize(buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (msg *blockTxn) Deserialization(p []byte) error {
+	buf := bytes.NewBuffer(p)
+	err := binary.Read(buf, binary.LittleEndian, &(msg.msgHdr))
+	if err != nil {
+		return errors.New("Parse blocktxn message hdr error")
+	}
+	if err := msg.hash.Deserialize(buf); err != nil {
+		return err
+	}
+	count, err := serialization.ReadVarUint(buf, uint64(config.Parameters.MaxBlockSize))
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < count; i++ {
+		txn := new(transaction.Transaction)
+		if err := txn.Deserialize(buf); err != nil {
+			return err
+		}
+		msg.txns = append(msg.txns, txn)
+	}
+	return nil
+}
+
+func (msg blockTxn) Handle(node Noder) error {
+	// the partial block may have timed out or been completed from another
+	// peer meanwhile, an unmatched blocktxn is dropped without a score
+	pb, ok := takePendingCompactBlock(node.GetID(), msg.hash)
+	if !ok {
+		log.Debugf("Drop blocktxn %x that is not pending from the peer", msg.hash.ToArrayReverse())
+		return nil
+	}
+
+	if len(msg.txns) != len(pb.missing) {
+		node.AddBanScore(BANSCOREMALFORMED, "blocktxn does not match the request")
+		return ReqBlkData(node, msg.hash)
+	}
+	for i, index := range pb.missing {
+		pb.blk.Transactions[index] = msg.txns[i]
+	}
+	return completeCompactBlock(node, pb.blk)
+}
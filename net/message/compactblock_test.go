@@ -0,0 +1,296 @@
+package message
+
+import (
+	"testing"
+
+	"Elastos.ELA/common"
+	"Elastos.ELA/common/config"
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/core/ledger"
+	"Elastos.ELA/core/transaction"
+	"Elastos.ELA/core/transaction/payload"
+	"Elastos.ELA/crypto"
+	. "Elastos.ELA/net/protocol"
+)
+
+// testNoder records what a handler does to the peer, the methods it does not
+// override are not expected to be called.
+type testNoder struct {
+	Noder
+	id       uint64
+	banScore uint32
+	sent     [][]byte
+	pool     map[common.Uint256]*transaction.Transaction
+}
+
+func (n *testNoder) GetID() uint64                           { return n.id }
+func (n *testNoder) LocalNode() Noder                        { return n }
+func (n *testNoder) AddBanScore(score uint32, reason string) { n.banScore += score }
+func (n *testNoder) AddRequestedBlock(hash common.Uint256)   {}
+func (n *testNoder) Tx(buf []byte)                           { n.sent = append(n.sent, buf) }
+func (n *testNoder) IsNeighborNoder(Noder) bool              { return true }
+func (n *testNoder) GetTxnPool(bool) map[common.Uint256]*transaction.Transaction {
+	return n.pool
+}
+
+// testBlockStore knows the blocks of the set only.
+type testBlockStore struct {
+	ledger.ILedgerStore
+	blocks map[common.Uint256]bool
+}
+
+func (s *testBlockStore) IsBlockInStore(hash common.Uint256) bool { return s.blocks[hash] }
+
+// newTestCompactBlock returns a block of a coinbase and count transfers.
+func newTestCompactBlock(t *testing.T, count int) *ledger.Block {
+	log.Init()
+	coinbase, _ := transaction.NewCoinBaseTransaction(&payload.CoinBase{}, 1)
+	coinbase.Outputs = []*transaction.TxOutput{{Value: 100}}
+	txns := []*transaction.Transaction{coinbase}
+	for i := 0; i < count; i++ {
+		txn, _ := transaction.NewTransferAssetTransaction(
+			[]*transaction.UTXOTxInput{{ReferTxID: common.Uint256{byte(i + 1)}}},
+			[]*transaction.TxOutput{{Value: common.Fixed64(i + 1)}})
+		txns = append(txns, txn)
+	}
+	var txids []common.Uint256
+	for _, txn := range txns {
+		txids = append(txids, txn.Hash())
+	}
+	root, err := crypto.ComputeRoot(txids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ledger.Block{
+		Blockdata:    &ledger.Blockdata{Height: 1, Timestamp: 1514000000, TransactionsRoot: root},
+		Transactions: txns,
+	}
+}
+
+func TestCompactBlockSerialization(t *testing.T) {
+	b := newTestCompactBlock(t, 3)
+	buf, err := NewCompactBlock(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg compactBlock
+	if err := msg.Deserialization(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := msg.Verify(buf[MSGHDRLEN:]); err != nil {
+		t.Fatal(err)
+	}
+	if msg.header.Hash() != b.Hash() {
+		t.Fatal("header is changed by the round trip")
+	}
+	if len(msg.prefilled) != 1 || msg.prefilled[0].index != 0 || msg.prefilled[0].txn.Hash() != b.Transactions[0].Hash() {
+		t.Fatal("coinbase is not prefilled")
+	}
+	key := shortIDKey(b.Hash(), msg.nonce)
+	if len(msg.shortIDs) != 3 {
+		t.Fatalf("%d short IDs, want 3", len(msg.shortIDs))
+	}
+	for i, id := range msg.shortIDs {
+		if id != shortID(key, b.Transactions[i+1].Hash()) {
+			t.Fatalf("short ID %d does not match its transaction", i)
+		}
+	}
+
+	again, err := msg.Serialization()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(buf) {
+		t.Fatal("serialization of a deserialized cmpctblock differs")
+	}
+}
+
+func TestBlockTxnSerialization(t *testing.T) {
+	b := newTestCompactBlock(t, 2)
+	hash := b.Hash()
+
+	buf, err := NewBlockTxnReq(hash, []uint32{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req blockTxnReq
+	if err := req.Deserialization(buf); err != nil {
+		t.Fatal(err)
+	}
+	if req.hash != hash || len(req.indexes) != 2 || req.indexes[0] != 1 || req.indexes[1] != 2 {
+		t.Fatalf("getblocktxn round trip gives %x %v", req.hash, req.indexes)
+	}
+
+	buf, err = NewBlockTxn(hash, b.Transactions[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp blockTxn
+	if err := resp.Deserialization(buf); err != nil {
+		t.Fatal(err)
+	}
+	if resp.hash != hash || len(resp.txns) != 2 || resp.txns[1].Hash() != b.Transactions[2].Hash() {
+		t.Fatal("blocktxn round trip changes the transactions")
+	}
+}
+
+func TestCompactBlockRebuild(t *testing.T) {
+	b := newTestCompactBlock(t, 4)
+	buf, _ := NewCompactBlock(b)
+	var msg compactBlock
+	if err := msg.Deserialization(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pool has the transactions 1 and 3 and one the block lacks
+	other := newTestCompactBlock(t, 6).Transactions[5]
+	pool := map[common.Uint256]*transaction.Transaction{
+		b.Transactions[1].Hash(): b.Transactions[1],
+		b.Transactions[3].Hash(): b.Transactions[3],
+		other.Hash():             other,
+	}
+	blk, missing, err := msg.rebuild(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 2 || missing[0] != 2 || missing[1] != 4 {
+		t.Fatalf("missing %v, want [2 4]", missing)
+	}
+	for _, index := range missing {
+		blk.Transactions[index] = b.Transactions[index]
+	}
+	if blk.Hash() != b.Hash() {
+		t.Fatal("rebuilt block has another hash")
+	}
+	for i, txn := range blk.Transactions {
+		if txn.Hash() != b.Transactions[i].Hash() {
+			t.Fatalf("transaction %d is not rebuilt", i)
+		}
+	}
+
+	// a full pool leaves nothing to request
+	for _, txn := range b.Transactions[1:] {
+		pool[txn.Hash()] = txn
+	}
+	if _, missing, _ := msg.rebuild(pool); len(missing) != 0 {
+		t.Fatalf("missing %v with a full pool", missing)
+	}
+
+	msg.prefilled = append(msg.prefilled, prefilledTxn{index: 0, txn: b.Transactions[0]})
+	if _, _, err := msg.rebuild(pool); err == nil {
+		t.Fatal("duplicate prefilled index accepted")
+	}
+}
+
+func TestPendingCompactBlockPerPeer(t *testing.T) {
+	b := newTestCompactBlock(t, 2)
+	hash := b.Hash()
+	first := &testNoder{id: 1}
+	second := &testNoder{id: 2}
+	third := &testNoder{id: 3}
+	addPendingCompactBlock(first.id, b, []uint32{1, 2})
+	addPendingCompactBlock(second.id, b, []uint32{2})
+
+	// a blocktxn of the wrong size is checked against the entry of its own
+	// peer, the entry of the other peer is kept
+	resp := blockTxn{hash: hash, txns: b.Transactions[2:]}
+	if err := resp.Handle(first); err != nil {
+		t.Fatal(err)
+	}
+	if first.banScore != BANSCOREMALFORMED || len(first.sent) != 1 {
+		t.Fatalf("short blocktxn of the first peer scored %d", first.banScore)
+	}
+	if _, ok := pendingCompactBlocks.blocks[pendingKey{hash, second.id}]; !ok {
+		t.Fatal("partial block of the second peer is dropped")
+	}
+
+	// an answer that matches nothing pending is dropped without a score
+	if err := resp.Handle(third); err != nil || third.banScore != 0 {
+		t.Fatalf("unmatched blocktxn scored %d", third.banScore)
+	}
+	if err := resp.Handle(first); err != nil || first.banScore != BANSCOREMALFORMED {
+		t.Fatal("repeated blocktxn is scored")
+	}
+	takePendingCompactBlock(second.id, hash)
+}
+
+// mineTestBlock sets the easiest target on the block and solves it.
+func mineTestBlock(b *ledger.Block) {
+	b.Blockdata.Bits = 0x207fffff
+	for ledger.CheckProofOfWork(b.Blockdata, config.Parameters.ChainParam.PowLimit) != nil {
+		b.Blockdata.AuxPow.ParBlockHeader.Nonce++
+	}
+}
+
+func TestCompactBlockHeaderChecked(t *testing.T) {
+	defaultLedger := ledger.DefaultLedger
+	defer func() { ledger.DefaultLedger = defaultLedger }()
+	parent := common.Uint256{0x01}
+	ledger.DefaultLedger = &ledger.Ledger{Store: &testBlockStore{blocks: map[common.Uint256]bool{parent: true}}}
+
+	b := newTestCompactBlock(t, 2)
+	b.Blockdata.PrevBlockHash = parent
+	var msg compactBlock
+	msg.header = *b.Blockdata
+	msg.prefilled = []prefilledTxn{{index: 0, txn: b.Transactions[0]}}
+	msg.shortIDs = []uint64{1, 2}
+
+	// a header without its proof of work is scored and nothing is kept
+	peer := &testNoder{id: 1}
+	if err := msg.Handle(peer); err == nil || peer.banScore != BANSCOREINVALIDHEADER {
+		t.Fatalf("header without proof of work scored %d", peer.banScore)
+	}
+
+	// a block of an unknown parent is requested in full
+	b.Blockdata.PrevBlockHash = common.Uint256{0x02}
+	mineTestBlock(b)
+	msg.header = *b.Blockdata
+	peer = &testNoder{id: 1}
+	if err := msg.Handle(peer); err != nil || peer.banScore != 0 || len(peer.sent) != 1 {
+		t.Fatalf("compact block of an unknown parent scored %d, sent %d", peer.banScore, len(peer.sent))
+	}
+	if len(pendingCompactBlocks.blocks) != 0 {
+		t.Fatal("partial block of an unknown parent is kept")
+	}
+
+	// a valid header on a known parent waits for its transactions
+	b.Blockdata.PrevBlockHash = parent
+	mineTestBlock(b)
+	msg.header = *b.Blockdata
+	if err := msg.Handle(peer); err != nil || len(peer.sent) != 2 {
+		t.Fatal(err)
+	}
+	if _, ok := takePendingCompactBlock(peer.id, b.Hash()); !ok {
+		t.Fatal("partial block of a valid header is not kept")
+	}
+}
+
+func TestPendingCompactBlockLimits(t *testing.T) {
+	defer func() { pendingCompactBlocks.blocks = make(map[pendingKey]*partialBlock) }()
+	b := newTestCompactBlock(t, 1)
+	newBlock := func(height uint32) *ledger.Block {
+		header := *b.Blockdata
+		header.Height = height
+		return &ledger.Block{Blockdata: &header, Transactions: b.Transactions}
+	}
+
+	for i := uint32(0); i < maxPeerPendingCompactBlocks; i++ {
+		if !addPendingCompactBlock(1, newBlock(i), []uint32{1}) {
+			t.Fatalf("partial block %d of the peer is refused", i)
+		}
+	}
+	if addPendingCompactBlock(1, newBlock(maxPeerPendingCompactBlocks), []uint32{1}) {
+		t.Fatal("partial block over the peer limit is kept")
+	}
+	// the same block again replaces its entry
+	if !addPendingCompactBlock(1, newBlock(0), []uint32{1}) {
+		t.Fatal("pending block of the peer is not replaced")
+	}
+
+	for peer := uint64(2); len(pendingCompactBlocks.blocks) < maxPendingCompactBlocks; peer++ {
+		addPendingCompactBlock(peer, newBlock(0), []uint32{1})
+	}
+	if addPendingCompactBlock(1000, newBlock(0), []uint32{1}) {
+		t.Fatal("partial block over the global limit is kept")
+	}
+}
@@ -0,0 +1,158 @@
+package message
+
+import (
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/common/serialization"
+	"Elastos.ELA/net/bloom"
+	. "Elastos.ELA/net/protocol"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The filterload message loads a bloom filter on the remote node, after
+// which only matching transactions are relayed to it.
+type filterload struct {
+	msgHdr
+	filter    []byte
+	hashFuncs uint32
+	tweak     uint32
+	flags     uint8
+}
+
+// The filteradd message adds a single data element to the loaded filter.
+type filteradd struct {
+	msgHdr
+	data []byte
+}
+
+// The filterclear message removes the loaded filter.
+type filterclear struct {
+	msgHdr
+}
+
+func (msg filterload) Verify(buf []byte) error {
+	err := msg.msgHdr.Verify(buf)
+	// TODO verify the message Content
+	return err
+}
+
+func (msg filterload) Handle(node Noder) error {
+	log.Debug("RX filterload message")
+	if len(msg.filter) == 0 {
+		node.AddBanScore(BANSCOREMALFORMED, "empty filterload")
+		return errors.New("filterload with an empty filter")
+	}
+	if len(msg.filter) > bloom.MaxFilterLoadFilterSize {
+		node.AddBanScore(BANSCOREMALFORMED, "oversized filterload")
+		return fmt.Errorf("filterload size %d exceeds max %d",
+			len(msg.filter), bloom.MaxFilterLoadFilterSize)
+	}
+	if msg.hashFuncs > bloom.MaxFilterLoadHashFuncs {
+		node.AddBanScore(BANSCOREMALFORMED, "filterload with too many hash functions")
+		return fmt.Errorf("filterload hash functions %d exceeds max %d",
+			msg.hashFuncs, bloom.MaxFilterLoadHashFuncs)
+	}
+
+	node.LoadFilter(bloom.LoadFilter(msg.filter, msg.hashFuncs,
+		msg.tweak, bloom.BloomUpdateType(msg.flags)))
+	return nil
+}
+
+func (msg filterload) Serialization() ([]byte, error) {
+	hdrBuf, err := msg.msgHdr.Serialization()
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(hdrBuf)
+	err = serialization.WriteVarBytes(buf, msg.filter)
+	if err != nil {
+		return nil, err
+	}
+	serialization.WriteUint32(buf, msg.hashFuncs)
+	serialization.WriteUint32(buf, msg.tweak)
+	serialization.WriteUint8(buf, msg.flags)
+
+	return buf.Bytes(), err
+}
+
+func (msg *filterload) Deserialization(p []byte) error {
+	buf := bytes.NewBuffer(p)
+	err := binary.Read(buf, binary.LittleEndian, &(msg.msgHdr))
+	if err != nil {
+		log.Warn("Parse filterload message hdr error")
+		return errors.New("Parse filterload message hdr error")
+	}
+
+	msg.filter, err = serialization.ReadVarBytes(buf)
+	if err != nil {
+		return err
+	}
+	msg.hashFuncs, err = serialization.ReadUint32(buf)
+	if err != nil {
+		return err
+	}
+	msg.tweak, err = serialization.ReadUint32(buf)
+	if err != nil {
+		return err
+	}
+	msg.flags, err = serialization.ReadUint8(buf)
+	return err
+}
+
+func (msg filteradd) Verify(buf []byte) error {
+	err := msg.msgHdr.Verify(buf)
+	// TODO verify the message Content
+	return err
+}
+
+func (msg filteradd) Handle(node Noder) error {
+	log.Debug("RX filteradd message")
+	if len(msg.data) > bloom.MaxFilterAddDataSize {
+		node.AddBanScore(BANSCOREMALFORMED, "oversized filteradd")
+		return fmt.Errorf("filteradd size %d exceeds max %d",
+			len(msg.data), bloom.MaxFilterAddDataSize)
+	}
+
+	filter := node.GetFilter()
+	if !filter.IsLoaded() {
+		node.AddBanScore(BANSCOREUNSOLICITED, "filteradd with no filter loaded")
+		return errors.New("filteradd received with no filter loaded")
+	}
+	filter.Add(msg.data)
+	return nil
+}
+
+func (msg filteradd) Serialization() ([]byte, error) {
+	hdrBuf, err := msg.msgHdr.Serialization()
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(hdrBuf)
+	err = serialization.WriteVarBytes(buf, msg.data)
+
+	return buf.Bytes(), err
+}
+
+func (msg *filteradd) Deserialization(p []byte) error {
+	buf := bytes.NewBuffer(p)
+	err := binary.Read(buf, binary.LittleEndian, &(msg.msgHdr))
+	if err != nil {
+		log.Warn("Parse filteradd message hdr error")
+		return errors.New("Parse filteradd message hdr error")
+	}
+
+	msg.data, err = serialization.ReadVarBytes(buf)
+	return err
+}
+
+func (msg filterclear) Handle(node Noder) error {
+	log.Debug("RX filterclear message")
+	filter := node.GetFilter()
+	if !filter.IsLoaded() {
+		return errors.New("filterclear received with no filter loaded")
+	}
+	filter.Unload()
+	return nil
+}
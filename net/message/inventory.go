@@ -209,9 +209,13 @@ func (msg Inv) Handle(node Noder) error {
 	case TRANSACTION:
 		log.Debug("RX TRX message")
 		// TODO check the ID queue
-		id.Deserialize(bytes.NewReader(msg.P.Blk[:32]))
-		if !node.ExistedID(id) {
-			reqTxnData(node, id)
+		var i uint32
+		for i = 0; i < msg.P.Cnt; i++ {
+			id.Deserialize(bytes.NewReader(msg.P.Blk[HASHLEN*i:]))
+			if node.LocalNode().GetTransaction(id) == nil &&
+				!ledger.DefaultLedger.Store.IsTxHashDuplicate(id) {
+				reqTxnData(node, id)
+			}
 		}
 	case BLOCK:
 		log.Debug("RX block message")
@@ -0,0 +1,86 @@
+package message
+
+import (
+	"Elastos.ELA/common/config"
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/net/bloom"
+	. "Elastos.ELA/net/protocol"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+type merkleBlock struct {
+	msgHdr
+	blk bloom.MerkleBlock
+}
+
+func NewMerkleBlockMsg(mb *bloom.MerkleBlock) ([]byte, error) {
+	log.Debug()
+	var msg merkleBlock
+	msg.blk = *mb
+	msg.msgHdr.Magic = config.Parameters.Magic
+	cmd := "merkleblock"
+	copy(msg.msgHdr.CMD[0:len(cmd)], cmd)
+	tmpBuffer := bytes.NewBuffer([]byte{})
+	err := mb.Serialize(tmpBuffer)
+	if err != nil {
+		return nil, err
+	}
+	s := sha256.Sum256(tmpBuffer.Bytes())
+	s2 := s[:]
+	s = sha256.Sum256(s2)
+	buf := bytes.NewBuffer(s[:4])
+	binary.Read(buf, binary.LittleEndian, &(msg.msgHdr.Checksum))
+	msg.msgHdr.Length = uint32(len(tmpBuffer.Bytes()))
+	log.Debug("The message payload length is ", msg.msgHdr.Length)
+
+	m, err := msg.Serialization()
+	if err != nil {
+		log.Error("Error Convert net message ", err.Error())
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (msg merkleBlock) Verify(buf []byte) error {
+	err := msg.msgHdr.Verify(buf)
+	// TODO verify the message Content
+	return err
+}
+
+func (msg merkleBlock) Handle(node Noder) error {
+	// Full nodes only serve merkle blocks, they never request them.
+	log.Debug("RX merkleblock message")
+	return nil
+}
+
+func (msg merkleBlock) Serialization() ([]byte, error) {
+	hdrBuf, err := msg.msgHdr.Serialization()
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(hdrBuf)
+	err = msg.blk.Serialize(buf)
+
+	return buf.Bytes(), err
+}
+
+func (msg *merkleBlock) Deserialization(p []byte) error {
+	buf := bytes.NewBuffer(p)
+	err := binary.Read(buf, binary.LittleEndian, &(msg.msgHdr))
+	if err != nil {
+		log.Warn("Parse merkleblock message hdr error")
+		return errors.New("Parse merkleblock message hdr error")
+	}
+
+	err = msg.blk.Deserialize(buf)
+	if err != nil {
+		log.Warn("Parse merkleblock message error")
+		return errors.New("Parse merkleblock message error")
+	}
+
+	return nil
+}
@@ -39,21 +39,6 @@ type varStr struct {
 	buf []byte
 }
 
-type filteradd struct {
-	msgHdr
-	//TBD
-}
-
-type filterclear struct {
-	msgHdr
-	//TBD
-}
-
-type filterload struct {
-	msgHdr
-	//TBD
-}
-
 // Alloc different message stucture
 // @t the message name or type
 // @len the message length only valid for varible length structure
@@ -137,12 +122,25 @@ func AllocMsg(t string, length int) Messager {
 		var msg txnPool
 		copy(msg.msgHdr.CMD[0:len(t)], t)
 		return &msg
+	case "cmpctblock":
+		var msg compactBlock
+		copy(msg.msgHdr.CMD[0:len(t)], t)
+		return &msg
+	case "getblocktxn":
+		var msg blockTxnReq
+		copy(msg.msgHdr.CMD[0:len(t)], t)
+		return &msg
+	case "blocktxn":
+		var msg blockTxn
+		copy(msg.msgHdr.CMD[0:len(t)], t)
+		return &msg
 	case "alert":
 		log.Warn("Not supported message type - alert")
 		return nil
 	case "merkleblock":
-		log.Warn("Not supported message type - merkleblock")
-		return nil
+		var msg merkleBlock
+		copy(msg.msgHdr.CMD[0:len(t)], t)
+		return &msg
 	case "notfound":
 		var msg notFound
 		copy(msg.msgHdr.CMD[0:len(t)], t)
@@ -204,35 +202,31 @@ func HandleNodeMsg(node Noder, buf []byte, len int) error {
 		return err
 	}
 
-	if s == "inv" || s == "block" {
+	if s == "inv" || s == "block" || s == "cmpctblock" || s == "blocktxn" {
 		node.LocalNode().AcqSyncBlkReqSem()
-		msg := AllocMsg(s, len)
-		if msg == nil {
-			log.Error(fmt.Sprintf("Allocation message %s failed", s))
-			return errors.New("Allocation message failed")
-		}
-		// Todo attach a node pointer to each message
-		// Todo drop the message when verify/deseria packet error
-		msg.Deserialization(buf[:len])
-		msg.Verify(buf[MSGHDRLEN:len])
-
-		errr := msg.Handle(node)
-		node.LocalNode().RelSyncBlkReqSem()
-		return errr
-	} else {
-		msg := AllocMsg(s, len)
-		if msg == nil {
-			log.Error(fmt.Sprintf("Allocation message %s failed", s))
-			return errors.New("Allocation message failed")
-		}
-		// Todo attach a node pointer to each message
-		// Todo drop the message when verify/deseria packet error
-		msg.Deserialization(buf[:len])
-		msg.Verify(buf[MSGHDRLEN:len])
+		defer node.LocalNode().RelSyncBlkReqSem()
+	}
 
-		errr := msg.Handle(node)
-		return errr
+	msg := AllocMsg(s, len)
+	if msg == nil {
+		log.Error(fmt.Sprintf("Allocation message %s failed", s))
+		return errors.New("Allocation message failed")
+	}
+	// only the known commands are counted, a peer must not be able to
+	// create new metric labels
+	receivedMessages.Inc(s)
+	receivedBytes.Add(s, uint64(len))
+	// Todo attach a node pointer to each message
+	if err := msg.Deserialization(buf[:len]); err != nil {
+		node.AddBanScore(BANSCOREMALFORMED, "malformed "+s+" message")
+		return err
 	}
+	if err := msg.Verify(buf[MSGHDRLEN:len]); err != nil {
+		node.AddBanScore(BANSCOREMALFORMED, s+" message "+err.Error())
+		return err
+	}
+
+	return msg.Handle(node)
 }
 
 func magicVerify(magic uint32) bool {
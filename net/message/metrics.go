@@ -0,0 +1,34 @@
+package message
+
+import (
+	"Elastos.ELA/common/metrics"
+	. "Elastos.ELA/net/protocol"
+)
+
+var (
+	receivedMessages = metrics.NewCounterVec("ela_p2p_received_messages_total",
+		"Messages received from peers by command.", "command")
+	receivedBytes = metrics.NewCounterVec("ela_p2p_received_bytes_total",
+		"Bytes received from peers by command, headers included.", "command")
+	sentMessages = metrics.NewCounterVec("ela_p2p_sent_messages_total",
+		"Messages sent to peers by command.", "command")
+	sentBytes = metrics.NewCounterVec("ela_p2p_sent_bytes_total",
+		"Bytes sent to peers by command, headers included.", "command")
+	blockValidationSeconds = metrics.NewHistogram("ela_block_validation_seconds",
+		"Time taken to validate and add a received block.", metrics.DefaultBuckets)
+	txValidationSeconds = metrics.NewHistogram("ela_tx_validation_seconds",
+		"Time taken to validate a received transaction for the pool.", metrics.DefaultBuckets)
+)
+
+// CountSentMessage records a message written to a peer.
+func CountSentMessage(buf []byte) {
+	if len(buf) < MSGHDRLEN {
+		return
+	}
+	cmd, err := MsgType(buf)
+	if err != nil {
+		return
+	}
+	sentMessages.Inc(cmd)
+	sentBytes.Add(cmd, uint64(len(buf)))
+}
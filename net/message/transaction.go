@@ -12,6 +12,7 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"errors"
+	"time"
 )
 
 type dataReq struct {
@@ -34,7 +35,13 @@ func (msg trn) Handle(node Noder) error {
 	log.Debug("RX Transaction message")
 	tx := &msg.txn
 	if !node.LocalNode().ExistedID(tx.Hash()) {
-		if errCode := node.LocalNode().AppendTxnPool(&(msg.txn)); errCode != Success {
+		start := time.Now()
+		errCode := node.LocalNode().AppendTxnPool(&(msg.txn))
+		txValidationSeconds.ObserveSince(start)
+		if errCode != Success {
+			if isInvalidTxn(errCode) {
+				node.AddBanScore(BANSCOREINVALIDTX, "invalid transaction: "+errCode.Error())
+			}
 			return errors.New("[message] VerifyTransaction failed when AppendTxnPool.")
 		}
 		node.LocalNode().Relay(node, tx)
@@ -47,14 +54,45 @@ func (msg trn) Handle(node Noder) error {
 	return nil
 }
 
+// isInvalidTxn returns whether the transaction can never be valid, a double
+// spend or a full pool may just be a race with another peer.
+func isInvalidTxn(errCode ErrCode) bool {
+	switch errCode {
+	case ErrInvalidInput, ErrInvalidOutput, ErrAssetPrecision,
+		ErrTransactionBalance, ErrAttributeProgram, ErrTransactionContracts,
+		ErrTransactionPayload, ErrTransactionSize, ErrIneffectiveCoinbase:
+		return true
+	}
+	return false
+}
+
 func reqTxnData(node Noder, hash common.Uint256) error {
 	var msg dataReq
 	msg.dataType = common.TRANSACTION
-	// TODO handle the hash array case
-	//msg.hash = hash
+	msg.hash = hash
 
-	buf, _ := msg.Serialization()
-	go node.Tx(buf)
+	msg.msgHdr.Magic = config.Parameters.Magic
+	copy(msg.msgHdr.CMD[0:7], "getdata")
+	p := bytes.NewBuffer([]byte{})
+	err := binary.Write(p, binary.LittleEndian, &(msg.dataType))
+	msg.hash.Serialize(p)
+	if err != nil {
+		log.Error("Binary Write failed at new getdata Msg")
+		return err
+	}
+	s := sha256.Sum256(p.Bytes())
+	s2 := s[:]
+	s = sha256.Sum256(s2)
+	buf := bytes.NewBuffer(s[:4])
+	binary.Read(buf, binary.LittleEndian, &(msg.msgHdr.Checksum))
+	msg.msgHdr.Length = uint32(len(p.Bytes()))
+
+	sendBuf, err := msg.Serialization()
+	if err != nil {
+		log.Error("Error Convert net message ", err.Error())
+		return err
+	}
+	go node.Tx(sendBuf)
 	return nil
 }
 
@@ -171,3 +209,39 @@ func ReqTxnPool(node Noder) error {
 
 	return nil
 }
+
+// Handle answers a txnpool request with inv messages of the transactions
+// in the local pool, only those matching the peer's bloom filter if loaded.
+func (msg txnPool) Handle(node Noder) error {
+	log.Debug("RX txnpool message")
+	filter := node.GetFilter()
+	var count uint32
+	buf := bytes.NewBuffer([]byte{})
+	for hash, txn := range node.LocalNode().GetTxnPool(false) {
+		if filter.IsLoaded() && !filter.MatchTxAndUpdate(txn) {
+			continue
+		}
+		hash.Serialize(buf)
+		count++
+		if count == MAXINVHDRCNT {
+			if err := sendTxnInv(node, count, buf.Bytes()); err != nil {
+				return err
+			}
+			count = 0
+			buf = bytes.NewBuffer([]byte{})
+		}
+	}
+	if count > 0 {
+		return sendTxnInv(node, count, buf.Bytes())
+	}
+	return nil
+}
+
+func sendTxnInv(node Noder, count uint32, hashes []byte) error {
+	buf, err := NewInv(NewInvPayload(common.TRANSACTION, count, hashes))
+	if err != nil {
+		return err
+	}
+	go node.Tx(buf)
+	return nil
+}
@@ -59,6 +59,7 @@ func (msg verACK) Handle(node Noder) error {
 	}
 
 	node.SetState(ESTABLISH)
+	node.LocalNode().MarkAddressGood(node.GetID())
 
 	if s == HANDSHAKE {
 		buf, _ := NewVerack()
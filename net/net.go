@@ -13,6 +13,7 @@ import (
 
 type Neter interface {
 	GetTxnPool(byCount bool) map[Uint256]*transaction.Transaction
+	GetTxnPoolByFeeRate() []*transaction.Transaction
 	Xmit(interface{}) error
 	GetEvent(eventName string) *events.Event
 	GetBookKeepersAddrs() ([]*crypto.PubKey, uint64)
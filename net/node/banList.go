@@ -0,0 +1,197 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/events"
+	. "Elastos.ELA/net/protocol"
+)
+
+// BanListFile keeps the banned IPs across restarts, it is kept in the data
+// directory.
+const BanListFile = "banlist.json"
+
+type banList struct {
+	sync.RWMutex
+	path string
+	bans map[string]BanEntry
+}
+
+func (bl *banList) init(path string) {
+	bl.path = path
+	bl.bans = make(map[string]BanEntry)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn("Read ban list error: ", err)
+		}
+		return
+	}
+	var entries []BanEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		log.Warn("Parse ban list error: ", err)
+		return
+	}
+	now := time.Now().Unix()
+	for _, entry := range entries {
+		if entry.Until > now {
+			bl.bans[entry.Addr] = entry
+		}
+	}
+	log.Infof("Loaded %d banned addresses", len(bl.bans))
+}
+
+// save writes the ban list, the caller must hold the lock.
+func (bl *banList) save() {
+	entries := make([]BanEntry, 0, len(bl.bans))
+	for _, entry := range bl.bans {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Addr < entries[j].Addr })
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		log.Error("Marshal ban list error: ", err)
+		return
+	}
+	tmp := bl.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		log.Error("Write ban list error: ", err)
+		return
+	}
+	if err := os.Rename(tmp, bl.path); err != nil {
+		log.Error("Write ban list error: ", err)
+	}
+}
+
+func (bl *banList) isBanned(addr string) bool {
+	bl.RLock()
+	entry, ok := bl.bans[addr]
+	bl.RUnlock()
+	return ok && entry.Until > time.Now().Unix()
+}
+
+func (bl *banList) ban(entry BanEntry) {
+	bl.Lock()
+	defer bl.Unlock()
+	if old, ok := bl.bans[entry.Addr]; ok && old.Until > entry.Until {
+		return
+	}
+	bl.bans[entry.Addr] = entry
+	bl.save()
+}
+
+func (bl *banList) unban(addr string) bool {
+	bl.Lock()
+	defer bl.Unlock()
+	if _, ok := bl.bans[addr]; !ok {
+		return false
+	}
+	delete(bl.bans, addr)
+	bl.save()
+	return true
+}
+
+func (bl *banList) list() []BanEntry {
+	bl.Lock()
+	defer bl.Unlock()
+	now := time.Now().Unix()
+	entries := make([]BanEntry, 0, len(bl.bans))
+	expired := false
+	for addr, entry := range bl.bans {
+		if entry.Until <= now {
+			delete(bl.bans, addr)
+			expired = true
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if expired {
+		bl.save()
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Addr < entries[j].Addr })
+	return entries
+}
+
+func (bl *banList) clear() {
+	bl.Lock()
+	defer bl.Unlock()
+	bl.bans = make(map[string]BanEntry)
+	bl.save()
+}
+
+// AddBanScore adds score to the misbehavior score of the peer, the peer is
+// disconnected and banned once the score reaches BANTHRESHOLD.
+func (node *node) AddBanScore(score uint32, reason string) {
+	if node == node.local {
+		return
+	}
+	total := atomic.AddUint32(&node.banScore, score)
+	log.Warnf("Peer %s misbehaving: %s, ban score increased to %d", node.addr, reason, total)
+	if total >= BANTHRESHOLD && total-score < BANTHRESHOLD {
+		node.local.BanAddr(node.addr, BANDURATION*time.Second, reason)
+	}
+}
+
+func (node *node) GetBanScore() uint32 {
+	return atomic.LoadUint32(&node.banScore)
+}
+
+func (node *node) IsBanned(addr string) bool {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return node.local.banList.isBanned(addr)
+}
+
+// BanAddr bans the IP addr for duration and disconnects the peers from it.
+func (node *node) BanAddr(addr string, duration time.Duration, reason string) error {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return errors.New("invalid IP address " + addr)
+	}
+	if duration <= 0 {
+		return errors.New("invalid ban duration")
+	}
+	addr = ip.String()
+	local := node.local
+	local.banList.ban(BanEntry{
+		Addr:   addr,
+		Until:  time.Now().Add(duration).Unix(),
+		Reason: reason,
+	})
+	log.Infof("Banned %s until %s: %s", addr, time.Now().Add(duration).Format(time.RFC3339), reason)
+
+	local.nbrNodes.RLock()
+	defer local.nbrNodes.RUnlock()
+	for _, n := range local.nbrNodes.List {
+		if n.addr == addr {
+			local.eventQueue.GetEvent("disconnect").Notify(events.EventNodeDisconnect, n)
+		}
+	}
+	return nil
+}
+
+func (node *node) UnbanAddr(addr string) bool {
+	if ip := net.ParseIP(addr); ip != nil {
+		addr = ip.String()
+	}
+	return node.local.banList.unban(addr)
+}
+
+func (node *node) GetBannedAddrs() []BanEntry {
+	return node.local.banList.list()
+}
+
+func (node *node) ClearBannedAddrs() {
+	node.local.banList.clear()
+}
@@ -0,0 +1,121 @@
+package node
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"Elastos.ELA/common/log"
+	. "Elastos.ELA/net/protocol"
+)
+
+func newTestBanList(t *testing.T) (*banList, func()) {
+	log.Init()
+	dir, err := ioutil.TempDir("", "banlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bl := new(banList)
+	bl.init(filepath.Join(dir, BanListFile))
+	return bl, func() { os.RemoveAll(dir) }
+}
+
+func TestBanListExpiry(t *testing.T) {
+	bl, cleanup := newTestBanList(t)
+	defer cleanup()
+
+	now := time.Now().Unix()
+	bl.ban(BanEntry{Addr: "10.0.0.1", Until: now + 3600, Reason: "test"})
+	bl.ban(BanEntry{Addr: "10.0.0.2", Until: now - 1, Reason: "test"})
+	if !bl.isBanned("10.0.0.1") {
+		t.Fatal("banned address is not banned")
+	}
+	if bl.isBanned("10.0.0.2") {
+		t.Fatal("expired ban is still in force")
+	}
+	if entries := bl.list(); len(entries) != 1 || entries[0].Addr != "10.0.0.1" {
+		t.Fatalf("list has %v, want the unexpired ban", entries)
+	}
+	if _, ok := bl.bans["10.0.0.2"]; ok {
+		t.Fatal("expired ban is kept after listing")
+	}
+
+	// a shorter ban does not cut an existing one
+	bl.ban(BanEntry{Addr: "10.0.0.1", Until: now + 60})
+	if bl.bans["10.0.0.1"].Until != now+3600 {
+		t.Fatal("ban is shortened")
+	}
+	bl.ban(BanEntry{Addr: "10.0.0.1", Until: now + 7200})
+	if bl.bans["10.0.0.1"].Until != now+7200 {
+		t.Fatal("ban is not extended")
+	}
+}
+
+func TestBanListReload(t *testing.T) {
+	bl, cleanup := newTestBanList(t)
+	defer cleanup()
+
+	now := time.Now().Unix()
+	bl.ban(BanEntry{Addr: "10.0.0.1", Until: now + 3600, Reason: "bad headers"})
+	bl.ban(BanEntry{Addr: "10.0.0.2", Until: now + 3600})
+	bl.ban(BanEntry{Addr: "10.0.0.3", Until: now + 3600})
+	if !bl.unban("10.0.0.2") || bl.unban("10.0.0.4") {
+		t.Fatal("unexpected unban result")
+	}
+	// expires while the node is down
+	bl.bans["10.0.0.3"] = BanEntry{Addr: "10.0.0.3", Until: now - 1}
+	bl.save()
+
+	reloaded := new(banList)
+	reloaded.init(bl.path)
+	if len(reloaded.bans) != 1 {
+		t.Fatalf("reloaded %d bans, want 1", len(reloaded.bans))
+	}
+	if entry := reloaded.bans["10.0.0.1"]; entry.Until != now+3600 || entry.Reason != "bad headers" {
+		t.Fatalf("reloaded ban %+v", entry)
+	}
+
+	reloaded.clear()
+	cleared := new(banList)
+	cleared.init(bl.path)
+	if len(cleared.bans) != 0 {
+		t.Fatal("cleared bans are reloaded")
+	}
+}
+
+func TestBanListBrokenFile(t *testing.T) {
+	bl, cleanup := newTestBanList(t)
+	defer cleanup()
+
+	if err := ioutil.WriteFile(bl.path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	broken := new(banList)
+	broken.init(bl.path)
+	if broken.bans == nil || len(broken.bans) != 0 {
+		t.Fatal("broken ban list is not ignored")
+	}
+	broken.ban(BanEntry{Addr: "10.0.0.1", Until: time.Now().Unix() + 60})
+	if !broken.isBanned("10.0.0.1") {
+		t.Fatal("ban list is unusable after a broken file")
+	}
+}
+
+func TestParseIPaddr(t *testing.T) {
+	log.Init()
+	for s, want := range map[string]string{
+		"10.0.0.1:20338":  "10.0.0.1",
+		"[::1]:20338":     "::1",
+		"[2001:db8::1]:1": "2001:db8::1",
+	} {
+		host, err := parseIPaddr(s)
+		if err != nil || host != want {
+			t.Fatalf("parseIPaddr(%q) = %q, %v, want %q", s, host, err, want)
+		}
+	}
+	if _, err := parseIPaddr("10.0.0.1"); err == nil {
+		t.Fatal("address without a port is accepted")
+	}
+}
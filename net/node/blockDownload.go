@@ -0,0 +1,176 @@
+package node
+
+import (
+	"sync"
+	"time"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/core/ledger"
+	. "Elastos.ELA/net/message"
+	. "Elastos.ELA/net/protocol"
+)
+
+// blockDownloader spreads the block requests of headers-first sync over all
+// the neighbors that have the blocks, at most MAXREQBLKONCE in flight on
+// each of them. A request that is not answered within BLOCKREQUESTTIMEOUT
+// is given to another peer.
+type blockDownloader struct {
+	sync.Mutex
+	requests map[Uint256]*blockRequest
+	inFlight map[uint64]int
+	// stalled keeps the peer a block request timed out on until the
+	// block is requested again
+	stalled map[Uint256]uint64
+}
+
+type blockRequest struct {
+	peer uint64
+	sent time.Time
+}
+
+func (d *blockDownloader) init() {
+	d.requests = make(map[Uint256]*blockRequest)
+	d.inFlight = make(map[uint64]int)
+	d.stalled = make(map[Uint256]uint64)
+}
+
+func (d *blockDownloader) release(hash Uint256) {
+	req, ok := d.requests[hash]
+	if !ok {
+		return
+	}
+	delete(d.requests, hash)
+	if d.inFlight[req.peer]--; d.inFlight[req.peer] <= 0 {
+		delete(d.inFlight, req.peer)
+	}
+}
+
+func (d *blockDownloader) complete(hash Uint256) {
+	d.Lock()
+	defer d.Unlock()
+	d.release(hash)
+	delete(d.stalled, hash)
+}
+
+func (d *blockDownloader) reset() {
+	d.Lock()
+	defer d.Unlock()
+	d.init()
+}
+
+// pickPeer returns the peer with the fewest requests in flight, the peer
+// the block stalled on is only used when there is no other.
+func (d *blockDownloader) pickPeer(peers map[uint64]*node, stalled uint64) *node {
+	var best, fallback *node
+	for id, n := range peers {
+		if d.inFlight[id] >= MAXREQBLKONCE {
+			continue
+		}
+		if id == stalled {
+			fallback = n
+			continue
+		}
+		if best == nil || d.inFlight[id] < d.inFlight[best.id] {
+			best = n
+		}
+	}
+	if best == nil {
+		return fallback
+	}
+	return best
+}
+
+// downloadPeers returns the neighbors that can serve the blocks above the
+// local height.
+func (n *node) downloadPeers() map[uint64]*node {
+	n.nbrNodes.RLock()
+	defer n.nbrNodes.RUnlock()
+
+	height := uint64(ledger.DefaultLedger.Blockchain.BlockHeight)
+	peers := make(map[uint64]*node)
+	for id, nbr := range n.nbrNodes.List {
+		if nbr.GetState() == ESTABLISH && nbr.GetHeight() > height && n.canServeBlocks(nbr) {
+			peers[id] = nbr
+		}
+	}
+	return peers
+}
+
+type blockAssignment struct {
+	peer *node
+	hash Uint256
+}
+
+// schedule releases the requests that timed out or whose peer is gone and
+// assigns the blocks of hashes that are neither requested nor stored to peers,
+// stored also tells the blocks held as orphans.
+func (d *blockDownloader) schedule(hashes []Uint256, peers map[uint64]*node,
+	stored func(Uint256) bool, now time.Time) []blockAssignment {
+	d.Lock()
+	defer d.Unlock()
+
+	for hash, req := range d.requests {
+		_, ok := peers[req.peer]
+		if ok && now.Sub(req.sent) < BLOCKREQUESTTIMEOUT*time.Second {
+			continue
+		}
+		if ok {
+			log.Infof("Block %x request to peer %d timed out", hash.ToArrayReverse(), req.peer)
+		}
+		d.release(hash)
+		d.stalled[hash] = req.peer
+	}
+
+	var assignments []blockAssignment
+	for _, hash := range hashes {
+		if _, ok := d.requests[hash]; ok {
+			continue
+		}
+		if stored(hash) {
+			continue
+		}
+		peer := d.pickPeer(peers, d.stalled[hash])
+		if peer == nil {
+			break
+		}
+		d.requests[hash] = &blockRequest{peer: peer.id, sent: now}
+		d.inFlight[peer.id]++
+		delete(d.stalled, hash)
+		assignments = append(assignments, blockAssignment{peer: peer, hash: hash})
+	}
+	return assignments
+}
+
+// haveBlock tells whether the block is stored or held as an orphan waiting
+// for its parent, neither has to be downloaded again.
+func haveBlock(hash Uint256) bool {
+	return ledger.DefaultLedger.BlockInLedger(hash) ||
+		ledger.DefaultLedger.Blockchain.IsKnownOrphan(&hash)
+}
+
+// ScheduleBlockDownloads requests the blocks of the next BLOCKDOWNLOADWINDOW
+// known headers from the neighbors and moves timed out requests to other
+// peers.
+func (n *node) ScheduleBlockDownloads() {
+	local := n.local
+	if !local.GetHeaderFisrtModeStatus() {
+		return
+	}
+	hashes := ledger.DefaultLedger.Store.GetHeaderHashes(BLOCKDOWNLOADWINDOW)
+	peers := local.downloadPeers()
+
+	assignments := local.downloader.schedule(hashes, peers, haveBlock, time.Now())
+	for _, a := range assignments {
+		if err := ReqBlkData(a.peer, a.hash); err != nil {
+			log.Error("failed build a new getdata")
+		}
+	}
+}
+
+func (n *node) downloadBlocks() {
+	ticker := time.NewTicker(time.Second)
+	for range ticker.C {
+		n.ScheduleBlockDownloads()
+	}
+}
@@ -0,0 +1,154 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	. "Elastos.ELA/common"
+	"Elastos.ELA/common/log"
+	"Elastos.ELA/core/ledger"
+	. "Elastos.ELA/net/protocol"
+)
+
+// testBlockStore knows the blocks of the set only.
+type testBlockStore struct {
+	ledger.ILedgerStore
+	blocks map[Uint256]bool
+}
+
+func (s *testBlockStore) IsBlockInStore(hash Uint256) bool { return s.blocks[hash] }
+
+func newTestDownloader(peerIDs ...uint64) (*blockDownloader, map[uint64]*node) {
+	log.Init()
+	d := new(blockDownloader)
+	d.init()
+	peers := make(map[uint64]*node)
+	for _, id := range peerIDs {
+		peers[id] = &node{id: id}
+	}
+	return d, peers
+}
+
+func testBlockHashes(count int) []Uint256 {
+	hashes := make([]Uint256, count)
+	for i := range hashes {
+		hashes[i] = Uint256{byte(i + 1)}
+	}
+	return hashes
+}
+
+func notStored(Uint256) bool { return false }
+
+func TestBlockDownloadSpread(t *testing.T) {
+	d, peers := newTestDownloader(1, 2)
+	hashes := testBlockHashes(3 * MAXREQBLKONCE)
+	now := time.Now()
+
+	assignments := d.schedule(hashes, peers, notStored, now)
+	if len(assignments) != 2*MAXREQBLKONCE {
+		t.Fatalf("%d blocks requested, want %d", len(assignments), 2*MAXREQBLKONCE)
+	}
+	if d.inFlight[1] != MAXREQBLKONCE || d.inFlight[2] != MAXREQBLKONCE {
+		t.Fatalf("requests in flight %v, want %d on each peer", d.inFlight, MAXREQBLKONCE)
+	}
+	// the first blocks are requested first
+	for i, a := range assignments {
+		if a.hash != hashes[i] {
+			t.Fatalf("assignment %d is block %x, want %x", i, a.hash, hashes[i])
+		}
+	}
+	if len(d.schedule(hashes, peers, notStored, now)) != 0 {
+		t.Fatal("blocks requested from peers without free slots")
+	}
+}
+
+func TestBlockDownloadStalledPeer(t *testing.T) {
+	d, peers := newTestDownloader(1)
+	hashes := testBlockHashes(2)
+	now := time.Now()
+	d.schedule(hashes, peers, notStored, now)
+
+	// the request is given to the new peer once it times out on peer 1
+	peers[2] = &node{id: 2}
+	if len(d.schedule(hashes, peers, notStored, now.Add(time.Second))) != 0 {
+		t.Fatal("requests in time are moved")
+	}
+	later := now.Add(BLOCKREQUESTTIMEOUT * time.Second)
+	assignments := d.schedule(hashes, peers, notStored, later)
+	if len(assignments) != 2 {
+		t.Fatalf("%d timed out blocks requested again, want 2", len(assignments))
+	}
+	for _, a := range assignments {
+		if a.peer.id != 2 {
+			t.Fatalf("block %x requested from stalled peer %d", a.hash, a.peer.id)
+		}
+	}
+	if d.inFlight[1] != 0 || d.inFlight[2] != 2 || len(d.stalled) != 0 {
+		t.Fatalf("in flight %v, stalled %v after the reassignment", d.inFlight, d.stalled)
+	}
+
+	// with no other peer the stalled one is asked again
+	delete(peers, 2)
+	assignments = d.schedule(hashes, peers, notStored, later)
+	if len(assignments) != 2 || assignments[0].peer.id != 1 {
+		t.Fatal("blocks of a disconnected peer are not requested from the stalled one")
+	}
+}
+
+func TestBlockDownloadOutOfOrder(t *testing.T) {
+	d, peers := newTestDownloader(1, 2)
+	hashes := testBlockHashes(4)
+	now := time.Now()
+	d.schedule(hashes, peers, notStored, now)
+
+	// the third block arrives before the others
+	stored := map[Uint256]bool{hashes[2]: true}
+	d.complete(hashes[2])
+	if _, ok := d.requests[hashes[2]]; ok || len(d.requests) != 3 {
+		t.Fatal("arrived block is still requested")
+	}
+	if d.inFlight[1]+d.inFlight[2] != 3 {
+		t.Fatalf("in flight %v after one arrival", d.inFlight)
+	}
+	// the headers of blocks not yet connected are still listed, the arrived
+	// block is neither requested again nor are the pending ones
+	next := append(hashes, Uint256{0xff})
+	assignments := d.schedule(next, peers, func(hash Uint256) bool { return stored[hash] }, now)
+	if len(assignments) != 1 || assignments[0].hash != next[4] {
+		t.Fatalf("%d blocks requested after an out of order arrival, want the new one", len(assignments))
+	}
+
+	// a block that arrives after its request timed out is released once
+	d.complete(hashes[0])
+	d.complete(hashes[0])
+	if d.inFlight[1]+d.inFlight[2] != 3 {
+		t.Fatalf("in flight %v after a repeated arrival", d.inFlight)
+	}
+}
+
+func TestBlockDownloadOrphan(t *testing.T) {
+	defaultLedger := ledger.DefaultLedger
+	defer func() { ledger.DefaultLedger = defaultLedger }()
+	store := &testBlockStore{blocks: make(map[Uint256]bool)}
+	ledger.DefaultLedger = &ledger.Ledger{Store: store}
+	ledger.DefaultLedger.Blockchain = ledger.NewBlockchain(0, ledger.DefaultLedger)
+
+	d, peers := newTestDownloader(1, 2)
+	hashes := testBlockHashes(2)
+	orphan := &ledger.Block{Blockdata: &ledger.Blockdata{PrevBlockHash: hashes[1], Height: 3}}
+	hashes = append(hashes, orphan.Hash())
+	store.blocks[hashes[0]] = true
+	now := time.Now()
+	if assignments := d.schedule(hashes, peers, haveBlock, now); len(assignments) != 2 {
+		t.Fatalf("%d blocks requested, want the two not stored", len(assignments))
+	}
+
+	// the last block arrives before its parent and is held as an orphan
+	ledger.DefaultLedger.Blockchain.AddOrphanBlock(orphan)
+	d.complete(orphan.Hash())
+	later := now.Add(BLOCKREQUESTTIMEOUT * time.Second)
+	assignments := d.schedule(hashes, peers, haveBlock, later)
+	if len(assignments) != 1 || assignments[0].hash != hashes[1] {
+		t.Fatalf("%d blocks requested again, want the parent of the orphan only", len(assignments))
+	}
+}
@@ -111,7 +111,9 @@ func (node *node) SyncBlks() {
 					blocator := ledger.DefaultLedger.Blockchain.BlockLocatorFromHash(&hash)
 					SendMsgSyncBlockHeaders(newSyncNode, blocator, emptyHash)
 				}
-			} else {
+			} else if !node.LocalNode().GetHeaderFisrtModeStatus() {
+				// in headers-first mode ScheduleBlockDownloads retries
+				// the stalled requests on other peers
 				for k := range rb {
 					if rb[k].Before(time.Now().Add(-3 * time.Second)) {
 						log.Infof("request block hash %x ", k.ToArrayReverse())
@@ -3,7 +3,13 @@ package node
 import (
 	"Elastos.ELA/common/log"
 	. "Elastos.ELA/net/protocol"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"net"
+	"os"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -18,11 +24,22 @@ const (
 	// numRetries is the number of tried without a single success before
 	// we assume an address is bad.
 	numRetries = 10
+	// maxGroupAddresses is the number of addresses kept from one network
+	// group, so a single subnet can not fill the address list.
+	maxGroupAddresses = 64
+	// saveAddressInterval is the interval the address list is written to
+	// AddrBookFile.
+	saveAddressInterval = 5 * time.Minute
 )
 
+// AddrBookFile keeps the known addresses across restarts, it is kept in the
+// data directory.
+const AddrBookFile = "peers.json"
+
 type KnownAddress struct {
 	srcAddr        NodeAddr
 	lastattempt    time.Time
+	lastSuccess    time.Time
 	lastDisconnect time.Time
 	attempts       int
 }
@@ -31,6 +48,35 @@ type KnownAddressList struct {
 	sync.RWMutex
 	List      map[uint64]*KnownAddress
 	addrCount uint64
+	groups    map[string]int // the number of addresses of each network group
+	path      string
+	quit      chan chan struct{}
+}
+
+// knownAddressRecord is a known address as written to AddrBookFile.
+type knownAddressRecord struct {
+	Addr        string
+	Services    uint64
+	ID          uint64
+	LastSeen    int64
+	LastAttempt int64
+	LastSuccess int64
+	Attempts    int
+}
+
+// networkGroup returns the /16 of an IPv4 address or the /32 of an IPv6
+// address, the addresses of a group are likely run by the same operator.
+// A private or loopback address is a group of its own, the nodes of a local
+// network share the prefix without being run by the same operator.
+func networkGroup(ip [16]byte) string {
+	addr := net.IP(ip[:])
+	if addr.IsPrivate() || addr.IsLoopback() {
+		return addr.String()
+	}
+	if v4 := addr.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d", v4[0], v4[1])
+	}
+	return addr.Mask(net.CIDRMask(32, 128)).String()
 }
 
 func (ka *KnownAddress) LastAttempt() time.Time {
@@ -46,6 +92,12 @@ func (ka *KnownAddress) updateLastAttempt() {
 	ka.lastattempt = time.Now()
 }
 
+func (ka *KnownAddress) updateLastSuccess() {
+	// a successful connection clears the failed attempts
+	ka.lastSuccess = time.Now()
+	ka.attempts = 0
+}
+
 func (ka *KnownAddress) updateLastDisconnect() {
 	// set last disconnect time to now
 	ka.lastDisconnect = time.Now()
@@ -160,12 +212,52 @@ func (al *KnownAddressList) AddAddressToKnownAddress(na NodeAddr) {
 	if al.AddressExisted(ka.GetID()) {
 		log.Debug("It is a existed addr\n")
 		al.UpdateAddress(ka.GetID(), na)
-	} else {
-		al.List[ka.GetID()] = ka
-		al.addrCount++
+	} else if al.makeGroupRoom(na) {
+		al.addAddress(ka)
 	}
 }
 
+func (al *KnownAddressList) addAddress(ka *KnownAddress) {
+	al.List[ka.GetID()] = ka
+	al.groups[networkGroup(ka.srcAddr.IpAddr)]++
+	al.addrCount++
+}
+
+func (al *KnownAddressList) removeAddress(id uint64) {
+	ka := al.List[id]
+	delete(al.List, id)
+	group := networkGroup(ka.srcAddr.IpAddr)
+	if al.groups[group]--; al.groups[group] <= 0 {
+		delete(al.groups, group)
+	}
+	al.addrCount--
+}
+
+// makeGroupRoom makes sure the group of na has room for it, evicting the
+// worst address of the group if that one is bad or older than na.
+func (al *KnownAddressList) makeGroupRoom(na NodeAddr) bool {
+	group := networkGroup(na.IpAddr)
+	if al.groups[group] < maxGroupAddresses {
+		return true
+	}
+
+	var worst *KnownAddress
+	for _, ka := range al.List {
+		if networkGroup(ka.srcAddr.IpAddr) != group {
+			continue
+		}
+		if worst == nil || (ka.isBad() && !worst.isBad()) ||
+			(ka.isBad() == worst.isBad() && ka.srcAddr.Time < worst.srcAddr.Time) {
+			worst = ka
+		}
+	}
+	if worst == nil || (!worst.isBad() && worst.srcAddr.Time >= na.Time) {
+		return false
+	}
+	al.removeAddress(worst.GetID())
+	return true
+}
+
 func (al *KnownAddressList) DelAddressFromList(id uint64) bool {
 	al.Lock()
 	defer al.Unlock()
@@ -174,10 +266,20 @@ func (al *KnownAddressList) DelAddressFromList(id uint64) bool {
 	if ok == false {
 		return false
 	}
-	delete(al.List, id)
+	al.removeAddress(id)
 	return true
 }
 
+// MarkAddressGood records a successful connection to the address of id.
+func (al *KnownAddressList) MarkAddressGood(id uint64) {
+	al.Lock()
+	defer al.Unlock()
+
+	if ka, ok := al.List[id]; ok {
+		ka.updateLastSuccess()
+	}
+}
+
 func (al *KnownAddressList) GetAddressCnt() uint64 {
 	al.RLock()
 	defer al.RUnlock()
@@ -187,8 +289,122 @@ func (al *KnownAddressList) GetAddressCnt() uint64 {
 	return 0
 }
 
-func (al *KnownAddressList) init() {
+func (al *KnownAddressList) init(path string) {
 	al.List = make(map[uint64]*KnownAddress)
+	al.groups = make(map[string]int)
+	al.path = path
+	al.quit = make(chan chan struct{})
+	al.load()
+	go al.saveLoop()
+}
+
+// load reads the addresses saved by a previous run, the bad ones are left
+// out.
+func (al *KnownAddressList) load() {
+	data, err := ioutil.ReadFile(al.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn("Read address book error: ", err)
+		}
+		return
+	}
+	var records []knownAddressRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		log.Warn("Parse address book error: ", err)
+		return
+	}
+
+	al.Lock()
+	defer al.Unlock()
+	for _, record := range records {
+		host, port, err := net.SplitHostPort(record.Addr)
+		if err != nil {
+			continue
+		}
+		ip := net.ParseIP(host)
+		p, err := strconv.ParseUint(port, 10, 16)
+		if ip == nil || err != nil {
+			continue
+		}
+		ka := new(KnownAddress)
+		ka.srcAddr.Time = record.LastSeen
+		ka.srcAddr.Services = record.Services
+		copy(ka.srcAddr.IpAddr[:], ip.To16())
+		ka.srcAddr.Port = uint16(p)
+		ka.srcAddr.ID = record.ID
+		if record.LastAttempt > 0 {
+			ka.lastattempt = time.Unix(record.LastAttempt, 0)
+		}
+		if record.LastSuccess > 0 {
+			ka.lastSuccess = time.Unix(record.LastSuccess, 0)
+		}
+		ka.attempts = record.Attempts
+		if ka.isBad() || al.AddressExisted(ka.GetID()) || !al.makeGroupRoom(ka.srcAddr) {
+			continue
+		}
+		al.addAddress(ka)
+	}
+	log.Infof("Loaded %d known addresses", al.addrCount)
+}
+
+func (al *KnownAddressList) save() {
+	al.RLock()
+	records := make([]knownAddressRecord, 0, len(al.List))
+	for _, ka := range al.List {
+		ip := net.IP(ka.srcAddr.IpAddr[:])
+		record := knownAddressRecord{
+			Addr:     net.JoinHostPort(ip.String(), strconv.Itoa(int(ka.srcAddr.Port))),
+			Services: ka.srcAddr.Services,
+			ID:       ka.srcAddr.ID,
+			LastSeen: ka.srcAddr.Time,
+			Attempts: ka.attempts,
+		}
+		if !ka.lastattempt.IsZero() {
+			record.LastAttempt = ka.lastattempt.Unix()
+		}
+		if !ka.lastSuccess.IsZero() {
+			record.LastSuccess = ka.lastSuccess.Unix()
+		}
+		records = append(records, record)
+	}
+	al.RUnlock()
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		log.Error("Marshal address book error: ", err)
+		return
+	}
+	tmp := al.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		log.Error("Write address book error: ", err)
+		return
+	}
+	if err := os.Rename(tmp, al.path); err != nil {
+		log.Error("Write address book error: ", err)
+	}
+}
+
+func (al *KnownAddressList) saveLoop() {
+	ticker := time.NewTicker(saveAddressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			al.save()
+		case done := <-al.quit:
+			al.save()
+			close(done)
+			return
+		}
+	}
+}
+
+// stop ends the save loop after a last save, so the addresses learned since
+// the previous save are not lost.
+func (al *KnownAddressList) stop() {
+	done := make(chan struct{})
+	al.quit <- done
+	<-done
 }
 
 func isInNbrList(id uint64, nbrAddrs []NodeAddr) bool {
@@ -200,9 +416,12 @@ func isInNbrList(id uint64, nbrAddrs []NodeAddr) bool {
 	return false
 }
 
+// RandGetAddresses picks up to the free outbound slots of addresses to
+// connect, at most one from each network group. The slots left when the
+// groups run out are filled with addresses of groups already used.
 func (al *KnownAddressList) RandGetAddresses(nbrAddrs []NodeAddr) []NodeAddr {
-	al.RLock()
-	defer al.RUnlock()
+	al.Lock()
+	defer al.Unlock()
 	var keys []uint64
 	for k := range al.List {
 		isInNbr := isInNbrList(k, nbrAddrs)
@@ -212,38 +431,35 @@ func (al *KnownAddressList) RandGetAddresses(nbrAddrs []NodeAddr) []NodeAddr {
 		}
 	}
 
-	addrLen := len(keys)
-	var i int
+	count := MAXOUTBOUNDCNT - len(nbrAddrs)
+	groups := make(map[string]bool)
+	for _, na := range nbrAddrs {
+		groups[networkGroup(na.IpAddr)] = true
+	}
 	addrs := []NodeAddr{}
-	if MAXOUTBOUNDCNT-len(nbrAddrs) > addrLen {
-		for _, v := range keys {
-			ka, ok := al.List[v]
-			if !ok {
-				continue
-			}
-			ka.increaseAttempts()
-			ka.updateLastAttempt()
-			addrs = append(addrs, ka.srcAddr)
+	var skipped []*KnownAddress
+	for _, i := range rand.Perm(len(keys)) {
+		if len(addrs) >= count {
+			break
 		}
-	} else {
-		order := rand.Perm(addrLen)
-		var count int
-		count = MAXOUTBOUNDCNT - len(nbrAddrs)
-		for i = 0; i < count; i++ {
-			for j, v := range keys {
-				if j == order[j] {
-					ka, ok := al.List[v]
-					if !ok {
-						continue
-					}
-					ka.increaseAttempts()
-					ka.updateLastAttempt()
-					addrs = append(addrs, ka.srcAddr)
-					keys = append(keys[:j], keys[j+1:]...)
-					break
-				}
-			}
+		ka := al.List[keys[i]]
+		group := networkGroup(ka.srcAddr.IpAddr)
+		if groups[group] {
+			skipped = append(skipped, ka)
+			continue
+		}
+		groups[group] = true
+		ka.increaseAttempts()
+		ka.updateLastAttempt()
+		addrs = append(addrs, ka.srcAddr)
+	}
+	for _, ka := range skipped {
+		if len(addrs) >= count {
+			break
 		}
+		ka.increaseAttempts()
+		ka.updateLastAttempt()
+		addrs = append(addrs, ka.srcAddr)
 	}
 
 	return addrs
@@ -0,0 +1,117 @@
+package node
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"Elastos.ELA/common/log"
+	. "Elastos.ELA/net/protocol"
+)
+
+func newTestNodeAddr(ip string, id uint64) NodeAddr {
+	na := NodeAddr{Time: time.Now().UnixNano(), Services: 1, Port: 20338, ID: id}
+	copy(na.IpAddr[:], net.ParseIP(ip).To16())
+	return na
+}
+
+func TestAddressBookSavedOnStop(t *testing.T) {
+	log.Init()
+	dir, err := ioutil.TempDir("", "peers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, AddrBookFile)
+
+	al := new(KnownAddressList)
+	al.init(path)
+	al.AddAddressToKnownAddress(newTestNodeAddr("45.0.0.1", 1))
+	al.AddAddressToKnownAddress(newTestNodeAddr("45.1.0.1", 2))
+	al.AddAddressToKnownAddress(newTestNodeAddr("45.2.0.1", 3))
+	al.MarkAddressGood(1)
+	al.List[2].attempts = 3
+	al.List[3].attempts = numRetries
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("address book is written before the save interval")
+	}
+	al.stop()
+
+	loaded := new(KnownAddressList)
+	loaded.init(path)
+	defer loaded.stop()
+	// the address that failed too often is left out
+	if loaded.GetAddressCnt() != 2 || loaded.List[3] != nil {
+		t.Fatalf("loaded %d addresses, want 2", loaded.GetAddressCnt())
+	}
+	ka := loaded.List[1]
+	if ka == nil || ka.lastSuccess.IsZero() || ka.srcAddr.Port != 20338 || ka.srcAddr.Services != 1 {
+		t.Fatalf("address 1 is loaded as %+v", ka)
+	}
+	if ip := net.IP(ka.srcAddr.IpAddr[:]); !ip.Equal(net.ParseIP("45.0.0.1")) {
+		t.Fatalf("address 1 is loaded with ip %s", ip)
+	}
+	if loaded.List[2].attempts != 3 {
+		t.Fatalf("address 2 is loaded with %d attempts, want 3", loaded.List[2].attempts)
+	}
+	if loaded.groups["45.1"] != 1 {
+		t.Fatal("network groups are not rebuilt on load")
+	}
+}
+
+func TestAddressBookGroupLimit(t *testing.T) {
+	al := &KnownAddressList{List: make(map[uint64]*KnownAddress), groups: make(map[string]int)}
+	for i := 0; i < maxGroupAddresses+10; i++ {
+		al.AddAddressToKnownAddress(newTestNodeAddr(net.IPv4(45, 0, byte(i), 1).String(), uint64(i+1)))
+	}
+	al.AddAddressToKnownAddress(newTestNodeAddr("45.1.0.1", 1000))
+	if al.groups["45.0"] != maxGroupAddresses || al.GetAddressCnt() != maxGroupAddresses+1 {
+		t.Fatalf("group 45.0 has %d addresses, want %d", al.groups["45.0"], maxGroupAddresses)
+	}
+}
+
+func TestAddressBookLocalGroups(t *testing.T) {
+	log.Init()
+	al := &KnownAddressList{List: make(map[uint64]*KnownAddress), groups: make(map[string]int)}
+	for i := 0; i < maxGroupAddresses+10; i++ {
+		al.AddAddressToKnownAddress(newTestNodeAddr(net.IPv4(10, 0, byte(i), 1).String(), uint64(i+1)))
+	}
+	if al.GetAddressCnt() != maxGroupAddresses+10 {
+		t.Fatalf("kept %d addresses of a private network, want all", al.GetAddressCnt())
+	}
+
+	// each private address is a group of its own
+	var nbrs []NodeAddr
+	for id := uint64(1); id <= 2; id++ {
+		nbrs = append(nbrs, al.List[id].srcAddr)
+	}
+	if addrs := al.RandGetAddresses(nbrs); len(addrs) != MAXOUTBOUNDCNT-len(nbrs) {
+		t.Fatalf("%d private addresses picked, want %d", len(addrs), MAXOUTBOUNDCNT-len(nbrs))
+	}
+}
+
+func TestRandGetAddressesRelaxesGroups(t *testing.T) {
+	log.Init()
+	al := &KnownAddressList{List: make(map[uint64]*KnownAddress), groups: make(map[string]int)}
+	for i := 0; i < MAXOUTBOUNDCNT; i++ {
+		al.AddAddressToKnownAddress(newTestNodeAddr(net.IPv4(45, 0, byte(i), 1).String(), uint64(i+1)))
+	}
+	al.AddAddressToKnownAddress(newTestNodeAddr("45.1.0.1", 1000))
+
+	// the other group is always picked, the free slots are filled from the
+	// crowded one
+	addrs := al.RandGetAddresses(nil)
+	if len(addrs) != MAXOUTBOUNDCNT {
+		t.Fatalf("%d addresses picked, want %d", len(addrs), MAXOUTBOUNDCNT)
+	}
+	found := false
+	for _, na := range addrs {
+		found = found || na.ID == 1000
+	}
+	if !found {
+		t.Fatal("address of the other group is not picked")
+	}
+}
@@ -15,7 +15,6 @@ import (
 	"net"
 	"os"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -55,6 +54,7 @@ func unpackNodeBuf(node *node, buf []byte) {
 		if msg.ValidMsgHdr(node.rxBuf.p) == false {
 			node.rxBuf.p = nil
 			node.rxBuf.len = 0
+			node.AddBanScore(BANSCOREMALFORMED, "invalid message header")
 			log.Warn("Get error message header, TODO: relocate the msg header")
 			// TODO Relocate the message header
 			return
@@ -146,10 +146,17 @@ func (n *node) initConnection() {
 		}
 		log.Info("Remote node connect with ", conn.RemoteAddr(), conn.LocalAddr())
 
+		addr, err := parseIPaddr(conn.RemoteAddr().String())
+		if err == nil && n.IsBanned(addr) {
+			log.Info("Reject connection from banned address ", addr)
+			conn.Close()
+			continue
+		}
+
 		n.link.connCnt++
 
 		node := NewNode()
-		node.addr, err = parseIPaddr(conn.RemoteAddr().String())
+		node.addr = addr
 		node.local = n
 		node.conn = conn
 		go node.rx()
@@ -207,12 +214,12 @@ func initTlsListen() (net.Listener, error) {
 }
 
 func parseIPaddr(s string) (string, error) {
-	i := strings.Index(s, ":")
-	if i < 0 {
+	host, _, err := net.SplitHostPort(s)
+	if err != nil {
 		log.Warn("Split IP address&port error")
 		return s, errors.New("Split IP address&port error")
 	}
-	return s[:i], nil
+	return host, nil
 }
 
 func (node *node) Connect(nodeAddr string) error {
@@ -221,6 +228,9 @@ func (node *node) Connect(nodeAddr string) error {
 	if node.IsAddrInNbrList(nodeAddr) == true {
 		return nil
 	}
+	if node.IsBanned(nodeAddr) {
+		return errors.New("node address is banned")
+	}
 	if added := node.SetAddrInConnectingList(nodeAddr); added == false {
 		return errors.New("node exist in connecting list, cancel")
 	}
@@ -313,5 +323,7 @@ func (node *node) Tx(buf []byte) {
 	if err != nil {
 		log.Error("Error sending messge to peer node ", err.Error())
 		node.local.eventQueue.GetEvent("disconnect").Notify(events.EventNodeDisconnect, node)
+		return
 	}
+	msg.CountSentMessage(buf)
 }
@@ -9,6 +9,7 @@ import (
 	"Elastos.ELA/core/transaction"
 	"Elastos.ELA/crypto"
 	"Elastos.ELA/events"
+	"Elastos.ELA/net/bloom"
 	. "Elastos.ELA/net/message"
 	. "Elastos.ELA/net/protocol"
 	"bytes"
@@ -45,7 +46,12 @@ type node struct {
 	height    uint64   // The node latest block height
 	txnCnt    uint64   // The transactions be transmit by this node
 	rxTxnCnt  uint64   // The transaction received by this node
+	banScore  uint32   // The misbehavior score of the node
 	publicKey *crypto.PubKey
+	filter    *bloom.Filter // The bloom filter loaded by a light client
+	// filterLock guards relay, which a filterload turns on together with
+	// loading the filter
+	filterLock sync.RWMutex
 	// TODO does this channel should be a buffer channel
 	chF        chan func() error // Channel used to operate the node without lock
 	link                         // The link status and infomation
@@ -71,6 +77,7 @@ type node struct {
 	ConnectingNodes
 	RetryConnAddrs
 	KnownAddressList
+	banList            banList
 	MaxOutboundCnt     uint
 	DefaultMaxPeers    uint
 	GetAddrMax         uint
@@ -78,6 +85,7 @@ type node struct {
 	headerFirstMode    bool
 	invRequestHashes   []Uint256
 	RequestedBlockList map[Uint256]time.Time
+	downloader         blockDownloader
 	// Checkpoints ordered from oldest to newest.
 	NextCheckpoint *Checkpoint
 	IsStartSync    bool
@@ -160,18 +168,15 @@ func (node *node) UpdateInfo(t time.Time, version uint32, services uint64,
 	node.version = version
 	node.services = services
 	node.port = port
-	if relay == 0 {
-		node.relay = false
-	} else {
-		node.relay = true
-	}
+	node.SetRelay(relay != 0)
 	node.height = uint64(height)
 }
 
 func NewNode() *node {
 	n := node{
-		state: INIT,
-		chF:   make(chan func() error),
+		state:  INIT,
+		chF:    make(chan func() error),
+		filter: bloom.LoadFilter(nil, 0, 0, bloom.BloomUpdateNone),
 	}
 	runtime.SetFinalizer(&n, rmNode)
 	go n.backend()
@@ -192,6 +197,12 @@ func InitNode(pubKey *crypto.PubKey) Noder {
 
 	n.link.port = uint16(Parameters.NodePort)
 	n.relay = true
+	if Parameters.PruneDepth > 0 || ledger.DefaultLedger.Store.IsPruned() {
+		n.services = NODENETWORKLIMITED
+	} else {
+		n.services = NODENETWORK
+	}
+	n.services |= NODECOMPACTBLOCKS
 	// TODO is it neccessary to init the rand seed here?
 	rand.Seed(time.Now().UTC().UnixNano())
 
@@ -205,10 +216,13 @@ func InitNode(pubKey *crypto.PubKey) Noder {
 	}
 	log.Info(fmt.Sprintf("Init node ID to 0x%x", n.id))
 	n.nbrNodes.init()
-	n.KnownAddressList.init()
+	n.KnownAddressList.init(config.DataPath(AddrBookFile))
+	n.banList.init(config.DataPath(BanListFile))
 	n.local = n
 	n.publicKey = pubKey
 	n.TXNPool.init()
+	// pool transactions may spend the outputs of other pool transactions
+	transaction.TxStore = &poolTxStore{ILedgerStore: ledger.DefaultLedger.Store, pool: &n.TXNPool}
 	n.eventQueue.init()
 	n.idCache.init()
 	n.cachedHashes = make([]Uint256, 0)
@@ -219,9 +233,11 @@ func InitNode(pubKey *crypto.PubKey) Noder {
 	n.local.headerFirstMode = false
 	n.invRequestHashes = make([]Uint256, 0)
 	n.RequestedBlockList = make(map[Uint256]time.Time)
+	n.downloader.init()
 	go n.initConnection()
 	go n.updateConnection()
 	go n.updateNodeInfo()
+	go n.downloadBlocks()
 
 	return n
 }
@@ -322,9 +338,30 @@ func (node *node) SetHttpInfoState(nodeInfo bool) {
 }
 
 func (node *node) GetRelay() bool {
+	node.filterLock.RLock()
+	defer node.filterLock.RUnlock()
 	return node.relay
 }
 
+func (node *node) SetRelay(relay bool) {
+	node.filterLock.Lock()
+	defer node.filterLock.Unlock()
+	node.relay = relay
+}
+
+func (node *node) GetFilter() *bloom.Filter {
+	return node.filter
+}
+
+// LoadFilter replaces the bloom filter of the node and turns relay on, a
+// relay seen on without the new filter would send unfiltered transactions.
+func (node *node) LoadFilter(filter *bloom.Filter) {
+	node.filterLock.Lock()
+	defer node.filterLock.Unlock()
+	node.filter.Reload(filter)
+	node.relay = true
+}
+
 func (node *node) Version() uint32 {
 	return node.version
 }
@@ -376,7 +413,7 @@ func (node *node) UpdateRXTime(t time.Time) {
 
 func (node *node) Xmit(message interface{}) error {
 	log.Debug()
-	var buffer []byte
+	var buffer, compact []byte
 	var err error
 	switch message.(type) {
 	case *transaction.Transaction:
@@ -396,6 +433,11 @@ func (node *node) Xmit(message interface{}) error {
 			log.Error("Error New Block message: ", err)
 			return err
 		}
+		compact, err = NewCompactBlock(block)
+		if err != nil {
+			log.Error("Error New cmpctblock message: ", err)
+			return err
+		}
 	case *ConsensusPayload:
 		log.Debug("TX consensus message")
 		consensusPayload := message.(*ConsensusPayload)
@@ -421,7 +463,21 @@ func (node *node) Xmit(message interface{}) error {
 		return errors.New("Unknown Xmit message type")
 	}
 
-	node.nbrNodes.Broadcast(buffer)
+	node.nbrNodes.RLock()
+	for _, n := range node.nbrNodes.List {
+		if n.state == ESTABLISH && n.GetRelay() {
+			if n.filter.IsLoaded() {
+				n.filteredTx(message, buffer)
+				continue
+			}
+			if compact != nil && n.services&NODECOMPACTBLOCKS != 0 {
+				n.Tx(compact)
+				continue
+			}
+			n.Tx(buffer)
+		}
+	}
+	node.nbrNodes.RUnlock()
 
 	return nil
 }
@@ -583,7 +639,7 @@ func (node *node) Relay(frmnode Noder, message interface{}) error {
 	if node.LocalNode().IsSyncHeaders() == true {
 		return nil
 	}
-	var buffer []byte
+	var buffer, compact []byte
 	var err error
 	isHash := false
 	switch message.(type) {
@@ -625,6 +681,13 @@ func (node *node) Relay(frmnode Noder, message interface{}) error {
 			log.Error("Error new block message: ", err)
 			return err
 		}
+		// peers that accept compact blocks rebuild the block from their
+		// transaction pool
+		compact, err = NewCompactBlock(blkpayload)
+		if err != nil {
+			log.Error("Error new cmpctblock message: ", err)
+			return err
+		}
 	default:
 		log.Warn("Unknown Relay message type")
 		return errors.New("Unknown Relay message type")
@@ -632,11 +695,19 @@ func (node *node) Relay(frmnode Noder, message interface{}) error {
 
 	node.nbrNodes.RLock()
 	for _, n := range node.nbrNodes.List {
-		if n.state == ESTABLISH && n.relay == true &&
+		if n.state == ESTABLISH && n.GetRelay() &&
 			n.id != frmnode.GetID() {
 			if isHash && n.ExistHash(message.(Uint256)) {
 				continue
 			}
+			if n.filter.IsLoaded() {
+				n.filteredTx(message, buffer)
+				continue
+			}
+			if compact != nil && n.services&NODECOMPACTBLOCKS != 0 {
+				n.Tx(compact)
+				continue
+			}
 			n.Tx(buffer)
 		}
 	}
@@ -644,6 +715,30 @@ func (node *node) Relay(frmnode Noder, message interface{}) error {
 	return nil
 }
 
+// filteredTx sends the message to a light client which loaded a bloom
+// filter. Only matching transactions are sent, and blocks are announced
+// by an inv so the client can request them as merkle blocks.
+func (node *node) filteredTx(message interface{}, buffer []byte) {
+	switch message.(type) {
+	case *transaction.Transaction:
+		if !node.filter.MatchTxAndUpdate(message.(*transaction.Transaction)) {
+			return
+		}
+	case *ledger.Block:
+		buf := bytes.NewBuffer([]byte{})
+		hash := message.(*ledger.Block).Hash()
+		hash.Serialize(buf)
+		invPayload := NewInvPayload(BLOCK, 1, buf.Bytes())
+		inv, err := NewInv(invPayload)
+		if err != nil {
+			log.Error("Error New inv message")
+			return
+		}
+		buffer = inv
+	}
+	node.Tx(buffer)
+}
+
 func (node *node) CacheHash(hash Uint256) {
 	node.cachelock.Lock()
 	defer node.cachelock.Unlock()
@@ -722,23 +817,42 @@ func (node *node) needSync() bool {
 func (node *node) GetBestHeightNoder() Noder {
 	node.nbrNodes.RLock()
 	defer node.nbrNodes.RUnlock()
-	var bestnode Noder
+	var bestnode, bestpruned Noder
 	for _, n := range node.nbrNodes.List {
-		if n.GetState() == ESTABLISH {
-			if bestnode == nil {
-				if !n.IsSyncFailed() {
-					bestnode = n
-				}
-			} else {
-				if (n.GetHeight() > bestnode.GetHeight()) && !n.IsSyncFailed() {
-					bestnode = n
-				}
+		if n.GetState() != ESTABLISH || n.IsSyncFailed() {
+			continue
+		}
+		// A pruned peer can not serve the blocks we miss when we are
+		// further behind than the blocks it keeps.
+		if !node.canServeBlocks(n) {
+			if bestpruned == nil || n.GetHeight() > bestpruned.GetHeight() {
+				bestpruned = n
 			}
+			continue
+		}
+		if bestnode == nil || n.GetHeight() > bestnode.GetHeight() {
+			bestnode = n
 		}
 	}
+	if bestnode == nil {
+		return bestpruned
+	}
 	return bestnode
 }
 
+func (node *node) canServeBlocks(n Noder) bool {
+	if n.Services()&NODENETWORKLIMITED == 0 {
+		return true
+	}
+	height := uint64(ledger.DefaultLedger.Blockchain.BlockHeight)
+	return n.GetHeight() <= height+MINPRUNEDEPTH
+}
+
+// Stop writes the state kept across restarts before the node exits.
+func (node *node) Stop() {
+	node.local.KnownAddressList.stop()
+}
+
 func (node *node) StartSync() {
 	needSync := node.needSync()
 	log.Info("needSync ", needSync)
@@ -832,11 +946,13 @@ func (node *node) ResetRequestedBlock() {
 	defer node.requestedBlockLock.Unlock()
 
 	node.RequestedBlockList = make(map[Uint256]time.Time)
+	node.local.downloader.reset()
 }
 
 func (node *node) DeleteRequestedBlock(hash Uint256) {
 	node.requestedBlockLock.Lock()
 	defer node.requestedBlockLock.Unlock()
+	node.local.downloader.complete(hash)
 	_, ok := node.RequestedBlockList[hash]
 	if ok == false {
 		return
@@ -844,12 +960,14 @@ func (node *node) DeleteRequestedBlock(hash Uint256) {
 	delete(node.RequestedBlockList, hash)
 }
 
-// newCheckpointFromStr parses checkpoints in the '<height>:<hash>' format.
+// newCheckpointFromStr parses checkpoints in the '<height>:<hash>' format,
+// an optional third field holds the commitment of a UTXO snapshot at that
+// height and is only used by the snapshot import.
 func newCheckpointFromStr(checkpoint string) (Checkpoint, error) {
 	parts := strings.Split(checkpoint, ":")
-	if len(parts) != 2 {
+	if len(parts) != 2 && len(parts) != 3 {
 		return Checkpoint{}, fmt.Errorf("unable to parse "+
-			"checkpoint %q -- use the syntax <height>:<hash>",
+			"checkpoint %q -- use the syntax <height>:<hash>[:<snapshot hash>]",
 			checkpoint)
 	}
 
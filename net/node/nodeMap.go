@@ -17,7 +17,7 @@ func (nm *nbrNodes) Broadcast(buf []byte) {
 	nm.RLock()
 	defer nm.RUnlock()
 	for _, node := range nm.List {
-		if node.state == ESTABLISH && node.relay == true {
+		if node.state == ESTABLISH && node.GetRelay() {
 			node.Tx(buf)
 		}
 	}
@@ -155,6 +155,17 @@ func (node *node) GetNbrNodeCnt() uint32 {
 	return count
 }
 
+// GetNbrStateCnt returns the number of neighbors in each state.
+func (node *node) GetNbrStateCnt() map[uint32]int {
+	node.nbrNodes.RLock()
+	defer node.nbrNodes.RUnlock()
+	counts := make(map[uint32]int)
+	for _, n := range node.nbrNodes.List {
+		counts[n.GetState()]++
+	}
+	return counts
+}
+
 func (node *node) RandGetANbr() Noder {
 	node.nbrNodes.RLock()
 	defer node.nbrNodes.RUnlock()
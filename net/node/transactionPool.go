@@ -9,20 +9,59 @@ import (
 	tx "Elastos.ELA/core/transaction"
 	. "Elastos.ELA/errors"
 	"Elastos.ELA/events"
-	"bytes"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
+)
+
+const (
+	// Limits used when they are not set in the configuration file.
+	DefaultMaxTxPoolSize  = 100 * 1024 * 1024 // bytes
+	DefaultMaxTxPoolCount = 50000
+	DefaultTxPoolExpiry   = 14 * 24 * time.Hour
 )
 
 var (
 	zeroHash = common.Uint256{}
 )
 
+// txPoolEntry is a transaction in the pool together with the in-pool
+// transactions it spends from (parents) and that spend from it (children).
+type txPoolEntry struct {
+	txn      *transaction.Transaction
+	size     int
+	added    time.Time
+	parents  map[common.Uint256]*txPoolEntry
+	children map[common.Uint256]*txPoolEntry
+}
+
+// poolTxStore looks transactions up in the ledger and then in the pool, so
+// the references of a transaction spending outputs of pool transactions are
+// found.
+type poolTxStore struct {
+	transaction.ILedgerStore
+	pool *TXNPool
+}
+
+func (s *poolTxStore) GetTransaction(hash common.Uint256) (*transaction.Transaction, uint32, error) {
+	txn, height, err := s.ILedgerStore.GetTransaction(hash)
+	if err == nil {
+		return txn, height, nil
+	}
+	if txn := s.pool.GetTransaction(hash); txn != nil {
+		// it is put in the next block at the earliest
+		return txn, s.GetHeight() + 1, nil
+	}
+	return nil, 0, err
+}
+
 type TXNPool struct {
 	sync.RWMutex
-	txnCnt  uint64                                      // count
-	txnList map[common.Uint256]*transaction.Transaction // transaction which have been verifyed will put into this map
+	txnCnt    uint64                          // count
+	txnList   map[common.Uint256]*txPoolEntry // transaction which have been verifyed will put into this map
+	totalSize int                             // serialized size of all transactions in txnList
 	//issueSummary  map[common.Uint256]common.Fixed64           // transaction which pass the verify will summary the amout to this map
 	inputUTXOList map[string]*transaction.Transaction // transaction which pass the verify will add the UTXO to this map
 }
@@ -31,40 +70,106 @@ func (this *TXNPool) init() {
 	this.Lock()
 	defer this.Unlock()
 	this.txnCnt = 0
+	this.totalSize = 0
 	this.inputUTXOList = make(map[string]*transaction.Transaction)
 	//this.issueSummary = make(map[common.Uint256]common.Fixed64)
-	this.txnList = make(map[common.Uint256]*transaction.Transaction)
+	this.txnList = make(map[common.Uint256]*txPoolEntry)
+}
+
+func maxTxPoolSize() int {
+	if config.Parameters.MaxTxPoolSize > 0 {
+		return config.Parameters.MaxTxPoolSize
+	}
+	return DefaultMaxTxPoolSize
+}
+
+func maxTxPoolCount() int {
+	if config.Parameters.MaxTxPoolCount > 0 {
+		return config.Parameters.MaxTxPoolCount
+	}
+	return DefaultMaxTxPoolCount
+}
+
+func txPoolExpiry() time.Duration {
+	if config.Parameters.TxPoolExpiry > 0 {
+		return time.Duration(config.Parameters.TxPoolExpiry) * time.Second
+	}
+	return DefaultTxPoolExpiry
 }
 
-//append transaction to txnpool when check ok.
-//1.check transaction. 2.check with ledger(db) 3.check with pool
+// append transaction to txnpool when check ok.
+// 1.check transaction. 2.check with ledger(db) 3.check with pool
 func (this *TXNPool) AppendTxnPool(txn *transaction.Transaction) ErrCode {
 	//verify transaction with Concurrency
 	if errCode := ledger.CheckTransactionSanity(txn); errCode != Success {
 		log.Info("Transaction verification failed", txn.Hash())
 		return errCode
 	}
-	if errCode := ledger.CheckTransactionContext(txn, ledger.DefaultLedger); errCode != Success {
+	parents := this.unconfirmedParents(txn)
+	if errCode := ledger.CheckPoolTransactionContext(txn, ledger.DefaultLedger, parents); errCode != Success {
 		log.Info("Transaction verification with ledger failed", txn.Hash())
 		return errCode
 	}
-	//verify transaction by pool with lock
-	if ok := this.verifyTransactionWithTxnPool(txn); !ok {
-		return ErrDoubleSpend
-	}
 
 	txn.Fee = common.Fixed64(txn.GetFee(ledger.DefaultLedger.Blockchain.AssetID))
-	b_buf := new(bytes.Buffer)
-	txn.Serialize(b_buf)
-	txn.FeePerKB = txn.Fee * 1000 / common.Fixed64(len(b_buf.Bytes()))
+	size := txn.GetSize()
+	txn.FeePerKB = txn.Fee * 1000 / common.Fixed64(size)
+
+	this.Lock()
+	if _, ok := this.txnList[txn.Hash()]; ok {
+		this.Unlock()
+		return ErrTxHashDuplicate
+	}
+	//the parents may have left the pool since they were looked up
+	ancestors := make(map[common.Uint256]*txPoolEntry)
+	for hash := range parents {
+		entry, ok := this.txnList[hash]
+		if !ok {
+			this.Unlock()
+			return ErrUnknownReferedTxn
+		}
+		ancestors[hash] = entry
+	}
+	ancestors = this.withAncestors(ancestors)
+	//verify transaction by pool, a double spend may replace the
+	//transactions it conflicts with when it pays more
+	conflicts, errCode := this.verifyTransactionWithTxnPool(txn)
+	if errCode != Success {
+		this.Unlock()
+		return errCode
+	}
+	for hash := range this.withDescendants(conflicts) {
+		if _, ok := ancestors[hash]; ok {
+			this.Unlock()
+			log.Info(fmt.Sprintf("Transaction %x replaces a transaction it spends from", txn.Hash()))
+			return ErrDoubleSpend
+		}
+	}
+	evicted, errCode := this.evictionSet(txn, size, conflicts, ancestors)
+	if errCode != Success {
+		this.Unlock()
+		return errCode
+	}
+	for _, entry := range conflicts {
+		log.Info(fmt.Sprintf("Transaction %x replaced by %x", entry.txn.Hash(), txn.Hash()))
+		this.removeWithDescendants(entry)
+	}
+	for _, entry := range evicted {
+		log.Info(fmt.Sprintf("Transaction %x evicted from full pool", entry.txn.Hash()))
+		this.removeWithDescendants(entry)
+	}
 	//add the transaction to process scope
-	this.addtxnList(txn)
+	this.addtxnList(txn, size)
+	this.Unlock()
+
+	ledger.DefaultLedger.Blockchain.BCEvents.Notify(events.EventNewTransactionPutInPool, txn)
 	return Success
 }
 
-//get the transaction in txnpool
+// get the transaction in txnpool
 func (this *TXNPool) GetTxnPool(byCount bool) map[common.Uint256]*transaction.Transaction {
 	this.RLock()
+	defer this.RUnlock()
 	count := config.Parameters.MaxTxInBlock
 	if count <= 0 {
 		byCount = false
@@ -72,88 +177,240 @@ func (this *TXNPool) GetTxnPool(byCount bool) map[common.Uint256]*transaction.Tr
 	if len(this.txnList) < count || !byCount {
 		count = len(this.txnList)
 	}
-	var num int
 	txnMap := make(map[common.Uint256]*transaction.Transaction, count)
-	for txnId, tx := range this.txnList {
-		txnMap[txnId] = tx
-		num++
-		if num >= count {
-			break
-		}
+	for _, entry := range this.sortedEntries(false)[:count] {
+		txnMap[entry.txn.Hash()] = entry.txn
 	}
-	this.RUnlock()
 	return txnMap
 }
 
-//clean the trasaction Pool with committed block.
+// GetTxnPoolByFeeRate returns the transactions which can be put in the next
+// block, highest fee rate first. Transactions spending outputs of other pool
+// transactions are left out until their parents are confirmed, a block can
+// only spend outputs already in the ledger.
+func (this *TXNPool) GetTxnPoolByFeeRate() []*transaction.Transaction {
+	this.RLock()
+	defer this.RUnlock()
+	entries := this.sortedEntries(true)
+	txns := make([]*transaction.Transaction, 0, len(entries))
+	for _, entry := range entries {
+		txns = append(txns, entry.txn)
+	}
+	return txns
+}
+
+// sortedEntries returns the pool entries ordered by descending fee rate,
+// older transactions first on equal fee rate.
+func (this *TXNPool) sortedEntries(withoutParents bool) []*txPoolEntry {
+	entries := make([]*txPoolEntry, 0, len(this.txnList))
+	for _, entry := range this.txnList {
+		if withoutParents && len(entry.parents) > 0 {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].txn.FeePerKB != entries[j].txn.FeePerKB {
+			return entries[i].txn.FeePerKB > entries[j].txn.FeePerKB
+		}
+		return entries[i].added.Before(entries[j].added)
+	})
+	return entries
+}
+
+// clean the trasaction Pool with committed block.
 func (this *TXNPool) CleanSubmittedTransactions(block *ledger.Block) error {
 	this.cleanTransactionList(block.Transactions)
 	this.cleanUTXOList(block.Transactions)
+	this.expireStale(time.Now())
 	//this.cleanIssueSummary(block.Transactions)
 	return nil
 }
 
-//get the transaction by hash
+// unconfirmedParents returns the pool transactions the transaction spends
+// from.
+func (this *TXNPool) unconfirmedParents(txn *transaction.Transaction) map[common.Uint256]*transaction.Transaction {
+	this.RLock()
+	defer this.RUnlock()
+	parents := make(map[common.Uint256]*transaction.Transaction)
+	for _, input := range txn.UTXOInputs {
+		if entry, ok := this.txnList[input.ReferTxID]; ok {
+			parents[input.ReferTxID] = entry.txn
+		}
+	}
+	return parents
+}
+
+// get the transaction by hash
 func (this *TXNPool) GetTransaction(hash common.Uint256) *transaction.Transaction {
 	this.RLock()
 	defer this.RUnlock()
-	return this.txnList[hash]
+	if entry, ok := this.txnList[hash]; ok {
+		return entry.txn
+	}
+	return nil
 }
 
-//verify transaction with txnpool
-func (this *TXNPool) verifyTransactionWithTxnPool(txn *transaction.Transaction) bool {
+// verify transaction with txnpool, returns the pool transactions that spend
+// the same inputs when the transaction is allowed to replace them.
+func (this *TXNPool) verifyTransactionWithTxnPool(txn *transaction.Transaction) (map[common.Uint256]*txPoolEntry, ErrCode) {
 	// check if the transaction includes double spent UTXO inputs
-	if err := this.verifyDoubleSpend(txn); err != nil {
+	conflicts, err := this.verifyDoubleSpend(txn)
+	if err != nil {
 		log.Info(err)
-		return false
+		return nil, ErrDoubleSpend
 	}
 
-	return true
+	return conflicts, Success
 }
 
-//remove from associated map
-func (this *TXNPool) removeTransaction(txn *transaction.Transaction) {
-	//1.remove from txnList
-	this.deltxnList(txn)
-	//2.remove from UTXO list map
-	result, err := txn.GetReference()
-	if err != nil {
-		log.Info(fmt.Sprintf("Transaction =%x not Exist in Pool when delete.", txn.Hash()))
-		return
+// check the inputs against the utxo list pool. A conflicting transaction
+// can be replaced only if the new one pays a higher fee rate than each of
+// them and a higher fee than they and their descendants pay together.
+func (this *TXNPool) verifyDoubleSpend(txn *transaction.Transaction) (map[common.Uint256]*txPoolEntry, error) {
+	conflicts := make(map[common.Uint256]*txPoolEntry)
+	for _, input := range txn.UTXOInputs {
+		spender, ok := this.inputUTXOList[input.ToString()]
+		if !ok {
+			continue
+		}
+		entry := this.txnList[spender.Hash()]
+		if entry == nil {
+			continue
+		}
+		if txn.FeePerKB <= spender.FeePerKB {
+			return nil, errors.New(fmt.Sprintf("double spent UTXO inputs detected, "+
+				"transaction hash: %x, input: %s, index: %s",
+				spender.Hash(), input.ToString()[:64], input.ToString()[64:]))
+		}
+		conflicts[spender.Hash()] = entry
+	}
+	if len(conflicts) == 0 {
+		return nil, nil
 	}
-	for UTXOTxInput := range result {
-		this.delInputUTXOList(UTXOTxInput)
+
+	var replacedFee common.Fixed64
+	for _, entry := range this.withDescendants(conflicts) {
+		replacedFee += entry.txn.Fee
 	}
+	if txn.Fee <= replacedFee {
+		return nil, errors.New(fmt.Sprintf("replacement transaction %x fee %d "+
+			"not higher than replaced fee %d", txn.Hash(), txn.Fee, replacedFee))
+	}
+	return conflicts, nil
 }
 
-//check and add to utxo list pool
-func (this *TXNPool) verifyDoubleSpend(txn *transaction.Transaction) error {
-	reference, err := txn.GetReference()
-	if err != nil {
-		return err
+// evictionSet picks the lowest fee rate entries to remove, each with its
+// descendants, so that the new transaction fits in the pool. A package paying
+// at least the fee rate of the new transaction is never evicted for it, nor
+// are the ancestors of the new transaction.
+func (this *TXNPool) evictionSet(txn *transaction.Transaction, size int,
+	conflicts, ancestors map[common.Uint256]*txPoolEntry) ([]*txPoolEntry, ErrCode) {
+	removed := this.withDescendants(conflicts)
+	count := len(this.txnList) - len(removed) + 1
+	total := this.totalSize + size
+	for _, entry := range removed {
+		total -= entry.size
 	}
-	inputs := []*transaction.UTXOTxInput{}
-	for k := range reference {
-		if txn := this.getInputUTXOList(k); txn != nil {
-			return errors.New(fmt.Sprintf("double spent UTXO inputs detected, "+
-				"transaction hash: %x, input: %s, index: %s",
-				txn.Hash(), k.ToString()[:64], k.ToString()[64:]))
+	if count <= maxTxPoolCount() && total <= maxTxPoolSize() {
+		return nil, Success
+	}
+
+	var evicted []*txPoolEntry
+	entries := this.sortedEntries(false)
+	for i := len(entries) - 1; i >= 0 && (count > maxTxPoolCount() || total > maxTxPoolSize()); i-- {
+		entry := entries[i]
+		if _, ok := removed[entry.txn.Hash()]; ok {
+			continue
+		}
+		if _, ok := ancestors[entry.txn.Hash()]; ok {
+			continue
+		}
+		pkg := this.withDescendants(map[common.Uint256]*txPoolEntry{entry.txn.Hash(): entry})
+		var pkgFee common.Fixed64
+		var pkgSize int
+		for _, e := range pkg {
+			pkgFee += e.txn.Fee
+			pkgSize += e.size
+		}
+		if pkgSize > 0 && pkgFee*1000/common.Fixed64(pkgSize) >= txn.FeePerKB {
+			continue
+		}
+		evicted = append(evicted, entry)
+		for hash, e := range pkg {
+			if _, ok := removed[hash]; ok {
+				continue
+			}
+			removed[hash] = e
+			count--
+			total -= e.size
 		}
-		inputs = append(inputs, k)
 	}
-	for _, v := range inputs {
-		this.addInputUTXOList(txn, v)
+	if count > maxTxPoolCount() || total > maxTxPoolSize() {
+		log.Info(fmt.Sprintf("Transaction pool full, rejected %x", txn.Hash()))
+		return nil, ErrTxPoolFull
 	}
+	return evicted, Success
+}
 
-	return nil
+// withDescendants returns the given entries and all pool transactions
+// spending from them, directly or not.
+func (this *TXNPool) withDescendants(entries map[common.Uint256]*txPoolEntry) map[common.Uint256]*txPoolEntry {
+	result := make(map[common.Uint256]*txPoolEntry, len(entries))
+	var visit func(entry *txPoolEntry)
+	visit = func(entry *txPoolEntry) {
+		hash := entry.txn.Hash()
+		if _, ok := result[hash]; ok {
+			return
+		}
+		result[hash] = entry
+		for _, child := range entry.children {
+			visit(child)
+		}
+	}
+	for _, entry := range entries {
+		visit(entry)
+	}
+	return result
 }
 
-//clean txnpool utxo map
+// withAncestors returns the given entries and all pool transactions they
+// spend from, directly or not.
+func (this *TXNPool) withAncestors(entries map[common.Uint256]*txPoolEntry) map[common.Uint256]*txPoolEntry {
+	result := make(map[common.Uint256]*txPoolEntry, len(entries))
+	var visit func(entry *txPoolEntry)
+	visit = func(entry *txPoolEntry) {
+		hash := entry.txn.Hash()
+		if _, ok := result[hash]; ok {
+			return
+		}
+		result[hash] = entry
+		for _, parent := range entry.parents {
+			visit(parent)
+		}
+	}
+	for _, entry := range entries {
+		visit(entry)
+	}
+	return result
+}
+
+// clean txnpool utxo map, pool transactions double spending an input of
+// the block are removed together with their descendants
 func (this *TXNPool) cleanUTXOList(txs []*transaction.Transaction) {
+	this.Lock()
+	defer this.Unlock()
 	for _, txn := range txs {
-		inputUtxos, _ := txn.GetReference()
-		for Utxoinput, _ := range inputUtxos {
-			this.delInputUTXOList(Utxoinput)
+		for _, input := range txn.UTXOInputs {
+			spender, ok := this.inputUTXOList[input.ToString()]
+			if !ok {
+				continue
+			}
+			if entry, ok := this.txnList[spender.Hash()]; ok {
+				log.Info(fmt.Sprintf("Transaction %x double spends a block input, removed", spender.Hash()))
+				this.removeWithDescendants(entry)
+			}
+			delete(this.inputUTXOList, input.ToString())
 		}
 	}
 }
@@ -178,74 +435,116 @@ func (this *TXNPool) cleanTransactionList(txns []*transaction.Transaction) error
 	return nil
 }
 
-func (this *TXNPool) addtxnList(txn *transaction.Transaction) bool {
+// expireStale removes the transactions which stayed in the pool longer
+// than the configured expiry, together with their descendants.
+func (this *TXNPool) expireStale(now time.Time) {
 	this.Lock()
 	defer this.Unlock()
+	expiry := txPoolExpiry()
+	for _, entry := range this.txnList {
+		if now.Sub(entry.added) < expiry {
+			continue
+		}
+		// it may already be gone as a descendant of an expired entry
+		if _, ok := this.txnList[entry.txn.Hash()]; !ok {
+			continue
+		}
+		log.Info(fmt.Sprintf("Transaction %x expired from pool", entry.txn.Hash()))
+		this.removeWithDescendants(entry)
+	}
+}
+
+// add the transaction and link it with its in-pool parents and children,
+// must be called with the pool lock held
+func (this *TXNPool) addtxnList(txn *transaction.Transaction, size int) bool {
 	txnHash := txn.Hash()
 	if _, ok := this.txnList[txnHash]; ok {
 		return false
 	}
-	this.txnList[txnHash] = txn
-	ledger.DefaultLedger.Blockchain.BCEvents.Notify(events.EventNewTransactionPutInPool, txn)
+	entry := &txPoolEntry{
+		txn:      txn,
+		size:     size,
+		added:    time.Now(),
+		parents:  make(map[common.Uint256]*txPoolEntry),
+		children: make(map[common.Uint256]*txPoolEntry),
+	}
+	for _, input := range txn.UTXOInputs {
+		if parent, ok := this.txnList[input.ReferTxID]; ok {
+			entry.parents[input.ReferTxID] = parent
+			parent.children[txnHash] = entry
+		}
+		this.inputUTXOList[input.ToString()] = txn
+	}
+	for i := range txn.Outputs {
+		output := tx.UTXOTxInput{
+			ReferTxID:          txnHash,
+			ReferTxOutputIndex: uint16(i),
+		}
+		if spender, ok := this.inputUTXOList[output.ToString()]; ok {
+			if child, ok := this.txnList[spender.Hash()]; ok {
+				entry.children[child.txn.Hash()] = child
+				child.parents[txnHash] = entry
+			}
+		}
+	}
+	this.txnList[txnHash] = entry
+	this.totalSize += size
 	return true
 }
 
+// remove the entry and unlink it, must be called with the pool lock held
+func (this *TXNPool) removeEntry(entry *txPoolEntry) {
+	txHash := entry.txn.Hash()
+	if _, ok := this.txnList[txHash]; !ok {
+		return
+	}
+	for hash, parent := range entry.parents {
+		delete(parent.children, txHash)
+		delete(entry.parents, hash)
+	}
+	for hash, child := range entry.children {
+		delete(child.parents, txHash)
+		delete(entry.children, hash)
+	}
+	for _, input := range entry.txn.UTXOInputs {
+		if spender, ok := this.inputUTXOList[input.ToString()]; ok && spender.Hash() == txHash {
+			delete(this.inputUTXOList, input.ToString())
+		}
+	}
+	delete(this.txnList, txHash)
+	this.totalSize -= entry.size
+}
+
+// remove the entry and all its descendants, must be called with the pool
+// lock held
+func (this *TXNPool) removeWithDescendants(entry *txPoolEntry) {
+	for _, e := range this.withDescendants(map[common.Uint256]*txPoolEntry{entry.txn.Hash(): entry}) {
+		this.removeEntry(e)
+	}
+}
+
 func (this *TXNPool) deltxnList(tx *transaction.Transaction) bool {
 	this.Lock()
 	defer this.Unlock()
-	txHash := tx.Hash()
-	if _, ok := this.txnList[txHash]; !ok {
+	entry, ok := this.txnList[tx.Hash()]
+	if !ok {
 		return false
 	}
-	delete(this.txnList, tx.Hash())
+	this.removeEntry(entry)
 	return true
 }
 
-func (this *TXNPool) copytxnList() map[common.Uint256]*transaction.Transaction {
-	this.RLock()
-	defer this.RUnlock()
-	txnMap := make(map[common.Uint256]*transaction.Transaction, len(this.txnList))
-	for txnId, txn := range this.txnList {
-		txnMap[txnId] = txn
-	}
-	return txnMap
-}
-
 func (this *TXNPool) GetTransactionCount() int {
 	this.RLock()
 	defer this.RUnlock()
 	return len(this.txnList)
 }
 
-func (this *TXNPool) getInputUTXOList(input *transaction.UTXOTxInput) *transaction.Transaction {
+// GetTxnPoolSize returns the serialized size of the pool transactions.
+func (this *TXNPool) GetTxnPoolSize() int {
 	this.RLock()
 	defer this.RUnlock()
-	return this.inputUTXOList[input.ToString()]
-}
-
-func (this *TXNPool) addInputUTXOList(tx *transaction.Transaction, input *transaction.UTXOTxInput) bool {
-	this.Lock()
-	defer this.Unlock()
-	id := input.ToString()
-	_, ok := this.inputUTXOList[id]
-	if ok {
-		return false
-	}
-	this.inputUTXOList[id] = tx
-
-	return true
-}
-
-func (this *TXNPool) delInputUTXOList(input *transaction.UTXOTxInput) bool {
-	this.Lock()
-	defer this.Unlock()
-	id := input.ToString()
-	_, ok := this.inputUTXOList[id]
-	if !ok {
-		return false
-	}
-	delete(this.inputUTXOList, id)
-	return true
+	return this.totalSize
 }
 
 func (this *TXNPool) MaybeAcceptTransaction(txn *tx.Transaction) error {
@@ -270,7 +569,10 @@ func (this *TXNPool) MaybeAcceptTransaction(txn *tx.Transaction) error {
 	return nil
 }
 
+// remove the pool transactions spending outputs of txn, and their descendants
 func (this *TXNPool) RemoveTransaction(txn *tx.Transaction) {
+	this.Lock()
+	defer this.Unlock()
 	txHash := txn.Hash()
 	for i := range txn.Outputs {
 		in := tx.UTXOTxInput{
@@ -278,8 +580,10 @@ func (this *TXNPool) RemoveTransaction(txn *tx.Transaction) {
 			ReferTxOutputIndex: uint16(i),
 		}
 		input := in.ToString()
-		if txn, ok := this.inputUTXOList[input]; ok {
-			this.removeTransaction(txn)
+		if spender, ok := this.inputUTXOList[input]; ok {
+			if entry, ok := this.txnList[spender.Hash()]; ok {
+				this.removeWithDescendants(entry)
+			}
 		}
 	}
 }
@@ -0,0 +1,236 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"Elastos.ELA/common"
+	"Elastos.ELA/common/config"
+	"Elastos.ELA/common/log"
+	tx "Elastos.ELA/core/transaction"
+	. "Elastos.ELA/errors"
+)
+
+// newTestPoolTx returns a transaction spending the outputs with the given
+// fee and fee rate, the ledger checks of AppendTxnPool are not run.
+func newTestPoolTx(fee, feePerKB common.Fixed64, outputs ...common.Uint256) *tx.Transaction {
+	var inputs []*tx.UTXOTxInput
+	for _, hash := range outputs {
+		inputs = append(inputs, &tx.UTXOTxInput{ReferTxID: hash})
+	}
+	txn, _ := tx.NewTransferAssetTransaction(inputs, []*tx.TxOutput{})
+	txn.Fee = fee
+	txn.FeePerKB = feePerKB
+	return txn
+}
+
+func newTestPool() *TXNPool {
+	log.Init()
+	pool := new(TXNPool)
+	pool.init()
+	return pool
+}
+
+func TestTxPoolReplacement(t *testing.T) {
+	pool := newTestPool()
+	spent := common.Uint256{0x01}
+	original := newTestPoolTx(100, 100, spent)
+	pool.addtxnList(original, 1000)
+
+	if _, err := pool.verifyDoubleSpend(newTestPoolTx(200, 100, spent)); err == nil {
+		t.Fatal("double spend without a higher fee rate is accepted")
+	}
+	if _, err := pool.verifyDoubleSpend(newTestPoolTx(100, 200, spent)); err == nil {
+		t.Fatal("double spend without a higher fee is accepted")
+	}
+
+	replacement := newTestPoolTx(200, 200, spent, common.Uint256{0x02})
+	conflicts, err := pool.verifyDoubleSpend(replacement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 || conflicts[original.Hash()] == nil {
+		t.Fatalf("replacement conflicts with %d transactions, want the original", len(conflicts))
+	}
+	pool.removeEntry(conflicts[original.Hash()])
+	pool.addtxnList(replacement, 1000)
+
+	if pool.GetTransaction(original.Hash()) != nil {
+		t.Fatal("replaced transaction is still in the pool")
+	}
+	if spender := pool.inputUTXOList[replacement.UTXOInputs[0].ToString()]; spender != replacement {
+		t.Fatal("spent output is not owned by the replacement")
+	}
+	if pool.GetTransactionCount() != 1 || pool.GetTxnPoolSize() != 1000 {
+		t.Fatalf("pool has %d transactions of %d bytes", pool.GetTransactionCount(), pool.GetTxnPoolSize())
+	}
+}
+
+func TestTxPoolEviction(t *testing.T) {
+	maxCount := config.Parameters.MaxTxPoolCount
+	config.Parameters.MaxTxPoolCount = 2
+	defer func() { config.Parameters.MaxTxPoolCount = maxCount }()
+
+	pool := newTestPool()
+	low := newTestPoolTx(10, 10, common.Uint256{0x01})
+	high := newTestPoolTx(30, 30, common.Uint256{0x02})
+	pool.addtxnList(low, 1000)
+	pool.addtxnList(high, 1000)
+
+	if _, errCode := pool.evictionSet(newTestPoolTx(5, 5, common.Uint256{0x03}), 1000, nil, nil); errCode != ErrTxPoolFull {
+		t.Fatalf("lower fee rate transaction in a full pool returned %s", errCode)
+	}
+
+	evicted, errCode := pool.evictionSet(newTestPoolTx(20, 20, common.Uint256{0x04}), 1000, nil, nil)
+	if errCode != Success {
+		t.Fatal(errCode)
+	}
+	if len(evicted) != 1 || evicted[0].txn != low {
+		t.Fatalf("evicted %d transactions, want the lowest fee rate one", len(evicted))
+	}
+
+	// a replacement frees the room of the transaction it replaces
+	conflicts := map[common.Uint256]*txPoolEntry{low.Hash(): pool.txnList[low.Hash()]}
+	evicted, errCode = pool.evictionSet(newTestPoolTx(20, 20, common.Uint256{0x01}), 1000, conflicts, nil)
+	if errCode != Success || len(evicted) != 0 {
+		t.Fatalf("replacement evicted %d transactions, returned %s", len(evicted), errCode)
+	}
+}
+
+func TestTxPoolEvictionWithinLimits(t *testing.T) {
+	pool := newTestPool()
+	pool.addtxnList(newTestPoolTx(10, 10, common.Uint256{0x01}), 1000)
+
+	evicted, errCode := pool.evictionSet(newTestPoolTx(5, 5, common.Uint256{0x02}), 1000, nil, nil)
+	if errCode != Success || evicted != nil {
+		t.Fatalf("pool within its limits evicted %d transactions, returned %s", len(evicted), errCode)
+	}
+}
+
+func TestTxPoolChainedSpends(t *testing.T) {
+	pool := newTestPool()
+	parent := newTestPoolTx(10, 10, common.Uint256{0x01})
+	parent.Outputs = []*tx.TxOutput{{}}
+	child := newTestPoolTx(10, 10, parent.Hash())
+	grandchild := newTestPoolTx(10, 10, child.Hash())
+	// the child arrives before its parent is linked through its outputs
+	pool.addtxnList(child, 1000)
+	pool.addtxnList(parent, 1000)
+	pool.addtxnList(grandchild, 1000)
+
+	parentEntry, childEntry := pool.txnList[parent.Hash()], pool.txnList[child.Hash()]
+	if childEntry.parents[parent.Hash()] != parentEntry || parentEntry.children[child.Hash()] != childEntry {
+		t.Fatal("child is not linked with its parent")
+	}
+	descendants := pool.withDescendants(map[common.Uint256]*txPoolEntry{parent.Hash(): parentEntry})
+	if len(descendants) != 3 {
+		t.Fatalf("parent has %d transactions in its package, want 3", len(descendants))
+	}
+
+	// only the parent can be put in the next block
+	selected := pool.GetTxnPoolByFeeRate()
+	if len(selected) != 1 || selected[0] != parent {
+		t.Fatalf("%d transactions selected, want the parent only", len(selected))
+	}
+
+	// once the parent is confirmed its child can be put in a block
+	pool.deltxnList(parent)
+	if len(childEntry.parents) != 0 {
+		t.Fatal("child is still linked with its confirmed parent")
+	}
+	selected = pool.GetTxnPoolByFeeRate()
+	if len(selected) != 1 || selected[0] != child {
+		t.Fatalf("%d transactions selected, want the child only", len(selected))
+	}
+}
+
+func TestTxPoolChainedRemoval(t *testing.T) {
+	pool := newTestPool()
+	spent := common.Uint256{0x01}
+	parent := newTestPoolTx(10, 10, spent)
+	child := newTestPoolTx(50, 50, parent.Hash())
+	pool.addtxnList(parent, 1000)
+	pool.addtxnList(child, 1000)
+
+	// a replacement has to pay for the descendants it drops as well
+	if _, err := pool.verifyDoubleSpend(newTestPoolTx(40, 40, spent)); err == nil {
+		t.Fatal("replacement paying less than the replaced package is accepted")
+	}
+	replacement := newTestPoolTx(70, 70, spent)
+	conflicts, err := pool.verifyDoubleSpend(replacement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.removeWithDescendants(conflicts[parent.Hash()])
+	if pool.GetTransactionCount() != 0 || pool.GetTxnPoolSize() != 0 {
+		t.Fatalf("pool has %d transactions after replacing their parent", pool.GetTransactionCount())
+	}
+	if _, ok := pool.inputUTXOList[child.UTXOInputs[0].ToString()]; ok {
+		t.Fatal("input of the removed child is still spent")
+	}
+}
+
+func TestTxPoolPackageEviction(t *testing.T) {
+	maxCount := config.Parameters.MaxTxPoolCount
+	config.Parameters.MaxTxPoolCount = 3
+	defer func() { config.Parameters.MaxTxPoolCount = maxCount }()
+
+	pool := newTestPool()
+	parent := newTestPoolTx(10, 10, common.Uint256{0x01})
+	child := newTestPoolTx(20, 20, parent.Hash())
+	other := newTestPoolTx(25, 25, common.Uint256{0x02})
+	pool.addtxnList(parent, 1000)
+	pool.addtxnList(child, 1000)
+	pool.addtxnList(other, 1000)
+
+	// the package of the parent pays 15 per KB, it goes with its child
+	evicted, errCode := pool.evictionSet(newTestPoolTx(18, 18, common.Uint256{0x03}), 1000, nil, nil)
+	if errCode != Success {
+		t.Fatal(errCode)
+	}
+	if len(evicted) != 1 || evicted[0].txn != parent {
+		t.Fatalf("evicted %d transactions, want the parent package", len(evicted))
+	}
+	pool.removeWithDescendants(evicted[0])
+	if pool.GetTransaction(child.Hash()) != nil || pool.GetTransactionCount() != 1 {
+		t.Fatal("child of the evicted parent is still in the pool")
+	}
+
+	// the ancestors of the new transaction are never evicted for it
+	pool = newTestPool()
+	config.Parameters.MaxTxPoolCount = 1
+	pool.addtxnList(parent, 1000)
+	ancestors := map[common.Uint256]*txPoolEntry{parent.Hash(): pool.txnList[parent.Hash()]}
+	if _, errCode := pool.evictionSet(child, 1000, nil, ancestors); errCode != ErrTxPoolFull {
+		t.Fatalf("child evicting its parent returned %s", errCode)
+	}
+}
+
+func TestTxPoolExpiry(t *testing.T) {
+	pool := newTestPool()
+	old := newTestPoolTx(10, 10, common.Uint256{0x01})
+	recent := newTestPoolTx(10, 10, common.Uint256{0x02})
+	pool.addtxnList(old, 1000)
+	pool.addtxnList(recent, 1000)
+	pool.txnList[old.Hash()].added = time.Now().Add(-txPoolExpiry() - time.Minute)
+
+	pool.expireStale(time.Now())
+	if pool.GetTransaction(old.Hash()) != nil {
+		t.Fatal("expired transaction is still in the pool")
+	}
+	if _, ok := pool.inputUTXOList[old.UTXOInputs[0].ToString()]; ok {
+		t.Fatal("input of the expired transaction is still spent")
+	}
+	if pool.GetTransaction(recent.Hash()) == nil || pool.GetTxnPoolSize() != 1000 {
+		t.Fatal("recent transaction expired")
+	}
+
+	// the descendants of an expired transaction leave with it
+	child := newTestPoolTx(10, 10, recent.Hash())
+	pool.addtxnList(child, 1000)
+	pool.txnList[recent.Hash()].added = time.Now().Add(-txPoolExpiry() - time.Minute)
+	pool.expireStale(time.Now())
+	if pool.GetTransactionCount() != 0 {
+		t.Fatal("child of the expired transaction is still in the pool")
+	}
+}
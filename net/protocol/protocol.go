@@ -7,6 +7,7 @@ import (
 	"Elastos.ELA/crypto"
 	. "Elastos.ELA/errors"
 	"Elastos.ELA/events"
+	"Elastos.ELA/net/bloom"
 	"bytes"
 	"encoding/binary"
 	"net"
@@ -27,6 +28,13 @@ const (
 	SERVICENODE = 2
 )
 
+// The service bits advertised in the version message
+const (
+	NODENETWORK        = 1 << 2 // serves every block of the chain
+	NODENETWORKLIMITED = 1 << 3 // serves only the blocks within MINPRUNEDEPTH of its tip
+	NODECOMPACTBLOCKS  = 1 << 4 // accepts blocks relayed as cmpctblock
+)
+
 const (
 	VERIFYNODENAME  = "verify"
 	SERVICENODENAME = "service"
@@ -68,7 +76,20 @@ const (
 	GETADDRMAX           = 2500
 	MAXIDCACHED          = 5000
 	MAXINVCACHEHASH      = 50000
-	MinInFlightBlocks    = 10
+	BLOCKDOWNLOADWINDOW  = 1024 // Blocks ahead of the tip requested in headers-first sync
+	BLOCKREQUESTTIMEOUT  = 15   // Seconds
+)
+
+// Ban scores added to a peer for misbehavior, a peer whose score reaches
+// BANTHRESHOLD is disconnected and its IP banned for BANDURATION.
+const (
+	BANTHRESHOLD          = 100
+	BANDURATION           = 24 * 60 * 60 // Seconds
+	BANSCOREMALFORMED     = 20           // unparsable message, bad checksum or magic
+	BANSCOREUNSOLICITED   = 10           // message the peer was not asked for
+	BANSCOREINVALIDTX     = 10
+	BANSCOREINVALIDHEADER = 50
+	BANSCOREINVALIDBLOCK  = 100
 )
 
 // The node state
@@ -96,6 +117,9 @@ type Noder interface {
 	SetHttpInfoState(bool)
 	GetState() uint32
 	GetRelay() bool
+	SetRelay(relay bool)
+	GetFilter() *bloom.Filter
+	LoadFilter(filter *bloom.Filter)
 	SetState(state uint32)
 	GetPubKey() *crypto.PubKey
 	CompareAndSetState(old, new uint32) bool
@@ -106,9 +130,13 @@ type Noder interface {
 	CloseConn()
 	GetHeight() uint64
 	GetConnectionCnt() uint
+	GetNbrStateCnt() map[uint32]int
 	GetConn() net.Conn
 	GetTxnPool(bool) map[common.Uint256]*transaction.Transaction
+	GetTxnPoolByFeeRate() []*transaction.Transaction
 	AppendTxnPool(*transaction.Transaction) ErrCode
+	GetTransactionCount() int
+	GetTxnPoolSize() int
 	ExistedID(id common.Uint256) bool
 	ReqNeighborList()
 	DumpInfo()
@@ -160,6 +188,7 @@ type Noder interface {
 	NeedMoreAddresses() bool
 	RandSelectAddresses() []NodeAddr
 	UpdateLastDisconn(id uint64)
+	MarkAddressGood(id uint64)
 	Relay(Noder, interface{}) error
 	ExistHash(hash common.Uint256) bool
 	CacheHash(hash common.Uint256)
@@ -169,6 +198,7 @@ type Noder interface {
 	IsSyncFailed() bool
 	SetSyncFailed()
 	StartSync()
+	Stop()
 	CacheInvHash(hash common.Uint256)
 	ExistInvHash(hash common.Uint256) bool
 	DeleteInvHash(hash common.Uint256)
@@ -195,6 +225,21 @@ type Noder interface {
 	SetStopHash(hash common.Uint256)
 	GetStopHash() common.Uint256
 	ResetRequestedBlock()
+	ScheduleBlockDownloads()
+	AddBanScore(score uint32, reason string)
+	GetBanScore() uint32
+	IsBanned(addr string) bool
+	BanAddr(addr string, duration time.Duration, reason string) error
+	UnbanAddr(addr string) bool
+	GetBannedAddrs() []BanEntry
+	ClearBannedAddrs()
+}
+
+// BanEntry is a banned peer IP, Until is the unix time the ban ends.
+type BanEntry struct {
+	Addr   string
+	Until  int64
+	Reason string
 }
 
 // Checkpoint identifies a known good point in the block chain.
@@ -12,7 +12,10 @@ import (
 	"Elastos.ELA/cli/info"
 	"Elastos.ELA/cli/mining"
 	"Elastos.ELA/cli/multisig"
+	"Elastos.ELA/cli/offline"
 	"Elastos.ELA/cli/recover"
+	"Elastos.ELA/cli/reindex"
+	"Elastos.ELA/cli/snapshot"
 	"Elastos.ELA/cli/wallet"
 	"github.com/urfave/cli"
 )
@@ -35,9 +38,12 @@ func main() {
 		*wallet.NewCommand(),
 		*asset.NewCommand(),
 		*recover.NewCommand(),
+		*reindex.NewCommand(),
+		*snapshot.NewCommand(),
 		*mining.NewCommand(),
 		*elatst.NewCommand(),
 		*multisig.NewCommand(),
+		*offline.NewCommand(),
 		*crosschain.NewCommand(),
 	}
 	sort.Sort(cli.CommandsByName(app.Commands))